@@ -13,8 +13,16 @@ import com.example.PKI.service.cert.CertificateService;
 import com.example.PKI.util.keyStoreUtils.KeyStoreReader;
 import com.example.PKI.util.keyStoreUtils.KeyStoreWriter;
 import org.bouncycastle.asn1.x500.X500Name;
+import org.bouncycastle.asn1.x500.style.IETFUtils;
+import org.bouncycastle.asn1.x509.BasicConstraints;
+import org.bouncycastle.asn1.x509.ExtendedKeyUsage;
+import org.bouncycastle.asn1.x509.Extension;
+import org.bouncycastle.asn1.x509.GeneralName;
+import org.bouncycastle.asn1.x509.GeneralNames;
+import org.bouncycastle.asn1.x509.KeyPurposeId;
 import org.bouncycastle.asn1.x500.X500NameBuilder;
 import org.bouncycastle.asn1.x500.style.BCStyle;
+import org.bouncycastle.cert.CertIOException;
 import org.bouncycastle.cert.X509CertificateHolder;
 import org.bouncycastle.cert.X509v3CertificateBuilder;
 import org.bouncycastle.cert.jcajce.JcaX509CertificateConverter;
@@ -114,6 +122,7 @@ public class CertificateServiceImpl implements CertificateService {
                     endDate,
                     generatedSubjectData.getX500Name(),
                     generatedSubjectData.getKeyPair().getPublic());
+            addExtensions(certGen, certificateDto.getType(), generatedSubjectData.getX500Name());
 
             X509CertificateHolder certHolder = certGen.build(contentSigner);
 
@@ -201,6 +210,20 @@ public class CertificateServiceImpl implements CertificateService {
         return certificate;
     }
 
+    // Services verify each other's certificates like TLS clients do: CAs need
+    // basic constraints, and a client certificate names its service (the common
+    // name) as a DNS SAN and may be used on both ends of a connection.
+    private void addExtensions(X509v3CertificateBuilder certGen, String type, X500Name subject) throws CertIOException {
+        boolean ca = !type.equalsIgnoreCase(CertificateType.CLIENT.toString());
+        certGen.addExtension(Extension.basicConstraints, true, new BasicConstraints(ca));
+        if (ca) return;
+        String commonName = IETFUtils.valueToString(subject.getRDNs(BCStyle.CN)[0].getFirst().getValue());
+        certGen.addExtension(Extension.subjectAlternativeName, false,
+                new GeneralNames(new GeneralName(GeneralName.dNSName, commonName)));
+        certGen.addExtension(Extension.extendedKeyUsage, false,
+                new ExtendedKeyUsage(new KeyPurposeId[]{KeyPurposeId.id_kp_serverAuth, KeyPurposeId.id_kp_clientAuth}));
+    }
+
     @Override
     public X509Certificate getCertificateByAlias(String alias, KeyStore keystore) throws KeyStoreException {
         X509Certificate certificate = (X509Certificate) keystore.getCertificate(alias);
@@ -539,6 +562,7 @@ public class CertificateServiceImpl implements CertificateService {
                     endDate,
                     generatedSubjectData.getX500Name(),
                     generatedSubjectData.getKeyPair().getPublic());
+            addExtensions(certGen, certificateDto.getType(), generatedSubjectData.getX500Name());
 
             X509CertificateHolder certHolder = certGen.build(contentSigner);
 
@@ -0,0 +1,18 @@
+package errors
+
+// The codes only the gateway answers with; the ones the services share are
+// in common/module/errors.
+const (
+	CodeAccountLocked       = "ACCOUNT_LOCKED"
+	CodeLoginExpired        = "LOGIN_EXPIRED"
+	CodeInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	CodeInvalidSession      = "INVALID_SESSION"
+	CodeWebAuthnFailed      = "WEBAUTHN_FAILED"
+	CodeCredentialNotFound  = "CREDENTIAL_NOT_FOUND"
+	CodeSessionNotFound     = "SESSION_NOT_FOUND"
+	CodeRoleNotFound        = "ROLE_NOT_FOUND"
+	CodeBuiltInRole         = "BUILT_IN_ROLE"
+	CodeLastRoleManager     = "LAST_ROLE_MANAGER"
+	CodeInvalidCursor       = "INVALID_CURSOR"
+	CodeApiRetired          = "API_RETIRED"
+)
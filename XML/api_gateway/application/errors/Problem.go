@@ -0,0 +1,91 @@
+package errors
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/logger"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is the body of every error the gateway answers with (RFC 7807).
+// Code is the stable code of the error, which clients branch on; Detail is
+// only meant for people.
+type Problem struct {
+	Type     string                        `json:"type"`
+	Title    string                        `json:"title"`
+	Status   int                           `json:"status"`
+	Detail   string                        `json:"detail,omitempty"`
+	Instance string                        `json:"instance,omitempty"`
+	Code     string                        `json:"code"`
+	Errors   []domainErrors.FieldViolation `json:"errors,omitempty"`
+}
+
+func NewProblem(r *http.Request, status int, code string, detail string) *Problem {
+	problem := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+	if r != nil {
+		problem.Instance = r.URL.Path
+	}
+	return problem
+}
+
+// ProblemOf answers err with the HTTP status of its gRPC status.
+func ProblemOf(r *http.Request, err error) *Problem {
+	e := domainErrors.FromError(err)
+	problem := NewProblem(r, runtime.HTTPStatusFromCode(e.Status), e.Code, e.Message)
+	problem.Errors = e.Fields
+	return problem
+}
+
+func (p *Problem) Write(rw http.ResponseWriter) {
+	body, _ := json.Marshal(p)
+	rw.Header().Set("Content-Type", ProblemContentType)
+	rw.Header().Del("Content-Length")
+	rw.WriteHeader(p.Status)
+	_, err := rw.Write(body)
+	if err != nil {
+		return
+	}
+}
+
+func WriteProblem(rw http.ResponseWriter, r *http.Request, err error) {
+	ProblemOf(r, err).Write(rw)
+}
+
+// ErrorHandler answers the errors of the routes generated from the services
+// as problems. Errors that aren't the caller's fault are logged with what
+// caused them, which the caller doesn't get to see.
+func ErrorHandler(logError *logger.Logger) runtime.ErrorHandlerFunc {
+	return func(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, rw http.ResponseWriter, r *http.Request, err error) {
+		var routing *runtime.HTTPStatusError
+		httpStatus := 0
+		if stderrors.As(err, &routing) {
+			err, httpStatus = routing.Err, routing.HTTPStatus
+		}
+		e := domainErrors.FromError(err)
+		if e.Leaks() {
+			domainErrors.Log(logError, e, logrus.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			})
+		}
+		problem := ProblemOf(r, e)
+		if httpStatus != 0 {
+			problem.Status, problem.Title = httpStatus, http.StatusText(httpStatus)
+		}
+		rw.Header().Del("Trailer")
+		rw.Header().Del("Transfer-Encoding")
+		problem.Write(rw)
+	}
+}
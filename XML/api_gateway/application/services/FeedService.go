@@ -0,0 +1,447 @@
+package services
+
+import (
+	"common/module/logger"
+	connectionPb "common/module/proto/connection_service"
+	postPb "common/module/proto/posts_service"
+	userPb "common/module/proto/user_service"
+	"common/module/ranking"
+	"context"
+	"encoding/base64"
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FeedPageSize    = 20
+	FeedMaxPageSize = 100
+	// FeedLatest serves the timeline newest first, FeedTop ranks it.
+	FeedLatest = "latest"
+	FeedTop    = "top"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid feed cursor")
+	ErrInvalidMode   = errors.New("feed mode must be latest or top")
+)
+
+// Posts carry the date as post_service prints a time.Time.
+const postDateLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// FeedService serves feeds a page at a time from the timelines the timeline
+// worker keeps. A timeline nobody read yet is first built from the posts of
+// the owner's connections. Timelines built longer than rebuildAfter ago are
+// built again on their next read, which brings back the posts whose events
+// never reached the worker. The top mode ranks the newest window entries of
+// the timeline with ranker. Calls to the services go over clients shared by
+// every request, at most concurrency at a time.
+type FeedService struct {
+	logInfo      *logger.Logger
+	logError     *logger.Logger
+	timelines    repositories.TimelineRepository
+	posts        postPb.PostServiceClient
+	connections  connectionPb.ConnectionServiceClient
+	users        userPb.UserServiceClient
+	ranker       *ranking.Ranker
+	window       int
+	concurrency  int
+	rebuildAfter time.Duration
+}
+
+func NewFeedService(logInfo *logger.Logger, logError *logger.Logger, timelines repositories.TimelineRepository,
+	posts postPb.PostServiceClient, connections connectionPb.ConnectionServiceClient, users userPb.UserServiceClient,
+	ranker *ranking.Ranker, window int, concurrency int, rebuildAfter time.Duration) *FeedService {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &FeedService{logInfo, logError, timelines, posts, connections, users, ranker, window, concurrency, rebuildAfter}
+}
+
+// GetFeed returns the page of username's feed that follows cursor, in the
+// given mode. Posts that can't be fetched before ctx is done are left out
+// and reported in the page's warnings.
+func (s *FeedService) GetFeed(ctx context.Context, username string, mode string, cursor string, limit int) (*model.FeedPage, error) {
+	switch mode {
+	case FeedLatest, "":
+		return s.getLatest(ctx, username, cursor, limit)
+	case FeedTop:
+		return s.getTop(ctx, username, cursor, limit)
+	default:
+		return nil, ErrInvalidMode
+	}
+}
+
+func (s *FeedService) getLatest(ctx context.Context, username string, cursor string, limit int) (*model.FeedPage, error) {
+	after, afterPost, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.FeedPage{Posts: []model.Post{}}
+	page.Warnings, err = s.ensureBuilt(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.timelines.Page(username, after, afterPost, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		page.NextCursor = encodeCursor(last.DatePosted, last.PostId)
+	}
+
+	posts, warnings := s.fetchPosts(ctx, username, entries)
+	page.Warnings = append(page.Warnings, warnings...)
+	for _, post := range posts {
+		if post != nil {
+			page.Posts = append(page.Posts, mapPost(post))
+		}
+	}
+	return page, nil
+}
+
+// getTop ranks the newest entries of the timeline. Pages are positions in
+// the ranking, which moves as posts age and collect reactions, so a post
+// can show up on two pages or on none while someone is paging.
+func (s *FeedService) getTop(ctx context.Context, username string, cursor string, limit int) (*model.FeedPage, error) {
+	offset, err := decodeTopCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.FeedPage{Posts: []model.Post{}}
+	page.Warnings, err = s.ensureBuilt(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.timelines.Page(username, time.Time{}, "", s.window)
+	if err != nil {
+		return nil, err
+	}
+	posts, warnings := s.fetchPosts(ctx, username, entries)
+	page.Warnings = append(page.Warnings, warnings...)
+
+	byId := map[string]*postPb.Post{}
+	var candidates []ranking.Candidate
+	for i, post := range posts {
+		if post == nil {
+			continue
+		}
+		byId[entries[i].PostId] = post
+		candidates = append(candidates, ranking.Candidate{
+			Id:       entries[i].PostId,
+			Author:   entries[i].Author,
+			Posted:   entries[i].DatePosted,
+			Likes:    int(post.LikesNumber),
+			Dislikes: int(post.DislikesNumber),
+			Comments: int(post.CommentsNumber),
+		})
+	}
+	if s.ranker.Uses("closeness") {
+		s.addCloseness(ctx, username, candidates)
+	}
+	if s.ranker.Uses("overlap") {
+		s.addOverlap(ctx, username, candidates)
+	}
+	s.ranker.Rank(candidates, time.Now())
+
+	if offset > len(candidates) {
+		offset = len(candidates)
+	}
+	end := offset + limit
+	if end < len(candidates) {
+		page.NextCursor = encodeTopCursor(end)
+	} else {
+		end = len(candidates)
+	}
+	for _, candidate := range candidates[offset:end] {
+		page.Posts = append(page.Posts, mapPost(byId[candidate.Id]))
+	}
+	return page, nil
+}
+
+func (s *FeedService) ensureBuilt(ctx context.Context, username string) ([]string, error) {
+	built, err := s.timelines.IsBuilt(username, time.Now().Add(-s.rebuildAfter))
+	if err != nil || built {
+		return nil, err
+	}
+	return s.build(ctx, username)
+}
+
+// fetchPosts loads the posts of entries, in order. Posts that are gone or
+// couldn't be loaded are nil; the latter are reported as warnings.
+func (s *FeedService) fetchPosts(ctx context.Context, username string, entries []model.TimelineEntry) ([]*postPb.Post, []string) {
+	posts := make([]*postPb.Post, len(entries))
+	errs := s.each(ctx, len(entries), func(i int) error {
+		response, err := s.posts.Get(ctx, &postPb.GetRequest{Id: entries[i].PostId})
+		if err == nil {
+			posts[i] = response.Post
+		}
+		return err
+	})
+	var warnings []string
+	for i, err := range errs {
+		if err == nil || status.Code(err) == codes.NotFound {
+			continue
+		}
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user":   username,
+			"postId": entries[i].PostId,
+		}).Errorf("ERR:LOADING FEED POST: %v", err)
+		warnings = append(warnings, "post "+entries[i].PostId+s.unavailable(ctx))
+	}
+	return posts, warnings
+}
+
+// addCloseness counts the connections the reader shares with each author.
+// Authors whose connections can't be loaded count as strangers.
+func (s *FeedService) addCloseness(ctx context.Context, username string, candidates []ranking.Candidate) {
+	mine, err := s.connections.GetConnections(ctx, &connectionPb.GetRequest{Username: username})
+	if err != nil {
+		s.logError.Logger.WithFields(logrus.Fields{"user": username}).Errorf("ERR:LOADING CONNECTIONS FOR RANKING: %v", err)
+		return
+	}
+	connected := map[string]bool{}
+	for _, user := range mine.Users {
+		connected[user.Username] = true
+	}
+	authors := distinctAuthors(candidates)
+	mutual := make([]int, len(authors))
+	s.each(ctx, len(authors), func(i int) error {
+		theirs, err := s.connections.GetConnections(ctx, &connectionPb.GetRequest{Username: authors[i]})
+		if err != nil {
+			return err
+		}
+		for _, user := range theirs.Users {
+			if connected[user.Username] {
+				mutual[i]++
+			}
+		}
+		return nil
+	})
+	counts := map[string]int{}
+	for i, author := range authors {
+		counts[author] = mutual[i]
+	}
+	for i := range candidates {
+		candidates[i].MutualConnections = counts[candidates[i].Author]
+	}
+}
+
+// addOverlap counts the skills and interests the reader shares with each
+// author. Profiles that can't be loaded share nothing.
+func (s *FeedService) addOverlap(ctx context.Context, username string, candidates []ranking.Candidate) {
+	authors := distinctAuthors(candidates)
+	profiles := make([]*userPb.UserDetails, len(authors)+1)
+	names := append([]string{username}, authors...)
+	s.each(ctx, len(names), func(i int) error {
+		details, err := s.users.GetUserDetails(ctx, &userPb.GetUserDetailsRequest{Username: &userPb.Username{Username: names[i]}})
+		if err == nil {
+			profiles[i] = details
+		}
+		return err
+	})
+	if profiles[0] == nil {
+		return
+	}
+	skills, interests := map[string]bool{}, map[string]bool{}
+	for _, skill := range profiles[0].Skills {
+		skills[strings.ToLower(skill.Skill)] = true
+	}
+	for _, interest := range profiles[0].Interests {
+		interests[strings.ToLower(interest.Interest)] = true
+	}
+	shared := map[string][2]int{}
+	for i, author := range authors {
+		profile := profiles[i+1]
+		if profile == nil {
+			continue
+		}
+		var counts [2]int
+		for _, skill := range profile.Skills {
+			if skills[strings.ToLower(skill.Skill)] {
+				counts[0]++
+			}
+		}
+		for _, interest := range profile.Interests {
+			if interests[strings.ToLower(interest.Interest)] {
+				counts[1]++
+			}
+		}
+		shared[author] = counts
+	}
+	for i := range candidates {
+		candidates[i].SharedSkills = shared[candidates[i].Author][0]
+		candidates[i].SharedInterests = shared[candidates[i].Author][1]
+	}
+}
+
+func distinctAuthors(candidates []ranking.Candidate) []string {
+	seen := map[string]bool{}
+	var authors []string
+	for _, candidate := range candidates {
+		if !seen[candidate.Author] {
+			seen[candidate.Author] = true
+			authors = append(authors, candidate.Author)
+		}
+	}
+	return authors
+}
+
+// build fills username's timeline with every post of their connections. The
+// timeline is only marked built when no connection was skipped; otherwise
+// the next read tries again and the skipped connections come back as
+// warnings.
+func (s *FeedService) build(ctx context.Context, username string) ([]string, error) {
+	connections, err := s.connections.GetConnections(ctx, &connectionPb.GetRequest{Username: username})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([][]model.TimelineEntry, len(connections.Users))
+	errs := s.each(ctx, len(connections.Users), func(i int) error {
+		response, err := s.posts.GetAllByUsername(ctx, &postPb.GetRequest{Id: connections.Users[i].Username})
+		if err == nil {
+			entries[i] = timelineEntries(username, response.Posts)
+		}
+		return err
+	})
+
+	var warnings []string
+	for i, err := range errs {
+		if err != nil {
+			s.logError.Logger.WithFields(logrus.Fields{
+				"user":       username,
+				"connection": connections.Users[i].Username,
+			}).Errorf("ERR:BUILDING TIMELINE: %v", err)
+			warnings = append(warnings, "posts of "+connections.Users[i].Username+s.unavailable(ctx))
+			continue
+		}
+		err = s.timelines.Add(entries[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(warnings) == 0 {
+		err = s.timelines.MarkBuilt(username)
+		if err != nil {
+			return nil, err
+		}
+		s.logInfo.Logger.WithFields(logrus.Fields{
+			"user":        username,
+			"connections": len(connections.Users),
+		}).Infof("INFO:TIMELINE BUILT")
+	}
+	return warnings, nil
+}
+
+// each calls fn for 0..count-1, at most s.concurrency at a time. Calls that
+// can't start before ctx is done fail with ctx's error instead.
+func (s *FeedService) each(ctx context.Context, count int, fn func(i int) error) []error {
+	errs := make([]error, count)
+	slots := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				errs[i] = fn(i)
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func (s *FeedService) unavailable(ctx context.Context) string {
+	if ctx.Err() != nil {
+		return " timed out"
+	}
+	return " unavailable"
+}
+
+func encodeCursor(posted time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(posted.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func encodeTopCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("top|" + strconv.Itoa(offset)))
+}
+
+func decodeTopCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), "top|") {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "top|"))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	if cursor == "" {
+		return time.Time{}, "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	posted, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil || posted.IsZero() {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return posted, parts[1], nil
+}
+
+// parsePostDate reads DatePosted; posts with a date it can't read sort last.
+func parsePostDate(date string) time.Time {
+	// Dates printed straight from time.Now() end with the monotonic clock.
+	if i := strings.Index(date, " m="); i >= 0 {
+		date = date[:i]
+	}
+	posted, err := time.Parse(postDateLayout, date)
+	if err != nil {
+		return time.Unix(0, 0)
+	}
+	return posted
+}
+
+func mapPost(postPb *postPb.Post) model.Post {
+	post := model.Post{
+		Id:             postPb.Id,
+		Username:       postPb.Username,
+		PostText:       postPb.PostText,
+		ImagePaths:     postPb.ImagePaths,
+		DatePosted:     postPb.DatePosted,
+		LikesNumber:    postPb.LikesNumber,
+		DislikesNumber: postPb.DislikesNumber,
+		CommentsNumber: postPb.CommentsNumber,
+	}
+	if postPb.Links != nil {
+		post.Links = model.Links{Comment: postPb.Links.Comment, Dislike: postPb.Links.Dislike, Like: postPb.Links.Like}
+	}
+	return post
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"strings"
+)
+
+// GraphqlLimits bound what a query may ask for before any of it is executed.
+// Depth counts nested fields. Complexity adds up the cost of every field,
+// counting the fields under a list GraphqlListFactor times, as if every list
+// held that many items. Zero means no limit.
+type GraphqlLimits struct {
+	Depth      int
+	Complexity int
+}
+
+const GraphqlListFactor = 10
+
+// check returns the error of the limit op exceeds, nil when it's within
+// them. doc has to be valid for schema, so its fragments exist and don't
+// spread themselves.
+func (l GraphqlLimits) check(schema *graphql.Schema, doc *ast.Document, op *ast.OperationDefinition) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	depth, complexity := graphqlCost(fragments, schema.QueryType(), op.SelectionSet, 1)
+	nodes := []ast.Node{op}
+	if l.Depth > 0 && depth > l.Depth {
+		message := fmt.Sprintf("the query is %d levels deep, more than the %d allowed", depth, l.Depth)
+		return gqlerrors.NewError(message, nodes, "", nil, nil, nil)
+	}
+	if l.Complexity > 0 && complexity > l.Complexity {
+		message := fmt.Sprintf("the query has a complexity of %d, more than the %d allowed", complexity, l.Complexity)
+		return gqlerrors.NewError(message, nodes, "", nil, nil, nil)
+	}
+	return nil
+}
+
+// graphqlCost returns the depth of the deepest field of set, which is on t at
+// the given depth, and its complexity. A field costs graphqlRpcCost when it
+// has a resolver of its own, as the fields that call a service do, and 1
+// otherwise.
+func graphqlCost(fragments map[string]*ast.FragmentDefinition, t graphql.Named, set *ast.SelectionSet,
+	depth int) (int, int) {
+	maxDepth, complexity := depth, 0
+	add := func(d int, c int) {
+		if d > maxDepth {
+			maxDepth = d
+		}
+		complexity += c
+	}
+	if set == nil {
+		return maxDepth, complexity
+	}
+
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			definition := graphqlField(t, s.Name.Value)
+			if definition == nil {
+				continue
+			}
+			cost := 1
+			if definition.Resolve != nil && !strings.HasPrefix(t.String(), "__") && !strings.HasPrefix(definition.Name, "__") {
+				cost = graphqlRpcCost
+			}
+			if s.SelectionSet == nil {
+				add(depth, cost)
+				continue
+			}
+			d, c := graphqlCost(fragments, graphql.GetNamed(definition.Type), s.SelectionSet, depth+1)
+			add(d, cost+graphqlMultiplier(definition.Type)*c)
+		case *ast.InlineFragment:
+			add(graphqlCost(fragments, t, s.SelectionSet, depth))
+		case *ast.FragmentSpread:
+			if fragment, ok := fragments[s.Name.Value]; ok {
+				add(graphqlCost(fragments, t, fragment.SelectionSet, depth))
+			}
+		}
+	}
+	return maxDepth, complexity
+}
+
+// graphqlField is the definition of the field name of t, nil for
+// __typename, which costs nothing.
+func graphqlField(t graphql.Named, name string) *graphql.FieldDefinition {
+	switch name {
+	case graphql.SchemaMetaFieldDef.Name:
+		return graphql.SchemaMetaFieldDef
+	case graphql.TypeMetaFieldDef.Name:
+		return graphql.TypeMetaFieldDef
+	}
+	if object, ok := t.(interface {
+		Fields() graphql.FieldDefinitionMap
+	}); ok {
+		return object.Fields()[name]
+	}
+	return nil
+}
+
+// graphqlMultiplier is how many times the fields under a field of type t
+// count.
+func graphqlMultiplier(t graphql.Type) int {
+	m := 1
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.List:
+			m *= GraphqlListFactor
+			t = wrapped.OfType
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		default:
+			return m
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+)
+
+// graphqlLoader deduplicates and defers the loads of a request. Load only
+// queues its key and returns a thunk, which the executor forces once every
+// field of the level asked for its value; the first thunk to be forced
+// fetches every queued key with one call of fetch. A key is fetched at most
+// once, so a loader must not outlive its request.
+type graphqlLoader struct {
+	fetch   func(keys []string) ([]interface{}, []error)
+	mu      sync.Mutex
+	entries map[string]*graphqlLoaderEntry
+	pending []*graphqlLoaderEntry
+}
+
+type graphqlLoaderEntry struct {
+	key   string
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newGraphqlLoader(fetch func(keys []string) ([]interface{}, []error)) *graphqlLoader {
+	return &graphqlLoader{fetch: fetch, entries: map[string]*graphqlLoaderEntry{}}
+}
+
+// Load returns a thunk of the type the executor forces, which is why it
+// isn't named.
+func (l *graphqlLoader) Load(key string) func() (interface{}, error) {
+	l.mu.Lock()
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &graphqlLoaderEntry{key: key, done: make(chan struct{})}
+		l.entries[key] = entry
+		l.pending = append(l.pending, entry)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.dispatch()
+		<-entry.done
+		return entry.value, entry.err
+	}
+}
+
+func (l *graphqlLoader) dispatch() {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	keys := make([]string, len(pending))
+	for i, entry := range pending {
+		keys[i] = entry.key
+	}
+	values, errs := l.safeFetch(keys)
+	for i, entry := range pending {
+		entry.value, entry.err = values[i], errs[i]
+		close(entry.done)
+	}
+}
+
+func (l *graphqlLoader) safeFetch(keys []string) (values []interface{}, errs []error) {
+	defer func() {
+		if r := recover(); r != nil || len(values) != len(keys) || len(errs) != len(keys) {
+			values, errs = make([]interface{}, len(keys)), make([]error, len(keys))
+			for i := range errs {
+				errs[i] = fmt.Errorf("internal error")
+			}
+		}
+	}()
+	return l.fetch(keys)
+}
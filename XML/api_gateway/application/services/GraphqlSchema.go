@@ -0,0 +1,603 @@
+package services
+
+import (
+	connectionPb "common/module/proto/connection_service"
+	notificationPb "common/module/proto/notification_service"
+	postPb "common/module/proto/posts_service"
+	userPb "common/module/proto/user_service"
+	"context"
+	"github.com/graphql-go/graphql"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"strings"
+)
+
+// queryType builds the schema. Objects are resolved to maps keyed by their
+// field names; fields that need a service load through the request's loaders,
+// and only they have resolvers, which is what their cost is told by.
+func (s *GraphqlService) queryType() *graphql.Object {
+	nonNullString := graphql.NewNonNull(graphql.String)
+	nonNullInt := graphql.NewNonNull(graphql.Int)
+	listOf := func(t graphql.Type) graphql.Output {
+		return graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t)))
+	}
+	// The lists that are loaded are nullable: a call can fail, and the
+	// executor takes out the whole result rather than the parent of a
+	// non-null field whose load failed.
+	loadedListOf := func(t graphql.Type) graphql.Output {
+		return graphql.NewList(graphql.NewNonNull(t))
+	}
+	load := func(call rpc, key func(p graphql.ResolveParams) string) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			return requestOf(p.Context).load(p, call, key(p)), nil
+		}
+	}
+	source := func(name string) func(p graphql.ResolveParams) string {
+		return func(p graphql.ResolveParams) string {
+			value, _ := p.Source.(map[string]interface{})[name].(string)
+			return value
+		}
+	}
+	arg := func(name string) func(p graphql.ResolveParams) string {
+		return func(p graphql.ResolveParams) string {
+			value, _ := p.Args[name].(string)
+			return value
+		}
+	}
+	none := func(graphql.ResolveParams) string {
+		return ""
+	}
+
+	jobOffer := graphql.NewObject(graphql.ObjectConfig{
+		Name: "JobOffer",
+		Fields: graphql.Fields{
+			"id":           {Type: graphql.NewNonNull(graphql.ID)},
+			"publisher":    {Type: graphql.String},
+			"position":     {Type: graphql.String},
+			"description":  {Type: graphql.String},
+			"requirements": {Type: listOf(graphql.String)},
+			"datePosted":   {Type: graphql.String},
+			"duration":     {Type: graphql.String},
+		},
+	})
+	notification := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Notification",
+		Fields: graphql.Fields{
+			"id":           {Type: graphql.NewNonNull(graphql.ID)},
+			"content":      {Type: graphql.String},
+			"from":         {Type: graphql.String},
+			"to":           {Type: graphql.String},
+			"redirectPath": {Type: graphql.String},
+			"type":         {Type: graphql.String},
+			"read":         {Type: graphql.NewNonNull(graphql.Boolean)},
+			"time":         {Type: graphql.String},
+		},
+	})
+	// User and the types under it refer to each other, so its fields are
+	// built once they all exist.
+	var post, connection *graphql.Object
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "A user and their profile.",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"username":      {Type: nonNullString},
+				"email":         {Type: graphql.String},
+				"phoneNumber":   {Type: graphql.String},
+				"firstName":     {Type: graphql.String},
+				"lastName":      {Type: graphql.String},
+				"gender":        {Type: graphql.String},
+				"dateOfBirth":   {Type: graphql.String},
+				"biography":     {Type: graphql.String},
+				"profileStatus": {Type: graphql.String},
+				"skills":        {Type: listOf(graphql.String)},
+				"interests":     {Type: listOf(graphql.String)},
+				"educations":    {Type: listOf(graphql.String)},
+				"experiences":   {Type: listOf(graphql.String)},
+				"posts": {
+					Type:    loadedListOf(post),
+					Resolve: load(s.userPosts(), source("username")),
+				},
+				"jobOffers": {
+					Type:        loadedListOf(jobOffer),
+					Description: "The job offers the user published. Only the user may see them.",
+					Resolve:     load(s.userJobOffers(), source("username")),
+				},
+				"recommendedJobOffers": {
+					Type:        loadedListOf(jobOffer),
+					Description: "Only the user may see them.",
+					Resolve:     load(s.recommendedJobOffers(), source("username")),
+				},
+				"connections": {
+					Type:    loadedListOf(connection),
+					Resolve: load(s.userConnections(), source("username")),
+				},
+				"connectionRequests": {
+					Type:        loadedListOf(connection),
+					Description: "Only the user may see them.",
+					Resolve:     load(s.connectionRequests(), source("username")),
+				},
+				"recommendedConnections": {
+					Type:        loadedListOf(connection),
+					Description: "Only the user may see them.",
+					Resolve:     load(s.recommendedConnections(), source("username")),
+				},
+				"connectionStatus": {
+					Type:        graphql.String,
+					Description: "The status of the connection between the caller and the user.",
+					Resolve:     load(s.connectionStatus(), source("username")),
+				},
+				"notifications": {
+					Type:        loadedListOf(notification),
+					Description: "Only the user may see them.",
+					Resolve:     load(s.userNotifications(), source("username")),
+				},
+			}
+		}),
+	})
+	comment := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.Fields{
+			"username":  {Type: nonNullString},
+			"firstName": {Type: graphql.String},
+			"lastName":  {Type: graphql.String},
+			"text":      {Type: graphql.String},
+			"author": {
+				Type:    user,
+				Resolve: load(s.userDetails(), source("username")),
+			},
+		},
+	})
+	post = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.Fields{
+			"id":            {Type: graphql.NewNonNull(graphql.ID)},
+			"username":      {Type: nonNullString},
+			"text":          {Type: graphql.String},
+			"imagePaths":    {Type: graphql.String},
+			"datePosted":    {Type: graphql.String},
+			"likes":         {Type: nonNullInt},
+			"dislikes":      {Type: nonNullInt},
+			"commentsCount": {Type: nonNullInt},
+			"author": {
+				Type:    user,
+				Resolve: load(s.userDetails(), source("username")),
+			},
+			"comments": {
+				Type:    loadedListOf(comment),
+				Resolve: load(s.postComments(), source("id")),
+			},
+			"myReaction": {
+				Type:        graphql.String,
+				Description: "LIKED, DISLIKED or NONE, for the caller.",
+				Resolve:     load(s.postReaction(), source("id")),
+			},
+		},
+	})
+	connection = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Connection",
+		Description: "A user as the connection service knows them.",
+		Fields: graphql.Fields{
+			"username":  {Type: nonNullString},
+			"firstName": {Type: graphql.String},
+			"lastName":  {Type: graphql.String},
+			"status":    {Type: graphql.String},
+			"user": {
+				Type:    user,
+				Resolve: load(s.userDetails(), source("username")),
+			},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": {
+				Type:        user,
+				Description: "The caller, null for anonymous callers.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := requestOf(p.Context)
+					if r.caller() == "" {
+						return nil, nil
+					}
+					return r.load(p, s.userDetails(), r.caller()), nil
+				},
+			},
+			"user": {
+				Type:    user,
+				Args:    graphql.FieldConfigArgument{"username": {Type: nonNullString}},
+				Resolve: load(s.userDetails(), arg("username")),
+			},
+			"post": {
+				Type:    post,
+				Args:    graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: load(s.post(), arg("id")),
+			},
+			"posts": {
+				Type:    loadedListOf(post),
+				Resolve: load(s.allPosts(), none),
+			},
+			"jobOffers": {
+				Type:    loadedListOf(jobOffer),
+				Resolve: load(s.allJobOffers(), none),
+			},
+		},
+	})
+}
+
+// printGraphqlSchema describes schema in the schema definition language,
+// leaving out the built-in types.
+func printGraphqlSchema(schema *graphql.Schema) string {
+	var names []string
+	for name, t := range schema.TypeMap() {
+		if _, ok := t.(*graphql.Object); ok && !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("schema {\n  query: " + schema.QueryType().Name() + "\n}\n")
+	for _, name := range names {
+		t := schema.TypeMap()[name].(*graphql.Object)
+		b.WriteString("\n")
+		writeGraphqlDescription(&b, "", t.Description())
+		b.WriteString("type " + name + " {\n")
+		fields := t.Fields()
+		fieldNames := make([]string, 0, len(fields))
+		for fieldName := range fields {
+			fieldNames = append(fieldNames, fieldName)
+		}
+		sort.Strings(fieldNames)
+		for _, fieldName := range fieldNames {
+			f := fields[fieldName]
+			writeGraphqlDescription(&b, "  ", f.Description)
+			b.WriteString("  " + fieldName)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for i, arg := range f.Args {
+					args[i] = arg.Name() + ": " + arg.Type.String()
+				}
+				sort.Strings(args)
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeGraphqlDescription(b *strings.Builder, indent string, description string) {
+	if description == "" {
+		return
+	}
+	b.WriteString(indent + `"""` + "\n")
+	for _, line := range strings.Split(description, "\n") {
+		b.WriteString(indent + line + "\n")
+	}
+	b.WriteString(indent + `"""` + "\n")
+}
+
+func (s *GraphqlService) userDetails() rpc {
+	return rpc{
+		method: "/user_service.UserService/GetUserDetails",
+		request: func(_ string, username string) proto.Message {
+			return &userPb.GetUserDetailsRequest{Username: &userPb.Username{Username: username}}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.users.GetUserDetails(ctx, request.(*userPb.GetUserDetailsRequest))
+			if err != nil {
+				return nil, err
+			}
+			return userValue(response), nil
+		},
+	}
+}
+
+func (s *GraphqlService) userPosts() rpc {
+	return rpc{
+		method: "/post_service.PostService/getAllByUsername",
+		request: func(_ string, username string) proto.Message {
+			return &postPb.GetRequest{Id: username}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.GetAllByUsername(ctx, request.(*postPb.GetRequest))
+			if err != nil {
+				return nil, err
+			}
+			return postValues(response.Posts), nil
+		},
+	}
+}
+
+func (s *GraphqlService) post() rpc {
+	return rpc{
+		method: "/post_service.PostService/get",
+		request: func(_ string, id string) proto.Message {
+			return &postPb.GetRequest{Id: id}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.Get(ctx, request.(*postPb.GetRequest))
+			if err != nil || response.Post == nil {
+				return nil, err
+			}
+			return postValue(response.Post), nil
+		},
+	}
+}
+
+func (s *GraphqlService) allPosts() rpc {
+	return rpc{
+		method: "/post_service.PostService/getAll",
+		request: func(string, string) proto.Message {
+			return &postPb.Empty{}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.GetAll(ctx, request.(*postPb.Empty))
+			if err != nil {
+				return nil, err
+			}
+			return postValues(response.Posts), nil
+		},
+	}
+}
+
+func (s *GraphqlService) postComments() rpc {
+	return rpc{
+		method: "/post_service.PostService/getAllCommentsForPost",
+		request: func(_ string, id string) proto.Message {
+			return &postPb.GetRequest{Id: id}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.GetAllCommentsForPost(ctx, request.(*postPb.GetRequest))
+			if err != nil {
+				return nil, err
+			}
+			comments := make([]map[string]interface{}, len(response.Comments))
+			for i, c := range response.Comments {
+				comments[i] = map[string]interface{}{
+					"username":  c.Username,
+					"firstName": c.FirstName,
+					"lastName":  c.LastName,
+					"text":      c.CommentText,
+				}
+			}
+			return comments, nil
+		},
+	}
+}
+
+// postReaction is keyed by post, the caller is the user who reacted.
+func (s *GraphqlService) postReaction() rpc {
+	return rpc{
+		method: "/post_service.PostService/checkLikedStatus",
+		request: func(caller string, id string) proto.Message {
+			return &postPb.UserReactionRequest{Id: id, Username: caller}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.CheckLikedStatus(ctx, request.(*postPb.UserReactionRequest))
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case response.Liked:
+				return "LIKED", nil
+			case response.Disliked:
+				return "DISLIKED", nil
+			}
+			return "NONE", nil
+		},
+	}
+}
+
+func (s *GraphqlService) allJobOffers() rpc {
+	return rpc{
+		method: "/post_service.PostService/getAllJobOffers",
+		request: func(string, string) proto.Message {
+			return &postPb.Empty{}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.GetAllJobOffers(ctx, request.(*postPb.Empty))
+			if err != nil {
+				return nil, err
+			}
+			return jobOfferValues(response.JobOffers), nil
+		},
+	}
+}
+
+func (s *GraphqlService) userJobOffers() rpc {
+	return rpc{
+		method: "/post_service.PostService/getUsersJobOffers",
+		request: func(_ string, username string) proto.Message {
+			return &postPb.GetMyJobsRequest{Username: username}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.posts.GetUsersJobOffers(ctx, request.(*postPb.GetMyJobsRequest))
+			if err != nil {
+				return nil, err
+			}
+			return jobOfferValues(response.JobOffers), nil
+		},
+	}
+}
+
+func (s *GraphqlService) recommendedJobOffers() rpc {
+	return rpc{
+		method: "/connection_service.ConnectionService/GetRecommendedJobOffers",
+		request: func(_ string, username string) proto.Message {
+			return &connectionPb.GetRequest{Username: username}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.connections.GetRecommendedJobOffers(ctx, request.(*connectionPb.GetRequest))
+			if err != nil {
+				return nil, err
+			}
+			offers := make([]map[string]interface{}, len(response.Offers))
+			for i, o := range response.Offers {
+				offers[i] = jobOfferValue(o.Id, o.Publisher, o.Position, o.JobDescription, o.Requirements, o.DatePosted, o.Duration)
+			}
+			return offers, nil
+		},
+	}
+}
+
+func (s *GraphqlService) userConnections() rpc {
+	return s.connectionList("/connection_service.ConnectionService/GetConnections", s.connections.GetConnections)
+}
+
+func (s *GraphqlService) connectionRequests() rpc {
+	return s.connectionList("/connection_service.ConnectionService/GetConnectionRequests", s.connections.GetConnectionRequests)
+}
+
+func (s *GraphqlService) recommendedConnections() rpc {
+	return s.connectionList("/connection_service.ConnectionService/GetRecommendedNewConnections", s.connections.GetRecommendedNewConnections)
+}
+
+func (s *GraphqlService) connectionList(method string,
+	list func(ctx context.Context, request *connectionPb.GetRequest, options ...grpc.CallOption) (*connectionPb.Users, error)) rpc {
+	return rpc{
+		method: method,
+		request: func(_ string, username string) proto.Message {
+			return &connectionPb.GetRequest{Username: username}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := list(ctx, request.(*connectionPb.GetRequest))
+			if err != nil {
+				return nil, err
+			}
+			users := make([]map[string]interface{}, len(response.Users))
+			for i, u := range response.Users {
+				users[i] = map[string]interface{}{
+					"username":  u.Username,
+					"firstName": u.FirstName,
+					"lastName":  u.LastName,
+					"status":    u.Status,
+				}
+			}
+			return users, nil
+		},
+	}
+}
+
+// connectionStatus is keyed by the other user, the caller sends the request.
+func (s *GraphqlService) connectionStatus() rpc {
+	return rpc{
+		method: "/connection_service.ConnectionService/ConnectionStatusForUsers",
+		request: func(caller string, username string) proto.Message {
+			return &connectionPb.NewConnection{Connection: &connectionPb.Connection{UserSender: caller, UserReceiver: username}}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.connections.ConnectionStatusForUsers(ctx, request.(*connectionPb.NewConnection))
+			if err != nil {
+				return nil, err
+			}
+			return response.ConnectionStatus, nil
+		},
+	}
+}
+
+func (s *GraphqlService) userNotifications() rpc {
+	return rpc{
+		method: "/notification_service.NotificationService/getAllForUser",
+		request: func(_ string, username string) proto.Message {
+			return &notificationPb.GetAllNotificationRequest{Username: username}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			response, err := s.notifications.GetAllForUser(ctx, request.(*notificationPb.GetAllNotificationRequest))
+			if err != nil {
+				return nil, err
+			}
+			notifications := make([]map[string]interface{}, len(response.Notifications))
+			for i, n := range response.Notifications {
+				notifications[i] = map[string]interface{}{
+					"id":           n.Id,
+					"content":      n.Content,
+					"from":         n.From,
+					"to":           n.To,
+					"redirectPath": n.RedirectPath,
+					"type":         n.NotificationType,
+					"read":         n.Read,
+					"time":         n.Time,
+				}
+			}
+			return notifications, nil
+		},
+	}
+}
+
+func userValue(details *userPb.UserDetails) map[string]interface{} {
+	value := map[string]interface{}{
+		"username":      details.Username,
+		"email":         details.Email,
+		"phoneNumber":   details.PhoneNumber,
+		"firstName":     details.FirstName,
+		"lastName":      details.LastName,
+		"gender":        details.Gender,
+		"dateOfBirth":   details.DateOfBirth,
+		"biography":     details.Biography,
+		"profileStatus": details.ProfileStatus,
+	}
+	skills := make([]string, len(details.Skills))
+	for i, skill := range details.Skills {
+		skills[i] = skill.Skill
+	}
+	interests := make([]string, len(details.Interests))
+	for i, interest := range details.Interests {
+		interests[i] = interest.Interest
+	}
+	educations := make([]string, len(details.Educations))
+	for i, education := range details.Educations {
+		educations[i] = education.Education
+	}
+	experiences := make([]string, len(details.Experiences))
+	for i, experience := range details.Experiences {
+		experiences[i] = experience.Experience
+	}
+	value["skills"], value["interests"], value["educations"], value["experiences"] = skills, interests, educations, experiences
+	return value
+}
+
+func postValue(post *postPb.Post) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            post.Id,
+		"username":      post.Username,
+		"text":          post.PostText,
+		"imagePaths":    post.ImagePaths,
+		"datePosted":    post.DatePosted,
+		"likes":         post.LikesNumber,
+		"dislikes":      post.DislikesNumber,
+		"commentsCount": post.CommentsNumber,
+	}
+}
+
+func postValues(posts []*postPb.Post) []map[string]interface{} {
+	values := make([]map[string]interface{}, len(posts))
+	for i, post := range posts {
+		values[i] = postValue(post)
+	}
+	return values
+}
+
+func jobOfferValue(id string, publisher string, position string, description string, requirements []string,
+	datePosted string, duration string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           id,
+		"publisher":    publisher,
+		"position":     position,
+		"description":  description,
+		"requirements": requirements,
+		"datePosted":   datePosted,
+		"duration":     duration,
+	}
+}
+
+func jobOfferValues(offers []*postPb.JobOffer) []map[string]interface{} {
+	values := make([]map[string]interface{}, len(offers))
+	for i, o := range offers {
+		values[i] = jobOfferValue(o.Id, o.Publisher, o.Position, o.JobDescription, o.Requirements, o.DatePosted, o.Duration)
+	}
+	return values
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/interceptor"
+	"common/module/logger"
+	connectionPb "common/module/proto/connection_service"
+	notificationPb "common/module/proto/notification_service"
+	postPb "common/module/proto/posts_service"
+	userPb "common/module/proto/user_service"
+	"context"
+	"fmt"
+	"gateway/module/auth"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"sync"
+)
+
+const (
+	// GraphqlConcurrency bounds the calls a request makes for one RPC at once.
+	GraphqlConcurrency = 8
+	// graphqlRpcCost is the complexity of a field that takes a call to a
+	// service.
+	graphqlRpcCost = 5
+)
+
+// GraphqlQuery is a query as clients post it.
+type GraphqlQuery struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphqlService answers GraphQL queries with the services. Fields that need
+// a service go through a loader of the request, so an RPC is called once per
+// distinct key of a request however many fields ask for it, and the keys a
+// level of the query needs are fetched together, GraphqlConcurrency at a
+// time. The services have no batch RPCs, so each key is still a call of its
+// own: the authors of n posts by different users take n calls. Before a call
+// is made it is checked against the rule of its method, as the route of the
+// RPC would be.
+type GraphqlService struct {
+	logError      *logger.Logger
+	authorizer    *auth.Authorizer
+	users         userPb.UserServiceClient
+	posts         postPb.PostServiceClient
+	connections   connectionPb.ConnectionServiceClient
+	notifications notificationPb.NotificationServiceClient
+	limits        GraphqlLimits
+	schema        graphql.Schema
+}
+
+func NewGraphqlService(logError *logger.Logger, authorizer *auth.Authorizer, users userPb.UserServiceClient,
+	posts postPb.PostServiceClient, connections connectionPb.ConnectionServiceClient,
+	notifications notificationPb.NotificationServiceClient, limits GraphqlLimits) *GraphqlService {
+	s := &GraphqlService{
+		logError:      logError,
+		authorizer:    authorizer,
+		users:         users,
+		posts:         posts,
+		connections:   connections,
+		notifications: notifications,
+		limits:        limits,
+	}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: s.queryType()})
+	if err != nil {
+		panic(err)
+	}
+	s.schema = schema
+	return s
+}
+
+// Schema describes the schema in the schema definition language.
+func (s *GraphqlService) Schema() string {
+	return printGraphqlSchema(&s.schema)
+}
+
+// Execute answers query for the caller with claims, nil when anonymous.
+// ctx has to carry the caller's token for the services, which check the
+// calls again. The query is checked against the schema and the limits
+// before anything is resolved.
+func (s *GraphqlService) Execute(ctx context.Context, claims *interceptor.JwtClaims, query GraphqlQuery) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(query.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	validation := graphql.ValidateDocument(&s.schema, doc, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	if op := graphqlOperation(doc, query.OperationName); op != nil {
+		if err := s.limits.check(&s.schema, doc, op); err != nil {
+			return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+		}
+	}
+
+	r := &graphqlRequest{service: s, ctx: ctx, claims: claims, loaders: map[string]*graphqlLoader{}, errors: map[string]error{}}
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: query.OperationName,
+		Args:          query.Variables,
+		Context:       context.WithValue(ctx, graphqlRequestKey{}, r),
+	})
+	r.extendErrors(result)
+	return result
+}
+
+// graphqlOperation is the operation of doc that name picks, nil when there
+// is none; executing it reports why.
+func graphqlOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" && found != nil {
+			return nil
+		}
+		if name == "" || op.Name != nil && op.Name.Value == name {
+			found = op
+		}
+	}
+	return found
+}
+
+type graphqlRequestKey struct{}
+
+// graphqlRequest holds the caller and the loaders of a request.
+type graphqlRequest struct {
+	service *GraphqlService
+	ctx     context.Context
+	claims  *interceptor.JwtClaims
+	mu      sync.Mutex
+	loaders map[string]*graphqlLoader
+	// errors holds the errors of the fields that failed, by their path.
+	errors map[string]error
+}
+
+func requestOf(ctx context.Context) *graphqlRequest {
+	return ctx.Value(graphqlRequestKey{}).(*graphqlRequest)
+}
+
+// caller is the username of the caller, empty when anonymous.
+func (r *graphqlRequest) caller() string {
+	if r.claims == nil {
+		return ""
+	}
+	return r.claims.Username
+}
+
+// rpc is how a field loads its value: the request the caller makes for a
+// key, and the call that turns it into the value.
+type rpc struct {
+	method  string
+	request func(caller string, key string) proto.Message
+	call    func(ctx context.Context, request proto.Message) (interface{}, error)
+}
+
+// load returns the thunk of the value of field p for key.
+func (r *graphqlRequest) load(p graphql.ResolveParams, call rpc, key string) func() (interface{}, error) {
+	r.mu.Lock()
+	loader, ok := r.loaders[call.method]
+	if !ok {
+		loader = newGraphqlLoader(func(keys []string) ([]interface{}, []error) {
+			return r.fetch(call, keys)
+		})
+		r.loaders[call.method] = loader
+	}
+	r.mu.Unlock()
+
+	thunk := loader.Load(key)
+	return func() (interface{}, error) {
+		value, err := thunk()
+		if err != nil {
+			r.mu.Lock()
+			r.errors[fmt.Sprint(p.Info.Path.AsArray())] = err
+			r.mu.Unlock()
+		}
+		return value, err
+	}
+}
+
+// extendErrors gives the errors of result the extensions of the errors of
+// their fields. The executor keeps the extensions of the errors resolvers
+// return, but drops those of the errors of thunks.
+func (r *graphqlRequest) extendErrors(result *graphql.Result) {
+	for i, formatted := range result.Errors {
+		err, ok := r.errors[fmt.Sprint(formatted.Path)]
+		if !ok {
+			continue
+		}
+		if extended, ok := err.(gqlerrors.ExtendedError); ok {
+			result.Errors[i].Extensions = extended.Extensions()
+		}
+	}
+}
+
+// fetch makes call for every key, at most GraphqlConcurrency at a time. It
+// doesn't merge the keys into one request, which the services have no RPCs
+// for: a level with n distinct keys costs the service n calls. Calls that
+// can't start before the request is done fail with its error.
+func (r *graphqlRequest) fetch(call rpc, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	slots := make(chan struct{}, GraphqlConcurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			request := call.request(r.caller(), key)
+			err := r.service.authorizer.AuthorizeRpc(r.claims, call.method, request)
+			if err != nil {
+				errs[i] = r.service.fieldError(call.method, err)
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				values[i], err = call.call(r.ctx, request)
+			case <-r.ctx.Done():
+				err = status.FromContextError(r.ctx.Err()).Err()
+			}
+			if err != nil {
+				values[i], errs[i] = nil, r.service.fieldError(call.method, err)
+			}
+		}(i, key)
+	}
+	wg.Wait()
+	return values, errs
+}
+
+// fieldError turns the error of a call into the error of the field, with
+// the stable code of the error as its code. Errors that aren't the caller's
+// are logged.
+func (s *GraphqlService) fieldError(method string, err error) error {
+	e := domainErrors.FromError(err)
+	if e.Leaks() {
+		domainErrors.Log(s.logError, e, logrus.Fields{"method": method})
+	}
+	extensions := map[string]interface{}{"code": e.Code}
+	if len(e.Fields) > 0 {
+		extensions["errors"] = e.Fields
+	}
+	return &graphqlFieldError{message: e.Message, extensions: extensions}
+}
+
+// graphqlFieldError is the error of a field, with the extensions clients
+// find its code in.
+type graphqlFieldError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *graphqlFieldError) Error() string {
+	return e.message
+}
+
+func (e *graphqlFieldError) Extensions() map[string]interface{} {
+	return e.extensions
+}
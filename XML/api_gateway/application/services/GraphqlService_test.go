@@ -0,0 +1,393 @@
+package services
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/interceptor"
+	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
+	connectionPb "common/module/proto/connection_service"
+	notificationPb "common/module/proto/notification_service"
+	postPb "common/module/proto/posts_service"
+	userPb "common/module/proto/user_service"
+	"common/module/revocation"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gateway/module/auth"
+	"github.com/graphql-go/graphql/gqlerrors"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// calls counts the calls of the stubs by method and key.
+type calls struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *calls) add(method string, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[method+" "+key]++
+}
+
+func (c *calls) made() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	made := map[string]int{}
+	for call, count := range c.counts {
+		made[call] = count
+	}
+	return made
+}
+
+// The stubs only implement the methods the schema calls; the embedded
+// interfaces are nil, so calling anything else panics.
+type userClientStub struct {
+	userPb.UserServiceClient
+	calls *calls
+}
+
+func (c userClientStub) GetUserDetails(_ context.Context, request *userPb.GetUserDetailsRequest, _ ...grpc.CallOption) (*userPb.UserDetails, error) {
+	username := request.Username.Username
+	c.calls.add("GetUserDetails", username)
+	if username == "ghost" {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &userPb.UserDetails{
+		Username:  username,
+		FirstName: "First " + username,
+		Skills:    []*userPb.Skill{{Skill: "go"}},
+	}, nil
+}
+
+type postClientStub struct {
+	postPb.PostServiceClient
+	calls *calls
+}
+
+func (c postClientStub) GetAll(context.Context, *postPb.Empty, ...grpc.CallOption) (*postPb.GetMultipleResponse, error) {
+	c.calls.add("GetAll", "")
+	return &postPb.GetMultipleResponse{Posts: []*postPb.Post{
+		{Id: "1", Username: "alice", PostText: "first", LikesNumber: 2},
+		{Id: "2", Username: "bob", PostText: "second"},
+		{Id: "3", Username: "alice", PostText: "third", CommentsNumber: 1},
+	}}, nil
+}
+
+func (c postClientStub) GetAllCommentsForPost(_ context.Context, request *postPb.GetRequest, _ ...grpc.CallOption) (*postPb.GetAllCommentsResponse, error) {
+	c.calls.add("GetAllCommentsForPost", request.Id)
+	if request.Id != "3" {
+		return &postPb.GetAllCommentsResponse{}, nil
+	}
+	return &postPb.GetAllCommentsResponse{Comments: []*postPb.Comment{{Username: "bob", CommentText: "nice"}}}, nil
+}
+
+func (c postClientStub) CheckLikedStatus(_ context.Context, request *postPb.UserReactionRequest, _ ...grpc.CallOption) (*postPb.GetUserReactionResponse, error) {
+	c.calls.add("CheckLikedStatus", request.Username+" "+request.Id)
+	return &postPb.GetUserReactionResponse{Liked: request.Id == "1", Neutral: request.Id != "1"}, nil
+}
+
+func (c postClientStub) GetUsersJobOffers(_ context.Context, request *postPb.GetMyJobsRequest, _ ...grpc.CallOption) (*postPb.GetAllJobOffers, error) {
+	c.calls.add("GetUsersJobOffers", request.Username)
+	return &postPb.GetAllJobOffers{JobOffers: []*postPb.JobOffer{{Id: "j1", Publisher: request.Username, Requirements: []string{"go"}}}}, nil
+}
+
+type graphqlFixture struct {
+	service *GraphqlService
+	calls   *calls
+}
+
+func newGraphqlFixture(t *testing.T, limits GraphqlLimits) *graphqlFixture {
+	l, _ := logtest.NewNullLogger()
+	discard := &logger.Logger{Logger: l}
+	authPolicy, err := policy.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer := auth.NewAuthorizer(authPolicy, nil, revocation.NewList(), permissions.NewCache(authPolicy.Roles), discard)
+	made := &calls{counts: map[string]int{}}
+	// The tests don't query the connection and notification services; their
+	// clients have no connection.
+	service := NewGraphqlService(discard, authorizer, userClientStub{calls: made}, postClientStub{calls: made},
+		connectionPb.NewConnectionServiceClient(nil), notificationPb.NewNotificationServiceClient(nil), limits)
+	return &graphqlFixture{service: service, calls: made}
+}
+
+// execute runs query for username, anonymously when it's empty, and returns
+// the response as JSON.
+func (f *graphqlFixture) execute(t *testing.T, username string, query string) string {
+	var claims *interceptor.JwtClaims
+	if username != "" {
+		claims = &interceptor.JwtClaims{Username: username, Roles: []string{"Regular"}}
+	}
+	response := f.service.Execute(context.Background(), claims, GraphqlQuery{Query: query})
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGraphqlResolvesFieldsWithTheServices(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	got := f.execute(t, "", `{ posts { id text likes author { username firstName skills } comments { text author { username } } } }`)
+	// The executor writes the fields of an object in the order of their names.
+	want := `{"data":{"posts":[` +
+		`{"author":{"firstName":"First alice","skills":["go"],"username":"alice"},"comments":[],"id":"1","likes":2,"text":"first"},` +
+		`{"author":{"firstName":"First bob","skills":["go"],"username":"bob"},"comments":[],"id":"2","likes":0,"text":"second"},` +
+		`{"author":{"firstName":"First alice","skills":["go"],"username":"alice"},` +
+		`"comments":[{"author":{"username":"bob"},"text":"nice"}],"id":"3","likes":0,"text":"third"}]}}`
+	if got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+
+	// Users are loaded once per request, however many fields ask for them.
+	wantCalls := map[string]int{
+		"GetAll ":                 1,
+		"GetAllCommentsForPost 1": 1,
+		"GetAllCommentsForPost 2": 1,
+		"GetAllCommentsForPost 3": 1,
+		"GetUserDetails alice":    1,
+		"GetUserDetails bob":      1,
+	}
+	if made := f.calls.made(); !reflect.DeepEqual(made, wantCalls) {
+		t.Fatalf("got calls %v, want %v", made, wantCalls)
+	}
+}
+
+func TestGraphqlLoadersBelongToTheRequest(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	for i := 0; i < 2; i++ {
+		f.execute(t, "", `{ user(username: "alice") { username } }`)
+	}
+	if made := f.calls.made()["GetUserDetails alice"]; made != 2 {
+		t.Fatalf("alice was loaded %d times by two requests, want 2", made)
+	}
+}
+
+func TestGraphqlMe(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	if got := f.execute(t, "", `{ me { username } }`); got != `{"data":{"me":null}}` {
+		t.Fatalf("got %s for an anonymous caller", got)
+	}
+	if got := f.execute(t, "alice", `{ me { username } }`); got != `{"data":{"me":{"username":"alice"}}}` {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestGraphqlCallerSendsTheRequest(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	got := f.execute(t, "alice", `{ posts { id myReaction } }`)
+	want := `{"data":{"posts":[{"id":"1","myReaction":"LIKED"},{"id":"2","myReaction":"NONE"},{"id":"3","myReaction":"NONE"}]}}`
+	if got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if f.calls.made()["CheckLikedStatus alice "+id] != 1 {
+			t.Fatalf("the reaction to %s wasn't checked for alice: %v", id, f.calls.made())
+		}
+	}
+}
+
+func TestGraphqlChecksTheRuleOfEveryCall(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	// Only bob may see his job offers, so they are null with an error.
+	query := `{ me { jobOffers { id requirements } } user(username: "bob") { username jobOffers { id } } }`
+	got := f.execute(t, "alice", query)
+	want := `{"data":{"me":{"jobOffers":[{"id":"j1","requirements":["go"]}]},"user":{"jobOffers":null,"username":"bob"}},` +
+		`"errors":[{"message":"Forbidden","locations":[{"line":1,"column":73}],"path":["user","jobOffers"],` +
+		`"extensions":{"code":"` + domainErrors.CodePermissionDenied + `"}}]}`
+	if got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+
+	got = f.execute(t, "", `{ posts { id myReaction } }`)
+	if made := f.calls.made(); made["CheckLikedStatus  1"] != 0 || made["GetUsersJobOffers bob"] != 0 {
+		t.Fatalf("calls were made that their rules refuse: %v", made)
+	}
+	var response struct {
+		Errors []gqlerrors.FormattedError `json:"errors"`
+	}
+	err := json.Unmarshal([]byte(got), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Errors) != 3 || response.Errors[0].Extensions["code"] != domainErrors.CodeUnauthenticated {
+		t.Fatalf("got %s, want an unauthenticated error for every post", got)
+	}
+}
+
+func TestGraphqlErrorsOfTheServices(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	got := f.execute(t, "", `{ user(username: "ghost") { username } }`)
+	want := `{"data":{"user":null},"errors":[{"message":"user not found","locations":[{"line":1,"column":3}],"path":["user"],` +
+		`"extensions":{"code":"` + domainErrors.CodeNotFound + `"}}]}`
+	if got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestGraphqlLimits(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{Depth: 3, Complexity: 100})
+	cases := []struct {
+		query string
+		error string
+	}{
+		// posts costs 5, and 10 times the id and the author under it.
+		{`{ posts { id author { username } } }`, ""},
+		{`{ posts { id author { username } comments { text } } }`, "the query has a complexity of 225, more than the 100 allowed"},
+		{`{ user(username: "alice") { posts { author { username } } } }`, "the query is 4 levels deep, more than the 3 allowed"},
+		// Fragments count where they are spread.
+		{`{ ...all } fragment all on Query { posts { ...post comments { text } } } fragment post on Post { id author { username } }`,
+			"the query has a complexity of 225, more than the 100 allowed"},
+		// So does introspection, at a cost of 1 a field.
+		{`{ __schema { types { fields { type { name } } } } }`, "the query is 5 levels deep, more than the 3 allowed"},
+	}
+	for _, c := range cases {
+		got := f.execute(t, "", c.query)
+		want := `{"data":null,"errors":[{"message":"` + c.error + `","locations":[{"line":1,"column":1}]}]}`
+		if c.error == "" && !strings.HasPrefix(got, `{"data":{"posts":[`) || c.error != "" && got != want {
+			t.Errorf("%s: got %s", c.query, got)
+		}
+	}
+}
+
+func TestGraphqlRefusesInvalidQueries(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	for _, query := range []string{`{ posts { id`, `{ posts { secret } }`, `{ user { username } }`} {
+		var response struct {
+			Data   interface{}                `json:"data"`
+			Errors []gqlerrors.FormattedError `json:"errors"`
+		}
+		if err := json.Unmarshal([]byte(f.execute(t, "", query)), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Data != nil || len(response.Errors) == 0 {
+			t.Errorf("%s: got %+v, want errors and no data", query, response)
+		}
+	}
+	if made := f.calls.made(); len(made) != 0 {
+		t.Fatalf("invalid queries made calls: %v", made)
+	}
+}
+
+func TestGraphqlSchema(t *testing.T) {
+	sdl := newGraphqlFixture(t, GraphqlLimits{}).service.Schema()
+	for _, want := range []string{
+		"schema {\n  query: Query\n}\n",
+		"  user(username: String!): User\n",
+		"  posts: [Post!]\n",
+		"  skills: [String!]!\n",
+		"\"\"\"\nA user and their profile.\n\"\"\"\ntype User {\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("the schema is missing %q:\n%s", want, sdl)
+		}
+	}
+	if strings.Contains(sdl, "__") {
+		t.Errorf("the schema describes the introspection types:\n%s", sdl)
+	}
+}
+
+func TestGraphqlFetchBoundsConcurrency(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	var mu sync.Mutex
+	running, most := 0, 0
+	call := rpc{
+		method: "/post_service.PostService/get",
+		request: func(_ string, id string) proto.Message {
+			return &postPb.GetRequest{Id: id}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return request.(*postPb.GetRequest).Id, nil
+		},
+	}
+
+	keys := make([]string, 3*GraphqlConcurrency)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	r := &graphqlRequest{service: f.service, ctx: context.Background()}
+	values, errs := r.fetch(call, keys)
+	for i, key := range keys {
+		if values[i] != key || errs[i] != nil {
+			t.Fatalf("got %v %v for %s", values[i], errs[i], key)
+		}
+	}
+	if most > GraphqlConcurrency {
+		t.Fatalf("%d calls ran at once, more than %d", most, GraphqlConcurrency)
+	}
+}
+
+func TestGraphqlFetchStopsWithTheRequest(t *testing.T) {
+	f := newGraphqlFixture(t, GraphqlLimits{})
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var started []string
+	call := rpc{
+		method: "/post_service.PostService/get",
+		request: func(_ string, id string) proto.Message {
+			return &postPb.GetRequest{Id: id}
+		},
+		call: func(ctx context.Context, request proto.Message) (interface{}, error) {
+			mu.Lock()
+			started = append(started, request.(*postPb.GetRequest).Id)
+			if len(started) == GraphqlConcurrency {
+				cancel()
+			}
+			mu.Unlock()
+			<-release
+			return nil, status.FromContextError(ctx.Err()).Err()
+		},
+	}
+
+	keys := make([]string, 2*GraphqlConcurrency)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	r := &graphqlRequest{service: f.service, ctx: ctx}
+	done := make(chan []error)
+	go func() {
+		_, errs := r.fetch(call, keys)
+		done <- errs
+	}()
+	// The calls that got a slot hold it until they are released, so the
+	// others can only see that the request is done.
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	errs := <-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(started) != GraphqlConcurrency {
+		t.Fatalf("%d calls started, want %d", len(started), GraphqlConcurrency)
+	}
+	for i, err := range errs {
+		code, _ := err.(*graphqlFieldError).extensions["code"].(string)
+		if code != domainErrors.CodeCanceled {
+			t.Fatalf("got %v with code %q for %s, want canceled", err, code, keys[i])
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"common/module/logger"
+	"common/module/mailer"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	AccountLockThreshold = 10
+	IPLockThreshold      = 50
+	FreeAttempts         = 3
+	BaseBackoff          = time.Second
+	MaxBackoff           = 5 * time.Minute
+	LockoutDuration      = 30 * time.Minute
+	AttemptWindow        = time.Hour
+)
+
+var (
+	ErrAccountLocked     = errors.New("account temporarily locked")
+	ErrTooManyAttempts   = errors.New("too many login attempts")
+	ErrInvalidUnlockCode = errors.New("invalid unlock code")
+)
+
+// ThrottledError is returned when a login attempt is refused before the
+// credentials are even looked at.
+type ThrottledError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+type LoginAttemptService struct {
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	repo     repositories.LoginAttemptRepository
+	userRepo repositories.UserRepository
+	mail     mailer.Mailer
+}
+
+func NewLoginAttemptService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.LoginAttemptRepository,
+	userRepo repositories.UserRepository, mail mailer.Mailer) *LoginAttemptService {
+	return &LoginAttemptService{logInfo, logError, repo, userRepo, mail}
+}
+
+// Start periodically forgets attempts that have been idle for longer than
+// AttemptWindow.
+func (s *LoginAttemptService) Start() {
+	go func() {
+		for range time.Tick(AttemptWindow / 4) {
+			err := s.repo.DeleteIdleSince(time.Now().Add(-AttemptWindow))
+			if err != nil {
+				s.logError.Logger.Errorf("ERR:CLEANING LOGIN ATTEMPTS: %v", err)
+			}
+		}
+	}()
+}
+
+// Attempt registers a login attempt for the account and the client address
+// before the credentials are checked. Every attempt counts as failed until
+// Succeeded is called, so concurrent guesses can't slip past the limits.
+// An empty username only tracks the address.
+func (s *LoginAttemptService) Attempt(username string, ip string) error {
+	err := s.attempt(ipKey(ip), IPLockThreshold, username, ip, false)
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		return nil
+	}
+	return s.attempt(accountKey(username), AccountLockThreshold, username, ip, true)
+}
+
+// Succeeded clears the account's failures and takes back the attempt counted
+// against the client address.
+func (s *LoginAttemptService) Succeeded(username string, ip string) {
+	if username != "" {
+		err := s.repo.Delete(accountKey(username))
+		if err != nil {
+			s.logError.Logger.Errorf("ERR:RESETTING LOGIN ATTEMPTS: %v", err)
+		}
+	}
+	_, err := s.repo.Update(ipKey(ip), func(attempt *model.LoginAttempt) {
+		if attempt.Failures > 0 {
+			attempt.Failures--
+		}
+	})
+	if err != nil {
+		s.logError.Logger.Errorf("ERR:RESETTING LOGIN ATTEMPTS: %v", err)
+	}
+}
+
+// CheckAccount refuses logins for an account that is locked, without
+// counting an attempt. It is used where the account is only known after the
+// attempt has been registered against the address.
+func (s *LoginAttemptService) CheckAccount(username string) error {
+	attempt, err := s.repo.Get(accountKey(username))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if attempt.LockedUntil.After(now) {
+		return &ThrottledError{ErrAccountLocked, attempt.LockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// Unlock lifts an account lockout using the code that was mailed when the
+// account got locked.
+func (s *LoginAttemptService) Unlock(code string) (string, error) {
+	attempt, err := s.repo.GetByUnlockCode(hashRefreshToken(code))
+	if err != nil || !attempt.LockedUntil.After(time.Now()) {
+		return "", ErrInvalidUnlockCode
+	}
+	err = s.repo.Delete(attempt.Key)
+	if err != nil {
+		return "", err
+	}
+	username := attempt.Key[len(accountKeyPrefix):]
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user": username,
+	}).Infof("INFO:ACCOUNT UNLOCKED BY EMAIL")
+	return username, nil
+}
+
+func (s *LoginAttemptService) attempt(key string, threshold int, username string, ip string, isAccount bool) error {
+	now := time.Now()
+	lockErr := ErrTooManyAttempts
+	if isAccount {
+		lockErr = ErrAccountLocked
+	}
+	var throttled *ThrottledError
+	var locked bool
+	var unlockCode string
+
+	_, err := s.repo.Update(key, func(attempt *model.LoginAttempt) {
+		if attempt.LastAttempt.Before(now.Add(-AttemptWindow)) && !attempt.LockedUntil.After(now) {
+			attempt.Failures = 0
+		}
+		if attempt.LockedUntil.After(now) {
+			throttled = &ThrottledError{lockErr, attempt.LockedUntil.Sub(now)}
+			return
+		}
+		if attempt.Failures >= threshold {
+			attempt.Failures = 0
+			attempt.LockedUntil = now.Add(LockoutDuration)
+			attempt.UnlockCode = ""
+			if isAccount {
+				unlockCode = newUnlockCode()
+			}
+			if unlockCode != "" {
+				attempt.UnlockCode = hashRefreshToken(unlockCode)
+			}
+			locked = true
+			throttled = &ThrottledError{lockErr, LockoutDuration}
+			return
+		}
+		if wait := attempt.LastAttempt.Add(backoff(attempt.Failures)).Sub(now); wait > 0 {
+			throttled = &ThrottledError{ErrTooManyAttempts, wait}
+			return
+		}
+		attempt.Failures++
+		attempt.LastAttempt = now
+	})
+	if err != nil {
+		s.logError.Logger.Errorf("ERR:TRACKING LOGIN ATTEMPTS: %v", err)
+		return err
+	}
+
+	if locked {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user":        username,
+			"userIP":      ip,
+			"lockedKey":   key,
+			"lockedUntil": now.Add(LockoutDuration),
+		}).Errorf("ERR:LOGIN LOCKOUT")
+		if isAccount {
+			s.sendUnlockCode(username, unlockCode)
+		}
+	} else if throttled != nil {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user":   username,
+			"userIP": ip,
+		}).Errorf("ERR:LOGIN THROTTLED: %s", throttled.Err.Error())
+	}
+	if throttled != nil {
+		return throttled
+	}
+	return nil
+}
+
+func (s *LoginAttemptService) sendUnlockCode(username string, code string) {
+	user, err := s.userRepo.GetByUsername(context.TODO(), username)
+	if err != nil || code == "" {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user": username,
+		}).Errorf("ERR:UNLOCK CODE NOT SENT")
+		return
+	}
+	message, err := mailer.NotificationEmail(user.Email, mailer.NotificationData{
+		Username:  username,
+		Title:     "Account locked",
+		Message:   "Your account was locked after too many failed login attempts. Use this code to unlock it:",
+		Code:      code,
+		ExpiresIn: LockoutDuration,
+	})
+	if err == nil {
+		err = s.mail.Send(context.TODO(), message)
+	}
+	if err != nil {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user": username,
+		}).Errorf("ERR:UNLOCK CODE NOT SENT: %v", err)
+	}
+}
+
+// backoff is how long to wait after the last attempt once failures have piled
+// up: nothing for the first few, then doubling up to MaxBackoff.
+func backoff(failures int) time.Duration {
+	if failures < FreeAttempts {
+		return 0
+	}
+	delay := BaseBackoff
+	for i := FreeAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return delay
+}
+
+func newUnlockCode() string {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+const accountKeyPrefix = "account:"
+
+func accountKey(username string) string {
+	return accountKeyPrefix + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
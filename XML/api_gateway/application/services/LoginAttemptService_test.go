@@ -0,0 +1,190 @@
+package services
+
+import (
+	"common/module/mailer"
+	"context"
+	"errors"
+	"fmt"
+	"gateway/module/domain/model"
+	"gateway/module/infrastructure/persistance"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type mailerInMemory struct {
+	messages []mailer.Message
+}
+
+func (m *mailerInMemory) Send(_ context.Context, message mailer.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+var unlockCodePattern = regexp.MustCompile(`[A-Za-z0-9_-]{43}`)
+
+type loginAttemptFixture struct {
+	service *LoginAttemptService
+	mail    *mailerInMemory
+}
+
+func newLoginAttemptFixture() *loginAttemptFixture {
+	discard, _ := discardLogger()
+	users := userRepositoryInMemory{users: map[string]*model.User{
+		"alice": {Username: "alice", Email: "alice@example.com"},
+		"bob":   {Username: "bob", Email: "bob@example.com"},
+	}}
+	mail := &mailerInMemory{}
+	return &loginAttemptFixture{
+		service: NewLoginAttemptService(discard, discard, persistance.NewLoginAttemptRepositoryInMemory(), users, mail),
+		mail:    mail,
+	}
+}
+
+// attempt registers an attempt once any backoff of the account and the
+// address has passed, so only the lockout thresholds can refuse it.
+func (f *loginAttemptFixture) attempt(username string, ip string) error {
+	for _, key := range []string{accountKey(username), ipKey(ip)} {
+		_, err := f.service.repo.Update(key, func(attempt *model.LoginAttempt) {
+			if !attempt.LastAttempt.IsZero() {
+				attempt.LastAttempt = attempt.LastAttempt.Add(-MaxBackoff)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return f.service.Attempt(username, ip)
+}
+
+func (f *loginAttemptFixture) unlockCode(t *testing.T) string {
+	if len(f.mail.messages) != 1 {
+		t.Fatalf("%d emails sent, want the unlock code", len(f.mail.messages))
+	}
+	code := unlockCodePattern.FindString(f.mail.messages[0].Text)
+	if code == "" {
+		t.Fatalf("no unlock code in %q", f.mail.messages[0].Text)
+	}
+	return code
+}
+
+func throttledBy(err error) (*ThrottledError, bool) {
+	var throttled *ThrottledError
+	ok := errors.As(err, &throttled)
+	return throttled, ok
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{FreeAttempts - 1, 0},
+		{FreeAttempts, BaseBackoff},
+		{FreeAttempts + 1, 2 * BaseBackoff},
+		{FreeAttempts + 3, 8 * BaseBackoff},
+		{FreeAttempts + 20, MaxBackoff},
+	}
+	for _, c := range cases {
+		if delay := backoff(c.failures); delay != c.delay {
+			t.Errorf("backoff(%d) = %v, want %v", c.failures, delay, c.delay)
+		}
+	}
+}
+
+func TestAttemptBacksOff(t *testing.T) {
+	f := newLoginAttemptFixture()
+	for i := 0; i < FreeAttempts; i++ {
+		if err := f.service.Attempt("alice", "192.0.2.1"); err != nil {
+			t.Fatalf("attempt %d refused: %v", i+1, err)
+		}
+	}
+	throttled, ok := throttledBy(f.service.Attempt("alice", "192.0.2.1"))
+	if !ok || throttled.Err != ErrTooManyAttempts {
+		t.Fatalf("got %v after %d failures, want to wait", throttled, FreeAttempts)
+	}
+	if throttled.RetryAfter <= 0 || throttled.RetryAfter > BaseBackoff {
+		t.Fatalf("retry after %v, want at most %v", throttled.RetryAfter, BaseBackoff)
+	}
+	if err := f.attempt("alice", "192.0.2.1"); err != nil {
+		t.Fatalf("attempt after the backoff refused: %v", err)
+	}
+}
+
+func TestAccountLockoutAndUnlock(t *testing.T) {
+	f := newLoginAttemptFixture()
+	for i := 0; i < AccountLockThreshold; i++ {
+		// Every attempt comes from another address, so only the account
+		// can be locked.
+		if err := f.attempt("alice", fmt.Sprintf("192.0.2.%d", i+1)); err != nil {
+			t.Fatalf("attempt %d refused: %v", i+1, err)
+		}
+	}
+	throttled, ok := throttledBy(f.attempt("alice", "198.51.100.1"))
+	if !ok || throttled.Err != ErrAccountLocked || throttled.RetryAfter != LockoutDuration {
+		t.Fatalf("got %v after %d failures, want the account locked", throttled, AccountLockThreshold)
+	}
+	if _, ok := throttledBy(f.service.CheckAccount("alice")); !ok {
+		t.Fatal("CheckAccount let a locked account through")
+	}
+	if err := f.attempt("bob", "198.51.100.1"); err != nil {
+		t.Fatalf("another account was refused: %v", err)
+	}
+
+	code := f.unlockCode(t)
+	if _, err := f.service.Unlock("not-the-code"); err != ErrInvalidUnlockCode {
+		t.Fatalf("got %v for a wrong code, want %v", err, ErrInvalidUnlockCode)
+	}
+	username, err := f.service.Unlock(code)
+	if err != nil || username != "alice" {
+		t.Fatalf("unlocked %q: %v", username, err)
+	}
+	if err := f.service.CheckAccount("alice"); err != nil {
+		t.Fatalf("the account is still locked: %v", err)
+	}
+	if _, err := f.service.Unlock(code); err != ErrInvalidUnlockCode {
+		t.Fatalf("got %v for a used code, want %v", err, ErrInvalidUnlockCode)
+	}
+}
+
+func TestAddressLockout(t *testing.T) {
+	f := newLoginAttemptFixture()
+	for i := 0; i < IPLockThreshold; i++ {
+		// Guesses spread over accounts that don't exist lock the address
+		// without locking any of them.
+		if err := f.attempt(fmt.Sprintf("guess-%d", i), "192.0.2.1"); err != nil {
+			t.Fatalf("attempt %d refused: %v", i+1, err)
+		}
+	}
+	throttled, ok := throttledBy(f.attempt("alice", "192.0.2.1"))
+	if !ok || throttled.Err != ErrTooManyAttempts || throttled.RetryAfter != LockoutDuration {
+		t.Fatalf("got %v after %d failures, want the address locked", throttled, IPLockThreshold)
+	}
+	if err := f.service.CheckAccount("alice"); err != nil {
+		t.Fatalf("the account was locked with the address: %v", err)
+	}
+	if err := f.attempt("alice", "198.51.100.1"); err != nil {
+		t.Fatalf("another address was refused: %v", err)
+	}
+	if len(f.mail.messages) != 0 {
+		t.Fatalf("%d unlock emails sent for an address lockout", len(f.mail.messages))
+	}
+}
+
+func TestSucceededResetsTheAccount(t *testing.T) {
+	f := newLoginAttemptFixture()
+	for i := 0; i < AccountLockThreshold; i++ {
+		if err := f.attempt("alice", "192.0.2.1"); err != nil {
+			t.Fatalf("attempt %d refused: %v", i+1, err)
+		}
+	}
+	f.service.Succeeded("alice", "192.0.2.1")
+
+	account, _ := f.service.repo.Get(accountKey("alice"))
+	address, _ := f.service.repo.Get(ipKey("192.0.2.1"))
+	if account.Failures != 0 || address.Failures != AccountLockThreshold-1 {
+		t.Fatalf("%d account and %d address failures left, want 0 and %d",
+			account.Failures, address.Failures, AccountLockThreshold-1)
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"common/module/logger"
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	MfaTicketDuration       = 5 * time.Minute
+	MaxSecondFactorAttempts = 5
+	mfaTicketAudience       = "mfa"
+)
+
+var (
+	ErrMfaTicketInvalid     = errors.New("mfa ticket invalid")
+	ErrMfaTicketUsed        = errors.New("mfa ticket already used")
+	ErrSecondFactorRequired = errors.New("second factor required")
+	ErrNoSecondFactor       = errors.New("second factor not enabled")
+)
+
+// MfaTicketClaims is what a ticket proves: that Subject passed the password
+// check and, if SecondFactor is set, still owes a second factor.
+type MfaTicketClaims struct {
+	SecondFactor bool `json:"secondFactor"`
+	jwt.StandardClaims
+}
+
+// MfaTicketService drives multi-step logins. The password step gets a
+// ticket, and only a ticket (plus the second factor when the user has one)
+// can be redeemed for a session. Tickets are HMAC-signed so they can never
+// pass as access tokens, which services accept only with asymmetric keys.
+type MfaTicketService struct {
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	repo     repositories.MfaTicketRepository
+	secret   []byte
+}
+
+func NewMfaTicketService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.MfaTicketRepository, secret []byte) *MfaTicketService {
+	return &MfaTicketService{logInfo, logError, repo, secret}
+}
+
+// Issue hands out a ticket once the password of username has been checked.
+func (s *MfaTicketService) Issue(username string, secondFactor bool, ip string) (string, time.Time, error) {
+	now := time.Now()
+	ticket := model.MfaTicket{
+		ID:           uuid.New(),
+		Username:     username,
+		SecondFactor: secondFactor,
+		ExpiresAt:    now.Add(MfaTicketDuration),
+		Attempts:     0,
+		Used:         false,
+	}
+	err := s.repo.Create(&ticket)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := &MfaTicketClaims{
+		SecondFactor: secondFactor,
+		StandardClaims: jwt.StandardClaims{
+			Id:        ticket.ID.String(),
+			Subject:   username,
+			Audience:  mfaTicketAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: ticket.ExpiresAt.Unix(),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.audit(claims, ip, "PASSWORD VERIFIED, TICKET ISSUED")
+	return signed, ticket.ExpiresAt, nil
+}
+
+// Verify checks a ticket's signature and that it can still be redeemed.
+func (s *MfaTicketService) Verify(ticketString string, ip string) (*MfaTicketClaims, error) {
+	claims := &MfaTicketClaims{}
+	_, err := jwt.ParseWithClaims(ticketString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrMfaTicketInvalid
+		}
+		return s.secret, nil
+	})
+	if err != nil || !claims.VerifyAudience(mfaTicketAudience, true) {
+		s.reject(claims, ip, "INVALID")
+		return nil, ErrMfaTicketInvalid
+	}
+
+	id, err := uuid.Parse(claims.Id)
+	if err != nil {
+		s.reject(claims, ip, "INVALID")
+		return nil, ErrMfaTicketInvalid
+	}
+	ticket, err := s.repo.Get(id)
+	if err != nil || ticket.Username != claims.Subject {
+		s.reject(claims, ip, "UNKNOWN")
+		return nil, ErrMfaTicketInvalid
+	}
+	if ticket.Used {
+		s.reject(claims, ip, "ALREADY USED")
+		return nil, ErrMfaTicketUsed
+	}
+	return claims, nil
+}
+
+// RedeemWithoutSecondFactor finishes a login for a user without 2FA.
+func (s *MfaTicketService) RedeemWithoutSecondFactor(claims *MfaTicketClaims, ip string) error {
+	if claims.SecondFactor {
+		s.reject(claims, ip, "SECOND FACTOR SKIPPED")
+		return ErrSecondFactorRequired
+	}
+	return s.redeem(claims, ip)
+}
+
+// RedeemWithSecondFactor finishes a login once the second factor checked
+// out. secondFactorValid is the outcome of that check; failures are counted
+// and burn the ticket after MaxSecondFactorAttempts.
+func (s *MfaTicketService) RedeemWithSecondFactor(claims *MfaTicketClaims, secondFactorValid bool, ip string) error {
+	if !claims.SecondFactor {
+		s.reject(claims, ip, "NO SECOND FACTOR EXPECTED")
+		return ErrNoSecondFactor
+	}
+	if !secondFactorValid {
+		id, _ := uuid.Parse(claims.Id)
+		attempts, err := s.repo.IncrementAttempts(id)
+		if err != nil {
+			return err
+		}
+		s.reject(claims, ip, "SECOND FACTOR FAILED")
+		if attempts >= MaxSecondFactorAttempts {
+			_, err = s.repo.MarkUsed(id)
+			if err != nil {
+				return err
+			}
+			s.reject(claims, ip, "TOO MANY SECOND FACTOR ATTEMPTS, TICKET BURNED")
+		}
+		return ErrInvalidTwoFactorCode
+	}
+	s.audit(claims, ip, "SECOND FACTOR VERIFIED")
+	return s.redeem(claims, ip)
+}
+
+func (s *MfaTicketService) redeem(claims *MfaTicketClaims, ip string) error {
+	id, _ := uuid.Parse(claims.Id)
+	marked, err := s.repo.MarkUsed(id)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		s.reject(claims, ip, "ALREADY USED")
+		return ErrMfaTicketUsed
+	}
+	s.audit(claims, ip, "TICKET REDEEMED, SESSION ISSUED")
+	return nil
+}
+
+func (s *MfaTicketService) audit(claims *MfaTicketClaims, ip string, step string) {
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user":   claims.Subject,
+		"userIP": ip,
+		"ticket": claims.Id,
+	}).Infof("INFO:MFA LOGIN: %s", step)
+}
+
+func (s *MfaTicketService) reject(claims *MfaTicketClaims, ip string, reason string) {
+	s.logError.Logger.WithFields(logrus.Fields{
+		"user":   claims.Subject,
+		"userIP": ip,
+		"ticket": claims.Id,
+	}).Errorf("ERR:MFA LOGIN: TICKET REJECTED: %s", reason)
+}
@@ -2,14 +2,13 @@ package services
 
 import (
 	"common/module/logger"
+	"common/module/mailer"
+	"common/module/onetimecode"
 	"context"
 	"errors"
-	"fmt"
 	modelGateway "gateway/module/domain/model"
-	"gateway/module/domain/repositories"
-	"github.com/google/uuid"
-	courier "github.com/trycourier/courier-go/v2"
-	"math/rand"
+	"github.com/sirupsen/logrus"
+	"net/url"
 	"regexp"
 	"time"
 )
@@ -17,7 +16,14 @@ import (
 type PasswordLessService struct {
 	logInfo  *logger.Logger
 	logError *logger.Logger
-	repo     repositories.LoginVerificationRepository
+	codes    *onetimecode.Manager
+	mail     mailer.Mailer
+}
+
+var PasswordlessLinkPolicy = onetimecode.Policy{
+	Purpose:     onetimecode.PasswordlessLogin,
+	TTL:         10 * time.Minute,
+	MaxAttempts: 1,
 }
 
 var (
@@ -25,49 +31,16 @@ var (
 	ErrInvalidMail        = errors.New("invalid mail")
 	ErrInvalidRedirectUri = errors.New("invalid redirect uri")
 	ErrInvalidVerCode     = errors.New("invalid verification code")
-	ErrCodeFlagUsed       = errors.New("code flag used")
-	ErrCodeUsed           = errors.New("code used")
-	ErrCodeExpired        = errors.New("code expired")
 )
 
-const authToken = "pk_prod_0FQXVBPMDHMZ3VJ3WN6CYC12KNMH"
-
-func NewPasswordLessService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.LoginVerificationRepository) *PasswordLessService {
-	return &PasswordLessService{logInfo, logError, repo}
+func NewPasswordLessService(logInfo *logger.Logger, logError *logger.Logger, codes *onetimecode.Manager, mail mailer.Mailer) *PasswordLessService {
+	return &PasswordLessService{logInfo, logError, codes, mail}
 
 }
 
-func (s *PasswordLessService) GetUsernameByCode(code string) (*modelGateway.LoginVerification, error) {
-	ver, er := s.repo.GetVerificationByCode(code)
-	return ver, er
-
-}
-
-func sendMailWithCourier(email string, code string, subject string, body string) {
-	client := courier.CreateClient(authToken, nil)
-	fmt.Println(code)
-	requestID, err := client.SendMessage(
-		context.Background(),
-		courier.SendMessageRequestBody{
-			Message: map[string]interface{}{
-				"to": map[string]string{
-					"email": email,
-				},
-				"content": map[string]string{
-					"title": subject,
-					"body":  body + code,
-				},
-				"data": map[string]string{
-					"joke": "What did C++ say to C? You have no class.",
-					"code": code,
-				},
-			},
-		})
-
-	if err != nil {
-		fmt.Println(err)
-	}
-	fmt.Println(requestID)
+// GetUsernameByCode tells whom a magic link was sent to, without using it up.
+func (s *PasswordLessService) GetUsernameByCode(token string) (string, error) {
+	return s.codes.ParseLink(PasswordlessLinkPolicy, token)
 }
 
 func BadEmail(input string) bool {
@@ -81,43 +54,26 @@ func (s *PasswordLessService) SendLink(ctx context.Context, redirectURI, origin
 		return ErrInvalidMail
 	}
 
-	var verificationCode string
-	rand.Seed(time.Now().UnixNano())
-	rn := rand.Intn(100000)
-	verificationCode = fmt.Sprintf("%d", rn)
-
-	loginVerification := modelGateway.LoginVerification{
-		ID:       uuid.New(),
-		Username: user.Username,
-		Email:    user.Email,
-		VerCode:  verificationCode,
-		Time:     time.Now(),
-		Used:     false,
+	token, err := s.codes.IssueLink(PasswordlessLinkPolicy, user.Username)
+	if err != nil {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user": user.Username,
+		}).Errorf("ERR:ISSUING PASSWORDLESS LINK: %v", err)
+		return err
 	}
 
-	ver, err := s.repo.CreateEmailVerification(&loginVerification)
-	fmt.Println(ver)
-	fmt.Println(err)
-
-	defer sendMailWithCourier(user.Email, loginVerification.VerCode, "Passwordless login", "Here is your code :")
-
-	return nil
+	message, err := mailer.PasswordlessEmail(user.Email, mailer.PasswordlessData{
+		Username:  user.Username,
+		Link:      redirectURI + "/login?magic=" + url.QueryEscape(token),
+		ExpiresIn: PasswordlessLinkPolicy.TTL,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mail.Send(ctx, message)
 }
 
-func (s *PasswordLessService) PasswordlessLogin(ver *modelGateway.LoginVerification) (bool, error) {
-
-	if ver.Time.Add(time.Minute * 3).After(time.Now()) {
-		if !ver.Used {
-			changePassErr := s.repo.UsedCode(ver)
-			if changePassErr != nil {
-				return false, ErrCodeFlagUsed
-			}
-
-		} else {
-			return false, ErrCodeUsed
-		}
-	} else {
-		return false, ErrCodeExpired
-	}
-	return true, nil
+// PasswordlessLogin uses up a magic link and returns the user it logs in.
+func (s *PasswordLessService) PasswordlessLogin(token string) (string, error) {
+	return s.codes.RedeemLink(PasswordlessLinkPolicy, token)
 }
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"common/module/logger"
+	"fmt"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callers are limited by class: anonymous callers by address, callers with
+// a user token by username, and callers of routes authenticated by an API
+// token by address, as the gateway can't verify those tokens. Every request
+// also takes a token of its address before it is authorized, so floods of
+// bad tokens are limited too.
+const (
+	RateLimitAnonymous     = "anonymous"
+	RateLimitAuthenticated = "authenticated"
+	RateLimitApiToken      = "apiToken"
+	RateLimitAddress       = "address"
+)
+
+// RateLimit lets a caller make Requests requests per Period, in bursts of
+// up to Requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseRateLimit parses limits written as "requests/period", like "60/1m".
+func ParseRateLimit(limit string) (RateLimit, error) {
+	requests, period, ok := strings.Cut(limit, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q: want requests/period", limit)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: invalid requests", limit)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: invalid period", limit)
+	}
+	return RateLimit{Requests: n, Period: d}, nil
+}
+
+// RateLimitDecision is the outcome of a request against its bucket. Reset
+// is how long the bucket takes to fill up again, RetryAfter how long a
+// refused caller has to wait for the next token.
+type RateLimitDecision struct {
+	Allowed    bool
+	Limit      RateLimit
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+	// FirstRefusal is set on the refusal that started a run of them.
+	FirstRefusal bool
+}
+
+// RateLimitService keeps a token bucket per caller. Buckets refill
+// continuously at Requests per Period.
+type RateLimitService struct {
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	repo     repositories.RateLimitRepository
+	limits   map[string]RateLimit
+}
+
+func NewRateLimitService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RateLimitRepository,
+	limits map[string]RateLimit) *RateLimitService {
+	return &RateLimitService{logInfo, logError, repo, limits}
+}
+
+// Start periodically forgets buckets that have been full for a while.
+func (s *RateLimitService) Start() {
+	longest := time.Minute
+	for _, limit := range s.limits {
+		if limit.Period > longest {
+			longest = limit.Period
+		}
+	}
+	go func() {
+		for range time.Tick(longest) {
+			err := s.repo.DeleteIdleSince(time.Now().Add(-2 * longest))
+			if err != nil {
+				s.logError.Logger.Errorf("ERR:CLEANING RATE LIMIT BUCKETS: %v", err)
+			}
+		}
+	}()
+}
+
+// Take takes a token from the bucket of caller in class.
+func (s *RateLimitService) Take(class string, caller string) (*RateLimitDecision, error) {
+	limit, ok := s.limits[class]
+	if !ok {
+		return nil, fmt.Errorf("no rate limit for class %s", class)
+	}
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+	decision := &RateLimitDecision{Limit: limit}
+
+	now := time.Now()
+	bucket, err := s.repo.Update(class+":"+caller, func(bucket *model.RateLimitBucket) {
+		if bucket.Refilled.IsZero() {
+			bucket.Tokens = capacity
+		} else {
+			refilled := now.Sub(bucket.Refilled).Seconds() / perToken.Seconds()
+			bucket.Tokens = math.Min(capacity, bucket.Tokens+refilled)
+		}
+		bucket.Refilled = now
+
+		decision.Allowed = bucket.Tokens >= 1
+		if decision.Allowed {
+			bucket.Tokens--
+			bucket.Throttled = false
+			return
+		}
+		decision.FirstRefusal = !bucket.Throttled
+		bucket.Throttled = true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	decision.Remaining = int(bucket.Tokens)
+	decision.Reset = time.Duration((capacity - bucket.Tokens) * float64(perToken))
+	if !decision.Allowed {
+		decision.RetryAfter = time.Duration((1 - bucket.Tokens) * float64(perToken))
+	}
+	return decision, nil
+}
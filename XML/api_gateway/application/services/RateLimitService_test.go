@@ -0,0 +1,112 @@
+package services
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/infrastructure/persistance"
+	"testing"
+	"time"
+)
+
+// testLimit hands out a token every 20 seconds.
+var testLimit = RateLimit{Requests: 3, Period: time.Minute}
+
+type rateLimitFixture struct {
+	service *RateLimitService
+}
+
+func newRateLimitFixture() *rateLimitFixture {
+	discard, _ := discardLogger()
+	return &rateLimitFixture{NewRateLimitService(discard, discard, persistance.NewRateLimitRepositoryInMemory(),
+		map[string]RateLimit{RateLimitAnonymous: testLimit})}
+}
+
+// wait makes the bucket of caller refill as if elapsed had passed.
+func (f *rateLimitFixture) wait(t *testing.T, caller string, elapsed time.Duration) {
+	_, err := f.service.repo.Update(RateLimitAnonymous+":"+caller, func(bucket *model.RateLimitBucket) {
+		bucket.Refilled = bucket.Refilled.Add(-elapsed)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *rateLimitFixture) take(t *testing.T, caller string) *RateLimitDecision {
+	decision, err := f.service.Take(RateLimitAnonymous, caller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decision
+}
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("60/1m")
+	if err != nil || limit != (RateLimit{Requests: 60, Period: time.Minute}) {
+		t.Fatalf("parsed %+v: %v", limit, err)
+	}
+	for _, invalid := range []string{"60", "0/1m", "x/1m", "60/0s", "60/x"} {
+		if _, err := ParseRateLimit(invalid); err == nil {
+			t.Errorf("parsed %q", invalid)
+		}
+	}
+}
+
+func TestTakeUntilTheBucketIsEmpty(t *testing.T) {
+	f := newRateLimitFixture()
+	for i := 1; i <= testLimit.Requests; i++ {
+		decision := f.take(t, "ip:192.0.2.1")
+		if !decision.Allowed || decision.Remaining != testLimit.Requests-i {
+			t.Fatalf("request %d: allowed %v with %d remaining", i, decision.Allowed, decision.Remaining)
+		}
+	}
+
+	refused := f.take(t, "ip:192.0.2.1")
+	if refused.Allowed || !refused.FirstRefusal {
+		t.Fatalf("got %+v for an empty bucket, want the first refusal", refused)
+	}
+	// The next token is at most 20 seconds away, and the bucket is full a
+	// minute after it was emptied.
+	if refused.RetryAfter <= 19*time.Second || refused.RetryAfter > 20*time.Second {
+		t.Fatalf("retry after %v, want about 20s", refused.RetryAfter)
+	}
+	if refused.Reset <= 59*time.Second || refused.Reset > time.Minute {
+		t.Fatalf("reset in %v, want about a minute", refused.Reset)
+	}
+	if again := f.take(t, "ip:192.0.2.1"); again.Allowed || again.FirstRefusal {
+		t.Fatalf("got %+v refusing again, want a refusal that isn't the first", again)
+	}
+
+	if other := f.take(t, "ip:198.51.100.1"); !other.Allowed {
+		t.Fatal("another caller was refused")
+	}
+}
+
+func TestTakeRefills(t *testing.T) {
+	f := newRateLimitFixture()
+	for i := 0; i <= testLimit.Requests; i++ {
+		f.take(t, "ip:192.0.2.1")
+	}
+
+	f.wait(t, "ip:192.0.2.1", 20*time.Second)
+	decision := f.take(t, "ip:192.0.2.1")
+	if !decision.Allowed || decision.Remaining != 0 {
+		t.Fatalf("got %+v a token later, want one request through", decision)
+	}
+	refused := f.take(t, "ip:192.0.2.1")
+	if refused.Allowed || !refused.FirstRefusal {
+		t.Fatalf("got %+v, want a new run of refusals", refused)
+	}
+
+	// Waiting longer than the period fills the bucket, and no more.
+	f.wait(t, "ip:192.0.2.1", time.Hour)
+	decision = f.take(t, "ip:192.0.2.1")
+	if !decision.Allowed || decision.Remaining != testLimit.Requests-1 {
+		t.Fatalf("got %+v after an hour, want a full bucket", decision)
+	}
+}
+
+func TestTakeUnknownClass(t *testing.T) {
+	f := newRateLimitFixture()
+	if _, err := f.service.Take(RateLimitApiToken, "ip:192.0.2.1"); err == nil {
+		t.Fatal("took a token of a class without a limit")
+	}
+}
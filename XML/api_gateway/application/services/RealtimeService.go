@@ -0,0 +1,182 @@
+package services
+
+import (
+	"common/module/interceptor"
+	"common/module/logger"
+	events "common/module/saga/realtime_events"
+	revocationEvents "common/module/saga/revocation_events"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// realtimeStreamBuffer is how many events a connection may fall behind
+// before it is dropped. Dropped clients reconnect and resume.
+const realtimeStreamBuffer = 64
+
+// RealtimeStream is one open connection of a user. Events is closed when the
+// stream is dropped for falling behind or the token it was opened with is
+// revoked.
+type RealtimeStream struct {
+	Events chan *events.RealtimeEvent
+	token  *interceptor.JwtClaims
+}
+
+type recentEvent struct {
+	event    *events.RealtimeEvent
+	received time.Time
+}
+
+type realtimeUser struct {
+	recent  []recentEvent
+	streams map[*RealtimeStream]bool
+}
+
+// RealtimeService delivers the events services publish to the connections
+// of their recipient. Every gateway instance receives every event, so each
+// keeps the last few events of every user and a client can resume on any
+// of them after reconnecting.
+type RealtimeService struct {
+	logInfo   *logger.Logger
+	replay    int
+	retention time.Duration
+	mutex     sync.Mutex
+	users     map[string]*realtimeUser
+}
+
+func NewRealtimeService(logInfo *logger.Logger, replay int, retention time.Duration) *RealtimeService {
+	return &RealtimeService{
+		logInfo:   logInfo,
+		replay:    replay,
+		retention: retention,
+		users:     map[string]*realtimeUser{},
+	}
+}
+
+// Start periodically forgets events older than the retention.
+func (s *RealtimeService) Start() {
+	go func() {
+		for range time.Tick(s.retention / 4) {
+			s.expire(time.Now().Add(-s.retention))
+		}
+	}()
+}
+
+// Subscribe opens a stream for the owner of token. It also returns the
+// retained events the client missed: those after lastEventId, or all of them
+// when the id is no longer known. A client that has nothing to resume from
+// passes "" and gets none.
+func (s *RealtimeService) Subscribe(token *interceptor.JwtClaims, lastEventId string) (*RealtimeStream, []*events.RealtimeEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := s.user(token.Username)
+	stream := &RealtimeStream{Events: make(chan *events.RealtimeEvent, realtimeStreamBuffer), token: token}
+	user.streams[stream] = true
+
+	if lastEventId == "" {
+		return stream, nil
+	}
+	start := 0
+	for i, recent := range user.recent {
+		if recent.event.Id.String() == lastEventId {
+			start = i + 1
+			break
+		}
+	}
+	missed := make([]*events.RealtimeEvent, 0, len(user.recent)-start)
+	for _, recent := range user.recent[start:] {
+		missed = append(missed, recent.event)
+	}
+	return stream, missed
+}
+
+func (s *RealtimeService) Unsubscribe(username string, stream *RealtimeStream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user, ok := s.users[username]
+	if !ok || !user.streams[stream] {
+		return
+	}
+	delete(user.streams, stream)
+	close(stream.Events)
+}
+
+// Deliver retains event for its recipient and passes it to their streams.
+func (s *RealtimeService) Deliver(event *events.RealtimeEvent) {
+	if event.Recipient == "" {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := s.user(event.Recipient)
+	user.recent = append(user.recent, recentEvent{event: event, received: time.Now()})
+	if len(user.recent) > s.replay {
+		user.recent = user.recent[len(user.recent)-s.replay:]
+	}
+	for stream := range user.streams {
+		select {
+		case stream.Events <- event:
+		default:
+			delete(user.streams, stream)
+			close(stream.Events)
+			s.logInfo.Logger.WithFields(logrus.Fields{
+				"user": event.Recipient,
+			}).Infof("INFO:DROPPED SLOW REALTIME STREAM")
+		}
+	}
+}
+
+// Revoke closes the streams opened with a token the revocation applies to,
+// the way the revocation list judges them.
+func (s *RealtimeService) Revoke(event *revocationEvents.RevocationEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for username, user := range s.users {
+		for stream := range user.streams {
+			if !revokes(event, stream.token) {
+				continue
+			}
+			delete(user.streams, stream)
+			close(stream.Events)
+			s.logInfo.Logger.WithFields(logrus.Fields{
+				"user": username,
+			}).Infof("INFO:CLOSED REVOKED REALTIME STREAM")
+		}
+	}
+}
+
+func revokes(event *revocationEvents.RevocationEvent, token *interceptor.JwtClaims) bool {
+	switch event.Type {
+	case revocationEvents.RevokeToken:
+		return event.TokenId != "" && event.TokenId == token.Id
+	case revocationEvents.RevokeSession:
+		return event.SessionId != "" && event.SessionId == token.SessionId
+	case revocationEvents.RevokeUserSessions:
+		return event.Username == token.Username && token.IssuedAt < event.RevokedAt.Unix()
+	}
+	return false
+}
+
+func (s *RealtimeService) user(username string) *realtimeUser {
+	user, ok := s.users[username]
+	if !ok {
+		user = &realtimeUser{streams: map[*RealtimeStream]bool{}}
+		s.users[username] = user
+	}
+	return user
+}
+
+func (s *RealtimeService) expire(before time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for username, user := range s.users {
+		expired := 0
+		for expired < len(user.recent) && user.recent[expired].received.Before(before) {
+			expired++
+		}
+		user.recent = user.recent[expired:]
+		if len(user.recent) == 0 && len(user.streams) == 0 {
+			delete(s.users, username)
+		}
+	}
+}
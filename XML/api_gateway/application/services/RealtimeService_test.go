@@ -0,0 +1,90 @@
+package services
+
+import (
+	"common/module/interceptor"
+	events "common/module/saga/realtime_events"
+	revocationEvents "common/module/saga/revocation_events"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func realtimeToken(username string, tokenId string, sessionId string, issuedAt time.Time) *interceptor.JwtClaims {
+	return &interceptor.JwtClaims{
+		Username:       username,
+		SessionId:      sessionId,
+		StandardClaims: jwt.StandardClaims{Id: tokenId, IssuedAt: issuedAt.Unix()},
+	}
+}
+
+// open reports whether stream is still open, draining any events it holds.
+func open(stream *RealtimeStream) bool {
+	for {
+		select {
+		case _, ok := <-stream.Events:
+			if !ok {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+func TestRealtimeSubscribeReplaysMissedEvents(t *testing.T) {
+	discard, _ := discardLogger()
+	service := NewRealtimeService(discard, 2, time.Hour)
+	var delivered []*events.RealtimeEvent
+	for i := 0; i < 3; i++ {
+		event := &events.RealtimeEvent{Id: uuid.New(), Recipient: "alice", Type: "notification"}
+		service.Deliver(event)
+		delivered = append(delivered, event)
+	}
+	token := realtimeToken("alice", "token", "session", time.Now())
+
+	if _, missed := service.Subscribe(token, ""); len(missed) != 0 {
+		t.Fatalf("a fresh client missed %d events", len(missed))
+	}
+	if _, missed := service.Subscribe(token, delivered[1].Id.String()); len(missed) != 1 || missed[0] != delivered[2] {
+		t.Fatalf("resumed with %v, want the last event", missed)
+	}
+	// The first event is no longer retained, so the client gets all there is.
+	if _, missed := service.Subscribe(token, delivered[0].Id.String()); len(missed) != 2 {
+		t.Fatalf("resumed with %d events, want the 2 retained", len(missed))
+	}
+}
+
+func TestRealtimeRevokeClosesStreams(t *testing.T) {
+	discard, _ := discardLogger()
+	now := time.Now()
+	cases := []struct {
+		name    string
+		event   *revocationEvents.RevocationEvent
+		revoked bool
+	}{
+		{"token", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeToken, TokenId: "token"}, true},
+		{"other token", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeToken, TokenId: "other"}, false},
+		{"session", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeSession, SessionId: "session"}, true},
+		{"other session", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeSession, SessionId: "other"}, false},
+		{"user", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeUserSessions, Username: "alice", RevokedAt: now.Add(time.Second)}, true},
+		{"user before the token", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeUserSessions, Username: "alice", RevokedAt: now.Add(-time.Second)}, false},
+		{"other user", &revocationEvents.RevocationEvent{Type: revocationEvents.RevokeUserSessions, Username: "carol", RevokedAt: now.Add(time.Second)}, false},
+	}
+	for _, c := range cases {
+		service := NewRealtimeService(discard, 10, time.Hour)
+		stream, _ := service.Subscribe(realtimeToken("alice", "token", "session", now), "")
+		other, _ := service.Subscribe(realtimeToken("bob", "bob-token", "bob-session", now), "")
+
+		service.Revoke(c.event)
+		if open(stream) == c.revoked {
+			t.Errorf("%s: stream open %v, want %v", c.name, c.revoked, !c.revoked)
+		}
+		if !open(other) {
+			t.Errorf("%s: closed another user's stream", c.name)
+		}
+		// Unsubscribing a closed stream is what the handler does on its way
+		// out; it must not close the channel again.
+		service.Unsubscribe("alice", stream)
+	}
+}
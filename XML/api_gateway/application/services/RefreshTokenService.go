@@ -0,0 +1,132 @@
+package services
+
+import (
+	"common/module/logger"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const RefreshTokenDuration = 7 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+type RefreshTokenService struct {
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	repo     repositories.RefreshTokenRepository
+}
+
+func NewRefreshTokenService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RefreshTokenRepository) *RefreshTokenService {
+	return &RefreshTokenService{logInfo, logError, repo}
+}
+
+// Issue starts the refresh-token family of a fresh login session.
+func (s *RefreshTokenService) Issue(username string, sessionID uuid.UUID) (string, time.Time, error) {
+	return s.issueInFamily(username, sessionID)
+}
+
+// Rotate exchanges a refresh token for a new one in the same family. A token
+// can be exchanged only once; presenting it again means it was stolen, so the
+// whole family is revoked and the owner has to log in again. The family ID
+// is returned as the session the token belongs to.
+func (s *RefreshTokenService) Rotate(refreshToken string) (string, uuid.UUID, string, time.Time, error) {
+	token, err := s.repo.GetByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		return "", uuid.Nil, "", time.Time{}, ErrRefreshTokenInvalid
+	}
+	if token.Revoked {
+		return "", uuid.Nil, "", time.Time{}, ErrRefreshTokenInvalid
+	}
+	if token.Used {
+		s.revokeReusedFamily(token)
+		return token.Username, token.FamilyID, "", time.Time{}, ErrRefreshTokenReused
+	}
+	if token.ExpiresAt.Before(time.Now()) {
+		return "", uuid.Nil, "", time.Time{}, ErrRefreshTokenExpired
+	}
+
+	marked, err := s.repo.MarkUsed(token)
+	if err != nil {
+		return "", uuid.Nil, "", time.Time{}, err
+	}
+	if !marked {
+		s.revokeReusedFamily(token)
+		return token.Username, token.FamilyID, "", time.Time{}, ErrRefreshTokenReused
+	}
+
+	newToken, expiresAt, err := s.issueInFamily(token.Username, token.FamilyID)
+	if err != nil {
+		return "", uuid.Nil, "", time.Time{}, err
+	}
+	return token.Username, token.FamilyID, newToken, expiresAt, nil
+}
+
+// Revoke invalidates every refresh token descended from the same login.
+func (s *RefreshTokenService) Revoke(refreshToken string) (string, error) {
+	token, err := s.repo.GetByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		return "", ErrRefreshTokenInvalid
+	}
+	err = s.repo.RevokeFamily(token.FamilyID)
+	if err != nil {
+		return "", err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user": token.Username,
+	}).Infof("INFO:REFRESH TOKEN FAMILY REVOKED")
+	return token.Username, nil
+}
+
+func (s *RefreshTokenService) issueInFamily(username string, familyID uuid.UUID) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	tokenString := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	token := model.RefreshToken{
+		ID:        uuid.New(),
+		FamilyID:  familyID,
+		Username:  username,
+		TokenHash: hashRefreshToken(tokenString),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(RefreshTokenDuration),
+		Used:      false,
+		Revoked:   false,
+	}
+	_, err = s.repo.Create(&token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, token.ExpiresAt, nil
+}
+
+func (s *RefreshTokenService) revokeReusedFamily(token *model.RefreshToken) {
+	s.logError.Logger.WithFields(logrus.Fields{
+		"user":   token.Username,
+		"family": token.FamilyID.String(),
+	}).Errorf("ERR:REFRESH TOKEN REUSE DETECTED")
+	err := s.repo.RevokeFamily(token.FamilyID)
+	if err != nil {
+		s.logError.Logger.Errorf("ERR:REVOKING REFRESH TOKEN FAMILY")
+	}
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
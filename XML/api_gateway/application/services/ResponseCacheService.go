@@ -0,0 +1,93 @@
+package services
+
+import (
+	"common/module/logger"
+	"crypto/sha256"
+	"encoding/hex"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"time"
+)
+
+// JobOffersCacheTag tags the list of every job offer.
+const JobOffersCacheTag = "jobOffers"
+
+func UserCacheTag(username string) string {
+	return "user:" + username
+}
+
+func PostCacheTag(id string) string {
+	return "post:" + id
+}
+
+// CacheRoute is how the responses of a route are cached. Responses of a
+// private route are only served back to the caller they were made for.
+type CacheRoute struct {
+	Private bool
+	Ttl     time.Duration
+	// Tags names what a response is made from, from the route's parameters.
+	Tags func(params map[string]string) []string
+}
+
+// ResponseCacheService keeps the responses of the read-heavy routes until
+// they expire or what they were made from changes.
+type ResponseCacheService struct {
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	repo     repositories.ResponseCacheRepository
+}
+
+func NewResponseCacheService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.ResponseCacheRepository) *ResponseCacheService {
+	return &ResponseCacheService{logInfo, logError, repo}
+}
+
+// Start periodically drops expired responses.
+func (s *ResponseCacheService) Start() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			err := s.repo.DeleteExpiredBefore(time.Now())
+			if err != nil {
+				s.logError.Logger.Errorf("ERR:CLEANING RESPONSE CACHE: %v", err)
+			}
+		}
+	}()
+}
+
+// Lookup returns the response stored under key, nil when there is none or
+// it expired.
+func (s *ResponseCacheService) Lookup(key string) (*model.CachedResponse, error) {
+	response, err := s.repo.Get(key)
+	if err != nil || response == nil || !time.Now().Before(response.ExpiresAt) {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Response makes the entry of a response of route, which expires after
+// the route's Ttl.
+func (s *ResponseCacheService) Response(key string, route CacheRoute, contentType string, body []byte) *model.CachedResponse {
+	now := time.Now()
+	return &model.CachedResponse{
+		Key:         key,
+		ContentType: contentType,
+		Body:        body,
+		ETag:        ETag(body),
+		StoredAt:    now,
+		ExpiresAt:   now.Add(route.Ttl),
+	}
+}
+
+func (s *ResponseCacheService) Store(response *model.CachedResponse, tags []string) error {
+	return s.repo.Save(response, tags)
+}
+
+// Invalidate drops every response tagged with tag.
+func (s *ResponseCacheService) Invalidate(tag string) error {
+	return s.repo.DeleteTagged(tag)
+}
+
+// ETag is a strong entity tag of body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"common/module/logger"
+	"common/module/revocation"
+	events "common/module/saga/revocation_events"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// RevocationService owns the persisted revocation store. Services only keep
+// an in-memory copy, which they rebuild from the events we re-broadcast.
+type RevocationService struct {
+	logInfo          *logger.Logger
+	logError         *logger.Logger
+	repo             repositories.RevocationRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+	revoker          *revocation.Revoker
+}
+
+func NewRevocationService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RevocationRepository,
+	refreshTokenRepo repositories.RefreshTokenRepository, revoker *revocation.Revoker) *RevocationService {
+	return &RevocationService{logInfo, logError, repo, refreshTokenRepo, revoker}
+}
+
+func (s *RevocationService) RevokeToken(tokenId string, expiresAt time.Time) error {
+	return s.revoker.RevokeToken(tokenId, expiresAt)
+}
+
+func (s *RevocationService) RevokeSession(sessionId uuid.UUID, expiresAt time.Time) error {
+	return s.revoker.RevokeSession(sessionId.String(), expiresAt)
+}
+
+func (s *RevocationService) RevokeUserSessions(username string) error {
+	return s.revoker.RevokeUserSessions(username)
+}
+
+// Store persists a revocation published by any service. Revoking a session,
+// or all sessions of a user, also kills the refresh tokens behind them so
+// they can't mint new tokens.
+func (s *RevocationService) Store(event *events.RevocationEvent) error {
+	err := s.repo.Save(&model.Revocation{
+		ID:        event.Id,
+		Type:      int8(event.Type),
+		TokenId:   event.TokenId,
+		SessionId: event.SessionId,
+		Username:  event.Username,
+		RevokedAt: event.RevokedAt,
+		ExpiresAt: event.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	if event.Type == events.RevokeSession {
+		familyID, err := uuid.Parse(event.SessionId)
+		if err != nil {
+			return err
+		}
+		return s.refreshTokenRepo.RevokeFamily(familyID)
+	}
+	if event.Type == events.RevokeUserSessions {
+		err = s.refreshTokenRepo.RevokeAllForUser(event.Username)
+		if err != nil {
+			return err
+		}
+		s.logInfo.Logger.WithFields(logrus.Fields{
+			"user": event.Username,
+		}).Infof("INFO:ALL SESSIONS REVOKED")
+	}
+	return nil
+}
+
+// Rebroadcast publishes every revocation that hasn't expired yet.
+func (s *RevocationService) Rebroadcast() error {
+	revocations, err := s.repo.GetActive(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, r := range revocations {
+		err = s.revoker.Publish(&events.RevocationEvent{
+			Id:        r.ID,
+			Type:      events.RevocationEventType(r.Type),
+			TokenId:   r.TokenId,
+			SessionId: r.SessionId,
+			Username:  r.Username,
+			RevokedAt: r.RevokedAt,
+			ExpiresAt: r.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
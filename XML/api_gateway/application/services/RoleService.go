@@ -0,0 +1,324 @@
+package services
+
+import (
+	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"sort"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrBuiltInRole       = errors.New("built-in roles can't be deleted")
+	ErrInvalidRoleName   = errors.New("role names are 2-32 letters, digits, '-' or '_'")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrNoRoles           = errors.New("a user needs at least one role")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrKeepsRoleManager  = errors.New("built-in roles keep the roles:manage permission the policy gives them")
+	ErrLastRoleManager   = errors.New("someone has to keep the roles:manage permission")
+)
+
+// ManageRoles is the permission to change roles and who holds them. The
+// service makes sure it can't be taken away from everyone.
+const ManageRoles = "roles:manage"
+
+var roleName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{1,31}$`)
+
+// RoleService owns roles, their permissions and who holds them. Every change
+// to a role is broadcast so the services' permission caches follow it; as
+// tokens carry only roles, the change applies to them right away.
+type RoleService struct {
+	logInfo           *logger.Logger
+	logError          *logger.Logger
+	repo              repositories.RoleRepository
+	userRepo          repositories.UserRepository
+	broadcaster       *permissions.Broadcaster
+	revocationService *RevocationService
+	policy            *policy.Policy
+}
+
+func NewRoleService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RoleRepository,
+	userRepo repositories.UserRepository, broadcaster *permissions.Broadcaster, revocationService *RevocationService,
+	policy *policy.Policy) *RoleService {
+	return &RoleService{logInfo, logError, repo, userRepo, broadcaster, revocationService, policy}
+}
+
+// Seed creates the built-in roles that aren't stored yet. Roles that are
+// stored keep whatever permissions admins gave them.
+func (s *RoleService) Seed() error {
+	for name, rolePermissions := range s.policy.Roles {
+		_, err := s.repo.Get(name)
+		if err == nil {
+			continue
+		}
+		err = s.repo.Save(&model.RoleDefinition{Name: name, Description: "Built-in role"}, rolePermissions)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RoleService) GetAll() ([]model.RoleDefinition, error) {
+	return s.repo.GetAll()
+}
+
+func (s *RoleService) KnownPermissions() []string {
+	return s.policy.Permissions()
+}
+
+func (s *RoleService) IsBuiltIn(name string) bool {
+	_, ok := s.policy.Roles[name]
+	return ok
+}
+
+// Save creates or updates a role, replacing its permissions.
+func (s *RoleService) Save(name string, description string, rolePermissions []string) error {
+	if !roleName.MatchString(name) {
+		return ErrInvalidRoleName
+	}
+	known := map[string]bool{}
+	for _, permission := range s.policy.Permissions() {
+		known[permission] = true
+	}
+	unique := map[string]bool{}
+	var cleaned []string
+	for _, permission := range rolePermissions {
+		if !known[permission] {
+			return ErrUnknownPermission
+		}
+		if !unique[permission] {
+			unique[permission] = true
+			cleaned = append(cleaned, permission)
+		}
+	}
+	sort.Strings(cleaned)
+	if !unique[ManageRoles] {
+		if contains(s.policy.Roles[name], ManageRoles) {
+			return ErrKeepsRoleManager
+		}
+		err := s.checkRoleManagerRemains(name, "", nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.repo.Save(&model.RoleDefinition{Name: name, Description: description}, cleaned)
+	if err != nil {
+		return err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"role":        name,
+		"permissions": cleaned,
+	}).Infof("INFO:ROLE SAVED")
+	return s.broadcaster.RoleUpdated(name, cleaned)
+}
+
+func (s *RoleService) Delete(name string) error {
+	if s.IsBuiltIn(name) {
+		return ErrBuiltInRole
+	}
+	err := s.checkRoleManagerRemains(name, "", nil)
+	if err != nil {
+		return err
+	}
+	err = s.repo.Delete(name)
+	if err != nil {
+		return ErrRoleNotFound
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"role": name,
+	}).Infof("INFO:ROLE DELETED")
+	return s.broadcaster.RoleDeleted(name)
+}
+
+// RolesOf returns the roles of username. Users nobody assigned roles to yet
+// hold just the role stored with their account.
+func (s *RoleService) RolesOf(username string) ([]string, error) {
+	roles, err := s.repo.GetUserRoles(username)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) > 0 {
+		return roles, nil
+	}
+	role, err := s.userRepo.GetUserRole(username)
+	if err != nil {
+		return nil, err
+	}
+	return []string{role}, nil
+}
+
+// UserRoles is RolesOf for users that have to exist.
+func (s *RoleService) UserRoles(username string) ([]string, error) {
+	err := s.userRepo.UserExists(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.RolesOf(username)
+}
+
+// PermissionsOf returns the union of the permissions of roles, sorted.
+// Roles that no longer exist grant nothing.
+func (s *RoleService) PermissionsOf(roles []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, name := range roles {
+		role, err := s.repo.Get(name)
+		if err != nil {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			if !seen[permission.Permission] {
+				seen[permission.Permission] = true
+				result = append(result, permission.Permission)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Assign replaces the roles of username. The roles are in the user's tokens,
+// so all of their sessions are revoked and they have to log in again.
+func (s *RoleService) Assign(username string, roles []string) error {
+	if len(roles) == 0 {
+		return ErrNoRoles
+	}
+	err := s.userRepo.UserExists(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	unique := map[string]bool{}
+	var cleaned []string
+	for _, name := range roles {
+		_, err = s.repo.Get(name)
+		if err != nil {
+			return ErrRoleNotFound
+		}
+		if !unique[name] {
+			unique[name] = true
+			cleaned = append(cleaned, name)
+		}
+	}
+	err = s.checkRoleManagerRemains("", username, cleaned)
+	if err != nil {
+		return err
+	}
+	err = s.repo.SetUserRoles(username, cleaned)
+	if err != nil {
+		return err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user":  username,
+		"roles": cleaned,
+	}).Infof("INFO:ROLES ASSIGNED")
+	return s.revocationService.RevokeUserSessions(username)
+}
+
+// checkRoleManagerRemains fails with ErrLastRoleManager when nobody would
+// hold ManageRoles once role stops granting it, or once username holds just
+// roles. Pass "" for the change that isn't made.
+func (s *RoleService) checkRoleManagerRemains(role string, username string, roles []string) error {
+	all, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	granted := map[string]bool{}
+	for _, definition := range all {
+		for _, permission := range definition.Permissions {
+			if permission.Permission == ManageRoles {
+				granted[definition.Name] = true
+			}
+		}
+	}
+	if role != "" && !granted[role] {
+		return nil
+	}
+	if username != "" {
+		held, err := s.RolesOf(username)
+		if err != nil {
+			return err
+		}
+		if !holdsAny(held, granted) || holdsAny(roles, granted) {
+			return nil
+		}
+	}
+	delete(granted, role)
+
+	// Users hold roles through assignments or, without any, through their
+	// account.
+	var managerRoles []string
+	for name := range granted {
+		managerRoles = append(managerRoles, name)
+	}
+	if len(managerRoles) == 0 {
+		return ErrLastRoleManager
+	}
+	candidates, err := s.repo.GetUsersWithRoles(managerRoles)
+	if err != nil {
+		return err
+	}
+	for _, name := range managerRoles {
+		holders, err := s.userRepo.GetUsernamesWithRole(name)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, holders...)
+	}
+	for _, candidate := range candidates {
+		if candidate == username {
+			continue
+		}
+		held, err := s.RolesOf(candidate)
+		if err != nil {
+			return err
+		}
+		if holdsAny(held, granted) {
+			return nil
+		}
+	}
+	return ErrLastRoleManager
+}
+
+func holdsAny(roles []string, wanted map[string]bool) bool {
+	for _, name := range roles {
+		if wanted[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Rebroadcast publishes every role, for services that just started.
+func (s *RoleService) Rebroadcast() error {
+	roles, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		rolePermissions := make([]string, 0, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			rolePermissions = append(rolePermissions, permission.Permission)
+		}
+		err = s.broadcaster.RoleUpdated(role.Name, rolePermissions)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"common/module/permissions"
+	"common/module/policy"
+	"common/module/revocation"
+	events "common/module/saga/revocation_events"
+	roleEvents "common/module/saga/role_events"
+	"errors"
+	"gateway/module/domain/model"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type roleRepositoryInMemory struct {
+	mutex       sync.Mutex
+	roles       map[string]model.RoleDefinition
+	assignments map[string][]string
+}
+
+func newRoleRepositoryInMemory() *roleRepositoryInMemory {
+	return &roleRepositoryInMemory{roles: map[string]model.RoleDefinition{}, assignments: map[string][]string{}}
+}
+
+func (r *roleRepositoryInMemory) GetAll() ([]model.RoleDefinition, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var roles []model.RoleDefinition
+	for _, role := range r.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *roleRepositoryInMemory) Get(name string) (*model.RoleDefinition, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	role, ok := r.roles[name]
+	if !ok {
+		return nil, errors.New("role not found")
+	}
+	return &role, nil
+}
+
+func (r *roleRepositoryInMemory) Save(role *model.RoleDefinition, rolePermissions []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	saved := model.RoleDefinition{Name: role.Name, Description: role.Description}
+	for _, permission := range rolePermissions {
+		saved.Permissions = append(saved.Permissions, model.RolePermission{RoleName: role.Name, Permission: permission})
+	}
+	r.roles[role.Name] = saved
+	return nil
+}
+
+func (r *roleRepositoryInMemory) Delete(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.roles[name]; !ok {
+		return errors.New("role not found")
+	}
+	delete(r.roles, name)
+	for username, roles := range r.assignments {
+		var kept []string
+		for _, role := range roles {
+			if role != name {
+				kept = append(kept, role)
+			}
+		}
+		r.assignments[username] = kept
+	}
+	return nil
+}
+
+func (r *roleRepositoryInMemory) GetUserRoles(username string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.assignments[username], nil
+}
+
+func (r *roleRepositoryInMemory) GetUsersWithRoles(roles []string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	wanted := map[string]bool{}
+	for _, role := range roles {
+		wanted[role] = true
+	}
+	var usernames []string
+	for username, assigned := range r.assignments {
+		if holdsAny(assigned, wanted) {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames, nil
+}
+
+func (r *roleRepositoryInMemory) SetUserRoles(username string, roles []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.assignments[username] = roles
+	return nil
+}
+
+type publisherInMemory struct {
+	mutex    sync.Mutex
+	messages []interface{}
+}
+
+func (p *publisherInMemory) Publish(message interface{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *publisherInMemory) last() interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.messages) == 0 {
+		return nil
+	}
+	return p.messages[len(p.messages)-1]
+}
+
+type roleFixture struct {
+	service     *RoleService
+	repo        *roleRepositoryInMemory
+	roleEvents  *publisherInMemory
+	revocations *publisherInMemory
+}
+
+// newRoleFixture seeds the built-in roles. alice is an admin through her
+// account, bob a regular user.
+func newRoleFixture(t *testing.T) *roleFixture {
+	discard, _ := discardLogger()
+	rolePolicy, err := policy.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := userRepositoryInMemory{users: map[string]*model.User{
+		"alice": {Username: "alice", Role: model.Admin},
+		"bob":   {Username: "bob", Role: model.Regular},
+	}}
+	f := &roleFixture{repo: newRoleRepositoryInMemory(), roleEvents: &publisherInMemory{}, revocations: &publisherInMemory{}}
+	revocationService := NewRevocationService(discard, discard, nil, nil, revocation.NewRevoker(f.revocations))
+	f.service = NewRoleService(discard, discard, f.repo, users, permissions.NewBroadcaster(f.roleEvents),
+		revocationService, rolePolicy)
+	if err := f.service.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *roleFixture) permissionsOf(t *testing.T, name string) []string {
+	role, err := f.repo.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, permission := range role.Permissions {
+		result = append(result, permission.Permission)
+	}
+	return result
+}
+
+func TestSeedKeepsChangedRoles(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Save("Regular", "Built-in role", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	if permissions := f.permissionsOf(t, "Regular"); len(permissions) != 0 {
+		t.Fatalf("seeding gave Regular back %v", permissions)
+	}
+}
+
+func TestSaveRole(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Save("x", "", nil); err != ErrInvalidRoleName {
+		t.Fatalf("got %v for a short name, want %v", err, ErrInvalidRoleName)
+	}
+	if err := f.service.Save("Moderator", "", []string{"no:such-permission"}); err != ErrUnknownPermission {
+		t.Fatalf("got %v for an unknown permission, want %v", err, ErrUnknownPermission)
+	}
+
+	err := f.service.Save("Moderator", "Moderates", []string{ManageRoles, "notification:create", ManageRoles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"notification:create", ManageRoles}
+	if got := f.permissionsOf(t, "Moderator"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("saved %v, want %v", got, want)
+	}
+	event, ok := f.roleEvents.last().(*roleEvents.RoleEvent)
+	if !ok || event.Type != roleEvents.RoleUpdated || event.Role != "Moderator" || !reflect.DeepEqual(event.Permissions, want) {
+		t.Fatalf("broadcast %+v, want the saved role", f.roleEvents.last())
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Delete("Admin"); err != ErrBuiltInRole {
+		t.Fatalf("got %v deleting a built-in role, want %v", err, ErrBuiltInRole)
+	}
+	if err := f.service.Delete("Moderator"); err != ErrRoleNotFound {
+		t.Fatalf("got %v deleting a missing role, want %v", err, ErrRoleNotFound)
+	}
+	if err := f.service.Save("Moderator", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.Delete("Moderator"); err != nil {
+		t.Fatal(err)
+	}
+	event, ok := f.roleEvents.last().(*roleEvents.RoleEvent)
+	if !ok || event.Type != roleEvents.RoleDeleted || event.Role != "Moderator" {
+		t.Fatalf("broadcast %+v, want the deletion", f.roleEvents.last())
+	}
+}
+
+func TestAssignRoles(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Assign("bob", nil); err != ErrNoRoles {
+		t.Fatalf("got %v for no roles, want %v", err, ErrNoRoles)
+	}
+	if err := f.service.Assign("carol", []string{"Regular"}); err != ErrUserNotFound {
+		t.Fatalf("got %v for a missing user, want %v", err, ErrUserNotFound)
+	}
+	if err := f.service.Assign("bob", []string{"Moderator"}); err != ErrRoleNotFound {
+		t.Fatalf("got %v for a missing role, want %v", err, ErrRoleNotFound)
+	}
+
+	roles, err := f.service.RolesOf("bob")
+	if err != nil || !reflect.DeepEqual(roles, []string{"Regular"}) {
+		t.Fatalf("bob holds %v before any assignment: %v", roles, err)
+	}
+	if err := f.service.Assign("bob", []string{"Agent", "Regular", "Agent"}); err != nil {
+		t.Fatal(err)
+	}
+	roles, err = f.service.UserRoles("bob")
+	if err != nil || !reflect.DeepEqual(roles, []string{"Agent", "Regular"}) {
+		t.Fatalf("bob holds %v: %v", roles, err)
+	}
+	event, ok := f.revocations.last().(*events.RevocationEvent)
+	if !ok || event.Type != events.RevokeUserSessions || event.Username != "bob" {
+		t.Fatalf("published %+v, want bob's sessions revoked", f.revocations.last())
+	}
+}
+
+func TestPermissionsOf(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Save("Moderator", "", []string{"notification:create"}); err != nil {
+		t.Fatal(err)
+	}
+	got := f.service.PermissionsOf([]string{"Moderator", "Admin", "Deleted"})
+	want := []string{"notification:create", ManageRoles}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := f.service.PermissionsOf(nil); len(got) != 0 {
+		t.Fatalf("no roles grant %v", got)
+	}
+}
+
+func TestBuiltInRolesKeepRoleManagement(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Save("Admin", "Built-in role", []string{"notification:create"}); err != ErrKeepsRoleManager {
+		t.Fatalf("got %v, want %v", err, ErrKeepsRoleManager)
+	}
+	if got := f.permissionsOf(t, "Admin"); !reflect.DeepEqual(got, []string{"notification:create", ManageRoles}) {
+		t.Fatalf("Admin was left with %v", got)
+	}
+}
+
+func TestLastRoleManager(t *testing.T) {
+	f := newRoleFixture(t)
+	if err := f.service.Assign("alice", []string{"Regular"}); err != ErrLastRoleManager {
+		t.Fatalf("got %v demoting the only admin, want %v", err, ErrLastRoleManager)
+	}
+	// Changes that don't touch role management go through.
+	if err := f.service.Assign("alice", []string{"Admin", "Agent"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.Assign("bob", []string{"Agent"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.service.Save("Owner", "", []string{ManageRoles}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.Assign("bob", []string{"Owner"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.Assign("alice", []string{"Regular"}); err != nil {
+		t.Fatalf("alice was refused although bob manages roles: %v", err)
+	}
+
+	if err := f.service.Save("Owner", "", nil); err != ErrLastRoleManager {
+		t.Fatalf("got %v taking role management from the only role that grants it, want %v", err, ErrLastRoleManager)
+	}
+	if err := f.service.Delete("Owner"); err != ErrLastRoleManager {
+		t.Fatalf("got %v deleting the only role that grants role management, want %v", err, ErrLastRoleManager)
+	}
+	if err := f.service.Assign("bob", []string{"Admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.Delete("Owner"); err != nil {
+		t.Fatalf("Owner can go once bob is an admin: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"common/module/logger"
+	notificationPb "common/module/proto/notification_service"
+	"context"
+	"errors"
+	"fmt"
+	"gateway/module/auth"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	LoginHistoryLimit  = 50
+	notificationSender = "Dislinkt"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService records every successful login and lets users see and end
+// their sessions. A session lives as long as its refresh-token family.
+type SessionService struct {
+	logInfo           *logger.Logger
+	logError          *logger.Logger
+	repo              repositories.LoginSessionRepository
+	revocationService *RevocationService
+	notifications     notificationPb.NotificationServiceClient
+}
+
+func NewSessionService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.LoginSessionRepository,
+	revocationService *RevocationService, notifications notificationPb.NotificationServiceClient) *SessionService {
+	return &SessionService{logInfo, logError, repo, revocationService, notifications}
+}
+
+// Start records a login. The user is notified when it comes from an address
+// or a device they never logged in from before.
+func (s *SessionService) Start(username string, method string, ip string, userAgent string) (*model.LoginSession, error) {
+	loggedInBefore, ipKnown, deviceKnown, err := s.repo.Known(username, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &model.LoginSession{
+		ID:         uuid.New(),
+		Username:   username,
+		Method:     method,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		LastSeenIP: ip,
+	}
+	err = s.repo.Create(session)
+	if err != nil {
+		return nil, err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user":    username,
+		"userIP":  ip,
+		"session": session.ID.String(),
+		"method":  method,
+	}).Infof("INFO:LOGIN RECORDED")
+
+	if loggedInBefore && (!ipKnown || !deviceKnown) {
+		go s.notifyNewDevice(session)
+	}
+	return session, nil
+}
+
+// Touch notes that a session was just used to refresh its tokens.
+func (s *SessionService) Touch(id uuid.UUID, ip string) {
+	err := s.repo.Touch(id, ip, time.Now())
+	if err != nil {
+		s.logError.Logger.Errorf("ERR:UPDATING SESSION %s: %v", id, err)
+	}
+}
+
+func (s *SessionService) GetActive(username string) ([]model.LoginSession, error) {
+	return s.repo.GetActive(username, time.Now())
+}
+
+func (s *SessionService) GetHistory(username string) ([]model.LoginSession, error) {
+	return s.repo.GetHistory(username, LoginHistoryLimit)
+}
+
+// Revoke ends one session of username: its refresh tokens stop working and
+// its access tokens are rejected until they would have expired anyway.
+func (s *SessionService) Revoke(username string, id uuid.UUID) error {
+	session, err := s.repo.Get(id)
+	if err != nil || session.Username != username {
+		return ErrSessionNotFound
+	}
+	err = s.revocationService.RevokeSession(session.ID, time.Now().Add(auth.TokenDuration))
+	if err != nil {
+		return err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user":    username,
+		"session": id.String(),
+	}).Infof("INFO:SESSION REVOKED")
+	return nil
+}
+
+func (s *SessionService) notifyNewDevice(session *model.LoginSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := s.notifications.Create(ctx, &notificationPb.NewNotificationRequest{
+		NewNotification: &notificationPb.NewNotification{
+			Content: fmt.Sprintf("New login to your account from %s (%s). If it wasn't you, end that session and change your password.",
+				session.IP, session.UserAgent),
+			From:             notificationSender,
+			To:               session.Username,
+			RedirectPath:     "/myProfile",
+			NotificationType: "SECURITY",
+		},
+	})
+	if err != nil {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user":    session.Username,
+			"session": session.ID.String(),
+		}).Errorf("ERR:NEW DEVICE NOTIFICATION NOT SENT: %v", err)
+	}
+}
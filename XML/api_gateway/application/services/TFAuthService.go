@@ -4,11 +4,18 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"errors"
+	"gateway/module/domain/model"
 	"gateway/module/domain/repositories"
 	"github.com/dgryski/dgoogauth"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	"log"
+	"strings"
+	"time"
 )
 
+const RecoveryCodeCount = 10
+
 type TFAuthService struct {
 	l          *log.Logger
 	repository repositories.TFAuthRepository
@@ -17,19 +24,30 @@ type TFAuthService struct {
 func NewTFAuthService(l *log.Logger, repository repositories.TFAuthRepository) *TFAuthService {
 	return &TFAuthService{l, repository}
 }
-func NewOTPConfig(secretBase32 string) *dgoogauth.OTPConfig {
+
+// NewOTPConfig refuses every time step up to lastUsedCounter, so a code that
+// was already accepted can't be replayed while it is still current.
+func NewOTPConfig(secretBase32 string, lastUsedCounter int) *dgoogauth.OTPConfig {
+	windowSize := 1
+	disallowReuse := make([]int, 0)
+	for t := currentCounter() - windowSize; t <= lastUsedCounter; t++ {
+		disallowReuse = append(disallowReuse, t)
+	}
 	return &dgoogauth.OTPConfig{
 		Secret:      secretBase32,
-		WindowSize:  1,
+		WindowSize:  windowSize,
 		HotpCounter: 0,
 		// UTC:         true,
-		DisallowReuse: make([]int, 0),
-		ScratchCodes:  make([]int, 0),
+		DisallowReuse: disallowReuse,
+		// Recovery codes are kept hashed in RecoveryCode instead.
+		ScratchCodes: make([]int, 0),
 	}
 }
 
 var (
-	TwoFactorEnabled = errors.New("two factor authentication already enabled ")
+	TwoFactorEnabled        = errors.New("two factor authentication already enabled ")
+	TwoFactorNotEnabled     = errors.New("two factor authentication not enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two factor code")
 )
 
 func GenerateNewUserSecret() []byte {
@@ -64,7 +82,7 @@ func (u TFAuthService) Enable2FaForUser(username string) (bool, string, error) {
 		return false, "", err
 	}
 
-	twofa := NewOTPConfig(secret)
+	twofa := NewOTPConfig(secret, 0)
 	uri := twofa.ProvisionURI(username)
 	//log.Println("This is URI: " + uri)
 	// No more writing to file
@@ -80,6 +98,127 @@ func (u TFAuthService) Enable2FaForUser(username string) (bool, string, error) {
 
 }
 
+// Confirm2FaForUser turns a pending enrollment on once the user has entered
+// a code from the authenticator, and hands out the first recovery codes.
+func (u TFAuthService) Confirm2FaForUser(username string, code string) ([]string, error) {
+	qr, err := u.repository.GetPendingQr(username)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := u.checkTotp(qr, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	err = u.repository.Confirm2FaForUser(username)
+	if err != nil {
+		return nil, err
+	}
+	return u.generateRecoveryCodes(username)
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes. A current
+// authenticator code is required.
+func (u TFAuthService) RegenerateRecoveryCodes(username string, code string) ([]string, error) {
+	qr, err := u.repository.GetUserQr(username)
+	if err != nil || qr.Secret == "" {
+		return nil, TwoFactorNotEnabled
+	}
+	valid, err := u.checkTotp(qr, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	return u.generateRecoveryCodes(username)
+}
+
+// Authenticate checks the second factor at login. Either a 6-digit code
+// from the authenticator or one of the recovery codes is accepted, each only
+// once.
+func (u TFAuthService) Authenticate(username string, code string) (bool, error) {
+	qr, err := u.repository.GetUserQr(username)
+	if err != nil || qr.Secret == "" {
+		return false, TwoFactorNotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		return u.checkTotp(qr, code)
+	}
+	return u.useRecoveryCode(username, code)
+}
+
+func (u TFAuthService) checkTotp(qr model.QrCode, code string) (bool, error) {
+	otpc := NewOTPConfig(qr.Secret, qr.LastUsedCounter)
+	valid, err := otpc.Authenticate(code)
+	if err != nil || !valid {
+		return false, err
+	}
+	counter := qr.LastUsedCounter
+	for _, t := range otpc.DisallowReuse {
+		if t > counter {
+			counter = t
+		}
+	}
+	return u.repository.UseCounter(qr, counter)
+}
+
+func (u TFAuthService) useRecoveryCode(username string, code string) (bool, error) {
+	code = normalizeRecoveryCode(code)
+	codes, err := u.repository.GetUnusedRecoveryCodes(username)
+	if err != nil {
+		return false, err
+	}
+	for _, recoveryCode := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(recoveryCode.CodeHash), []byte(code)) == nil {
+			return u.repository.UseRecoveryCode(recoveryCode)
+		}
+	}
+	return false, nil
+}
+
+func (u TFAuthService) generateRecoveryCodes(username string) ([]string, error) {
+	plain := make([]string, 0, RecoveryCodeCount)
+	codes := make([]model.RecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, code[:5]+"-"+code[5:])
+		codes = append(codes, model.RecoveryCode{
+			ID:       uuid.New(),
+			Username: username,
+			CodeHash: string(hash),
+			Used:     false,
+		})
+	}
+	err := u.repository.ReplaceRecoveryCodes(username, codes)
+	if err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToLower(code)
+}
+
+func currentCounter() int {
+	return int(time.Now().Unix() / 30)
+}
+
 func (u TFAuthService) Disable2FaForUser(username string) (bool, error) {
 	res, err := u.repository.Disable2FaForUser(username)
 
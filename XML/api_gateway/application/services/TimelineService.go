@@ -0,0 +1,120 @@
+package services
+
+import (
+	"common/module/interceptor"
+	"common/module/logger"
+	connectionPb "common/module/proto/connection_service"
+	postPb "common/module/proto/posts_service"
+	events "common/module/saga/timeline_events"
+	"context"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"time"
+)
+
+// timelineCallTimeout bounds each call the worker makes to the services.
+const timelineCallTimeout = 10 * time.Second
+
+// TokenIssuer signs tokens; the KeyManager is one.
+type TokenIssuer interface {
+	GenerateToken(claims *interceptor.JwtClaims) (string, time.Time, error)
+}
+
+// TimelineService is the timeline worker: it pushes every new post into the
+// timelines of its author's connections, backfills both timelines when two
+// users connect and clears them again when they disconnect.
+type TimelineService struct {
+	logInfo     *logger.Logger
+	logError    *logger.Logger
+	repo        repositories.TimelineRepository
+	posts       postPb.PostServiceClient
+	connections connectionPb.ConnectionServiceClient
+	tokens      TokenIssuer
+}
+
+func NewTimelineService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.TimelineRepository,
+	posts postPb.PostServiceClient, connections connectionPb.ConnectionServiceClient, tokens TokenIssuer) *TimelineService {
+	return &TimelineService{logInfo, logError, repo, posts, connections, tokens}
+}
+
+func (s *TimelineService) PostCreated(event *events.TimelineEvent) error {
+	ctx, cancel, err := s.serviceContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	connections, err := s.connections.GetConnections(ctx, &connectionPb.GetRequest{Username: event.Author})
+	if err != nil {
+		return err
+	}
+	entries := make([]model.TimelineEntry, 0, len(connections.Users))
+	for _, connection := range connections.Users {
+		entries = append(entries, model.TimelineEntry{
+			Owner:      connection.Username,
+			PostId:     event.Post,
+			Author:     event.Author,
+			DatePosted: event.DatePosted.UTC(),
+		})
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"postId":    event.Post,
+		"author":    event.Author,
+		"timelines": len(entries),
+	}).Infof("INFO:POST FANNED OUT")
+	return s.repo.Add(entries)
+}
+
+// UsersConnected backfills each user's timeline with the other's posts.
+func (s *TimelineService) UsersConnected(userOne string, userTwo string) error {
+	err := s.backfill(userOne, userTwo)
+	if err != nil {
+		return err
+	}
+	return s.backfill(userTwo, userOne)
+}
+
+func (s *TimelineService) UsersDisconnected(userOne string, userTwo string) error {
+	err := s.repo.RemoveAuthor(userOne, userTwo)
+	if err != nil {
+		return err
+	}
+	return s.repo.RemoveAuthor(userTwo, userOne)
+}
+
+func (s *TimelineService) backfill(owner string, author string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timelineCallTimeout)
+	defer cancel()
+	response, err := s.posts.GetAllByUsername(ctx, &postPb.GetRequest{Id: author})
+	if err != nil {
+		return err
+	}
+	return s.repo.Add(timelineEntries(owner, response.Posts))
+}
+
+// serviceContext authorizes the worker's own calls. There is no user whose
+// token it could forward, so it signs one for the gateway itself.
+func (s *TimelineService) serviceContext() (context.Context, context.CancelFunc, error) {
+	claims := &interceptor.JwtClaims{}
+	claims.Subject = "api_gateway"
+	token, _, err := s.tokens.GenerateToken(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timelineCallTimeout)
+	return metadata.AppendToOutgoingContext(ctx, "Authorization", "Bearer "+token), cancel, nil
+}
+
+func timelineEntries(owner string, posts []*postPb.Post) []model.TimelineEntry {
+	entries := make([]model.TimelineEntry, 0, len(posts))
+	for _, post := range posts {
+		entries = append(entries, model.TimelineEntry{
+			Owner:      owner,
+			PostId:     post.Id,
+			Author:     post.Username,
+			DatePosted: parsePostDate(post.DatePosted).UTC(),
+		})
+	}
+	return entries
+}
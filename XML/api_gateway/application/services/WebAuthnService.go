@@ -0,0 +1,371 @@
+package services
+
+import (
+	"bytes"
+	"common/module/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	WebAuthnSessionDuration = 5 * time.Minute
+
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+	ceremonySecondFactor = "second-factor"
+)
+
+var (
+	ErrWebAuthnSessionInvalid = errors.New("webauthn session invalid")
+	ErrWebAuthnCloned         = errors.New("webauthn authenticator may be cloned")
+)
+
+// WebAuthnService runs the registration and assertion ceremonies for
+// security keys and passkeys. A passkey can replace the password (BeginLogin)
+// or serve as the second factor after it (BeginSecondFactor).
+type WebAuthnService struct {
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	webAuthn *webauthn.WebAuthn
+	repo     repositories.WebAuthnRepository
+	userRepo repositories.UserRepository
+}
+
+func NewWebAuthnService(logInfo *logger.Logger, logError *logger.Logger, webAuthn *webauthn.WebAuthn,
+	repo repositories.WebAuthnRepository, userRepo repositories.UserRepository) *WebAuthnService {
+	return &WebAuthnService{logInfo, logError, webAuthn, repo, userRepo}
+}
+
+// webAuthnUser adapts a gateway user and their credentials to what the
+// webauthn library expects.
+type webAuthnUser struct {
+	user        *model.User
+	credentials []model.WebAuthnCredential
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+}
+
+func (u webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, credential := range u.credentials {
+		credentials = append(credentials, toLibraryCredential(credential))
+	}
+	return credentials
+}
+
+func (s *WebAuthnService) HasCredentials(username string) (bool, error) {
+	credentials, err := s.repo.GetCredentials(username)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+func (s *WebAuthnService) GetCredentials(username string) ([]model.WebAuthnCredential, error) {
+	return s.repo.GetCredentials(username)
+}
+
+func (s *WebAuthnService) RenameCredential(username string, id uuid.UUID, name string) error {
+	return s.repo.RenameCredential(id, username, name)
+}
+
+func (s *WebAuthnService) RemoveCredential(username string, id uuid.UUID) error {
+	err := s.repo.DeleteCredential(id, username)
+	if err != nil {
+		return err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user":       username,
+		"credential": id.String(),
+	}).Infof("INFO:WEBAUTHN CREDENTIAL REMOVED")
+	return nil
+}
+
+// BeginRegistration starts adding an authenticator for a logged-in user.
+// Resident keys are preferred so the credential can be used as a passkey.
+func (s *WebAuthnService) BeginRegistration(username string) (*protocol.CredentialCreation, uuid.UUID, error) {
+	user, err := s.loadUser(username)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	options, session, err := s.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	sessionID, err := s.saveSession(username, ceremonyRegistration, "", session)
+	return options, sessionID, err
+}
+
+func (s *WebAuthnService) FinishRegistration(username string, sessionID uuid.UUID, name string, body io.Reader) (*model.WebAuthnCredential, error) {
+	session, ceremony, err := s.takeSession(sessionID, ceremonyRegistration)
+	if err != nil || ceremony.Username != username {
+		return nil, ErrWebAuthnSessionInvalid
+	}
+	user, err := s.loadUser(username)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = "Security key"
+	}
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	now := time.Now()
+	stored := &model.WebAuthnCredential{
+		ID:              uuid.New(),
+		Username:        username,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		CreatedAt:       now,
+		LastUsedAt:      now,
+	}
+	err = s.repo.CreateCredential(stored)
+	if err != nil {
+		return nil, err
+	}
+	s.logInfo.Logger.WithFields(logrus.Fields{
+		"user":       username,
+		"credential": stored.ID.String(),
+	}).Infof("INFO:WEBAUTHN CREDENTIAL REGISTERED")
+	return stored, nil
+}
+
+// BeginLogin starts a passwordless login. Without a username the browser
+// offers whichever passkey it holds for this site.
+func (s *WebAuthnService) BeginLogin(username string) (*protocol.CredentialAssertion, uuid.UUID, error) {
+	verification := webauthn.WithUserVerification(protocol.VerificationRequired)
+	var options *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var err error
+	if username == "" {
+		options, session, err = s.webAuthn.BeginDiscoverableLogin(verification)
+	} else {
+		var user *webAuthnUser
+		user, err = s.loadUser(username)
+		if err != nil {
+			return nil, uuid.Nil, err
+		}
+		options, session, err = s.webAuthn.BeginLogin(user, verification)
+	}
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	sessionID, err := s.saveSession(username, ceremonyLogin, "", session)
+	return options, sessionID, err
+}
+
+// FinishLogin checks the assertion and returns the user it belongs to. User
+// verification is required, so the passkey alone is enough for a session.
+func (s *WebAuthnService) FinishLogin(sessionID uuid.UUID, body io.Reader) (string, error) {
+	session, stored, err := s.takeSession(sessionID, ceremonyLogin)
+	if err != nil {
+		return "", ErrWebAuthnSessionInvalid
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return "", err
+	}
+
+	var user *webAuthnUser
+	var credential *webauthn.Credential
+	if stored.Username == "" {
+		credential, err = s.webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			owner, err := s.repo.GetCredentialByCredentialID(rawID)
+			if err != nil {
+				return nil, err
+			}
+			user, err = s.loadUser(owner.Username)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(user.WebAuthnID(), userHandle) {
+				return nil, errors.New("user handle mismatch")
+			}
+			return user, nil
+		}, *session, parsed)
+	} else {
+		user, err = s.loadUser(stored.Username)
+		if err != nil {
+			return "", err
+		}
+		credential, err = s.webAuthn.ValidateLogin(user, *session, parsed)
+	}
+	if err != nil {
+		return "", err
+	}
+	err = s.recordUse(user.user.Username, credential)
+	if err != nil {
+		return "", err
+	}
+	return user.user.Username, nil
+}
+
+// BeginSecondFactor challenges the authenticators of a user who has passed
+// the password step. The ticket is kept with the session and handed back by
+// FinishSecondFactor.
+func (s *WebAuthnService) BeginSecondFactor(username string, ticket string) (*protocol.CredentialAssertion, uuid.UUID, error) {
+	user, err := s.loadUser(username)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	options, session, err := s.webAuthn.BeginLogin(user)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	sessionID, err := s.saveSession(username, ceremonySecondFactor, ticket, session)
+	return options, sessionID, err
+}
+
+// FinishSecondFactor returns the MFA ticket the ceremony was started with
+// and whether the assertion checked out.
+func (s *WebAuthnService) FinishSecondFactor(sessionID uuid.UUID, body io.Reader) (string, bool, error) {
+	session, stored, err := s.takeSession(sessionID, ceremonySecondFactor)
+	if err != nil {
+		return "", false, ErrWebAuthnSessionInvalid
+	}
+	user, err := s.loadUser(stored.Username)
+	if err != nil {
+		return stored.Ticket, false, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return stored.Ticket, false, nil
+	}
+	credential, err := s.webAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return stored.Ticket, false, nil
+	}
+	err = s.recordUse(stored.Username, credential)
+	if err != nil {
+		return stored.Ticket, false, err
+	}
+	return stored.Ticket, true, nil
+}
+
+func (s *WebAuthnService) recordUse(username string, credential *webauthn.Credential) error {
+	stored, err := s.repo.GetCredentialByCredentialID(credential.ID)
+	if err != nil || stored.Username != username {
+		return errors.New("credential not found")
+	}
+	if credential.Authenticator.CloneWarning {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"user":       username,
+			"credential": stored.ID.String(),
+		}).Errorf("ERR:WEBAUTHN SIGNATURE COUNTER WENT BACKWARDS, POSSIBLE CLONED AUTHENTICATOR")
+		return ErrWebAuthnCloned
+	}
+	return s.repo.UpdateCredentialUse(stored.ID, credential.Authenticator.SignCount, time.Now())
+}
+
+func (s *WebAuthnService) loadUser(username string) (*webAuthnUser, error) {
+	user, err := s.userRepo.GetByUsername(context.TODO(), username)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.repo.GetCredentials(username)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user, credentials}, nil
+}
+
+func (s *WebAuthnService) saveSession(username string, ceremony string, ticket string, session *webauthn.SessionData) (uuid.UUID, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	stored := &model.WebAuthnSession{
+		ID:        uuid.New(),
+		Username:  username,
+		Ceremony:  ceremony,
+		Data:      string(data),
+		Ticket:    ticket,
+		ExpiresAt: time.Now().Add(WebAuthnSessionDuration),
+	}
+	err = s.repo.CreateSession(stored)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return stored.ID, nil
+}
+
+func (s *WebAuthnService) takeSession(id uuid.UUID, ceremony string) (*webauthn.SessionData, *model.WebAuthnSession, error) {
+	stored, err := s.repo.TakeSession(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stored.Ceremony != ceremony || stored.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrWebAuthnSessionInvalid
+	}
+	session := &webauthn.SessionData{}
+	err = json.Unmarshal([]byte(stored.Data), session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, stored, nil
+}
+
+func toLibraryCredential(credential model.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0)
+	for _, transport := range strings.Split(credential.Transports, ",") {
+		if transport != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+	return webauthn.Credential{
+		ID:              credential.CredentialID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transport:       transports,
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    credential.AAGUID,
+			SignCount: credential.SignCount,
+		},
+	}
+}
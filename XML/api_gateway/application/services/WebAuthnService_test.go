@@ -0,0 +1,562 @@
+package services
+
+import (
+	"bytes"
+	"common/module/logger"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"gateway/module/domain/model"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "https://localhost:4200"
+)
+
+// softAuthenticator is a software authenticator with one P-256 credential.
+// It answers ceremonies the way a browser hands them to the gateway.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialID: id, origin: testOrigin}
+}
+
+func (a *softAuthenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.Challenge) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": challenge.String(),
+		"origin":    a.origin,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags protocol.AuthenticatorFlags, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, byte(flags))
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, a.signCount)
+	data = append(data, count...)
+	return append(data, attested...)
+}
+
+// create answers a registration with a "none" attestation.
+func (a *softAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) io.Reader {
+	a.userHandle = options.Response.User.ID
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1,
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(a.credentialID)))
+	attested = append(attested, length...)
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified | protocol.FlagAttestedCredentialData
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(flags, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.body(map[string]interface{}{
+		"clientDataJSON":    protocol.URLEncodedBase64(a.clientData(protocol.CreateCeremony, options.Response.Challenge)),
+		"attestationObject": protocol.URLEncodedBase64(attestation),
+	})
+}
+
+// get answers an assertion, counting the signature.
+func (a *softAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) io.Reader {
+	a.signCount++
+	authData := a.authData(protocol.FlagUserPresent|protocol.FlagUserVerified, nil)
+	clientData := a.clientData(protocol.AssertCeremony, options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.body(map[string]interface{}{
+		"clientDataJSON":    protocol.URLEncodedBase64(clientData),
+		"authenticatorData": protocol.URLEncodedBase64(authData),
+		"signature":         protocol.URLEncodedBase64(signature),
+		"userHandle":        protocol.URLEncodedBase64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) body(response map[string]interface{}) io.Reader {
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":       id,
+		"rawId":    id,
+		"type":     "public-key",
+		"response": response,
+	})
+	return bytes.NewReader(body)
+}
+
+type webAuthnRepositoryInMemory struct {
+	mu          sync.Mutex
+	credentials map[uuid.UUID]model.WebAuthnCredential
+	sessions    map[uuid.UUID]model.WebAuthnSession
+}
+
+func (r *webAuthnRepositoryInMemory) CreateCredential(credential *model.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.credentials[credential.ID] = *credential
+	return nil
+}
+
+func (r *webAuthnRepositoryInMemory) GetCredentials(username string) ([]model.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var credentials []model.WebAuthnCredential
+	for _, credential := range r.credentials {
+		if credential.Username == username {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *webAuthnRepositoryInMemory) GetCredentialByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, credential := range r.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			return &credential, nil
+		}
+	}
+	return nil, errors.New("credential not found")
+}
+
+func (r *webAuthnRepositoryInMemory) UpdateCredentialUse(id uuid.UUID, signCount uint32, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credential := r.credentials[id]
+	credential.SignCount, credential.LastUsedAt = signCount, usedAt
+	r.credentials[id] = credential
+	return nil
+}
+
+func (r *webAuthnRepositoryInMemory) RenameCredential(id uuid.UUID, username string, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credential, ok := r.credentials[id]
+	if !ok || credential.Username != username {
+		return errors.New("credential not found")
+	}
+	credential.Name = name
+	r.credentials[id] = credential
+	return nil
+}
+
+func (r *webAuthnRepositoryInMemory) DeleteCredential(id uuid.UUID, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credential, ok := r.credentials[id]
+	if !ok || credential.Username != username {
+		return errors.New("credential not found")
+	}
+	delete(r.credentials, id)
+	return nil
+}
+
+func (r *webAuthnRepositoryInMemory) CreateSession(session *model.WebAuthnSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *webAuthnRepositoryInMemory) TakeSession(id uuid.UUID) (*model.WebAuthnSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, errors.New("session not found")
+	}
+	delete(r.sessions, id)
+	return &session, nil
+}
+
+type userRepositoryInMemory struct {
+	users map[string]*model.User
+}
+
+func (r userRepositoryInMemory) GetByUsername(_ context.Context, username string) (*model.User, error) {
+	user, ok := r.users[username]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (r userRepositoryInMemory) UserExists(username string) error {
+	_, err := r.GetByUsername(context.TODO(), username)
+	return err
+}
+
+func (r userRepositoryInMemory) GetUserSalt(string) (string, error) {
+	return "", nil
+}
+
+func (r userRepositoryInMemory) GetUserRole(username string) (string, error) {
+	user, err := r.GetByUsername(context.TODO(), username)
+	if err != nil {
+		return "", err
+	}
+	return user.Role.String(), nil
+}
+
+func (r userRepositoryInMemory) GetUsernamesWithRole(role string) ([]string, error) {
+	var usernames []string
+	for username, user := range r.users {
+		if user.Role.String() == role {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames, nil
+}
+
+func discardLogger() (*logger.Logger, *logtest.Hook) {
+	l, hook := logtest.NewNullLogger()
+	l.SetLevel(logrus.DebugLevel)
+	return &logger.Logger{Logger: l}, hook
+}
+
+type webAuthnFixture struct {
+	service *WebAuthnService
+	repo    *webAuthnRepositoryInMemory
+	errors  *logtest.Hook
+}
+
+func newWebAuthnFixture(t *testing.T, usernames ...string) *webAuthnFixture {
+	webAuthn, err := webauthn.New(&webauthn.Config{RPDisplayName: "Dislinkt", RPID: testRPID, RPOrigin: testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := userRepositoryInMemory{users: map[string]*model.User{}}
+	for _, username := range usernames {
+		users.users[username] = &model.User{ID: uuid.New(), Username: username, FirstName: "Test", LastName: username}
+	}
+	repo := &webAuthnRepositoryInMemory{
+		credentials: map[uuid.UUID]model.WebAuthnCredential{},
+		sessions:    map[uuid.UUID]model.WebAuthnSession{},
+	}
+	logInfo, _ := discardLogger()
+	logError, errorHook := discardLogger()
+	return &webAuthnFixture{NewWebAuthnService(logInfo, logError, webAuthn, repo, users), repo, errorHook}
+}
+
+func (f *webAuthnFixture) register(t *testing.T, username string, authenticator *softAuthenticator) *model.WebAuthnCredential {
+	options, sessionID, err := f.service.BeginRegistration(username)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	credential, err := f.service.FinishRegistration(username, sessionID, "Laptop", authenticator.create(t, options))
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+	return credential
+}
+
+func (f *webAuthnFixture) login(t *testing.T, username string, authenticator *softAuthenticator) (string, error) {
+	options, sessionID, err := f.service.BeginLogin(username)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	return f.service.FinishLogin(sessionID, authenticator.get(t, options))
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+
+	credential := f.register(t, "alice", authenticator)
+	if credential.Name != "Laptop" || !bytes.Equal(credential.CredentialID, authenticator.credentialID) {
+		t.Fatalf("stored credential = %+v", credential)
+	}
+	has, err := f.service.HasCredentials("alice")
+	if err != nil || !has {
+		t.Fatalf("HasCredentials = %v, %v", has, err)
+	}
+
+	options, _, err := f.service.BeginRegistration("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	excluded := options.Response.CredentialExcludeList
+	if len(excluded) != 1 || !bytes.Equal(excluded[0].CredentialID, authenticator.credentialID) {
+		t.Fatalf("registered credential isn't excluded: %+v", excluded)
+	}
+}
+
+func TestWebAuthnRegistrationSessionBelongsToItsUser(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice", "mallory")
+	options, sessionID, err := f.service.BeginRegistration("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.service.FinishRegistration("mallory", sessionID, "", newSoftAuthenticator(t).create(t, options))
+	if !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Fatalf("err = %v, want %v", err, ErrWebAuthnSessionInvalid)
+	}
+}
+
+func TestWebAuthnPasskeyLogin(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	username, err := f.login(t, "alice", authenticator)
+	if err != nil || username != "alice" {
+		t.Fatalf("login = %q, %v", username, err)
+	}
+	stored, _ := f.repo.GetCredentialByCredentialID(authenticator.credentialID)
+	if stored.SignCount != authenticator.signCount {
+		t.Fatalf("sign count = %d, want %d", stored.SignCount, authenticator.signCount)
+	}
+}
+
+func TestWebAuthnDiscoverableLogin(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	options, _, err := f.service.BeginLogin("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Response.AllowedCredentials) != 0 {
+		t.Fatalf("discoverable login names credentials: %+v", options.Response.AllowedCredentials)
+	}
+	username, err := f.login(t, "", authenticator)
+	if err != nil || username != "alice" {
+		t.Fatalf("login = %q, %v", username, err)
+	}
+}
+
+func TestWebAuthnDiscoverableLoginRejectsForeignUserHandle(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	authenticator.userHandle = []byte("someone else")
+	_, err := f.login(t, "", authenticator)
+	if err == nil {
+		t.Fatal("login with another user's handle succeeded")
+	}
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	options, sessionID, err := f.service.BeginSecondFactor("alice", "the-ticket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, valid, err := f.service.FinishSecondFactor(sessionID, authenticator.get(t, options))
+	if err != nil || !valid || ticket != "the-ticket" {
+		t.Fatalf("second factor = %q, %v, %v", ticket, valid, err)
+	}
+
+	// A login session can't stand in for a second-factor one.
+	options, sessionID, err = f.service.BeginLogin("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = f.service.FinishSecondFactor(sessionID, authenticator.get(t, options))
+	if !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Fatalf("err = %v, want %v", err, ErrWebAuthnSessionInvalid)
+	}
+}
+
+func TestWebAuthnSecondFactorRejectsOtherAuthenticator(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	f.register(t, "alice", newSoftAuthenticator(t))
+
+	options, sessionID, err := f.service.BeginSecondFactor("alice", "the-ticket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, valid, err := f.service.FinishSecondFactor(sessionID, newSoftAuthenticator(t).get(t, options))
+	if err != nil || valid || ticket != "the-ticket" {
+		t.Fatalf("second factor = %q, %v, %v", ticket, valid, err)
+	}
+}
+
+func TestWebAuthnRenameAndRemoveCredential(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice", "mallory")
+	authenticator := newSoftAuthenticator(t)
+	credential := f.register(t, "alice", authenticator)
+
+	if err := f.service.RenameCredential("mallory", credential.ID, "Mine now"); err == nil {
+		t.Fatal("renamed another user's credential")
+	}
+	if err := f.service.RenameCredential("alice", credential.ID, "Phone"); err != nil {
+		t.Fatal(err)
+	}
+	credentials, _ := f.service.GetCredentials("alice")
+	if len(credentials) != 1 || credentials[0].Name != "Phone" {
+		t.Fatalf("credentials = %+v", credentials)
+	}
+
+	if err := f.service.RemoveCredential("mallory", credential.ID); err == nil {
+		t.Fatal("removed another user's credential")
+	}
+	if err := f.service.RemoveCredential("alice", credential.ID); err != nil {
+		t.Fatal(err)
+	}
+	has, _ := f.service.HasCredentials("alice")
+	if has {
+		t.Fatal("credential still there after removal")
+	}
+	if _, err := f.login(t, "", authenticator); err == nil {
+		t.Fatal("login with a removed credential succeeded")
+	}
+}
+
+func TestWebAuthnCloneWarning(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+	authenticator.signCount = 5
+	if _, err := f.login(t, "alice", authenticator); err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of the key that signed fewer times than the original.
+	authenticator.signCount = 2
+	_, err := f.login(t, "alice", authenticator)
+	if !errors.Is(err, ErrWebAuthnCloned) {
+		t.Fatalf("err = %v, want %v", err, ErrWebAuthnCloned)
+	}
+	entry := f.errors.LastEntry()
+	if entry == nil || entry.Data["user"] != "alice" {
+		t.Fatalf("clone warning not logged: %+v", entry)
+	}
+	stored, _ := f.repo.GetCredentialByCredentialID(authenticator.credentialID)
+	if stored.SignCount != 6 {
+		t.Fatalf("sign count = %d, want it kept at 6", stored.SignCount)
+	}
+}
+
+func TestWebAuthnRejectsReplayedAssertion(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	options, sessionID, err := f.service.BeginLogin("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion, _ := io.ReadAll(authenticator.get(t, options))
+	if _, err := f.service.FinishLogin(sessionID, bytes.NewReader(assertion)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.FinishLogin(sessionID, bytes.NewReader(assertion)); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Fatalf("replay in the same session: err = %v, want %v", err, ErrWebAuthnSessionInvalid)
+	}
+
+	_, otherSession, err := f.service.BeginLogin("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.FinishLogin(otherSession, bytes.NewReader(assertion)); err == nil {
+		t.Fatal("replay against a new challenge succeeded")
+	}
+}
+
+func TestWebAuthnRejectsForeignOrigin(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	authenticator.origin = "https://dislinkt.example.net"
+	if _, err := f.login(t, "alice", authenticator); err == nil {
+		t.Fatal("assertion from a foreign origin succeeded")
+	}
+
+	options, sessionID, err := f.service.BeginRegistration("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.FinishRegistration("alice", sessionID, "", newSoftAuthenticator(t).create(t, options)); err != nil {
+		t.Fatalf("control registration failed: %v", err)
+	}
+	phished := newSoftAuthenticator(t)
+	phished.origin = "https://dislinkt.example.net"
+	options, sessionID, err = f.service.BeginRegistration("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.FinishRegistration("alice", sessionID, "", phished.create(t, options)); err == nil {
+		t.Fatal("registration from a foreign origin succeeded")
+	}
+}
+
+func TestWebAuthnRejectsExpiredSession(t *testing.T) {
+	f := newWebAuthnFixture(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	f.register(t, "alice", authenticator)
+
+	options, sessionID, err := f.service.BeginLogin("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := f.repo.sessions[sessionID]
+	session.ExpiresAt = time.Now().Add(-time.Second)
+	f.repo.sessions[sessionID] = session
+	if _, err := f.service.FinishLogin(sessionID, authenticator.get(t, options)); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Fatalf("err = %v, want %v", err, ErrWebAuthnSessionInvalid)
+	}
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/interceptor"
+	"common/module/logger"
+	"common/module/policy"
+	"context"
+	myerr "gateway/module/application/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type claimsKey struct{}
+
+var (
+	errRouteNotFound   = domainErrors.NotFound(domainErrors.CodeRouteNotFound, "Not Found")
+	errUnauthenticated = domainErrors.Unauthenticated(domainErrors.CodeUnauthenticated, "Unauthorized")
+	errForbidden       = domainErrors.PermissionDenied(domainErrors.CodePermissionDenied, "Forbidden")
+)
+
+// Authorizer enforces the policy on every request before it reaches the mux,
+// so a route is protected even when the service behind it isn't.
+type Authorizer struct {
+	policy      *policy.Policy
+	keys        interceptor.KeySource
+	revocations interceptor.RevocationChecker
+	permissions interceptor.PermissionResolver
+	logError    *logger.Logger
+}
+
+func NewAuthorizer(policy *policy.Policy, keys interceptor.KeySource, revocations interceptor.RevocationChecker,
+	permissions interceptor.PermissionResolver, logError *logger.Logger) *Authorizer {
+	return &Authorizer{
+		policy:      policy,
+		keys:        keys,
+		revocations: revocations,
+		permissions: permissions,
+		logError:    logError,
+	}
+}
+
+// Authorize checks r against the rule of its route. It answers the request
+// itself and returns false when the caller isn't allowed; otherwise it
+// returns r carrying the caller's claims, if there are any.
+func (a *Authorizer) Authorize(rw http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	rule, params, ok := a.policy.Route(r.Method, r.URL.Path)
+	if !ok {
+		a.logError.Logger.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Errorf("ERR:NO POLICY FOR ROUTE")
+		myerr.WriteProblem(rw, r, errRouteNotFound)
+		return r, false
+	}
+	token, ok := bearerToken(r, rule)
+	if rule.Public {
+		// Callers of public routes are still identified when they send a
+		// valid token, so they can be told apart.
+		if !ok {
+			return r, true
+		}
+		if claims := a.verify(token); claims != nil {
+			return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)), true
+		}
+		return r, true
+	}
+	if !ok {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return r, false
+	}
+	claims := a.verify(token)
+	if claims == nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return r, false
+	}
+
+	if !rule.Allows(interceptor.PermissionsOf(claims, a.permissions)) || (rule.Owner != "" && params[rule.Owner] != claims.Username) {
+		a.logError.Logger.WithFields(logrus.Fields{
+			"user":   claims.Username,
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Errorf("ERR:FORBIDEN")
+		myerr.WriteProblem(rw, r, errForbidden)
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)), true
+}
+
+// verify returns the claims of token, or nil when it's invalid or revoked.
+func (a *Authorizer) verify(token string) *interceptor.JwtClaims {
+	claims, err := interceptor.VerifyToken(token, a.keys)
+	if err != nil || claims.Valid() != nil {
+		return nil
+	}
+	if a.revocations.IsRevoked(claims.Id, claims.SessionId, claims.Username, claims.IssuedAt) {
+		a.logError.Logger.WithFields(logrus.Fields{
+			"user": claims.Username,
+			"jti":  claims.Id,
+		}).Errorf("ERR:UNOTHORIZED:TOKEN REVOKED")
+		return nil
+	}
+	return claims
+}
+
+// AuthorizeRpc checks a call the gateway makes on behalf of the caller with
+// claims, nil for anonymous callers, against the rule of its method, as the
+// services would. It returns the status error the service would answer with.
+func (a *Authorizer) AuthorizeRpc(claims *interceptor.JwtClaims, method string, request interface{}) error {
+	rule, ok := a.policy.Rpc(method)
+	if !ok {
+		a.logError.Logger.Errorf("ERR:FORBIDEN:NO POLICY FOR %s", method)
+		return errForbidden
+	}
+	if rule.Public {
+		return nil
+	}
+	if claims == nil {
+		return errUnauthenticated
+	}
+	if !rule.Allows(interceptor.PermissionsOf(claims, a.permissions)) || rule.CheckOwner(request, claims.Username) != nil {
+		a.logError.Logger.WithFields(logrus.Fields{
+			"user":   claims.Username,
+			"method": method,
+		}).Errorf("ERR:FORBIDEN")
+		return errForbidden
+	}
+	return nil
+}
+
+func bearerToken(r *http.Request, rule policy.Rule) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" && rule.QueryToken {
+		token := r.URL.Query().Get("access_token")
+		return token, token != ""
+	}
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// Caller returns the claims Authorize verified for r, or nil when a public
+// route was called without a valid token.
+func Caller(r *http.Request) *interceptor.JwtClaims {
+	claims, _ := r.Context().Value(claimsKey{}).(*interceptor.JwtClaims)
+	return claims
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"common/module/interceptor"
+	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
+	userService "common/module/proto/user_service"
+	"common/module/revocation"
+	events "common/module/saga/revocation_events"
+	"gateway/module/domain/model"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type signingKeyRepositoryInMemory struct {
+	keys []model.SigningKey
+}
+
+func (r *signingKeyRepositoryInMemory) Save(key *model.SigningKey) error {
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *signingKeyRepositoryInMemory) GetCreatedAfter(t time.Time) ([]model.SigningKey, error) {
+	var keys []model.SigningKey
+	for _, key := range r.keys {
+		if key.CreatedAt.After(t) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *signingKeyRepositoryInMemory) DeleteCreatedBefore(time.Time) error {
+	return nil
+}
+
+type authorizerFixture struct {
+	authorizer  *Authorizer
+	keys        *KeyManager
+	revocations *revocation.List
+}
+
+func newAuthorizerFixture(t *testing.T) *authorizerFixture {
+	l, _ := logtest.NewNullLogger()
+	discard := &logger.Logger{Logger: l}
+	authPolicy, err := policy.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyManager(&signingKeyRepositoryInMemory{}, "RS256", time.Hour, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := revocation.NewList()
+	authorizer := NewAuthorizer(authPolicy, keys, revocations, permissions.NewCache(authPolicy.Roles), discard)
+	return &authorizerFixture{authorizer, keys, revocations}
+}
+
+// token issues a token that carries only roles, so permissions come from
+// the cache the way they do for every token the gateway issues.
+func (f *authorizerFixture) token(t *testing.T, username string, roles ...string) (string, *interceptor.JwtClaims) {
+	claims := &interceptor.JwtClaims{Username: username, Roles: roles}
+	token, _, err := f.keys.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, claims
+}
+
+func (f *authorizerFixture) authorize(method string, target string, token string) (*httptest.ResponseRecorder, *http.Request, bool) {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rw := httptest.NewRecorder()
+	r, ok := f.authorizer.Authorize(rw, r)
+	return rw, r, ok
+}
+
+func TestAuthorizeRoutes(t *testing.T) {
+	f := newAuthorizerFixture(t)
+	alice, _ := f.token(t, "alice", "Regular")
+	admin, _ := f.token(t, "root", "Admin")
+
+	cases := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+	}{
+		{"public route", "GET", "/status", "", http.StatusOK},
+		{"unknown route", "GET", "/nowhere", alice, http.StatusNotFound},
+		{"no token", "GET", "/users/sessions", "", http.StatusUnauthorized},
+		{"bad token", "GET", "/users/sessions", "not-a-token", http.StatusUnauthorized},
+		{"logged in", "GET", "/users/sessions", alice, http.StatusOK},
+		{"own feed", "GET", "/users/alice/feed", alice, http.StatusOK},
+		{"someone else's feed", "GET", "/users/bob/feed", alice, http.StatusForbidden},
+		{"feed without token", "GET", "/users/alice/feed", "", http.StatusUnauthorized},
+		{"missing permission", "GET", "/roles", alice, http.StatusForbidden},
+		{"permission from role", "GET", "/roles", admin, http.StatusOK},
+		{"token in query refused", "GET", "/users/sessions?access_token=" + alice, "", http.StatusUnauthorized},
+		{"token in query allowed", "GET", "/events?access_token=" + alice, "", http.StatusOK},
+		{"API token", "POST", "/users/token/generate", alice, http.StatusOK},
+		{"API token without permission", "POST", "/users/token/generate", admin, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		rw, _, ok := f.authorize(c.method, c.target, c.token)
+		if ok != (c.status == http.StatusOK) || (!ok && rw.Code != c.status) {
+			t.Errorf("%s: allowed %v with status %d, want %d", c.name, ok, rw.Code, c.status)
+		}
+	}
+}
+
+func TestAuthorizeAttachesCaller(t *testing.T) {
+	f := newAuthorizerFixture(t)
+	alice, _ := f.token(t, "alice", "Regular")
+
+	_, r, ok := f.authorize("GET", "/users/alice/feed", alice)
+	if !ok || Caller(r) == nil || Caller(r).Username != "alice" {
+		t.Fatal("the caller of a private route wasn't attached")
+	}
+	_, r, ok = f.authorize("GET", "/status", alice)
+	if !ok || Caller(r) == nil || Caller(r).Username != "alice" {
+		t.Fatal("the caller of a public route wasn't attached")
+	}
+	_, r, ok = f.authorize("GET", "/status", "not-a-token")
+	if !ok || Caller(r) != nil {
+		t.Fatal("a public route refused a bad token or attached a caller for it")
+	}
+}
+
+func TestAuthorizeRefusesRevokedTokens(t *testing.T) {
+	f := newAuthorizerFixture(t)
+	alice, claims := f.token(t, "alice", "Regular")
+	f.revocations.Apply(&events.RevocationEvent{
+		Type:      events.RevokeToken,
+		TokenId:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	})
+
+	rw, _, ok := f.authorize("GET", "/users/alice/feed", alice)
+	if ok || rw.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token allowed %v with status %d", ok, rw.Code)
+	}
+}
+
+func TestApiTokensAreNotAccessTokens(t *testing.T) {
+	f := newAuthorizerFixture(t)
+	apiToken, expiresAt, err := f.keys.GenerateApiToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expiresAt) < ApiTokenDuration-time.Minute {
+		t.Fatalf("the API token expires at %v", expiresAt)
+	}
+
+	rw, _, ok := f.authorize("GET", "/users/alice/feed", apiToken)
+	if ok || rw.Code != http.StatusUnauthorized {
+		t.Fatalf("API token used as an access token allowed %v with status %d", ok, rw.Code)
+	}
+	claims, err := interceptor.VerifyApiToken(apiToken, f.keys)
+	if err != nil || claims.Username != "alice" {
+		t.Fatalf("API token refused: %v", err)
+	}
+	accessToken, _ := f.token(t, "alice", "Regular")
+	if _, err := interceptor.VerifyApiToken(accessToken, f.keys); err == nil {
+		t.Fatal("an access token was accepted as an API token")
+	}
+}
+
+func TestAuthorizeRpc(t *testing.T) {
+	f := newAuthorizerFixture(t)
+	_, alice := f.token(t, "alice", "Regular")
+	_, agent := f.token(t, "agent", "Agent")
+	own := &userService.UserDetailsRequest{UserDetails: &userService.UserDetails{Username: "alice"}}
+	other := &userService.UserDetailsRequest{UserDetails: &userService.UserDetails{Username: "bob"}}
+	const edit = "/user_service.UserService/EditUserDetails"
+
+	if err := f.authorizer.AuthorizeRpc(alice, edit, own); err != nil {
+		t.Fatalf("owner refused: %v", err)
+	}
+	if err := f.authorizer.AuthorizeRpc(alice, edit, other); err != errForbidden {
+		t.Fatalf("got %v for another user's details, want forbidden", err)
+	}
+	if err := f.authorizer.AuthorizeRpc(agent, edit, &userService.UserDetailsRequest{
+		UserDetails: &userService.UserDetails{Username: "agent"}}); err != errForbidden {
+		t.Fatalf("got %v without the permission, want forbidden", err)
+	}
+	if err := f.authorizer.AuthorizeRpc(nil, edit, own); err != errUnauthenticated {
+		t.Fatalf("got %v for an anonymous caller, want unauthenticated", err)
+	}
+	if err := f.authorizer.AuthorizeRpc(nil, "/user_service.UserService/GetAll", &userService.EmptyRequest{}); err != nil {
+		t.Fatalf("public rpc refused: %v", err)
+	}
+	if err := f.authorizer.AuthorizeRpc(alice, "/user_service.UserService/Unknown", own); err != errForbidden {
+		t.Fatalf("got %v for an rpc without a rule, want forbidden", err)
+	}
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"common/module/interceptor"
+	"common/module/jwks"
+	"common/module/logger"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+type signingKey struct {
+	kid        string
+	alg        string
+	privateKey crypto.Signer
+	createdAt  time.Time
+}
+
+// KeyManager owns the gateway's token signing keys. The newest key signs,
+// and older keys stay published in the JWKS for as long as a token they
+// signed can still be valid, so rotating never invalidates tokens in flight.
+type KeyManager struct {
+	repo             repositories.SigningKeyRepository
+	algorithm        string
+	rotationInterval time.Duration
+	logError         *logger.Logger
+	mutex            sync.RWMutex
+	keys             []signingKey
+}
+
+func NewKeyManager(repo repositories.SigningKeyRepository, algorithm string, rotationInterval time.Duration, logError *logger.Logger) (*KeyManager, error) {
+	if algorithm != jwks.AlgorithmRS256 && algorithm != jwks.AlgorithmEdDSA {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	m := &KeyManager{
+		repo:             repo,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		logError:         logError,
+	}
+	err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	err = m.rotateIfDue()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start reloads the keys periodically, so several gateway instances converge
+// on the same signing key, and rotates once the current key gets too old.
+func (m *KeyManager) Start() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			err := m.load()
+			if err == nil {
+				err = m.rotateIfDue()
+			}
+			if err != nil {
+				m.logError.Logger.Errorf("ERR:SIGNING KEY ROTATION: %v", err)
+			}
+		}
+	}()
+}
+
+func (m *KeyManager) Rotate() error {
+	kid := uuid.New().String()
+	privateKey, err := generatePrivateKey(m.algorithm)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	err = m.repo.Save(&model.SigningKey{
+		Kid:        kid,
+		Algorithm:  m.algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	err = m.repo.DeleteCreatedBefore(time.Now().UTC().Add(-m.retention()))
+	if err != nil {
+		return err
+	}
+	return m.load()
+}
+
+func (m *KeyManager) GenerateToken(claims *interceptor.JwtClaims) (string, time.Time, error) {
+	return generateToken(m, claims, TokenDuration)
+}
+
+// GenerateApiToken issues the API token an agent shares job offers with.
+// Services only accept it through interceptor.VerifyApiToken.
+func (m *KeyManager) GenerateApiToken(username string) (string, time.Time, error) {
+	claims := &interceptor.JwtClaims{Username: username}
+	claims.Audience = interceptor.ApiTokenAudience
+	return generateToken(m, claims, ApiTokenDuration)
+}
+
+// VerificationKey makes the KeyManager usable as an interceptor.KeySource
+// for the tokens the gateway has to check itself.
+func (m *KeyManager) VerificationKey(kid string, alg string) (interface{}, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, k := range m.keys {
+		if k.kid == kid {
+			if k.alg != alg {
+				return nil, fmt.Errorf("key %s is not an %s key", kid, alg)
+			}
+			return k.privateKey.Public(), nil
+		}
+	}
+	return nil, jwks.ErrKeyNotFound
+}
+
+func (m *KeyManager) KeySet() jwks.KeySet {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	keySet := jwks.KeySet{Keys: []jwks.Key{}}
+	for _, k := range m.keys {
+		key, err := jwks.NewKey(k.kid, k.privateKey.Public())
+		if err != nil {
+			continue
+		}
+		keySet.Keys = append(keySet.Keys, key)
+	}
+	return keySet
+}
+
+func (m *KeyManager) current() (signingKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if len(m.keys) == 0 {
+		return signingKey{}, jwks.ErrKeyNotFound
+	}
+	return m.keys[0], nil
+}
+
+// retention is how long a key stays published: the time it is used for
+// signing plus the lifetime of the last token it signed, which can be an
+// API token.
+func (m *KeyManager) retention() time.Duration {
+	return m.rotationInterval + ApiTokenDuration
+}
+
+func (m *KeyManager) rotateIfDue() error {
+	current, err := m.current()
+	if err == nil && current.alg == m.algorithm && time.Since(current.createdAt) < m.rotationInterval {
+		return nil
+	}
+	return m.Rotate()
+}
+
+func (m *KeyManager) load() error {
+	stored, err := m.repo.GetCreatedAfter(time.Now().UTC().Add(-m.retention()))
+	if err != nil {
+		return err
+	}
+	var keys []signingKey
+	for _, k := range stored {
+		block, _ := pem.Decode([]byte(k.PrivateKey))
+		if block == nil {
+			m.logError.Logger.Errorf("ERR:SIGNING KEY %s IS NOT PEM", k.Kid)
+			continue
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			m.logError.Logger.Errorf("ERR:PARSING SIGNING KEY %s: %v", k.Kid, err)
+			continue
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			continue
+		}
+		keys = append(keys, signingKey{kid: k.Kid, alg: k.Algorithm, privateKey: signer, createdAt: k.CreatedAt})
+	}
+
+	m.mutex.Lock()
+	m.keys = keys
+	m.mutex.Unlock()
+	return nil
+}
+
+func generatePrivateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case jwks.AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case jwks.AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
@@ -2,24 +2,41 @@ package auth
 
 import (
 	"common/module/interceptor"
+	"common/module/jwks"
 	myerr "gateway/module/application/errors"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 	"os"
 	"time"
 )
 
-func GenerateToken(claims *interceptor.JwtClaims) (tokenString string, tokenExpirationTime time.Time, err error) {
+const TokenDuration = 30 * time.Minute
+
+// ApiTokenDuration is how long the API tokens of agents stay valid.
+const ApiTokenDuration = 30 * 24 * time.Hour
+
+func generateToken(keys *KeyManager, claims *interceptor.JwtClaims, duration time.Duration) (tokenString string, tokenExpirationTime time.Time, err error) {
 
 	var tokenCreationTime = time.Now().UTC()
-	tokenExpirationTime = tokenCreationTime.Add(time.Duration(30) * time.Minute)
+	tokenExpirationTime = tokenCreationTime.Add(duration)
 
+	claims.Id = uuid.New().String()
 	claims.ExpiresAt = tokenExpirationTime.Unix()
 	claims.IssuedAt = time.Now().UTC().Unix()
 	claims.Issuer = os.Getenv("IP")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	mySigningKey := []byte(os.Getenv("SECRET"))
-	tokenString, err = token.SignedString(mySigningKey)
+	key, err := keys.current()
+	if err != nil {
+		return tokenString, tokenExpirationTime, &myerr.AuthenticationError{StatusCode: 404, Err: err, Message: "Error generating token"}
+	}
+
+	var method jwt.SigningMethod = jwt.SigningMethodRS256
+	if key.alg == jwks.AlgorithmEdDSA {
+		method = jwks.SigningMethodEd25519
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.kid
+	tokenString, err = token.SignedString(key.privateKey)
 	if err != nil {
 		return tokenString, tokenExpirationTime, &myerr.AuthenticationError{StatusCode: 404, Err: err, Message: "Error generating token"}
 	}
@@ -0,0 +1,5 @@
+package dto
+
+type ApiTokenResponse struct {
+	ApiToken string `json:"apiToken"`
+}
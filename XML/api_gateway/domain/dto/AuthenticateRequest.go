@@ -1,6 +1,7 @@
 package dto
 
 type AuthenticateRequest struct {
-	Username string `json:"username" form:"username" binding:"required"`
-	Token    int    `json:"token" form:"token" binding:"required"`
+	Ticket       string `json:"ticket" form:"ticket"`
+	Code         string `json:"code" form:"code"`
+	RecoveryCode string `json:"recoveryCode" form:"recoveryCode"`
 }
@@ -1,6 +1,11 @@
 package dto
 
+import "time"
+
 type AuthenticateResponse struct {
-	Username string `json:"username" form:"username" binding:"required"`
-	TwoFa    bool   `json:"twofa" form:"twofa" binding:"required"`
+	Username             string    `json:"username" form:"username" binding:"required"`
+	Totp                 bool      `json:"totp"`
+	WebAuthn             bool      `json:"webauthn"`
+	Ticket               string    `json:"ticket"`
+	TicketExpirationTime time.Time `json:"ticketExpirationTime"`
 }
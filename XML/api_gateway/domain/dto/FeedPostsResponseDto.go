@@ -3,5 +3,7 @@ package dto
 import "gateway/module/domain/model"
 
 type FeedPostsResponseDto struct {
-	Feed []model.Post
+	Feed       []model.Post
+	NextCursor string   `json:",omitempty"`
+	Warnings   []string `json:",omitempty"`
 }
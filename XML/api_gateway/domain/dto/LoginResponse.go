@@ -3,9 +3,13 @@ package dto
 import "time"
 
 type LogInResponseDto struct {
-	Token          string    `json:"token"`
-	Role           string    `json:"role"`
-	Email          string    `json:"email"`
-	Username       string    `json:"username"`
-	ExpirationTime time.Time `json:"expirationTime"`
+	Token                 string    `json:"token"`
+	Role                  string    `json:"role"`
+	Roles                 []string  `json:"roles"`
+	Permissions           []string  `json:"permissions"`
+	Email                 string    `json:"email"`
+	Username              string    `json:"username"`
+	ExpirationTime        time.Time `json:"expirationTime"`
+	RefreshToken          string    `json:"refreshToken"`
+	RefreshExpirationTime time.Time `json:"refreshExpirationTime"`
 }
@@ -0,0 +1,5 @@
+package dto
+
+type MfaTicketRequest struct {
+	Ticket string `json:"ticket" form:"ticket" binding:"required"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+import "encoding/json"
+
+// RealtimeEventDto is how events are framed on WebSocket streams. SSE
+// streams carry the same fields in the id, event and data lines.
+type RealtimeEventDto struct {
+	Id   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
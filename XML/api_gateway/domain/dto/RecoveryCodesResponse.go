@@ -0,0 +1,5 @@
+package dto
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+type RoleDto struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	BuiltIn     bool     `json:"builtIn"`
+}
+
+type SaveRoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserRolesDto struct {
+	Roles []string `json:"roles"`
+}
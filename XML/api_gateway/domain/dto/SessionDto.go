@@ -0,0 +1,10 @@
+package dto
+
+import (
+	"gateway/module/domain/model"
+)
+
+type SessionDto struct {
+	model.LoginSession
+	Current bool `json:"current"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+import "time"
+
+// StatusDto is the gateway's view of the services it calls. Status is
+// "degraded" while any backend's circuit breaker isn't closed. The errors
+// that opened a breaker are only logged: the route is public.
+type StatusDto struct {
+	Status   string             `json:"status"`
+	Backends []BackendStatusDto `json:"backends"`
+}
+
+type BackendStatusDto struct {
+	Backend  string     `json:"backend"`
+	Breaker  string     `json:"breaker"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
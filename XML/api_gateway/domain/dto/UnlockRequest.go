@@ -0,0 +1,5 @@
+package dto
+
+type UnlockRequest struct {
+	Code string `json:"code" form:"code" binding:"required"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+type WebAuthnBeginResponse struct {
+	SessionId string      `json:"sessionId"`
+	Options   interface{} `json:"options"`
+}
+
+type WebAuthnCredentialName struct {
+	Name string `json:"name" form:"name" binding:"required"`
+}
+
+// ReauthenticateRequest proves the caller is the account's owner, not just
+// the holder of its access token: the password, or a code from the
+// authenticator app.
+type ReauthenticateRequest struct {
+	Password string `json:"password" form:"password"`
+	Code     string `json:"code" form:"code"`
+}
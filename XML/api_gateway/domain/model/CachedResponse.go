@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// CachedResponse is a response of a cached route, keyed by the request it
+// answered ("GET /post/<id>?<query>"). Responses of private routes have
+// the caller at the end of their key.
+type CachedResponse struct {
+	Key         string    `json:"key" gorm:"primaryKey"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+	ETag        string    `json:"etag" gorm:"not null"`
+	StoredAt    time.Time `json:"storedAt" gorm:"not null"`
+	ExpiresAt   time.Time `json:"expiresAt" gorm:"index"`
+}
+
+// CachedResponseTag ties a cached response to what it was made from, like
+// "user:<username>", so changing that drops the response.
+type CachedResponseTag struct {
+	Tag string `json:"tag" gorm:"primaryKey"`
+	Key string `json:"key" gorm:"primaryKey"`
+}
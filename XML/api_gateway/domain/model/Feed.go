@@ -0,0 +1,10 @@
+package model
+
+// FeedPage is one page of a user's feed, newest post first. NextCursor is
+// empty on the last page. Warnings name the posts, or the connections whose
+// posts, are missing because their backend failed or was too slow.
+type FeedPage struct {
+	Posts      []Post
+	NextCursor string
+	Warnings   []string
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// LoginAttempt tracks failed logins for one key, either an account
+// ("account:<username>") or a client address ("ip:<address>").
+type LoginAttempt struct {
+	Key         string    `json:"key" gorm:"primaryKey"`
+	Failures    int       `json:"failures" gorm:"not null"`
+	LastAttempt time.Time `json:"lastAttempt" gorm:"index"`
+	LockedUntil time.Time `json:"lockedUntil"`
+	UnlockCode  string    `json:"-" gorm:"index"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodTwoFactor    = "2fa"
+	LoginMethodPasswordless = "passwordless"
+	LoginMethodPasskey      = "passkey"
+)
+
+// LoginSession is one successful login. Its ID doubles as the family ID of
+// the refresh tokens issued for it and as the sid claim of its access tokens.
+type LoginSession struct {
+	ID         uuid.UUID `json:"id" gorm:"primaryKey"`
+	Username   string    `json:"username" gorm:"index;not null"`
+	Method     string    `json:"method" gorm:"not null"`
+	IP         string    `json:"ip" gorm:"not null"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index;not null"`
+	LastSeenAt time.Time `json:"last_seen_at" gorm:"not null"`
+	LastSeenIP string    `json:"last_seen_ip"`
+}
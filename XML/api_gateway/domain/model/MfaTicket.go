@@ -0,0 +1,18 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// MfaTicket is the server-side record of a ticket handed out after a
+// successful password check. It makes tickets single use and caps the number
+// of second-factor guesses made with one.
+type MfaTicket struct {
+	ID           uuid.UUID `json:"id" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"not null"`
+	SecondFactor bool      `json:"secondFactor" gorm:"not null"`
+	ExpiresAt    time.Time `json:"expiresAt" gorm:"not null"`
+	Attempts     int       `json:"attempts" gorm:"not null"`
+	Used         bool      `json:"used" gorm:"not null"`
+}
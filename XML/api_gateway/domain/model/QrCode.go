@@ -7,4 +7,10 @@ type QrCode struct {
 	Secret   string    `json:"secret" gorm:"unique;not null"`
 	Username string    `json:"username" gorm:"not null"`
 	IsValid  bool      `json:"is_valid" gorm:"not null"`
+	// IsPending is set until the user proves the authenticator works by
+	// entering a first code.
+	IsPending bool `json:"is_pending" gorm:"not null;default:false"`
+	// LastUsedCounter is the TOTP time step of the last accepted code. Codes
+	// from that step or earlier are refused.
+	LastUsedCounter int `json:"-" gorm:"not null;default:0"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// RateLimitBucket is the token bucket of one caller, keyed by its limit
+// class and the caller ("authenticated:user:<username>", "anonymous:ip:<address>").
+// Throttled is set while the caller is being refused, so only the first
+// refusal is logged.
+type RateLimitBucket struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Tokens    float64   `json:"tokens" gorm:"not null"`
+	Refilled  time.Time `json:"refilled" gorm:"index"`
+	Throttled bool      `json:"throttled" gorm:"not null"`
+}
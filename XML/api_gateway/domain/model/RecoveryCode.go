@@ -0,0 +1,10 @@
+package model
+
+import "github.com/google/uuid"
+
+type RecoveryCode struct {
+	ID       uuid.UUID `json:"id" gorm:"index:idx_name,unique"`
+	Username string    `json:"username" gorm:"index;not null"`
+	CodeHash string    `json:"-" gorm:"not null"`
+	Used     bool      `json:"used" gorm:"not null"`
+}
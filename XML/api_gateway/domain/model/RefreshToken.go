@@ -0,0 +1,17 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type RefreshToken struct {
+	ID        uuid.UUID `json:"id" gorm:"index:idx_refresh_id,unique"`
+	FamilyID  uuid.UUID `json:"family_id" gorm:"index;not null"`
+	Username  string    `json:"username" gorm:"not null"`
+	TokenHash string    `json:"token_hash" gorm:"unique;not null"`
+	IssuedAt  time.Time `json:"issued_at" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+	Used      bool      `json:"used" gorm:"not null"`
+	Revoked   bool      `json:"revoked" gorm:"not null"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Revocation struct {
+	ID        uuid.UUID `json:"id" gorm:"primaryKey"`
+	Type      int8      `json:"type" gorm:"not null"`
+	TokenId   string    `json:"token_id" gorm:"index"`
+	SessionId string    `json:"session_id" gorm:"index"`
+	Username  string    `json:"username" gorm:"index"`
+	RevokedAt time.Time `json:"revoked_at" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+}
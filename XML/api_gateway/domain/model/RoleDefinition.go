@@ -0,0 +1,30 @@
+package model
+
+// RoleDefinition is a named set of permissions. The built-in roles come from
+// the policy file; admins can change them and add their own.
+type RoleDefinition struct {
+	Name        string           `json:"name" gorm:"primaryKey"`
+	Description string           `json:"description"`
+	Permissions []RolePermission `json:"-" gorm:"foreignKey:RoleName;constraint:OnDelete:CASCADE"`
+}
+
+func (RoleDefinition) TableName() string {
+	return "roles"
+}
+
+type RolePermission struct {
+	RoleName   string `json:"role" gorm:"primaryKey"`
+	Permission string `json:"permission" gorm:"primaryKey"`
+}
+
+// UserRoleAssignment gives a user a role. Users hold any number of roles;
+// one without assignments still has the single role in User.Role.
+type UserRoleAssignment struct {
+	Username string         `json:"username" gorm:"primaryKey"`
+	RoleName string         `json:"role" gorm:"primaryKey"`
+	Role     RoleDefinition `json:"-" gorm:"foreignKey:RoleName;constraint:OnDelete:CASCADE"`
+}
+
+func (UserRoleAssignment) TableName() string {
+	return "user_roles"
+}
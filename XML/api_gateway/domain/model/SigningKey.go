@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+type SigningKey struct {
+	Kid        string    `json:"kid" gorm:"primaryKey"`
+	Algorithm  string    `json:"algorithm" gorm:"not null"`
+	PrivateKey string    `json:"-" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// TimelineEntry puts one post in one user's home timeline. Entries only
+// point at posts; the posts themselves stay in post_service.
+type TimelineEntry struct {
+	Owner      string    `json:"owner" gorm:"primaryKey"`
+	PostId     string    `json:"postId" gorm:"primaryKey"`
+	Author     string    `json:"author" gorm:"index"`
+	DatePosted time.Time `json:"datePosted" gorm:"index"`
+}
+
+// TimelineState marks a timeline as built from every post of the owner's
+// connections. From then on the timeline worker keeps it up to date, and the
+// feed rebuilds it now and then for the events the worker never got.
+type TimelineState struct {
+	Owner   string    `json:"owner" gorm:"primaryKey"`
+	BuiltAt time.Time `json:"builtAt"`
+}
@@ -7,3 +7,15 @@ const (
 	Admin
 	Agent
 )
+
+func (r Role) String() string {
+	switch r {
+	case Admin:
+		return "Admin"
+	case Agent:
+		return "Agent"
+	case Regular:
+		return "Regular"
+	}
+	return ""
+}
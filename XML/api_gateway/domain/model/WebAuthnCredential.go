@@ -0,0 +1,33 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// WebAuthnCredential is a security key or passkey registered by a user. A
+// user can have several, each with a name of their choosing.
+type WebAuthnCredential struct {
+	ID              uuid.UUID `json:"id" gorm:"index:idx_name,unique"`
+	Username        string    `json:"username" gorm:"index;not null"`
+	Name            string    `json:"name" gorm:"not null"`
+	CredentialID    []byte    `json:"-" gorm:"unique;not null"`
+	PublicKey       []byte    `json:"-" gorm:"not null"`
+	AttestationType string    `json:"-"`
+	Transports      string    `json:"transports"`
+	AAGUID          []byte    `json:"-"`
+	SignCount       uint32    `json:"-" gorm:"not null"`
+	CreatedAt       time.Time `json:"createdAt"`
+	LastUsedAt      time.Time `json:"lastUsedAt"`
+}
+
+// WebAuthnSession holds the challenge of a registration or login ceremony
+// between its begin and finish requests.
+type WebAuthnSession struct {
+	ID        uuid.UUID `json:"id" gorm:"primaryKey"`
+	Username  string    `json:"username"`
+	Ceremony  string    `json:"ceremony" gorm:"not null"`
+	Data      string    `json:"-" gorm:"not null"`
+	Ticket    string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
+}
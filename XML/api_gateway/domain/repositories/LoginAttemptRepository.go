@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"time"
+)
+
+type LoginAttemptRepository interface {
+	// Update loads the attempt stored under key (a zero attempt if there is
+	// none), applies fn and saves the result, atomically with respect to other
+	// updates of the same key.
+	Update(key string, fn func(attempt *model.LoginAttempt)) (*model.LoginAttempt, error)
+	Get(key string) (*model.LoginAttempt, error)
+	GetByUnlockCode(codeHash string) (*model.LoginAttempt, error)
+	Delete(key string) error
+	DeleteIdleSince(before time.Time) error
+}
@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"github.com/google/uuid"
+	"time"
+)
+
+type LoginSessionRepository interface {
+	Create(session *model.LoginSession) error
+	Get(id uuid.UUID) (*model.LoginSession, error)
+	Touch(id uuid.UUID, ip string, at time.Time) error
+	// GetActive returns the sessions whose refresh tokens can still be used.
+	GetActive(username string, now time.Time) ([]model.LoginSession, error)
+	GetHistory(username string, limit int) ([]model.LoginSession, error)
+	// Known tells whether the user logged in before at all, from ip and
+	// with userAgent.
+	Known(username string, ip string, userAgent string) (bool, bool, bool, error)
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"github.com/google/uuid"
+)
+
+type MfaTicketRepository interface {
+	Create(ticket *model.MfaTicket) error
+	Get(id uuid.UUID) (*model.MfaTicket, error)
+	MarkUsed(id uuid.UUID) (bool, error)
+	IncrementAttempts(id uuid.UUID) (int, error)
+}
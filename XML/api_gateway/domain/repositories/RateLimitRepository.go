@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"time"
+)
+
+type RateLimitRepository interface {
+	// Update loads the bucket stored under key (a zero bucket if there is
+	// none), applies fn and saves the result, atomically with respect to other
+	// updates of the same key.
+	Update(key string, fn func(bucket *model.RateLimitBucket)) (*model.RateLimitBucket, error)
+	DeleteIdleSince(before time.Time) error
+}
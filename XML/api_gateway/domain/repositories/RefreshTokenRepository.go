@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"github.com/google/uuid"
+)
+
+type RefreshTokenRepository interface {
+	Create(token *model.RefreshToken) (*model.RefreshToken, error)
+	GetByHash(tokenHash string) (*model.RefreshToken, error)
+	MarkUsed(token *model.RefreshToken) (bool, error)
+	RevokeFamily(familyID uuid.UUID) error
+	RevokeAllForUser(username string) error
+}
@@ -0,0 +1,15 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"time"
+)
+
+type ResponseCacheRepository interface {
+	// Get returns nil when nothing is stored under key.
+	Get(key string) (*model.CachedResponse, error)
+	// Save replaces the response stored under its key, and its tags.
+	Save(response *model.CachedResponse, tags []string) error
+	DeleteTagged(tag string) error
+	DeleteExpiredBefore(before time.Time) error
+}
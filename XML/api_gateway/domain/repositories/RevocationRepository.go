@@ -0,0 +1,11 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"time"
+)
+
+type RevocationRepository interface {
+	Save(revocation *model.Revocation) error
+	GetActive(now time.Time) ([]model.Revocation, error)
+}
@@ -0,0 +1,15 @@
+package repositories
+
+import "gateway/module/domain/model"
+
+type RoleRepository interface {
+	GetAll() ([]model.RoleDefinition, error)
+	Get(name string) (*model.RoleDefinition, error)
+	// Save creates or updates role and replaces its permissions.
+	Save(role *model.RoleDefinition, permissions []string) error
+	Delete(name string) error
+	GetUserRoles(username string) ([]string, error)
+	// GetUsersWithRoles returns the users assigned any of roles.
+	GetUsersWithRoles(roles []string) ([]string, error)
+	SetUserRoles(username string, roles []string) error
+}
@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"time"
+)
+
+type SigningKeyRepository interface {
+	Save(key *model.SigningKey) error
+	GetCreatedAfter(t time.Time) ([]model.SigningKey, error)
+	DeleteCreatedBefore(t time.Time) error
+}
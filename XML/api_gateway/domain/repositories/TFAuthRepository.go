@@ -5,7 +5,13 @@ import "gateway/module/domain/model"
 type TFAuthRepository interface {
 	Check2FaForUser(username string) (bool, error)
 	Enable2FaForUser(username string, secret string) (bool, error)
+	Confirm2FaForUser(username string) error
 	Disable2FaForUser(username string) (bool, error)
 	GetUserSecret(username string) (string, error)
 	GetUserQr(username string) (model.QrCode, error)
+	GetPendingQr(username string) (model.QrCode, error)
+	UseCounter(qr model.QrCode, counter int) (bool, error)
+	ReplaceRecoveryCodes(username string, codes []model.RecoveryCode) error
+	GetUnusedRecoveryCodes(username string) ([]model.RecoveryCode, error)
+	UseRecoveryCode(code model.RecoveryCode) (bool, error)
 }
@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"time"
+)
+
+type TimelineRepository interface {
+	// Add puts entries in their owners' timelines. Entries that are already
+	// there are left as they are.
+	Add(entries []model.TimelineEntry) error
+	// Page returns up to limit entries of owner's timeline, newest first,
+	// that come after the entry of afterPost posted at after. A zero after
+	// starts from the newest entry.
+	Page(owner string, after time.Time, afterPost string, limit int) ([]model.TimelineEntry, error)
+	// RemoveAuthor takes every post of author out of owner's timeline.
+	RemoveAuthor(owner string, author string) error
+	// IsBuilt reports whether owner's timeline was last built at or after
+	// since.
+	IsBuilt(owner string, since time.Time) (bool, error)
+	MarkBuilt(owner string) error
+}
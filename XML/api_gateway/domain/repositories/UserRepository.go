@@ -10,4 +10,6 @@ type UserRepository interface {
 	UserExists(username string) error
 	GetUserSalt(username string) (string, error)
 	GetUserRole(username string) (string, error)
+	// GetUsernamesWithRole returns the users whose account has role.
+	GetUsernamesWithRole(role string) ([]string, error)
 }
@@ -0,0 +1,20 @@
+package repositories
+
+import (
+	"gateway/module/domain/model"
+	"github.com/google/uuid"
+	"time"
+)
+
+type WebAuthnRepository interface {
+	CreateCredential(credential *model.WebAuthnCredential) error
+	GetCredentials(username string) ([]model.WebAuthnCredential, error)
+	GetCredentialByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error)
+	UpdateCredentialUse(id uuid.UUID, signCount uint32, usedAt time.Time) error
+	RenameCredential(id uuid.UUID, username string, name string) error
+	DeleteCredential(id uuid.UUID, username string) error
+	CreateSession(session *model.WebAuthnSession) error
+	// TakeSession returns the session and deletes it, so every challenge can
+	// be answered only once.
+	TakeSession(id uuid.UUID) (*model.WebAuthnSession, error)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"common/module/logger"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerState is what the status endpoint reports about a backend.
+type BreakerState struct {
+	Backend  string
+	State    string
+	Failures int
+	OpenedAt time.Time
+}
+
+// CircuitBreaker stops calls to a backend that failed failures times in a
+// row, so requests fail at once instead of piling up behind a dead service.
+// After cooldown a single call is let through; the breaker closes when it
+// succeeds and opens again when it doesn't.
+type CircuitBreaker struct {
+	backend  string
+	failures int
+	cooldown time.Duration
+	logInfo  *logger.Logger
+	logError *logger.Logger
+
+	mutex       sync.Mutex
+	state       string
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+}
+
+func NewCircuitBreaker(backend string, failures int, cooldown time.Duration, logInfo *logger.Logger, logError *logger.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		backend:  backend,
+		failures: failures,
+		cooldown: cooldown,
+		logInfo:  logInfo,
+		logError: logError,
+		state:    BreakerClosed,
+	}
+}
+
+// Allow returns the error to fail a call with when the breaker is open.
+func (b *CircuitBreaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return status.Errorf(codes.Unavailable, "%s is unavailable", b.backend)
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return status.Errorf(codes.Unavailable, "%s is unavailable", b.backend)
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Record counts the outcome of a call Allow let through. Only errors that
+// say the backend is down or too slow count against it; a call that was
+// refused for its content proves the backend is up.
+func (b *CircuitBreaker) Record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+	// The caller gave up; that says nothing about the backend.
+	if status.Code(err) == codes.Canceled {
+		return
+	}
+	if !backendFailed(err) {
+		if b.state != BreakerClosed {
+			b.logInfo.Logger.WithFields(logrus.Fields{
+				"backend": b.backend,
+			}).Infof("INFO:CIRCUIT BREAKER CLOSED")
+		}
+		b.state = BreakerClosed
+		b.consecutive = 0
+		return
+	}
+
+	b.consecutive++
+	if b.state == BreakerHalfOpen || b.consecutive >= b.failures {
+		if b.state != BreakerOpen {
+			b.logError.Logger.WithFields(logrus.Fields{
+				"backend":  b.backend,
+				"failures": b.consecutive,
+			}).Errorf("ERR:CIRCUIT BREAKER OPEN: %v", err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return BreakerState{
+		Backend:  b.backend,
+		State:    b.state,
+		Failures: b.consecutive,
+		OpenedAt: b.openedAt,
+	}
+}
+
+func backendFailed(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
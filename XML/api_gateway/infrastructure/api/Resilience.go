@@ -0,0 +1,175 @@
+package api
+
+import (
+	"common/module/logger"
+	"context"
+	"fmt"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResilienceConfig says how patient the gateway is with the services. Every
+// call gets Timeout, or its entry in Timeouts (keyed by full method name),
+// for all of its attempts together. Reads are retried Retries times after
+// failing with Unavailable, waiting a random time up to Backoff, doubled on
+// every attempt. A backend's breaker opens after BreakerFailures failures in
+// a row and lets a call through again after BreakerCooldown.
+type ResilienceConfig struct {
+	Timeout         time.Duration
+	Timeouts        map[string]time.Duration
+	Retries         int
+	Backoff         time.Duration
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// Resilience guards the gateway's calls to the services with an interceptor
+// per backend. Connections to the same backend share its circuit breaker.
+type Resilience struct {
+	config   ResilienceConfig
+	logInfo  *logger.Logger
+	logError *logger.Logger
+	reads    map[string]bool
+	mutex    sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewResilience(config ResilienceConfig, logInfo *logger.Logger, logError *logger.Logger) *Resilience {
+	return &Resilience{
+		config:   config,
+		logInfo:  logInfo,
+		logError: logError,
+		reads:    readMethods(),
+		breakers: map[string]*CircuitBreaker{},
+	}
+}
+
+// Interceptor guards calls to backend.
+func (r *Resilience) Interceptor(backend string) grpc.UnaryClientInterceptor {
+	breaker := r.breaker(backend)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := context.WithTimeout(ctx, r.timeout(method))
+		defer cancel()
+
+		retries := 0
+		if r.reads[method] {
+			retries = r.config.Retries
+		}
+		for attempt := 0; ; attempt++ {
+			err := breaker.Allow()
+			if err != nil {
+				return err
+			}
+			err = invoker(ctx, method, req, reply, cc, opts...)
+			breaker.Record(err)
+			if err == nil || status.Code(err) != codes.Unavailable || attempt >= retries {
+				return err
+			}
+			select {
+			case <-time.After(r.backoff(attempt)):
+			case <-ctx.Done():
+				return err
+			}
+		}
+	}
+}
+
+// Breakers reports the state of every backend's breaker, by backend name.
+func (r *Resilience) Breakers() []BreakerState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	states := make([]BreakerState, 0, len(r.breakers))
+	for _, breaker := range r.breakers {
+		states = append(states, breaker.State())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Backend < states[j].Backend
+	})
+	return states
+}
+
+func (r *Resilience) breaker(backend string) *CircuitBreaker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	breaker, ok := r.breakers[backend]
+	if !ok {
+		breaker = NewCircuitBreaker(backend, r.config.BreakerFailures, r.config.BreakerCooldown, r.logInfo, r.logError)
+		r.breakers[backend] = breaker
+	}
+	return breaker
+}
+
+func (r *Resilience) timeout(method string) time.Duration {
+	timeout, ok := r.config.Timeouts[method]
+	if !ok {
+		return r.config.Timeout
+	}
+	return timeout
+}
+
+// backoff spreads retries out at random, so the callers of a backend that
+// just came back don't all hit it at the same moment.
+func (r *Resilience) backoff(attempt int) time.Duration {
+	limit := r.config.Backoff << attempt
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// readMethods finds the methods that are safe to retry: those the services
+// expose over HTTP GET.
+func readMethods() map[string]bool {
+	reads := map[string]bool{}
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				options := method.Options()
+				if !proto.HasExtension(options, annotations.E_Http) {
+					continue
+				}
+				binding := proto.GetExtension(options, annotations.E_Http).(*annotations.HttpRule)
+				if binding.GetGet() != "" {
+					reads["/"+string(services.Get(i).FullName())+"/"+string(method.Name())] = true
+				}
+			}
+		}
+		return true
+	})
+	return reads
+}
+
+// ParseTimeouts parses per-method timeouts, given as a comma separated list
+// of "/package.Service/Method=duration".
+func ParseTimeouts(list string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("timeout %q: want method=duration", entry)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout %q: invalid duration", entry)
+		}
+		timeouts[strings.TrimSpace(method)] = timeout
+	}
+	return timeouts, nil
+}
@@ -2,33 +2,41 @@ package api
 
 import (
 	connectionPb "common/module/proto/connection_service"
+	notificationPb "common/module/proto/notification_service"
 	postPb "common/module/proto/posts_service"
 	userPb "common/module/proto/user_service"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"log"
 )
 
-func NewUserClient(serviceAddress string) userPb.UserServiceClient {
-	conn, err := grpc.Dial(serviceAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewUserClient(serviceAddress string, options ...grpc.DialOption) userPb.UserServiceClient {
+	conn, err := grpc.Dial(serviceAddress, options...)
 	if err != nil {
 		log.Fatalf("Failed to start gRPC connection to User service: %v", err)
 	}
 	return userPb.NewUserServiceClient(conn)
 }
 
-func NewPostClient(serviceAddress string) postPb.PostServiceClient {
-	conn, err := grpc.Dial(serviceAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewPostClient(serviceAddress string, options ...grpc.DialOption) postPb.PostServiceClient {
+	conn, err := grpc.Dial(serviceAddress, options...)
 	if err != nil {
 		log.Fatalf("Failed to start gRPC connection to Post service: %v", err)
 	}
 	return postPb.NewPostServiceClient(conn)
 }
 
-func NewConnectionClient(serviceAddress string) connectionPb.ConnectionServiceClient {
-	conn, err := grpc.Dial(serviceAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewConnectionClient(serviceAddress string, options ...grpc.DialOption) connectionPb.ConnectionServiceClient {
+	conn, err := grpc.Dial(serviceAddress, options...)
 	if err != nil {
 		log.Fatalf("Failed to start gRPC connection to Connection service: %v", err)
 	}
 	return connectionPb.NewConnectionServiceClient(conn)
 }
+
+func NewNotificationClient(serviceAddress string, options ...grpc.DialOption) notificationPb.NotificationServiceClient {
+	conn, err := grpc.Dial(serviceAddress, options...)
+	if err != nil {
+		log.Fatalf("Failed to start gRPC connection to Notification service: %v", err)
+	}
+	return notificationPb.NewNotificationServiceClient(conn)
+}
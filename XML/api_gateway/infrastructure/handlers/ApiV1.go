@@ -0,0 +1,41 @@
+package handlers
+
+import "fmt"
+
+// V1Adapters serve v1 over the handlers of v2. v1 took TOTP codes as the
+// number "token", which loses leading zeros, where v2 takes the string
+// "code"; and v1 answered a password check with "twofa", which v2 dropped
+// for the factors it was made of.
+//
+// v1 logged in with a second factor by sending the username with the code,
+// where v2 takes the ticket of the password check. A username can't be
+// turned into a ticket, so that route isn't compatible and is retired.
+var V1Adapters = map[string]Adapter{
+	"POST /2fa/authenticate": {Retired: "v1 two-factor logins are retired: send the ticket of " +
+		"POST /v2/users/auth/user with the code to POST /v2/2fa/authenticate"},
+	"POST /2fa/confirm":        {Request: codeFromToken},
+	"POST /2fa/recovery-codes": {Request: codeFromToken},
+	"POST /users/auth/user":    {Response: twofaFromFactors},
+	// A login link answers with a ticket when the account has a second factor.
+	"GET /users/login/passwordless/{id}": {Response: twofaFromFactors},
+}
+
+func codeFromToken(body map[string]interface{}) {
+	token, ok := body["token"].(float64)
+	if !ok {
+		return
+	}
+	delete(body, "token")
+	if _, ok := body["code"]; !ok {
+		body["code"] = fmt.Sprintf("%06d", int64(token))
+	}
+}
+
+func twofaFromFactors(body map[string]interface{}) {
+	if _, ok := body["ticket"]; !ok {
+		return
+	}
+	totp, _ := body["totp"].(bool)
+	webAuthn, _ := body["webauthn"].(bool)
+	body["twofa"] = totp || webAuthn
+}
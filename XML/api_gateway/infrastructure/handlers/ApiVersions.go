@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"bytes"
+	"common/module/logger"
+	"encoding/json"
+	"fmt"
+	myerr "gateway/module/application/errors"
+	"gateway/module/openapi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAdaptedBody bounds the request bodies an Adapter rewrites.
+const maxAdaptedBody = 1 << 20
+
+// ApiVersion is a version of the REST API, mounted under /<Name>. Routes are
+// handled in the shapes of the current version; Adapters, keyed like the
+// policy ("METHOD /path/{param}"), map the shapes of this version to them.
+type ApiVersion struct {
+	Name string
+	// Deprecated is when the version was deprecated, zero while it isn't.
+	Deprecated time.Time
+	// Sunset is when a deprecated version stops being served.
+	Sunset   time.Time
+	Adapters map[string]Adapter
+}
+
+// Adapter rewrites the JSON objects a route takes and answers with. Bodies
+// that aren't objects are passed through as they are. A route that can't be
+// adapted is Retired: it answers 410 with the reason, which should tell
+// callers what to use instead.
+type Adapter struct {
+	Request  func(body map[string]interface{})
+	Response func(body map[string]interface{})
+	Retired  string
+}
+
+// ApiVersions strips the version off a request's path before the request is
+// authorized and routed, so the policy and the mux only know unversioned
+// routes. Paths without a version are served as the unversioned version,
+// which keeps clients that predate versions working until its sunset.
+type ApiVersions struct {
+	logInfo     *logger.Logger
+	ordered     []*ApiVersion
+	versions    map[string]*ApiVersion
+	current     *ApiVersion
+	unversioned *ApiVersion
+}
+
+// NewApiVersions takes the versions from the oldest to the current one.
+func NewApiVersions(logInfo *logger.Logger, unversioned string, versions ...*ApiVersion) *ApiVersions {
+	v := &ApiVersions{
+		logInfo:  logInfo,
+		ordered:  versions,
+		versions: map[string]*ApiVersion{},
+		current:  versions[len(versions)-1],
+	}
+	for _, version := range versions {
+		v.versions[version.Name] = version
+	}
+	v.unversioned = v.versions[unversioned]
+	return v
+}
+
+// Current is the prefix of the current version's paths.
+func (v *ApiVersions) Current() string {
+	return "/" + v.current.Name
+}
+
+// Servers lists the versions for the API's description, the current first.
+func (v *ApiVersions) Servers() []openapi.Server {
+	servers := []openapi.Server{{Url: v.Current(), Description: "Current version"}}
+	for i := len(v.ordered) - 2; i >= 0; i-- {
+		version := v.ordered[i]
+		description := fmt.Sprintf("Deprecated, served until %s", version.Sunset.UTC().Format("2006-01-02"))
+		if retired := version.retired(); len(retired) > 0 {
+			description += fmt.Sprintf(", except for %s, which answer 410", strings.Join(retired, ", "))
+		}
+		servers = append(servers, openapi.Server{Url: "/" + version.Name, Description: description})
+	}
+	return servers
+}
+
+func (v *ApiVersions) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		version, path := v.route(r.URL.Path)
+		if !version.Deprecated.IsZero() {
+			if !v.announce(rw, r, version, path) {
+				return
+			}
+		}
+		r = withPath(r, path)
+
+		adapter, ok := version.adapter(r.Method, path)
+		if !ok {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if adapter.Retired != "" {
+			myerr.NewProblem(r, http.StatusGone, myerr.CodeApiRetired, adapter.Retired).Write(rw)
+			return
+		}
+		if adapter.Request != nil {
+			r = adaptRequest(rw, r, adapter.Request)
+		}
+		if adapter.Response == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		response := &adaptedResponse{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(response, r)
+		response.finish(adapter.Response)
+	})
+}
+
+// route splits path into its version and the route it names.
+func (v *ApiVersions) route(path string) (*ApiVersion, string) {
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if version, ok := v.versions[segment]; ok {
+		return version, "/" + rest
+	}
+	return v.unversioned, path
+}
+
+// announce sets the headers of a deprecated version and logs its use, so the
+// callers that still need moving can be found. It answers 410 itself once
+// the version is past its sunset.
+func (v *ApiVersions) announce(rw http.ResponseWriter, r *http.Request, version *ApiVersion, path string) bool {
+	header := rw.Header()
+	header.Set("Deprecation", "@"+strconv.FormatInt(version.Deprecated.Unix(), 10))
+	header.Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+	header.Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", v.Current(), path))
+
+	sunset := time.Now().After(version.Sunset)
+	v.logInfo.Logger.WithFields(logrus.Fields{
+		"version":   version.Name,
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"userIP":    ReadUserIP(r),
+		"userAgent": r.UserAgent(),
+		"sunset":    sunset,
+	}).Infof("INFO:DEPRECATED API VERSION CALLED")
+	if sunset {
+		myerr.NewProblem(r, http.StatusGone, myerr.CodeApiRetired,
+			fmt.Sprintf("API %s was retired, use %s", version.Name, v.Current())).Write(rw)
+		return false
+	}
+	return true
+}
+
+func (version *ApiVersion) adapter(method string, path string) (Adapter, bool) {
+	for key, adapter := range version.Adapters {
+		routeMethod, pattern, _ := strings.Cut(key, " ")
+		if routeMethod == method && matchPath(pattern, path) {
+			return adapter, true
+		}
+	}
+	return Adapter{}, false
+}
+
+// retired lists the routes of version that answer 410, sorted.
+func (version *ApiVersion) retired() []string {
+	var routes []string
+	for key, adapter := range version.Adapters {
+		if adapter.Retired != "" {
+			routes = append(routes, key)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// matchPath tells whether path fits pattern, whose {param} segments match
+// any one segment.
+func matchPath(pattern string, path string) bool {
+	_, ok := pathParams(pattern, path)
+	return ok
+}
+
+// pathParams matches path against pattern and returns the segments its
+// {param} segments matched, by name.
+func pathParams(pattern string, path string) (map[string]string, bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func withPath(r *http.Request, path string) *http.Request {
+	if r.URL.Path == path {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.URL.Path = path
+	r.URL.RawPath = ""
+	return r
+}
+
+func adaptRequest(rw http.ResponseWriter, r *http.Request, adapt func(map[string]interface{})) *http.Request {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxAdaptedBody))
+	if err != nil {
+		// The handler reports the body it can't read.
+		return r
+	}
+	var object map[string]interface{}
+	if json.Unmarshal(body, &object) == nil && object != nil {
+		adapt(object)
+		body, _ = json.Marshal(object)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return r
+}
+
+// adaptedResponse holds the response back until it's adapted. Some handlers
+// write JSON without a Content-Type, so bodies without one are tried too.
+type adaptedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (a *adaptedResponse) WriteHeader(status int) {
+	a.status = status
+}
+
+func (a *adaptedResponse) Write(data []byte) (int, error) {
+	return a.body.Write(data)
+}
+
+func (a *adaptedResponse) finish(adapt func(map[string]interface{})) {
+	body := a.body.Bytes()
+	contentType := a.Header().Get("Content-Type")
+	var object map[string]interface{}
+	if (contentType == "" || strings.HasPrefix(contentType, "application/json")) &&
+		json.Unmarshal(body, &object) == nil && object != nil {
+		adapt(object)
+		body, _ = json.Marshal(object)
+		a.Header().Set("Content-Type", "application/json")
+	}
+	a.Header().Del("Content-Length")
+	a.ResponseWriter.WriteHeader(a.status)
+	_, err := a.ResponseWriter.Write(body)
+	if err != nil {
+		return
+	}
+}
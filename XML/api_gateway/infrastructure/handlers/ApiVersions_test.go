@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"common/module/logger"
+	"encoding/json"
+	myerr "gateway/module/application/errors"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routed is what the handler behind the versions got.
+type routed struct {
+	called bool
+	path   string
+	body   map[string]interface{}
+}
+
+// newTestVersions serves v1 with its adapters, deprecated a day ago and
+// retired at sunset, and v2. The handler behind them answers a password
+// check the way v2 does.
+func newTestVersions(t *testing.T, sunset time.Time) (http.Handler, *ApiVersions, *routed, time.Time) {
+	l, _ := logtest.NewNullLogger()
+	deprecated := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	v1 := &ApiVersion{Name: "v1", Deprecated: deprecated, Sunset: sunset, Adapters: V1Adapters}
+	versions := NewApiVersions(&logger.Logger{Logger: l}, "v1", v1, &ApiVersion{Name: "v2"})
+
+	got := &routed{}
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got.called, got.path, got.body = true, r.URL.Path, nil
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &got.body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if r.URL.Path == "/users/auth/user" {
+			writeJson(rw, map[string]interface{}{"ticket": "ticket", "totp": true, "webauthn": false})
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	return versions.Handler(next), versions, got, deprecated
+}
+
+func serve(h http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rw
+}
+
+func TestApiVersionsStripTheVersion(t *testing.T) {
+	h, _, got, _ := newTestVersions(t, time.Now().Add(time.Hour))
+	cases := []struct {
+		path       string
+		route      string
+		deprecated bool
+	}{
+		{"/v2/users/user/details", "/users/user/details", false},
+		{"/v1/users/user/details", "/users/user/details", true},
+		// Paths without a version are v1, and so are those with a segment
+		// that isn't one.
+		{"/users/user/details", "/users/user/details", true},
+		{"/v3/users/user/details", "/v3/users/user/details", true},
+	}
+	for _, c := range cases {
+		rw := serve(h, "GET", c.path, "")
+		if !got.called || got.path != c.route {
+			t.Errorf("%s: routed to %q, want %q", c.path, got.path, c.route)
+		}
+		if deprecated := rw.Header().Get("Deprecation") != ""; deprecated != c.deprecated {
+			t.Errorf("%s: deprecated %v, want %v", c.path, deprecated, c.deprecated)
+		}
+	}
+}
+
+func TestApiVersionsAnnounceTheDeprecation(t *testing.T) {
+	sunset := time.Now().Add(time.Hour)
+	h, _, _, deprecated := newTestVersions(t, sunset)
+	header := serve(h, "GET", "/v1/users/user/details", "").Header()
+	if got, want := header.Get("Deprecation"), "@"+strconv.FormatInt(deprecated.Unix(), 10); got != want {
+		t.Errorf("Deprecation %q, want %q", got, want)
+	}
+	if got, want := header.Get("Sunset"), sunset.UTC().Format(http.TimeFormat); got != want {
+		t.Errorf("Sunset %q, want %q", got, want)
+	}
+	if got, want := header.Get("Link"), `</v2/users/user/details>; rel="successor-version"`; got != want {
+		t.Errorf("Link %q, want %q", got, want)
+	}
+}
+
+func TestApiVersionsRetireAtSunset(t *testing.T) {
+	h, _, got, _ := newTestVersions(t, time.Now().Add(-time.Hour))
+	for _, path := range []string{"/v1/users/user/details", "/users/user/details"} {
+		rw := serve(h, "GET", path, "")
+		var problem myerr.Problem
+		if err := json.Unmarshal(rw.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+		if rw.Code != http.StatusGone || problem.Code != myerr.CodeApiRetired || got.called {
+			t.Errorf("%s: got %d %+v, routed %v; want 410 %s", path, rw.Code, problem, got.called, myerr.CodeApiRetired)
+		}
+	}
+	if rw := serve(h, "GET", "/v2/users/user/details", ""); !got.called || rw.Code != http.StatusNoContent {
+		t.Fatalf("v2 got %d after the sunset of v1", rw.Code)
+	}
+}
+
+func TestApiVersionsAdaptV1(t *testing.T) {
+	h, _, got, _ := newTestVersions(t, time.Now().Add(time.Hour))
+
+	// v1 sent codes as numbers, which lose their leading zeros.
+	serve(h, "POST", "/v1/2fa/confirm", `{"username":"alice","token":1234}`)
+	if want := map[string]interface{}{"username": "alice", "code": "001234"}; !reflect.DeepEqual(got.body, want) {
+		t.Errorf("v1 sent %v, want %v", got.body, want)
+	}
+	serve(h, "POST", "/v2/2fa/confirm", `{"username":"alice","token":1234}`)
+	if want := map[string]interface{}{"username": "alice", "token": float64(1234)}; !reflect.DeepEqual(got.body, want) {
+		t.Errorf("v2 sent %v, want the body as it was", got.body)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(serve(h, "POST", "/v1/users/auth/user", `{}`).Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response["twofa"] != true || response["ticket"] != "ticket" {
+		t.Errorf("v1 got %v, want twofa with the ticket", response)
+	}
+	response = nil
+	if err := json.Unmarshal(serve(h, "POST", "/v2/users/auth/user", `{}`).Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := response["twofa"]; ok {
+		t.Errorf("v2 got %v, want no twofa", response)
+	}
+}
+
+func TestApiVersionsRetiredRoutes(t *testing.T) {
+	h, versions, got, _ := newTestVersions(t, time.Now().Add(time.Hour))
+	got.called = false
+	rw := serve(h, "POST", "/v1/2fa/authenticate", `{"username":"alice","token":123456}`)
+	var problem myerr.Problem
+	if err := json.Unmarshal(rw.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Code != http.StatusGone || problem.Code != myerr.CodeApiRetired || got.called {
+		t.Fatalf("got %d %+v, routed %v; want 410 %s", rw.Code, problem, got.called, myerr.CodeApiRetired)
+	}
+	if rw := serve(h, "POST", "/v2/2fa/authenticate", `{"ticket":"ticket","code":"123456"}`); !got.called || rw.Code != http.StatusNoContent {
+		t.Fatalf("v2 got %d", rw.Code)
+	}
+
+	servers := versions.Servers()
+	if len(servers) != 2 || !strings.Contains(servers[1].Description, "POST /2fa/authenticate") {
+		t.Fatalf("the servers %+v don't say which v1 routes are retired", servers)
+	}
+}
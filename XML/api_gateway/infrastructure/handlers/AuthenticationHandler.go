@@ -2,26 +2,32 @@ package handlers
 
 import (
 	common "common/module"
+	domainErrors "common/module/errors"
 	"common/module/interceptor"
 	"common/module/logger"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	myerr "gateway/module/application/errors"
 	"gateway/module/application/helpers"
 	"gateway/module/application/services"
 	"gateway/module/auth"
 	"gateway/module/domain/dto"
 	modelGateway "gateway/module/domain/model"
+	"github.com/google/uuid"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/go-playground/validator.v9"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type AuthenticationHandler struct {
@@ -33,13 +39,26 @@ type AuthenticationHandler struct {
 	validator           *validator.Validate
 	passwordUtil        *helpers.PasswordUtil
 	passwordLessService *services.PasswordLessService
+	refreshTokenService *services.RefreshTokenService
+	revocationService   *services.RevocationService
+	keyManager          *auth.KeyManager
+	loginAttemptService *services.LoginAttemptService
+	mfaTicketService    *services.MfaTicketService
+	webAuthnService     *services.WebAuthnService
+	sessionService      *services.SessionService
+	roleService         *services.RoleService
 }
 
 func NewAuthenticationHandler(l *log.Logger, logInfo *logger.Logger, logError *logger.Logger, userService *services.UserService,
 	tfaService *services.TFAuthService,
 	validator *validator.Validate,
-	passwordUtil *helpers.PasswordUtil, passwordLessService *services.PasswordLessService) Handler {
-	return &AuthenticationHandler{l, logInfo, logError, userService, tfaService, validator, passwordUtil, passwordLessService}
+	passwordUtil *helpers.PasswordUtil, passwordLessService *services.PasswordLessService,
+	refreshTokenService *services.RefreshTokenService, revocationService *services.RevocationService, keyManager *auth.KeyManager,
+	loginAttemptService *services.LoginAttemptService, mfaTicketService *services.MfaTicketService,
+	webAuthnService *services.WebAuthnService, sessionService *services.SessionService, roleService *services.RoleService) Handler {
+	return &AuthenticationHandler{l, logInfo, logError, userService, tfaService, validator, passwordUtil, passwordLessService,
+		refreshTokenService, revocationService, keyManager, loginAttemptService, mfaTicketService,
+		webAuthnService, sessionService, roleService}
 }
 
 func (a AuthenticationHandler) Init(mux *runtime.ServeMux) {
@@ -69,6 +88,14 @@ func (a AuthenticationHandler) Init(mux *runtime.ServeMux) {
 	if err != nil {
 		panic(err)
 	}
+	err = mux.HandlePath("POST", "/2fa/confirm", a.Confirm2FaForUser)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/2fa/recovery-codes", a.RegenerateRecoveryCodes)
+	if err != nil {
+		panic(err)
+	}
 
 	err = mux.HandlePath("POST", "/users/login/passwordless", a.PasswordLessLoginReq)
 	if err != nil {
@@ -78,6 +105,62 @@ func (a AuthenticationHandler) Init(mux *runtime.ServeMux) {
 	if err != nil {
 		panic(err)
 	}
+	err = mux.HandlePath("POST", "/users/login/unlock", a.UnlockAccount)
+	if err != nil {
+		panic(err)
+	}
+
+	err = mux.HandlePath("POST", "/webauthn/register/begin", a.WebAuthnBeginRegistration)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/webauthn/register/finish", a.WebAuthnFinishRegistration)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/webauthn/credentials", a.WebAuthnCredentials)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("PUT", "/webauthn/credentials/{id}", a.WebAuthnRenameCredential)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("DELETE", "/webauthn/credentials/{id}", a.WebAuthnRemoveCredential)
+	if err != nil {
+		panic(err)
+	}
+	// Replaces the route generated for UserService.GenerateAPIToken: API
+	// tokens are signed with the gateway's keys, like access tokens.
+	err = mux.HandlePath("POST", "/users/token/generate", a.GenerateApiToken)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/webauthn/login/begin", a.WebAuthnBeginLogin)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/webauthn/login/finish", a.WebAuthnFinishLogin)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/webauthn/2fa/begin", a.WebAuthnBeginSecondFactor)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/webauthn/2fa/finish", a.WebAuthnFinishSecondFactor)
+	if err != nil {
+		panic(err)
+	}
+
+	err = mux.HandlePath("POST", "/users/auth/refresh", a.RefreshToken)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("POST", "/users/auth/logout", a.Logout)
+	if err != nil {
+		panic(err)
+	}
 
 }
 
@@ -87,7 +170,7 @@ func (a AuthenticationHandler) Check2FaForUser(rw http.ResponseWriter, r *http.R
 
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(rw, "Error decoding request", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
 	policy := bluemonday.UGCPolicy()
@@ -95,7 +178,7 @@ func (a AuthenticationHandler) Check2FaForUser(rw http.ResponseWriter, r *http.R
 	request.Username = strings.TrimSpace(policy.Sanitize(request.Username))
 	res, err := a.tfaService.Check2FaForUser(request.Username)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
 		return
 	}
 
@@ -115,11 +198,15 @@ func (a AuthenticationHandler) Enable2FaForUser(rw http.ResponseWriter, r *http.
 
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(rw, "Error decoding request", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
 	policy := bluemonday.UGCPolicy()
 	request.Username = strings.TrimSpace(policy.Sanitize(request.Username))
+	if request.Username != auth.Caller(r).Username {
+		myerr.WriteProblem(rw, r, errForbidden)
+		return
+	}
 
 	res, uri, _ := a.tfaService.Enable2FaForUser(request.Username)
 	enable2FaResponse := dto.Enable2FaResponse{
@@ -141,12 +228,16 @@ func (a AuthenticationHandler) Disable2FaForUser(rw http.ResponseWriter, r *http
 
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(rw, "Error decoding request", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
 	policy := bluemonday.UGCPolicy()
 
 	request.Username = strings.TrimSpace(policy.Sanitize(request.Username))
+	if request.Username != auth.Caller(r).Username {
+		myerr.WriteProblem(rw, r, errForbidden)
+		return
+	}
 	res, _ := a.tfaService.Disable2FaForUser(request.Username)
 
 	response, _ := json.Marshal(res)
@@ -158,6 +249,70 @@ func (a AuthenticationHandler) Disable2FaForUser(rw http.ResponseWriter, r *http
 	rw.Header().Set("Content-Type", "application/json")
 }
 
+func (a AuthenticationHandler) Confirm2FaForUser(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Printf("Handling Confirm2FaForUser Users ")
+	ip := ReadUserIP(r)
+
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	var request dto.AuthenticateRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+
+	recoveryCodes, err := a.tfaService.Confirm2FaForUser(claims.Username, request.Code)
+	if err != nil {
+		a.LogError(ip, claims.Username, "2FA CONFIRMATION FAILED")
+		myerr.WriteProblem(rw, r, errInvalidCode)
+		return
+	}
+	a.LogInfo(ip, "2FA enabled for user "+claims.Username)
+
+	response, _ := json.Marshal(dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	rw.Header().Set("Content-Type", "application/json")
+	_, err = rw.Write(response)
+	if err != nil {
+		return
+	}
+}
+
+func (a AuthenticationHandler) RegenerateRecoveryCodes(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Printf("Handling RegenerateRecoveryCodes Users ")
+	ip := ReadUserIP(r)
+
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	var request dto.AuthenticateRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+
+	recoveryCodes, err := a.tfaService.RegenerateRecoveryCodes(claims.Username, request.Code)
+	if err != nil {
+		a.LogError(ip, claims.Username, "RECOVERY CODE REGENERATION FAILED")
+		myerr.WriteProblem(rw, r, errInvalidCode)
+		return
+	}
+	a.LogInfo(ip, "Recovery codes regenerated for user "+claims.Username)
+
+	response, _ := json.Marshal(dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	rw.Header().Set("Content-Type", "application/json")
+	_, err = rw.Write(response)
+	if err != nil {
+		return
+	}
+}
+
 func (a AuthenticationHandler) AuthenticateUser(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
 	a.l.Println("Handling AuthenticateUser Users")
 
@@ -165,13 +320,18 @@ func (a AuthenticationHandler) AuthenticateUser(rw http.ResponseWriter, r *http.
 
 	err := json.NewDecoder(r.Body).Decode(&loginRequest)
 	if err != nil {
-		http.Error(rw, "Error decoding loginRequest:"+err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
 	ip := ReadUserIP(r)
 	err = CheckForAttack(loginRequest, ip, a)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, err)
+		return
+	}
+	err = a.loginAttemptService.Attempt(loginRequest.Username, ip)
+	if err != nil {
+		writeThrottled(rw, r, err)
 		return
 	}
 	a.logInfo.Logger.WithFields(logrus.Fields{
@@ -181,53 +341,83 @@ func (a AuthenticationHandler) AuthenticateUser(rw http.ResponseWriter, r *http.
 
 	user, err := a.userService.GetByUsername(context.TODO(), loginRequest.Username)
 	if err != nil {
-		http.Error(rw, "Invalid credentials!", http.StatusBadRequest)
 		a.logError.Logger.WithFields(logrus.Fields{
 			"user":   loginRequest.Username,
 			"userIP": ip,
 		}).Errorf("ERR:USER NOT FOUND")
-		http.Error(rw, "User not found! "+err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errInvalidCredentials)
 		return
 	}
 	if !user.IsConfirmed {
-		http.Error(rw, "Check your mail for activation code! ", http.StatusBadRequest)
 		a.logError.Logger.WithFields(logrus.Fields{
 			"user":   loginRequest.Username,
 			"userIP": ip,
 		}).Errorf("ERR:USER NOT ACTIVATED")
+		myerr.WriteProblem(rw, r, errNotActivated)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password))
 	if err != nil {
-		http.Error(rw, "Invalid credentials!", http.StatusBadRequest)
 		a.logError.Logger.WithFields(logrus.Fields{
 			"user":   loginRequest.Username,
 			"userIP": ip,
 		}).Errorf("ERR:INCORRECT PASSWORD")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errInvalidCredentials)
 		return
 	}
 
-	policy := bluemonday.UGCPolicy()
+	twofa, webAuthn, ok := a.secondFactors(rw, r, user.Username, ip)
+	if !ok {
+		return
+	}
+	// With 2FA on, the attempt stays counted until the second factor is in.
+	if !twofa && !webAuthn {
+		a.loginAttemptService.Succeeded(user.Username, ip)
+	}
+	a.writeTicket(rw, r, user.Username, twofa, webAuthn, ip)
+}
 
-	loginRequest.Username = strings.TrimSpace(policy.Sanitize(loginRequest.Username))
-	twofa, err := a.tfaService.Check2FaForUser(loginRequest.Username)
+// secondFactors tells which second factors the account has. It answers the
+// request itself and returns false when they can't be loaded.
+func (a AuthenticationHandler) secondFactors(rw http.ResponseWriter, r *http.Request, username string, ip string) (bool, bool, bool) {
+	twofa, err := a.tfaService.Check2FaForUser(username)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		a.LogError(ip, username, "LOADING 2FA STATUS: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return false, false, false
+	}
+	webAuthn, err := a.webAuthnService.HasCredentials(username)
+	if err != nil {
+		a.LogError(ip, username, "LOADING WEBAUTHN CREDENTIALS: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return false, false, false
+	}
+	return twofa, webAuthn, true
+}
+
+// writeTicket answers a first factor with the ticket the session is then
+// exchanged for, along with the second factors the ticket asks for.
+func (a AuthenticationHandler) writeTicket(rw http.ResponseWriter, r *http.Request, username string, twofa bool, webAuthn bool, ip string) {
+	ticket, ticketExpirationTime, err := a.mfaTicketService.Issue(username, twofa || webAuthn, ip)
+	if err != nil {
+		a.LogError(ip, username, "ISSUING MFA TICKET")
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
 		return
 	}
 	res := dto.AuthenticateResponse{
-		Username: loginRequest.Username,
-		TwoFa:    twofa,
+		Username:             username,
+		Totp:                 twofa,
+		WebAuthn:             webAuthn,
+		Ticket:               ticket,
+		TicketExpirationTime: ticketExpirationTime,
 	}
 	response, _ := json.Marshal(res)
+	rw.Header().Set("Content-Type", "application/json")
 	_, err = rw.Write(response)
 	if err != nil {
 		return
 	}
-
-	rw.Header().Set("Content-Type", "application/json")
 }
 
 func (a AuthenticationHandler) Authenticate2Fa(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
@@ -236,161 +426,91 @@ func (a AuthenticationHandler) Authenticate2Fa(rw http.ResponseWriter, r *http.R
 
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(rw, "Error decoding request", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
-	policy := bluemonday.UGCPolicy()
 
-	request.Username = strings.TrimSpace(policy.Sanitize(request.Username))
-	userSecret, err := a.tfaService.GetUserSecret(request.Username)
+	ip := ReadUserIP(r)
+	ticket, err := a.mfaTicketService.Verify(request.Ticket, ip)
 	if err != nil {
-		http.Error(rw, "Error user secret", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errLoginExpired)
 		return
 	}
-	otpc := services.NewOTPConfig(userSecret)
-
-	val, err := otpc.Authenticate(strconv.Itoa(request.Token))
+	username := ticket.Subject
+	err = a.loginAttemptService.Attempt(username, ip)
 	if err != nil {
-		fmt.Println(err)
+		writeThrottled(rw, r, err)
 		return
 	}
-
-	if !val {
-		fmt.Println("Sorry, Not Authenticated")
-		return
+	code := request.RecoveryCode
+	if code == "" {
+		code = request.Code
 	}
-
-	fmt.Println("Authenticated!")
-
-	var claims = &interceptor.JwtClaims{}
-	claims.Username = request.Username
-
-	userRoles, err := a.userService.GetUserRole(request.Username)
-	ip := ReadUserIP(r)
+	val, err := a.tfaService.Authenticate(username, code)
 	if err != nil {
-		a.logError.Logger.WithFields(logrus.Fields{
-			"user":   request.Username,
-			"userIP": ip,
-		}).Errorf("ERR:THIS USER HAS NO ROLE")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
-		return
-
+		a.LogError(ip, username, "2FA CHECK: "+err.Error())
+		val = false
 	}
 
-	claims.Roles = append(claims.Roles, userRoles)
-
-	token, expirationTime, err := auth.GenerateToken(claims)
-
-	if err != nil {
-		a.logError.Logger.WithFields(logrus.Fields{
-			"user":   request.Username,
-			"userIP": ip,
-		}).Errorf("ERR:GENERATING TOKEN")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+	err = a.mfaTicketService.RedeemWithSecondFactor(ticket, val, ip)
+	if err == services.ErrInvalidTwoFactorCode {
+		myerr.WriteProblem(rw, r, errInvalidCode)
 		return
-
-	}
-	user, err := a.userService.GetByUsername(context.TODO(), request.Username)
-	var roleString string
-
-	if user.Role == modelGateway.Admin {
-		roleString = "Admin"
-	} else if user.Role == modelGateway.Agent {
-		roleString = "Agent"
-	} else if user.Role == modelGateway.Regular {
-		roleString = "Regular"
 	}
-
-	logInResponse := dto.LogInResponseDto{
-		Token:          token,
-		Role:           roleString,
-		Email:          user.Email,
-		Username:       user.Username,
-		ExpirationTime: expirationTime,
+	if err != nil {
+		myerr.WriteProblem(rw, r, errLoginExpired)
+		return
 	}
 
-	logInResponseJson, _ := json.Marshal(logInResponse)
-	rw.WriteHeader(http.StatusOK)
-	rw.Header().Set("Content-Type", "application/json")
-	_, err = rw.Write(logInResponseJson)
+	user, err := a.userService.GetByUsername(context.TODO(), username)
 	if err != nil {
+		a.LogError(ip, username, "USER NOT FOUND")
+		myerr.WriteProblem(rw, r, errUserNotFound)
 		return
 	}
+
+	a.loginAttemptService.Succeeded(user.Username, ip)
+	a.issueSession(rw, r, user, ip, modelGateway.LoginMethodTwoFactor)
 }
 
+// AuthenticateUserRegular finishes the login of a user without 2FA. The
+// ticket from AuthenticateUser is the proof that the password was checked.
 func (a AuthenticationHandler) AuthenticateUserRegular(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
 	a.l.Println("Handling AuthenticateUserRegular Users")
 
-	var loginRequest dto.UsernameRequest
+	var request dto.MfaTicketRequest
 
-	err := json.NewDecoder(r.Body).Decode(&loginRequest)
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(rw, "Error decoding loginRequest:"+err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
-	policy := bluemonday.UGCPolicy()
-	loginRequest.Username = strings.TrimSpace(policy.Sanitize(loginRequest.Username))
 
-	var claims = &interceptor.JwtClaims{}
-	claims.Username = loginRequest.Username
-
-	userRoles, err := a.userService.GetUserRole(loginRequest.Username)
 	ip := ReadUserIP(r)
-	if err != nil {
-		a.logError.Logger.WithFields(logrus.Fields{
-			"user":   loginRequest.Username,
-			"userIP": ip,
-		}).Errorf("ERR:THIS USER HAS NO ROLE")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
-		return
-
+	ticket, err := a.mfaTicketService.Verify(request.Ticket, ip)
+	if err == nil {
+		err = a.mfaTicketService.RedeemWithoutSecondFactor(ticket, ip)
 	}
-
-	claims.Roles = append(claims.Roles, userRoles)
-	token, expirationTime, err := auth.GenerateToken(claims)
-
 	if err != nil {
-		a.logError.Logger.WithFields(logrus.Fields{
-			"user":   loginRequest.Username,
-			"userIP": ip,
-		}).Errorf("ERR:GENERATING TOKEN")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errLoginExpired)
 		return
-
-	}
-	user, err := a.userService.GetByUsername(context.TODO(), loginRequest.Username)
-	var roleString string
-
-	if user.Role == modelGateway.Admin {
-		roleString = "Admin"
-	} else if user.Role == modelGateway.Agent {
-		roleString = "Agent"
-	} else if user.Role == modelGateway.Regular {
-		roleString = "Regular"
 	}
 
-	logInResponse := dto.LogInResponseDto{
-		Token:          token,
-		Role:           roleString,
-		Email:          user.Email,
-		Username:       user.Username,
-		ExpirationTime: expirationTime,
-	}
-
-	logInResponseJson, _ := json.Marshal(logInResponse)
-	rw.WriteHeader(http.StatusOK)
-	rw.Header().Set("Content-Type", "application/json")
-	_, err = rw.Write(logInResponseJson)
+	user, err := a.userService.GetByUsername(context.TODO(), ticket.Subject)
 	if err != nil {
+		a.LogError(ip, ticket.Subject, "USER NOT FOUND")
+		myerr.WriteProblem(rw, r, errUserNotFound)
 		return
 	}
+
+	a.issueSession(rw, r, user, ip, modelGateway.LoginMethodPassword)
 }
 
 func (a AuthenticationHandler) PasswordLessLoginReq(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
 	var loginRequest dto.PasswordLessLoginRequest
 	err := json.NewDecoder(r.Body).Decode(&loginRequest)
 	if err != nil {
-		http.Error(rw, "Error decoding loginRequest:"+err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
 	ip := ReadUserIP(r)
@@ -403,14 +523,14 @@ func (a AuthenticationHandler) PasswordLessLoginReq(rw http.ResponseWriter, r *h
 			"user":   loginRequest.Username,
 			"userIP": ip,
 		}).Errorf("ERR:XSS")
-		http.Error(rw, "XSS! ", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errUnsafeInput)
 		return
 	} else if sqlInj {
 		a.logError.Logger.WithFields(logrus.Fields{
 			"user":   loginRequest.Username,
 			"userIP": ip,
 		}).Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		http.Error(rw, "Chance for sql injection! ", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errUnsafeInput)
 		return
 	} else {
 		a.logInfo.Logger.WithFields(logrus.Fields{
@@ -425,7 +545,7 @@ func (a AuthenticationHandler) PasswordLessLoginReq(rw http.ResponseWriter, r *h
 			"user":   loginRequest.Username,
 			"userIP": ip,
 		}).Errorf("ERR:USER NOT FOUND")
-		http.Error(rw, "User not found! "+err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errUserNotFound)
 		return
 	}
 	if !user.IsConfirmed {
@@ -434,11 +554,13 @@ func (a AuthenticationHandler) PasswordLessLoginReq(rw http.ResponseWriter, r *h
 			"userIP": ip,
 		}).Errorf("ERR:USER NOT ACTIVATED")
 		fmt.Println("account not activated")
-		http.Error(rw, "User account not activated! ", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errNotActivated)
 		return
 	}
 	err = a.passwordLessService.SendLink(context.TODO(), "https://localhost:4200", "http://localhost:9090/", user)
 	if err != nil {
+		a.LogError(ip, user.Username, "SENDING PASSWORDLESS LINK: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
 		return
 	}
 
@@ -452,7 +574,7 @@ func (a AuthenticationHandler) PasswordlessLogin(rw http.ResponseWriter, r *http
 	var code string
 	p := strings.Split(r.URL.Path, "/")
 	if len(p) == 1 {
-		http.Error(rw, "no path param", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errInvalidCode)
 		return
 	} else if len(p) > 1 {
 		code = p[len(p)-1]
@@ -460,94 +582,573 @@ func (a AuthenticationHandler) PasswordlessLogin(rw http.ResponseWriter, r *http
 
 	policy := bluemonday.UGCPolicy()
 	code = strings.TrimSpace(policy.Sanitize(code))
-	sqlInj := common.BadId(code)
+	sqlInj := common.BadLinkToken(code)
 
 	if code == "" {
 		a.LogError(ip, "", "XSS")
-		http.Error(rw, "XSS! ", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errUnsafeInput)
 		return
 	} else if sqlInj {
 		a.LogError(ip, "", "BAD VALIDATION: POSSIBLE INJECTION")
-		http.Error(rw, "Chance for sql injection! ", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errUnsafeInput)
 		return
 	} else {
 		a.LogInfo(ip, "Handling PasswordlessLogin")
 
 	}
 
-	ver, err := a.passwordLessService.GetUsernameByCode(code)
-	username := ver.Username
+	// The link is all we get, so guesses are tracked per address until it
+	// tells us whose account this is.
+	err := a.loginAttemptService.Attempt("", ip)
+	if err != nil {
+		writeThrottled(rw, r, err)
+		return
+	}
+	username, err := a.passwordLessService.GetUsernameByCode(code)
+	if err != nil {
+		a.LogError(ip, "", "PASSWORDLESS LINK REJECTED: "+err.Error())
+		myerr.WriteProblem(rw, r, errInvalidCode)
+		return
+	}
+	err = a.loginAttemptService.CheckAccount(username)
 	if err != nil {
-		http.Error(rw, "code doesn't exist ot is invalid", http.StatusBadRequest)
+		writeThrottled(rw, r, err)
 		return
 	}
 
 	user, err := a.userService.GetByUsername(context.TODO(), username)
 	if err != nil {
 		a.LogError(ip, user.Username, "USER NOT FOUND")
-		http.Error(rw, "User not found! "+err.Error(), http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errUserNotFound)
 		return
 	}
 	if !user.IsConfirmed {
 		a.LogError(ip, user.Username, "USER NOT ACTIVATED")
-		http.Error(rw, "User account not activated! ", http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, errNotActivated)
 		return
 	}
-	validCode, err := a.passwordLessService.PasswordlessLogin(ver)
-	if !validCode {
-		a.LogError(ip, user.Username, "CODE INVALID")
-		http.Error(rw, "Code invalid! ", http.StatusBadRequest)
+	_, err = a.passwordLessService.PasswordlessLogin(code)
+	if err != nil {
+		a.LogError(ip, user.Username, "PASSWORDLESS LINK REJECTED: "+err.Error())
+		myerr.WriteProblem(rw, r, errInvalidCode)
+		return
+	}
+
+	// The link only proves the mailbox; an account with a second factor
+	// still has to give it, with the ticket, before it gets a session.
+	twofa, webAuthn, ok := a.secondFactors(rw, r, user.Username, ip)
+	if !ok {
+		return
+	}
+	if twofa || webAuthn {
+		a.LogInfo(ip, "Passwordless link accepted, second factor required for user "+user.Username)
+		a.writeTicket(rw, r, user.Username, twofa, webAuthn, ip)
+		return
+	}
+	a.loginAttemptService.Succeeded(user.Username, ip)
+	a.issueSession(rw, r, user, ip, modelGateway.LoginMethodPasswordless)
+}
+
+func (a AuthenticationHandler) RefreshToken(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling RefreshToken")
+	ip := ReadUserIP(r)
+
+	var request dto.RefreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.RefreshToken == "" {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
 		return
 	}
+
+	username, sessionID, refreshToken, refreshExpirationTime, err := a.refreshTokenService.Rotate(request.RefreshToken)
+	if err == services.ErrRefreshTokenReused {
+		// Whoever holds the other copy of this token may already have an
+		// access token from it, so every session of the user goes.
+		revokeErr := a.revocationService.RevokeUserSessions(username)
+		if revokeErr != nil {
+			a.LogError(ip, username, "REVOKING SESSIONS AFTER REFRESH TOKEN REUSE")
+		}
+	}
 	if err != nil {
-		a.LogError(ip, user.Username, "CORE FLAG CHANGE")
-		http.Error(rw, "Login code error! ", http.StatusBadRequest)
+		a.LogError(ip, username, "REFRESH TOKEN REJECTED: "+err.Error())
+		myerr.WriteProblem(rw, r, errInvalidRefreshToken)
 		return
 	}
 
-	var claims = &interceptor.JwtClaims{}
-	claims.Username = username
+	user, err := a.userService.GetByUsername(context.TODO(), username)
+	if err != nil {
+		a.LogError(ip, username, "USER NOT FOUND")
+		myerr.WriteProblem(rw, r, errInvalidRefreshToken)
+		return
+	}
+
+	a.sessionService.Touch(sessionID, ip)
+	a.writeTokens(rw, r, user, ip, sessionID, refreshToken, refreshExpirationTime)
+}
+
+func (a AuthenticationHandler) Logout(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling Logout")
+	ip := ReadUserIP(r)
+
+	var request dto.RefreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.RefreshToken == "" {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
 
-	userRoles, err := a.userService.GetUserRole(username)
+	username, err := a.refreshTokenService.Revoke(request.RefreshToken)
 	if err != nil {
-		a.LogError(ip, user.Username, "THIS USER HAS NO ROLE")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		a.LogError(ip, "", "LOGOUT WITH UNKNOWN REFRESH TOKEN")
+		myerr.WriteProblem(rw, r, errInvalidRefreshToken)
 		return
+	}
 
+	claims, err := bearerClaims(r)
+	if err == nil && claims.Id != "" {
+		err = a.revocationService.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+		if err != nil {
+			a.LogError(ip, username, "REVOKING ACCESS TOKEN")
+		}
 	}
+	a.LogInfo(ip, "Logged out user "+username)
 
-	claims.Roles = append(claims.Roles, userRoles)
+	rw.WriteHeader(http.StatusNoContent)
+}
 
-	token, expirationTime, err := auth.GenerateToken(claims)
+// UnlockAccount takes the code in the body, so it doesn't end up in access
+// logs and browser history the way a path would.
+func (a AuthenticationHandler) UnlockAccount(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling UnlockAccount")
+	ip := ReadUserIP(r)
 
+	var request dto.UnlockRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Code == "" {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	username, err := a.loginAttemptService.Unlock(request.Code)
 	if err != nil {
-		a.LogError(ip, user.Username, "GENERATING TOKEN")
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		a.LogError(ip, "", "ACCOUNT UNLOCK FAILED")
+		myerr.WriteProblem(rw, r, errInvalidCode)
 		return
+	}
+	a.LogInfo(ip, "Unlocked account "+username)
+
+	rw.WriteHeader(http.StatusNoContent)
+}
 
+// WebAuthnBeginRegistration asks for the password or a TOTP code again: a
+// passkey outlives the token, so a stolen token mustn't be enough to add one.
+func (a AuthenticationHandler) WebAuthnBeginRegistration(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnBeginRegistration")
+	ip := ReadUserIP(r)
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	var request dto.ReauthenticateRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	if !a.reauthenticate(rw, r, claims.Username, request, ip) {
+		return
+	}
+
+	options, sessionID, err := a.webAuthnService.BeginRegistration(claims.Username)
+	if err != nil {
+		a.LogError(ip, claims.Username, "WEBAUTHN BEGIN REGISTRATION: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.InvalidArgument(myerr.CodeWebAuthnFailed, "Couldn't start the registration"))
+		return
+	}
+	writeWebAuthnOptions(rw, sessionID.String(), options)
+}
+
+// reauthenticate checks the password or TOTP code of a logged-in user. The
+// check counts as a login attempt, so it can't be used to guess passwords.
+// It answers the request itself and returns false when the check fails.
+func (a AuthenticationHandler) reauthenticate(rw http.ResponseWriter, r *http.Request, username string,
+	request dto.ReauthenticateRequest, ip string) bool {
+	if request.Password == "" && request.Code == "" {
+		myerr.WriteProblem(rw, r, invalidField("password", "or a code from the authenticator app is required"))
+		return false
+	}
+	err := a.loginAttemptService.Attempt(username, ip)
+	if err != nil {
+		writeThrottled(rw, r, err)
+		return false
+	}
+	var valid bool
+	if request.Password != "" {
+		user, err := a.userService.GetByUsername(context.TODO(), username)
+		valid = err == nil && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)) == nil
+	} else {
+		valid, err = a.tfaService.Authenticate(username, request.Code)
+		valid = valid && err == nil
+	}
+	if !valid {
+		a.LogError(ip, username, "REAUTHENTICATION FAILED")
+		myerr.WriteProblem(rw, r, errInvalidCredentials)
+		return false
+	}
+	a.loginAttemptService.Succeeded(username, ip)
+	return true
+}
+
+// WebAuthnFinishRegistration takes the browser's attestation as the body, so
+// the session and the name of the new authenticator come in the query.
+func (a AuthenticationHandler) WebAuthnFinishRegistration(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnFinishRegistration")
+	ip := ReadUserIP(r)
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	sessionID, err := uuid.Parse(r.URL.Query().Get("session"))
+	if err != nil {
+		myerr.WriteProblem(rw, r, errInvalidSession)
+		return
+	}
+	policy := bluemonday.UGCPolicy()
+	name := strings.TrimSpace(policy.Sanitize(r.URL.Query().Get("name")))
+
+	credential, err := a.webAuthnService.FinishRegistration(claims.Username, sessionID, name, r.Body)
+	if err != nil {
+		a.LogError(ip, claims.Username, "WEBAUTHN FINISH REGISTRATION: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.InvalidArgument(myerr.CodeWebAuthnFailed, "The registration failed"))
+		return
+	}
+
+	response, _ := json.Marshal(credential)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	_, err = rw.Write(response)
+	if err != nil {
+		return
+	}
+}
+
+func (a AuthenticationHandler) GenerateApiToken(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling GenerateApiToken")
+	ip := ReadUserIP(r)
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	var request dto.UsernameRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	if request.Username != claims.Username {
+		a.LogError(ip, claims.Username, "API TOKEN FOR ANOTHER USER")
+		myerr.WriteProblem(rw, r, errForbidden)
+		return
+	}
+
+	token, _, err := a.keyManager.GenerateApiToken(claims.Username)
+	if err != nil {
+		a.LogError(ip, claims.Username, "GENERATING API TOKEN: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	a.LogInfo(ip, "Generated an API token for "+claims.Username)
+
+	response, _ := json.Marshal(dto.ApiTokenResponse{ApiToken: token})
+	rw.Header().Set("Content-Type", "application/json")
+	_, err = rw.Write(response)
+	if err != nil {
+		return
+	}
+}
+
+func (a AuthenticationHandler) WebAuthnCredentials(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnCredentials")
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+
+	credentials, err := a.webAuthnService.GetCredentials(claims.Username)
+	if err != nil {
+		a.LogError(ReadUserIP(r), claims.Username, "LOADING WEBAUTHN CREDENTIALS: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+
+	response, _ := json.Marshal(credentials)
+	rw.Header().Set("Content-Type", "application/json")
+	_, err = rw.Write(response)
+	if err != nil {
+		return
+	}
+}
+
+func (a AuthenticationHandler) WebAuthnRenameCredential(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	a.l.Println("Handling WebAuthnRenameCredential")
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		myerr.WriteProblem(rw, r, errInvalidId)
+		return
+	}
+	var request dto.WebAuthnCredentialName
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	policy := bluemonday.UGCPolicy()
+	request.Name = strings.TrimSpace(policy.Sanitize(request.Name))
+	if request.Name == "" {
+		myerr.WriteProblem(rw, r, invalidField("name", "is required"))
+		return
+	}
+
+	err = a.webAuthnService.RenameCredential(claims.Username, id, request.Name)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errCredentialNotFound)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (a AuthenticationHandler) WebAuthnRemoveCredential(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	a.l.Println("Handling WebAuthnRemoveCredential")
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		myerr.WriteProblem(rw, r, errInvalidId)
+		return
+	}
+
+	err = a.webAuthnService.RemoveCredential(claims.Username, id)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errCredentialNotFound)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// WebAuthnBeginLogin starts a login with a passkey instead of a password. The
+// username is optional; without it any discoverable passkey will do.
+func (a AuthenticationHandler) WebAuthnBeginLogin(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnBeginLogin")
+	ip := ReadUserIP(r)
+	var request dto.UsernameRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && err != io.EOF {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	policy := bluemonday.UGCPolicy()
+	request.Username = strings.TrimSpace(policy.Sanitize(request.Username))
+
+	options, sessionID, err := a.webAuthnService.BeginLogin(request.Username)
+	if err != nil {
+		a.LogError(ip, request.Username, "WEBAUTHN BEGIN LOGIN: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.InvalidArgument(myerr.CodeWebAuthnFailed, "Couldn't start the login"))
+		return
+	}
+	writeWebAuthnOptions(rw, sessionID.String(), options)
+}
+
+func (a AuthenticationHandler) WebAuthnFinishLogin(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnFinishLogin")
+	ip := ReadUserIP(r)
+	sessionID, err := uuid.Parse(r.URL.Query().Get("session"))
+	if err != nil {
+		myerr.WriteProblem(rw, r, errInvalidSession)
+		return
+	}
+	err = a.loginAttemptService.Attempt("", ip)
+	if err != nil {
+		writeThrottled(rw, r, err)
+		return
+	}
+
+	username, err := a.webAuthnService.FinishLogin(sessionID, r.Body)
+	if err != nil {
+		a.LogError(ip, username, "WEBAUTHN LOGIN FAILED: "+err.Error())
+		myerr.WriteProblem(rw, r, errInvalidCredentials)
+		return
+	}
+	err = a.loginAttemptService.CheckAccount(username)
+	if err != nil {
+		writeThrottled(rw, r, err)
+		return
+	}
+	user, err := a.userService.GetByUsername(context.TODO(), username)
+	if err != nil {
+		a.LogError(ip, username, "USER NOT FOUND")
+		myerr.WriteProblem(rw, r, errUserNotFound)
+		return
+	}
+	if !user.IsConfirmed {
+		a.LogError(ip, username, "USER NOT ACTIVATED")
+		myerr.WriteProblem(rw, r, errNotActivated)
+		return
+	}
+	a.LogInfo(ip, "Passkey login for user "+username)
+
+	a.loginAttemptService.Succeeded(username, ip)
+	a.issueSession(rw, r, user, ip, modelGateway.LoginMethodPasskey)
+}
+
+// WebAuthnBeginSecondFactor challenges the user's authenticators after the
+// password step, in place of a TOTP code.
+func (a AuthenticationHandler) WebAuthnBeginSecondFactor(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnBeginSecondFactor")
+	ip := ReadUserIP(r)
+	var request dto.MfaTicketRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	ticket, err := a.mfaTicketService.Verify(request.Ticket, ip)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errLoginExpired)
+		return
+	}
+
+	options, sessionID, err := a.webAuthnService.BeginSecondFactor(ticket.Subject, request.Ticket)
+	if err != nil {
+		a.LogError(ip, ticket.Subject, "WEBAUTHN BEGIN SECOND FACTOR: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.InvalidArgument(myerr.CodeWebAuthnFailed, "Couldn't start the login"))
+		return
+	}
+	writeWebAuthnOptions(rw, sessionID.String(), options)
+}
+
+func (a AuthenticationHandler) WebAuthnFinishSecondFactor(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	a.l.Println("Handling WebAuthnFinishSecondFactor")
+	ip := ReadUserIP(r)
+	sessionID, err := uuid.Parse(r.URL.Query().Get("session"))
+	if err != nil {
+		myerr.WriteProblem(rw, r, errInvalidSession)
+		return
+	}
+
+	ticketString, valid, err := a.webAuthnService.FinishSecondFactor(sessionID, r.Body)
+	if err == services.ErrWebAuthnSessionInvalid {
+		myerr.WriteProblem(rw, r, errInvalidSession)
+		return
+	}
+	if err != nil {
+		a.LogError(ip, "", "WEBAUTHN SECOND FACTOR: "+err.Error())
+		valid = false
+	}
+	ticket, err := a.mfaTicketService.Verify(ticketString, ip)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errLoginExpired)
+		return
+	}
+	err = a.loginAttemptService.Attempt(ticket.Subject, ip)
+	if err != nil {
+		writeThrottled(rw, r, err)
+		return
+	}
+
+	err = a.mfaTicketService.RedeemWithSecondFactor(ticket, valid, ip)
+	if err == services.ErrInvalidTwoFactorCode {
+		myerr.WriteProblem(rw, r, errInvalidCredentials)
+		return
+	}
+	if err != nil {
+		myerr.WriteProblem(rw, r, errLoginExpired)
+		return
+	}
+
+	user, err := a.userService.GetByUsername(context.TODO(), ticket.Subject)
+	if err != nil {
+		a.LogError(ip, ticket.Subject, "USER NOT FOUND")
+		myerr.WriteProblem(rw, r, errUserNotFound)
+		return
 	}
 
-	var roleString string
+	a.loginAttemptService.Succeeded(user.Username, ip)
+	a.issueSession(rw, r, user, ip, modelGateway.LoginMethodTwoFactor)
+}
 
-	if user.Role == modelGateway.Admin {
-		roleString = "Admin"
-	} else if user.Role == modelGateway.Agent {
-		roleString = "Agent"
-	} else if user.Role == modelGateway.Regular {
-		roleString = "Regular"
+func writeWebAuthnOptions(rw http.ResponseWriter, sessionID string, options interface{}) {
+	response, _ := json.Marshal(dto.WebAuthnBeginResponse{SessionId: sessionID, Options: options})
+	rw.Header().Set("Content-Type", "application/json")
+	_, err := rw.Write(response)
+	if err != nil {
+		return
+	}
+}
+
+// issueSession starts a new refresh-token family for the user and writes the
+// login response. Every login method ends up here once the user is verified.
+func (a AuthenticationHandler) issueSession(rw http.ResponseWriter, r *http.Request, user *modelGateway.User, ip string, method string) {
+	session, err := a.sessionService.Start(user.Username, method, ip, r.UserAgent())
+	if err != nil {
+		a.LogError(ip, user.Username, "RECORDING LOGIN SESSION")
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	refreshToken, refreshExpirationTime, err := a.refreshTokenService.Issue(user.Username, session.ID)
+	if err != nil {
+		a.LogError(ip, user.Username, "GENERATING REFRESH TOKEN")
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	a.writeTokens(rw, r, user, ip, session.ID, refreshToken, refreshExpirationTime)
+}
+
+func (a AuthenticationHandler) writeTokens(rw http.ResponseWriter, r *http.Request, user *modelGateway.User, ip string, sessionID uuid.UUID, refreshToken string, refreshExpirationTime time.Time) {
+	var claims = &interceptor.JwtClaims{}
+	claims.Username = user.Username
+	claims.SessionId = sessionID.String()
+
+	userRoles, err := a.roleService.RolesOf(user.Username)
+	if err != nil {
+		a.LogError(ip, user.Username, "THIS USER HAS NO ROLE")
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	claims.Roles = userRoles
+
+	token, expirationTime, err := a.keyManager.GenerateToken(claims)
+	if err != nil {
+		a.LogError(ip, user.Username, "GENERATING TOKEN")
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
 	}
 
 	logInResponse := dto.LogInResponseDto{
-		Token:          token,
-		Role:           roleString,
-		Email:          user.Email,
-		Username:       user.Username,
-		ExpirationTime: expirationTime,
+		Token:                 token,
+		Role:                  user.Role.String(),
+		Roles:                 claims.Roles,
+		Permissions:           a.roleService.PermissionsOf(userRoles),
+		Email:                 user.Email,
+		Username:              user.Username,
+		ExpirationTime:        expirationTime,
+		RefreshToken:          refreshToken,
+		RefreshExpirationTime: refreshExpirationTime,
 	}
 
 	logInResponseJson, _ := json.Marshal(logInResponse)
-	rw.WriteHeader(http.StatusOK)
 	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
 	_, err = rw.Write(logInResponseJson)
 	if err != nil {
 		return
@@ -567,15 +1168,31 @@ func (a AuthenticationHandler) LogInfo(ip string, message string) {
 	}).Infof(message)
 
 }
-func ReadUserIP(r *http.Request) string {
-	IPAddress := r.Header.Get("X-Real-Ip")
-	if IPAddress == "" {
-		IPAddress = r.Header.Get("X-Forwarded-For")
+
+// bearerClaims returns the caller the Authorizer attached to r, so tokens
+// that were revoked are refused like on every other route.
+func bearerClaims(r *http.Request) (*interceptor.JwtClaims, error) {
+	claims := auth.Caller(r)
+	if claims == nil {
+		return nil, errors.New("no bearer token")
+	}
+	return claims, nil
+}
+
+// writeThrottled answers a login attempt refused by LoginAttemptService.
+func writeThrottled(rw http.ResponseWriter, r *http.Request, err error) {
+	var throttled *services.ThrottledError
+	if !errors.As(err, &throttled) {
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
 	}
-	if IPAddress == "" {
-		IPAddress = r.RemoteAddr
+	retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	if throttled.Err == services.ErrAccountLocked {
+		myerr.WriteProblem(rw, r, domainErrors.ResourceExhausted(myerr.CodeAccountLocked, "The account is temporarily locked"))
+		return
 	}
-	return IPAddress
+	myerr.WriteProblem(rw, r, domainErrors.ResourceExhausted(domainErrors.CodeRateLimited, "Too many login attempts"))
 }
 
 func CheckForAttack(loginRequest dto.LoginRequest, ip string, a AuthenticationHandler) error {
@@ -592,7 +1209,7 @@ func CheckForAttack(loginRequest dto.LoginRequest, ip string, a AuthenticationHa
 			"userIP": ip,
 		}).Errorf("ERR:XSS")
 
-		return errors.New("XSS! ")
+		return errUnsafeInput
 
 	} else if sqlInj || sqlInj2 {
 		a.logError.Logger.WithFields(logrus.Fields{
@@ -600,7 +1217,7 @@ func CheckForAttack(loginRequest dto.LoginRequest, ip string, a AuthenticationHa
 			"userIP": ip,
 		}).Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
 
-		return errors.New("Chance for sql injection! ")
+		return errUnsafeInput
 
 	}
 	return nil
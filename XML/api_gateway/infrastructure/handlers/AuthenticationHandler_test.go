@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"common/module/interceptor"
+	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
+	"common/module/revocation"
+	events "common/module/saga/revocation_events"
+	"context"
+	"errors"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"gateway/module/domain/model"
+	"gateway/module/infrastructure/persistance"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signingKeyRepositoryInMemory struct {
+	keys []model.SigningKey
+}
+
+func (r *signingKeyRepositoryInMemory) Save(key *model.SigningKey) error {
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *signingKeyRepositoryInMemory) GetCreatedAfter(t time.Time) ([]model.SigningKey, error) {
+	var keys []model.SigningKey
+	for _, key := range r.keys {
+		if key.CreatedAt.After(t) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *signingKeyRepositoryInMemory) DeleteCreatedBefore(time.Time) error {
+	return nil
+}
+
+type userRepositoryInMemory struct {
+	users map[string]*model.User
+}
+
+func (r userRepositoryInMemory) GetByUsername(_ context.Context, username string) (*model.User, error) {
+	user, ok := r.users[username]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (r userRepositoryInMemory) UserExists(username string) error {
+	_, err := r.GetByUsername(context.TODO(), username)
+	return err
+}
+
+func (r userRepositoryInMemory) GetUserSalt(string) (string, error) {
+	return "", nil
+}
+
+func (r userRepositoryInMemory) GetUserRole(username string) (string, error) {
+	user, err := r.GetByUsername(context.TODO(), username)
+	if err != nil {
+		return "", err
+	}
+	return user.Role.String(), nil
+}
+
+func (r userRepositoryInMemory) GetUsernamesWithRole(role string) ([]string, error) {
+	var usernames []string
+	for username, user := range r.users {
+		if user.Role.String() == role {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames, nil
+}
+
+// tfAuthRepositoryDisabled is the store of a user who never enabled TOTP.
+type tfAuthRepositoryDisabled struct{}
+
+var errNoTfa = errors.New("2fa not enabled")
+
+func (tfAuthRepositoryDisabled) Check2FaForUser(string) (bool, error) { return false, nil }
+func (tfAuthRepositoryDisabled) Enable2FaForUser(string, string) (bool, error) {
+	return false, errNoTfa
+}
+func (tfAuthRepositoryDisabled) Confirm2FaForUser(string) error         { return errNoTfa }
+func (tfAuthRepositoryDisabled) Disable2FaForUser(string) (bool, error) { return false, errNoTfa }
+func (tfAuthRepositoryDisabled) GetUserSecret(string) (string, error)   { return "", errNoTfa }
+func (tfAuthRepositoryDisabled) GetUserQr(string) (model.QrCode, error) {
+	return model.QrCode{}, errNoTfa
+}
+func (tfAuthRepositoryDisabled) GetPendingQr(string) (model.QrCode, error) {
+	return model.QrCode{}, errNoTfa
+}
+func (tfAuthRepositoryDisabled) UseCounter(model.QrCode, int) (bool, error) {
+	return false, errNoTfa
+}
+func (tfAuthRepositoryDisabled) ReplaceRecoveryCodes(string, []model.RecoveryCode) error {
+	return errNoTfa
+}
+func (tfAuthRepositoryDisabled) GetUnusedRecoveryCodes(string) ([]model.RecoveryCode, error) {
+	return nil, errNoTfa
+}
+func (tfAuthRepositoryDisabled) UseRecoveryCode(model.RecoveryCode) (bool, error) {
+	return false, errNoTfa
+}
+
+type webAuthnRepositoryInMemory struct {
+	sessions map[uuid.UUID]model.WebAuthnSession
+}
+
+func (r *webAuthnRepositoryInMemory) CreateCredential(*model.WebAuthnCredential) error { return nil }
+func (r *webAuthnRepositoryInMemory) GetCredentials(string) ([]model.WebAuthnCredential, error) {
+	return nil, nil
+}
+func (r *webAuthnRepositoryInMemory) GetCredentialByCredentialID([]byte) (*model.WebAuthnCredential, error) {
+	return nil, errors.New("credential not found")
+}
+func (r *webAuthnRepositoryInMemory) UpdateCredentialUse(uuid.UUID, uint32, time.Time) error {
+	return nil
+}
+func (r *webAuthnRepositoryInMemory) RenameCredential(uuid.UUID, string, string) error { return nil }
+func (r *webAuthnRepositoryInMemory) DeleteCredential(uuid.UUID, string) error         { return nil }
+func (r *webAuthnRepositoryInMemory) CreateSession(session *model.WebAuthnSession) error {
+	r.sessions[session.ID] = *session
+	return nil
+}
+func (r *webAuthnRepositoryInMemory) TakeSession(id uuid.UUID) (*model.WebAuthnSession, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, errors.New("session not found")
+	}
+	delete(r.sessions, id)
+	return &session, nil
+}
+
+type registrationFixture struct {
+	handler     AuthenticationHandler
+	authorizer  *auth.Authorizer
+	revocations *revocation.List
+	sessions    *webAuthnRepositoryInMemory
+	token       string
+}
+
+func newRegistrationFixture(t *testing.T) *registrationFixture {
+	l, _ := logtest.NewNullLogger()
+	discard := &logger.Logger{Logger: l}
+	keys, err := auth.NewKeyManager(&signingKeyRepositoryInMemory{}, "RS256", time.Hour, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := keys.GenerateToken(&interceptor.JwtClaims{Username: "alice", Roles: []string{"User"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authPolicy, err := policy.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := revocation.NewList()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := userRepositoryInMemory{users: map[string]*model.User{
+		"alice": {ID: uuid.New(), Username: "alice", Password: string(hash), FirstName: "Alice", LastName: "Test"},
+	}}
+	webAuthn, err := webauthn.New(&webauthn.Config{RPDisplayName: "Dislinkt", RPID: "localhost", RPOrigin: "https://localhost:4200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := &webAuthnRepositoryInMemory{sessions: map[uuid.UUID]model.WebAuthnSession{}}
+	quiet := log.New(io.Discard, "", 0)
+	return &registrationFixture{
+		handler: AuthenticationHandler{
+			l:                   quiet,
+			logInfo:             discard,
+			logError:            discard,
+			userService:         services.NewUserService(quiet, discard, discard, users),
+			tfaService:          services.NewTFAuthService(quiet, tfAuthRepositoryDisabled{}),
+			keyManager:          keys,
+			loginAttemptService: services.NewLoginAttemptService(discard, discard, persistance.NewLoginAttemptRepositoryInMemory(), users, nil),
+			webAuthnService:     services.NewWebAuthnService(discard, discard, webAuthn, sessions, users),
+		},
+		authorizer:  auth.NewAuthorizer(authPolicy, keys, revocations, permissions.NewCache(authPolicy.Roles), discard),
+		revocations: revocations,
+		sessions:    sessions,
+		token:       token,
+	}
+}
+
+func (f *registrationFixture) begin(token string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/webauthn/register/begin", strings.NewReader(body))
+	r.RemoteAddr = "192.0.2.1:50000"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rw := httptest.NewRecorder()
+	r, ok := f.authorizer.Authorize(rw, r)
+	if ok {
+		f.handler.WebAuthnBeginRegistration(rw, r, nil)
+	}
+	return rw
+}
+
+func TestWebAuthnBeginRegistrationRequiresReauthentication(t *testing.T) {
+	f := newRegistrationFixture(t)
+	cases := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"no token", "", `{"password":"correct horse"}`, http.StatusUnauthorized},
+		{"no body", f.token, ``, http.StatusBadRequest},
+		{"no password or code", f.token, `{}`, http.StatusBadRequest},
+		{"wrong password", f.token, `{"password":"wrong"}`, http.StatusUnauthorized},
+		{"code without 2fa", f.token, `{"code":"123456"}`, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		rw := f.begin(c.token, c.body)
+		if rw.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, rw.Code, c.status)
+		}
+	}
+	if len(f.sessions.sessions) != 0 {
+		t.Fatalf("%d registration sessions started without reauthentication", len(f.sessions.sessions))
+	}
+}
+
+func TestWebAuthnBeginRegistrationRefusesRevokedTokens(t *testing.T) {
+	f := newRegistrationFixture(t)
+	f.revocations.Apply(&events.RevocationEvent{
+		Type:      events.RevokeUserSessions,
+		Username:  "alice",
+		RevokedAt: time.Now().Add(time.Second),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	rw := f.begin(f.token, `{"password":"correct horse"}`)
+	if rw.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d with a revoked token, want 401", rw.Code)
+	}
+	if len(f.sessions.sessions) != 0 {
+		t.Fatal("a registration session was started with a revoked token")
+	}
+}
+
+func TestWebAuthnBeginRegistrationWithPassword(t *testing.T) {
+	f := newRegistrationFixture(t)
+	rw := f.begin(f.token, `{"password":"correct horse"}`)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rw.Code, rw.Body.String())
+	}
+	if !strings.Contains(rw.Body.String(), `"sessionId"`) || len(f.sessions.sessions) != 1 {
+		t.Fatalf("no registration session in %s", rw.Body.String())
+	}
+}
+
+func TestWebAuthnBeginRegistrationIsThrottled(t *testing.T) {
+	f := newRegistrationFixture(t)
+	for i := 0; i < services.FreeAttempts; i++ {
+		rw := f.begin(f.token, `{"password":"wrong"}`)
+		if rw.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d", i+1, rw.Code)
+		}
+	}
+	rw := f.begin(f.token, `{"password":"correct horse"}`)
+	if rw.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d after %d failures, want 429", rw.Code, services.FreeAttempts)
+	}
+	if rw.Header().Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"common/module/logger"
+	events "common/module/saga/change_events"
+	saga "common/module/saga/messaging"
+	"gateway/module/application/services"
+	"github.com/sirupsen/logrus"
+)
+
+type ChangeEventHandler struct {
+	logError             *logger.Logger
+	responseCacheService *services.ResponseCacheService
+	subscriber           saga.Subscriber
+}
+
+func NewChangeEventHandler(logError *logger.Logger, responseCacheService *services.ResponseCacheService, subscriber saga.Subscriber) (*ChangeEventHandler, error) {
+	h := &ChangeEventHandler{
+		logError:             logError,
+		responseCacheService: responseCacheService,
+		subscriber:           subscriber,
+	}
+	err := h.subscriber.Subscribe(h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *ChangeEventHandler) handle(event *events.ChangeEvent) {
+	var tag string
+	switch event.Type {
+	case events.UserUpdated:
+		tag = services.UserCacheTag(event.Username)
+	case events.PostCreated, events.PostUpdated:
+		tag = services.PostCacheTag(event.Post)
+	case events.JobOfferCreated:
+		tag = services.JobOffersCacheTag
+	default:
+		return
+	}
+	err := h.responseCacheService.Invalidate(tag)
+	if err != nil {
+		h.logError.Logger.WithFields(logrus.Fields{
+			"event": event.Id,
+			"type":  event.Type,
+			"tag":   tag,
+		}).Errorf("ERR:INVALIDATING RESPONSE CACHE: %v", err)
+	}
+}
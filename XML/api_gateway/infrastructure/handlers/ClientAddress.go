@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the peers whose X-Real-Ip and X-Forwarded-For headers
+// are believed. Any other client can send those headers with whatever it
+// likes.
+var trustedProxies []*net.IPNet
+
+// TrustProxies sets the proxies in front of the gateway from a comma
+// separated list of addresses and CIDR ranges. It is called once, before
+// the gateway serves.
+func TrustProxies(list string) error {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return fmt.Errorf("trusted proxy %q: invalid address", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q: %v", entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	trustedProxies = proxies
+	return nil
+}
+
+// ReadUserIP is the address of the client, without the port, which differs
+// per connection. Forwarding headers are only read from trusted proxies;
+// X-Forwarded-For is read from the right, past the trusted proxies, as
+// whatever the client sent is on its left.
+func ReadUserIP(r *http.Request) string {
+	peer := hostOf(r.RemoteAddr)
+	if !trustedProxy(peer) {
+		return peer
+	}
+	if real := hostOf(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); net.ParseIP(real) != nil {
+		return real
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := hostOf(strings.TrimSpace(forwarded[i]))
+		if net.ParseIP(address) == nil {
+			break
+		}
+		if !trustedProxy(address) {
+			return address
+		}
+	}
+	return peer
+}
+
+func trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return strings.Trim(address, "[]")
+	}
+	return host
+}
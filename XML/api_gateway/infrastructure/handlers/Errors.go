@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	domainErrors "common/module/errors"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
+)
+
+var (
+	errMalformedRequest = domainErrors.InvalidArgument(domainErrors.CodeMalformedRequest,
+		"The request body can't be decoded")
+	errUnsafeInput = domainErrors.InvalidArgument(domainErrors.CodeUnsafeInput,
+		"Fields are empty or contain characters that aren't allowed")
+	errUnauthenticated    = domainErrors.Unauthenticated(domainErrors.CodeUnauthenticated, "Unauthorized")
+	errForbidden          = domainErrors.PermissionDenied(domainErrors.CodePermissionDenied, "Forbidden")
+	errInvalidCredentials = domainErrors.Unauthenticated(domainErrors.CodeInvalidCredentials, "Invalid credentials")
+	errNotActivated       = domainErrors.FailedPrecondition(domainErrors.CodeAccountNotActivated,
+		"The account isn't activated, check your mail for the activation code")
+	errInvalidCode         = domainErrors.InvalidArgument(domainErrors.CodeInvalidCode, "The code is invalid or expired")
+	errUserNotFound        = domainErrors.NotFound(domainErrors.CodeUserNotFound, "User not found")
+	errLoginExpired        = domainErrors.Unauthenticated(myerr.CodeLoginExpired, "Login expired, log in again")
+	errInvalidRefreshToken = domainErrors.Unauthenticated(myerr.CodeInvalidRefreshToken, "Invalid refresh token")
+	errInvalidSession      = domainErrors.InvalidArgument(myerr.CodeInvalidSession, "Invalid session",
+		domainErrors.Field("session", "is not a session that was started"))
+	errCredentialNotFound = domainErrors.NotFound(myerr.CodeCredentialNotFound, "Credential not found")
+	errRoleNotFound       = domainErrors.NotFound(myerr.CodeRoleNotFound, "Role not found")
+	errLastRoleManager    = domainErrors.FailedPrecondition(myerr.CodeLastRoleManager,
+		"Someone has to keep the "+services.ManageRoles+" permission")
+	errInvalidId = domainErrors.InvalidArgument(domainErrors.CodeInvalidArgument, "Invalid id",
+		domainErrors.Field("id", "is not a UUID"))
+)
+
+// invalidField is a validation error of a single field.
+func invalidField(field string, description string) *domainErrors.Error {
+	return domainErrors.InvalidArgument(domainErrors.CodeValidationFailed, "Some fields are invalid",
+		domainErrors.Field(field, description))
+}
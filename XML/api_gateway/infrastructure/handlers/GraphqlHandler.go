@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"common/module/logger"
+	"encoding/json"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+// maxGraphqlBody bounds the size of a query with its variables.
+const maxGraphqlBody = 1 << 20
+
+type GraphqlHandler struct {
+	logError       *logger.Logger
+	graphqlService *services.GraphqlService
+}
+
+func NewGraphqlHandler(logError *logger.Logger, graphqlService *services.GraphqlService) Handler {
+	return &GraphqlHandler{
+		logError:       logError,
+		graphqlService: graphqlService,
+	}
+}
+
+func (g GraphqlHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("POST", "/graphql", g.Query)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/graphql/schema", g.GetSchema)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Query answers a query with 200 whenever it could be read; errors of the
+// query or of its fields are in the body, as GraphQL clients expect them.
+func (g GraphqlHandler) Query(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var request services.GraphqlQuery
+	err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxGraphqlBody)).Decode(&request)
+	if err != nil || request.Query == "" {
+		g.logError.Logger.WithFields(logrus.Fields{
+			"userIP": ReadUserIP(r),
+		}).Errorf("ERR:INVALID GRAPHQL REQUEST")
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if token := r.Header.Get("Authorization"); token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "Authorization", token)
+	}
+	writeJson(rw, g.graphqlService.Execute(ctx, auth.Caller(r), request))
+}
+
+func (g GraphqlHandler) GetSchema(rw http.ResponseWriter, _ *http.Request, _ map[string]string) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write([]byte(g.graphqlService.Schema()))
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"gateway/module/auth"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"net/http"
+)
+
+type JwksHandler struct {
+	keyManager *auth.KeyManager
+}
+
+func NewJwksHandler(keyManager *auth.KeyManager) Handler {
+	return &JwksHandler{keyManager: keyManager}
+}
+
+func (j JwksHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("GET", "/.well-known/jwks.json", j.GetKeySet)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (j JwksHandler) GetKeySet(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	response, _ := json.Marshal(j.keyManager.KeySet())
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "public, max-age=300")
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write(response)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"gateway/module/openapi"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"net/http"
+	"path/filepath"
+)
+
+// docAssets are the files of Swagger UI the documentation page loads. They
+// are served by the gateway, from the copy in its image, rather than from a
+// CDN.
+var docAssets = map[string]bool{
+	"swagger-ui-bundle.js": true,
+	"swagger-ui.css":       true,
+}
+
+// OpenApiHandler serves the description of the API and the page that
+// renders it.
+type OpenApiHandler struct {
+	document  []byte
+	assetsDir string
+}
+
+func NewOpenApiHandler(document *openapi.Document, assetsDir string) Handler {
+	encoded, _ := json.Marshal(document)
+	return &OpenApiHandler{encoded, assetsDir}
+}
+
+func (h OpenApiHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("GET", "/openapi.json", h.GetDocument)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/docs", h.GetPage)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/docs/assets/{file}", h.GetAsset)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (h OpenApiHandler) GetDocument(rw http.ResponseWriter, _ *http.Request, _ map[string]string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "public, max-age=300")
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write(h.document)
+	if err != nil {
+		return
+	}
+}
+
+func (h OpenApiHandler) GetPage(rw http.ResponseWriter, _ *http.Request, _ map[string]string) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write(openapi.Page)
+	if err != nil {
+		return
+	}
+}
+
+func (h OpenApiHandler) GetAsset(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !docAssets[params["file"]] {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(rw, r, filepath.Join(h.assetsDir, params["file"]))
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"common/module/policy"
+	"gateway/module/openapi"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The gateway refuses to start when a route of the policy has no
+// documentation; this catches it before a deploy does.
+func TestEveryRouteIsDocumented(t *testing.T) {
+	authPolicy, err := policy.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := openapi.Build(authPolicy, RouteDocs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := document.Paths["/docs/assets/{file}"]; !ok {
+		t.Fatal("the document leaves out a route of RouteDocs")
+	}
+}
+
+func TestGetAssetServesOnlySwaggerUi(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "swagger-ui.css"), []byte("body {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := OpenApiHandler{assetsDir: dir}
+
+	cases := []struct {
+		file   string
+		status int
+	}{
+		{"swagger-ui.css", http.StatusOK},
+		{"swagger-ui-bundle.js", http.StatusNotFound},
+		{"secret.txt", http.StatusNotFound},
+		{"../go.mod", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rw := httptest.NewRecorder()
+		h.GetAsset(rw, httptest.NewRequest("GET", "/docs/assets/x", nil), map[string]string{"file": c.file})
+		if rw.Code != c.status {
+			t.Errorf("%s: got %d, want %d", c.file, rw.Code, c.status)
+		}
+	}
+}
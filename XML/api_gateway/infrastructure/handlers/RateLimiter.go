@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/logger"
+	"common/module/policy"
+	"fmt"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// RateLimiter refuses callers that exhausted their token bucket, before the
+// request reaches the mux. AllowAddress runs before the Authorizer, so
+// requests it refuses count too; Allow runs after it, so callers are
+// classified by the token it verified.
+type RateLimiter struct {
+	logError         *logger.Logger
+	rateLimitService *services.RateLimitService
+	policy           *policy.Policy
+}
+
+func NewRateLimiter(logError *logger.Logger, rateLimitService *services.RateLimitService, policy *policy.Policy) *RateLimiter {
+	return &RateLimiter{logError, rateLimitService, policy}
+}
+
+// AllowAddress takes a token of the address r comes from, whatever its
+// token. It answers like Allow.
+func (l *RateLimiter) AllowAddress(rw http.ResponseWriter, r *http.Request) bool {
+	return l.take(rw, r, services.RateLimitAddress, "ip:"+ReadUserIP(r))
+}
+
+// Allow takes a token for r and sets the RateLimit headers. It answers the
+// request itself and returns false when the caller is over its limit. When
+// the buckets can't be reached requests are let through.
+func (l *RateLimiter) Allow(rw http.ResponseWriter, r *http.Request) bool {
+	class, caller := l.classify(r)
+	return l.take(rw, r, class, caller)
+}
+
+func (l *RateLimiter) take(rw http.ResponseWriter, r *http.Request, class string, caller string) bool {
+	decision, err := l.rateLimitService.Take(class, caller)
+	if err != nil {
+		l.logError.Logger.WithFields(logrus.Fields{
+			"class":  class,
+			"caller": caller,
+		}).Errorf("ERR:TAKING RATE LIMIT TOKEN: %v", err)
+		return true
+	}
+
+	header := rw.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit.Requests))
+	header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds(decision.Reset.Seconds())))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", decision.Limit.Requests, seconds(decision.Limit.Period.Seconds())))
+	if decision.Allowed {
+		return true
+	}
+
+	if decision.FirstRefusal {
+		l.logError.Logger.WithFields(logrus.Fields{
+			"class":  class,
+			"caller": caller,
+			"userIP": ReadUserIP(r),
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Errorf("ERR:RATE LIMIT EXCEEDED")
+	}
+	header.Set("Retry-After", strconv.Itoa(seconds(decision.RetryAfter.Seconds())))
+	myerr.WriteProblem(rw, r, domainErrors.ResourceExhausted(domainErrors.CodeRateLimited, "Too many requests, try again later"))
+	return false
+}
+
+func (l *RateLimiter) classify(r *http.Request) (string, string) {
+	if claims := auth.Caller(r); claims != nil {
+		return services.RateLimitAuthenticated, "user:" + claims.Username
+	}
+	// ReadUserIP only believes forwarding headers from trusted proxies, so
+	// a client can't get a fresh bucket by sending a new address each time.
+	rule, _, ok := l.policy.Route(r.Method, r.URL.Path)
+	if ok && rule.ApiToken {
+		return services.RateLimitApiToken, "ip:" + ReadUserIP(r)
+	}
+	return services.RateLimitAnonymous, "ip:" + ReadUserIP(r)
+}
+
+// seconds rounds up, so clients never come back too early.
+func seconds(s float64) int {
+	return int(math.Ceil(s))
+}
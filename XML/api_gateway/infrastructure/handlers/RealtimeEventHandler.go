@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/realtime_events"
+	revocationEvents "common/module/saga/revocation_events"
+	"gateway/module/application/services"
+)
+
+type RealtimeEventHandler struct {
+	realtimeService *services.RealtimeService
+	subscriber      saga.Subscriber
+}
+
+func NewRealtimeEventHandler(realtimeService *services.RealtimeService, subscriber saga.Subscriber) (*RealtimeEventHandler, error) {
+	h := &RealtimeEventHandler{
+		realtimeService: realtimeService,
+		subscriber:      subscriber,
+	}
+	err := h.subscriber.Subscribe(h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *RealtimeEventHandler) handle(event *events.RealtimeEvent) {
+	h.realtimeService.Deliver(event)
+}
+
+// RealtimeRevocationHandler closes the streams of revoked tokens. Like the
+// revocation list it hears every revocation, whichever instance holds the
+// streams.
+type RealtimeRevocationHandler struct {
+	realtimeService *services.RealtimeService
+	subscriber      saga.Subscriber
+}
+
+func NewRealtimeRevocationHandler(realtimeService *services.RealtimeService, subscriber saga.Subscriber) (*RealtimeRevocationHandler, error) {
+	h := &RealtimeRevocationHandler{
+		realtimeService: realtimeService,
+		subscriber:      subscriber,
+	}
+	err := h.subscriber.Subscribe(h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *RealtimeRevocationHandler) handle(event *revocationEvents.RevocationEvent) {
+	h.realtimeService.Revoke(event)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	domainErrors "common/module/errors"
+	"common/module/logger"
+	events "common/module/saga/realtime_events"
+	"encoding/json"
+	"errors"
+	"fmt"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"gateway/module/domain/dto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"time"
+)
+
+// keepAliveInterval keeps idle streams from being closed by proxies.
+const keepAliveInterval = 25 * time.Second
+
+// RealtimeHandler streams the caller's events over SSE (/events) or a
+// WebSocket (/events/ws). Clients resume by sending the id of the last event
+// they saw, in the Last-Event-ID header or the lastEventId query parameter.
+// Streams end when the token they were opened with expires or is revoked, so
+// clients reconnect with a fresh one.
+type RealtimeHandler struct {
+	logInfo         *logger.Logger
+	realtimeService *services.RealtimeService
+}
+
+func NewRealtimeHandler(logInfo *logger.Logger, realtimeService *services.RealtimeService) Handler {
+	return &RealtimeHandler{logInfo, realtimeService}
+}
+
+func (h RealtimeHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("GET", "/events", h.Stream)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/events/ws", h.WebSocket)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (h RealtimeHandler) Stream(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		myerr.WriteProblem(rw, r, domainErrors.Internal(errors.New("response writer can't flush")))
+		return
+	}
+	caller := auth.Caller(r)
+	if caller.Username == "" {
+		myerr.WriteProblem(rw, r, errForbidden)
+		return
+	}
+	stream, missed := h.realtimeService.Subscribe(caller, lastEventId(r))
+	defer h.realtimeService.Unsubscribe(caller.Username, stream)
+	h.LogConnected(r, "SSE", len(missed))
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	for _, event := range missed {
+		writeServerSentEvent(rw, event)
+	}
+	flusher.Flush()
+
+	expired := time.NewTimer(time.Until(time.Unix(caller.ExpiresAt, 0)))
+	defer expired.Stop()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-stream.Events:
+			if !ok {
+				return
+			}
+			writeServerSentEvent(rw, event)
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keep-alive\n\n")
+		case <-expired.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (h RealtimeHandler) WebSocket(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	caller := auth.Caller(r)
+	if caller.Username == "" {
+		myerr.WriteProblem(rw, r, errForbidden)
+		return
+	}
+	// The token authenticates the socket, not cookies, so any origin may
+	// open one.
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		stream, missed := h.realtimeService.Subscribe(caller, lastEventId(r))
+		defer h.realtimeService.Unsubscribe(caller.Username, stream)
+		h.LogConnected(r, "WEBSOCKET", len(missed))
+
+		// Clients have nothing to say; reading only notices them leaving.
+		closed := make(chan struct{})
+		go func() {
+			var ignored []byte
+			for websocket.Message.Receive(ws, &ignored) == nil {
+			}
+			close(closed)
+		}()
+
+		for _, event := range missed {
+			if writeWebSocketEvent(ws, event) != nil {
+				return
+			}
+		}
+		expired := time.NewTimer(time.Until(time.Unix(caller.ExpiresAt, 0)))
+		defer expired.Stop()
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			var err error
+			select {
+			case event, ok := <-stream.Events:
+				if !ok {
+					return
+				}
+				err = writeWebSocketEvent(ws, event)
+			case <-keepAlive.C:
+				err = ping(ws)
+			case <-expired.C:
+				return
+			case <-closed:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}}
+	server.ServeHTTP(rw, r)
+}
+
+func lastEventId(r *http.Request) string {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("lastEventId")
+	}
+	return id
+}
+
+func writeServerSentEvent(rw http.ResponseWriter, event *events.RealtimeEvent) {
+	fmt.Fprintf(rw, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, event.Type, compactJson(event.Payload))
+}
+
+func writeWebSocketEvent(ws *websocket.Conn, event *events.RealtimeEvent) error {
+	return websocket.JSON.Send(ws, dto.RealtimeEventDto{
+		Id:   event.Id.String(),
+		Type: event.Type,
+		Data: event.Payload,
+	})
+}
+
+func ping(ws *websocket.Conn) error {
+	ws.PayloadType = websocket.PingFrame
+	defer func() { ws.PayloadType = websocket.TextFrame }()
+	_, err := ws.Write(nil)
+	return err
+}
+
+// compactJson keeps a payload on one line, as an SSE data field has to be.
+func compactJson(payload json.RawMessage) []byte {
+	var compacted bytes.Buffer
+	if json.Compact(&compacted, payload) != nil {
+		return []byte("null")
+	}
+	return compacted.Bytes()
+}
+
+func (h RealtimeHandler) LogConnected(r *http.Request, transport string, missed int) {
+	h.logInfo.Logger.WithFields(logrus.Fields{
+		"user":   auth.Caller(r).Username,
+		"userIP": ReadUserIP(r),
+		"missed": missed,
+	}).Infof("INFO:%s STREAM OPENED", transport)
+}
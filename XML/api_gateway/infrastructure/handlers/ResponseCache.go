@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"common/module/logger"
+	"fmt"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachedRoutes are the read-heavy routes whose responses the gateway
+// caches, keyed like the policy. The contact details of a user are only
+// given to that user, so they are cached per caller.
+func CachedRoutes(profileTtl time.Duration, postTtl time.Duration, jobOffersTtl time.Duration) map[string]services.CacheRoute {
+	return map[string]services.CacheRoute{
+		"GET /users/user/contact/{username}": {
+			Private: true,
+			Ttl:     profileTtl,
+			Tags: func(params map[string]string) []string {
+				return []string{services.UserCacheTag(params["username"])}
+			},
+		},
+		"GET /post/{Id}": {
+			Ttl: postTtl,
+			Tags: func(params map[string]string) []string {
+				return []string{services.PostCacheTag(params["Id"])}
+			},
+		},
+		"GET /job_offer": {
+			Ttl: jobOffersTtl,
+			Tags: func(map[string]string) []string {
+				return []string{services.JobOffersCacheTag}
+			},
+		},
+	}
+}
+
+// ResponseCache answers the cached routes from the cache, and answers
+// If-None-Match with 304 when the response didn't change. It runs after
+// the Authorizer, so every request is still authorized; private responses
+// are keyed by the caller the Authorizer verified. When the cache can't be
+// reached requests go to the services.
+type ResponseCache struct {
+	logError *logger.Logger
+	service  *services.ResponseCacheService
+	routes   map[string]services.CacheRoute
+}
+
+func NewResponseCache(logError *logger.Logger, service *services.ResponseCacheService, routes map[string]services.CacheRoute) *ResponseCache {
+	return &ResponseCache{logError, service, routes}
+}
+
+func (c *ResponseCache) Serve(rw http.ResponseWriter, r *http.Request, next http.Handler) {
+	route, params, ok := c.route(r)
+	if !ok {
+		next.ServeHTTP(rw, r)
+		return
+	}
+	key := r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+	if route.Private {
+		claims := auth.Caller(r)
+		if claims == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		key += " " + claims.Username
+	}
+
+	if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		cached, err := c.service.Lookup(key)
+		if err != nil {
+			c.logError.Logger.WithFields(logrus.Fields{
+				"key": key,
+			}).Errorf("ERR:READING RESPONSE CACHE: %v", err)
+		}
+		if cached != nil {
+			rw.Header().Set("Age", strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+			rw.Header().Set("X-Cache", "HIT")
+			c.write(rw, r, route, cached.ContentType, cached.Body, cached.ETag, cached.ExpiresAt)
+			return
+		}
+	}
+
+	recorded := &recordedResponse{ResponseWriter: rw, status: http.StatusOK}
+	next.ServeHTTP(recorded, r)
+	if recorded.status != http.StatusOK {
+		recorded.flush()
+		return
+	}
+	response := c.service.Response(key, route, rw.Header().Get("Content-Type"), recorded.body.Bytes())
+	err := c.service.Store(response, route.Tags(params))
+	if err != nil {
+		c.logError.Logger.WithFields(logrus.Fields{
+			"key": key,
+		}).Errorf("ERR:STORING RESPONSE CACHE: %v", err)
+	}
+	rw.Header().Set("X-Cache", "MISS")
+	c.write(rw, r, route, response.ContentType, response.Body, response.ETag, response.ExpiresAt)
+}
+
+func (c *ResponseCache) route(r *http.Request) (services.CacheRoute, map[string]string, bool) {
+	if r.Method != http.MethodGet {
+		return services.CacheRoute{}, nil, false
+	}
+	for key, route := range c.routes {
+		method, pattern, _ := strings.Cut(key, " ")
+		if method != r.Method {
+			continue
+		}
+		if params, ok := pathParams(pattern, r.URL.Path); ok {
+			return route, params, true
+		}
+	}
+	return services.CacheRoute{}, nil, false
+}
+
+// write answers with a cached body, or with 304 when the caller has it.
+// Private responses may be kept by the caller's browser but by no cache
+// in between.
+func (c *ResponseCache) write(rw http.ResponseWriter, r *http.Request, route services.CacheRoute,
+	contentType string, body []byte, etag string, expiresAt time.Time) {
+	header := rw.Header()
+	visibility := "public"
+	if route.Private {
+		visibility = "private"
+		header.Add("Vary", "Authorization")
+	}
+	header.Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, seconds(time.Until(expiresAt).Seconds())))
+	header.Set("ETag", etag)
+	header.Del("Content-Length")
+	if noneMatch(r.Header.Get("If-None-Match"), etag) {
+		header.Del("Content-Type")
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write(body)
+	if err != nil {
+		return
+	}
+}
+
+// noneMatch tells whether an If-None-Match header names etag. It compares
+// weakly, as RFC 9110 asks for If-None-Match.
+func noneMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// recordedResponse holds the response back until it's known whether it can
+// be cached.
+type recordedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *recordedResponse) WriteHeader(status int) {
+	rr.status = status
+}
+
+func (rr *recordedResponse) Write(data []byte) (int, error) {
+	return rr.body.Write(data)
+}
+
+func (rr *recordedResponse) flush() {
+	rr.ResponseWriter.WriteHeader(rr.status)
+	_, err := rr.ResponseWriter.Write(rr.body.Bytes())
+	if err != nil {
+		return
+	}
+}
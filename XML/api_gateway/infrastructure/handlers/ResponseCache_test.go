@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"common/module/interceptor"
+	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
+	"common/module/revocation"
+	events "common/module/saga/change_events"
+	"fmt"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"gateway/module/infrastructure/persistance"
+	"github.com/google/uuid"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cachePolicy lets any caller with a token read any user's contact details,
+// so only the cache stands between one caller and another's response.
+const cachePolicy = `{
+  "routes": {
+    "GET /users/user/contact/{username}": {},
+    "GET /post/{Id}": {"public": true},
+    "GET /job_offer": {"public": true}
+  }
+}`
+
+type responseCacheFixture struct {
+	cache      *ResponseCache
+	changes    *ChangeEventHandler
+	authorizer *auth.Authorizer
+	tokens     map[string]string
+	// calls counts the requests that reached the services.
+	calls int
+}
+
+func newResponseCacheFixture(t *testing.T) *responseCacheFixture {
+	l, _ := logtest.NewNullLogger()
+	discard := &logger.Logger{Logger: l}
+	keys, err := auth.NewKeyManager(&signingKeyRepositoryInMemory{}, "RS256", time.Hour, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]string{}
+	for _, username := range []string{"alice", "bob"} {
+		tokens[username], _, err = keys.GenerateToken(&interceptor.JwtClaims{Username: username, Roles: []string{"Regular"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	authPolicy, err := policy.Parse([]byte(cachePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := services.NewResponseCacheService(discard, discard, persistance.NewResponseCacheRepositoryInMemory())
+	return &responseCacheFixture{
+		cache:      NewResponseCache(discard, service, CachedRoutes(time.Minute, time.Minute, time.Minute)),
+		changes:    &ChangeEventHandler{logError: discard, responseCacheService: service},
+		authorizer: auth.NewAuthorizer(authPolicy, keys, revocation.NewList(), permissions.NewCache(authPolicy.Roles), discard),
+		tokens:     tokens,
+	}
+}
+
+// get sends a request the way the gateway does, through the Authorizer and
+// then the cache. The services answer with the caller and the number of
+// the call, and don't know the post "missing".
+func (f *responseCacheFixture) get(t *testing.T, caller string, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if caller != "" {
+		r.Header.Set("Authorization", "Bearer "+f.tokens[caller])
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rw := httptest.NewRecorder()
+	r, ok := f.authorizer.Authorize(rw, r)
+	if !ok {
+		t.Fatalf("%s got %d for %s", caller, rw.Code, target)
+	}
+	f.cache.Serve(rw, r, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		f.calls++
+		if r.URL.Path == "/post/missing" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(rw, `{"caller":%q,"call":%d}`, caller, f.calls)
+	}))
+	return rw
+}
+
+func (f *responseCacheFixture) change(eventType events.ChangeEventType, username string, post string) {
+	f.changes.handle(&events.ChangeEvent{Id: uuid.New(), Type: eventType, Username: username, Post: post, ChangedAt: time.Now()})
+}
+
+func TestResponseCacheKeepsPrivateResponsesToTheirCaller(t *testing.T) {
+	f := newResponseCacheFixture(t)
+	first := f.get(t, "alice", "/users/user/contact/alice")
+	if first.Header().Get("X-Cache") != "MISS" || first.Body.String() != `{"caller":"alice","call":1}` {
+		t.Fatalf("alice got %s %q first", first.Header().Get("X-Cache"), first.Body.String())
+	}
+	if got, want := first.Header().Get("Cache-Control"), "private, max-age=60"; got != want {
+		t.Errorf("Cache-Control %q, want %q", got, want)
+	}
+	if got := first.Header().Get("Vary"); got != "Authorization" {
+		t.Errorf("Vary %q, want Authorization", got)
+	}
+	if again := f.get(t, "alice", "/users/user/contact/alice"); again.Header().Get("X-Cache") != "HIT" || again.Body.String() != first.Body.String() {
+		t.Fatalf("alice got %s %q again, want the one cached for alice", again.Header().Get("X-Cache"), again.Body.String())
+	}
+
+	other := f.get(t, "bob", "/users/user/contact/alice")
+	if other.Header().Get("X-Cache") != "MISS" || other.Body.String() != `{"caller":"bob","call":2}` {
+		t.Fatalf("bob got %s %q, want one made for bob", other.Header().Get("X-Cache"), other.Body.String())
+	}
+	if again := f.get(t, "alice", "/users/user/contact/alice"); again.Body.String() != first.Body.String() {
+		t.Fatalf("alice got %q after bob, want the one cached for alice", again.Body.String())
+	}
+}
+
+func TestResponseCacheAnswersIfNoneMatch(t *testing.T) {
+	f := newResponseCacheFixture(t)
+	first := f.get(t, "", "/post/1")
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Fatalf("got ETag %q and Cache-Control %q", etag, first.Header().Get("Cache-Control"))
+	}
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		rw := f.get(t, "", "/post/1", "If-None-Match", ifNoneMatch)
+		if rw.Code != http.StatusNotModified || rw.Body.Len() != 0 || rw.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %s: got %d %q, want 304", ifNoneMatch, rw.Code, rw.Body.String())
+		}
+	}
+	rw := f.get(t, "", "/post/1", "If-None-Match", `"other"`)
+	if rw.Code != http.StatusOK || rw.Body.String() != first.Body.String() {
+		t.Fatalf("got %d %q for another ETag, want the cached response", rw.Code, rw.Body.String())
+	}
+	if f.calls != 1 {
+		t.Fatalf("the services were called %d times, want once", f.calls)
+	}
+}
+
+func TestResponseCacheStoresOnlyOkResponses(t *testing.T) {
+	f := newResponseCacheFixture(t)
+	for i := 1; i <= 2; i++ {
+		rw := f.get(t, "", "/post/missing")
+		if rw.Code != http.StatusNotFound || rw.Header().Get("X-Cache") != "" || rw.Header().Get("ETag") != "" {
+			t.Fatalf("request %d: got %d with X-Cache %q, want the 404 as it was", i, rw.Code, rw.Header().Get("X-Cache"))
+		}
+		if f.calls != i {
+			t.Fatalf("request %d: the services were called %d times", i, f.calls)
+		}
+	}
+}
+
+func TestResponseCacheDropsWhatChanged(t *testing.T) {
+	f := newResponseCacheFixture(t)
+	targets := []struct {
+		caller string
+		target string
+	}{
+		{"alice", "/users/user/contact/alice"},
+		{"bob", "/users/user/contact/alice"},
+		{"alice", "/users/user/contact/bob"},
+		{"", "/post/1"},
+		{"", "/post/2"},
+		{"", "/job_offer"},
+	}
+	for _, c := range targets {
+		f.get(t, c.caller, c.target)
+	}
+	cached := func() map[string]bool {
+		hits := map[string]bool{}
+		for _, c := range targets {
+			hits[c.caller+" "+c.target] = f.get(t, c.caller, c.target).Header().Get("X-Cache") == "HIT"
+		}
+		return hits
+	}
+	expect := func(change string, want map[string]bool) {
+		t.Helper()
+		for key, hit := range cached() {
+			if hit != want[key] {
+				t.Errorf("after %s %s cached %v, want %v", change, key, hit, want[key])
+			}
+		}
+	}
+
+	expect("nothing", map[string]bool{
+		"alice /users/user/contact/alice": true, "bob /users/user/contact/alice": true,
+		"alice /users/user/contact/bob": true, " /post/1": true, " /post/2": true, " /job_offer": true,
+	})
+	f.change(events.UnknownChangeEvent, "alice", "2")
+	f.change(events.PostUpdated, "bob", "1")
+	// Every caller's copy of alice's details goes.
+	f.change(events.UserUpdated, "alice", "")
+	f.change(events.JobOfferCreated, "bob", "")
+	expect("the changes", map[string]bool{"alice /users/user/contact/bob": true, " /post/2": true})
+	expect("caching again", map[string]bool{
+		"alice /users/user/contact/alice": true, "bob /users/user/contact/alice": true,
+		"alice /users/user/contact/bob": true, " /post/1": true, " /post/2": true, " /job_offer": true,
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"common/module/logger"
+	saga "common/module/saga/messaging"
+	events "common/module/saga/revocation_events"
+	"gateway/module/application/services"
+)
+
+type RevocationEventHandler struct {
+	logError          *logger.Logger
+	revocationService *services.RevocationService
+	subscriber        saga.Subscriber
+}
+
+func NewRevocationEventHandler(logError *logger.Logger, revocationService *services.RevocationService, subscriber saga.Subscriber) (*RevocationEventHandler, error) {
+	h := &RevocationEventHandler{
+		logError:          logError,
+		revocationService: revocationService,
+		subscriber:        subscriber,
+	}
+	err := h.subscriber.Subscribe(h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *RevocationEventHandler) handle(event *events.RevocationEvent) {
+	switch event.Type {
+	case events.RevokeToken, events.RevokeSession, events.RevokeUserSessions:
+		err := h.revocationService.Store(event)
+		if err != nil {
+			h.logError.Logger.Errorf("ERR:STORING REVOCATION: %v", err)
+		}
+	case events.SyncRequest:
+		err := h.revocationService.Rebroadcast()
+		if err != nil {
+			h.logError.Logger.Errorf("ERR:REBROADCASTING REVOCATIONS: %v", err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"common/module/logger"
+	saga "common/module/saga/messaging"
+	events "common/module/saga/role_events"
+	"gateway/module/application/services"
+)
+
+// RoleEventHandler answers the sync requests of services whose permission
+// cache just started.
+type RoleEventHandler struct {
+	logError    *logger.Logger
+	roleService *services.RoleService
+	subscriber  saga.Subscriber
+}
+
+func NewRoleEventHandler(logError *logger.Logger, roleService *services.RoleService, subscriber saga.Subscriber) (*RoleEventHandler, error) {
+	h := &RoleEventHandler{
+		logError:    logError,
+		roleService: roleService,
+		subscriber:  subscriber,
+	}
+	err := h.subscriber.Subscribe(h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *RoleEventHandler) handle(event *events.RoleEvent) {
+	if event.Type != events.RoleSyncRequest {
+		return
+	}
+	err := h.roleService.Rebroadcast()
+	if err != nil {
+		h.logError.Logger.Errorf("ERR:REBROADCASTING ROLES: %v", err)
+	}
+}
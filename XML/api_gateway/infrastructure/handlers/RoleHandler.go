@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/logger"
+	"encoding/json"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
+	"gateway/module/auth"
+	"gateway/module/domain/dto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// RoleHandler is the admin API for roles. The policy only lets callers with
+// the roles:manage permission through.
+type RoleHandler struct {
+	logError    *logger.Logger
+	roleService *services.RoleService
+}
+
+func NewRoleHandler(logError *logger.Logger, roleService *services.RoleService) Handler {
+	return &RoleHandler{logError, roleService}
+}
+
+func (h RoleHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("GET", "/permissions", h.GetPermissions)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/roles", h.GetRoles)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("PUT", "/roles/{name}", h.SaveRole)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("DELETE", "/roles/{name}", h.DeleteRole)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/users/{username}/roles", h.GetUserRoles)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("PUT", "/users/{username}/roles", h.SetUserRoles)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (h RoleHandler) GetPermissions(rw http.ResponseWriter, _ *http.Request, _ map[string]string) {
+	writeJson(rw, h.roleService.KnownPermissions())
+}
+
+func (h RoleHandler) GetRoles(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	roles, err := h.roleService.GetAll()
+	if err != nil {
+		h.LogError(r, "LOADING ROLES: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	response := make([]dto.RoleDto, 0, len(roles))
+	for _, role := range roles {
+		permissions := make([]string, 0, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			permissions = append(permissions, permission.Permission)
+		}
+		response = append(response, dto.RoleDto{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: permissions,
+			BuiltIn:     h.roleService.IsBuiltIn(role.Name),
+		})
+	}
+	writeJson(rw, response)
+}
+
+func (h RoleHandler) SaveRole(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	var request dto.SaveRoleRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+	policy := bluemonday.StrictPolicy()
+	request.Description = strings.TrimSpace(policy.Sanitize(request.Description))
+
+	err = h.roleService.Save(params["name"], request.Description, request.Permissions)
+	if err == services.ErrInvalidRoleName {
+		myerr.WriteProblem(rw, r, invalidField("name", "must be 2-32 letters, digits, '-' or '_'"))
+		return
+	}
+	if err == services.ErrUnknownPermission {
+		myerr.WriteProblem(rw, r, invalidField("permissions", "names a permission that doesn't exist"))
+		return
+	}
+	if err == services.ErrKeepsRoleManager {
+		myerr.WriteProblem(rw, r, domainErrors.FailedPrecondition(myerr.CodeBuiltInRole,
+			"Built-in roles keep the "+services.ManageRoles+" permission the policy gives them"))
+		return
+	}
+	if err == services.ErrLastRoleManager {
+		myerr.WriteProblem(rw, r, errLastRoleManager)
+		return
+	}
+	if err != nil {
+		h.LogError(r, "SAVING ROLE: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h RoleHandler) DeleteRole(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	err := h.roleService.Delete(params["name"])
+	if err == services.ErrBuiltInRole {
+		myerr.WriteProblem(rw, r, domainErrors.FailedPrecondition(myerr.CodeBuiltInRole, "Built-in roles can't be deleted"))
+		return
+	}
+	if err == services.ErrRoleNotFound {
+		myerr.WriteProblem(rw, r, errRoleNotFound)
+		return
+	}
+	if err == services.ErrLastRoleManager {
+		myerr.WriteProblem(rw, r, errLastRoleManager)
+		return
+	}
+	if err != nil {
+		h.LogError(r, "DELETING ROLE: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h RoleHandler) GetUserRoles(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	roles, err := h.roleService.UserRoles(params["username"])
+	if err == services.ErrUserNotFound {
+		myerr.WriteProblem(rw, r, errUserNotFound)
+		return
+	}
+	if err != nil {
+		h.LogError(r, "LOADING USER ROLES: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	writeJson(rw, dto.UserRolesDto{Roles: roles})
+}
+
+func (h RoleHandler) SetUserRoles(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	var request dto.UserRolesDto
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errMalformedRequest)
+		return
+	}
+
+	err = h.roleService.Assign(params["username"], request.Roles)
+	if err == services.ErrNoRoles {
+		myerr.WriteProblem(rw, r, invalidField("roles", "can't be empty"))
+		return
+	}
+	if err == services.ErrRoleNotFound {
+		myerr.WriteProblem(rw, r, invalidField("roles", "names a role that doesn't exist"))
+		return
+	}
+	if err == services.ErrUserNotFound {
+		myerr.WriteProblem(rw, r, errUserNotFound)
+		return
+	}
+	if err == services.ErrLastRoleManager {
+		myerr.WriteProblem(rw, r, errLastRoleManager)
+		return
+	}
+	if err != nil {
+		h.LogError(r, "ASSIGNING ROLES: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h RoleHandler) LogError(r *http.Request, message string) {
+	h.logError.Logger.WithFields(logrus.Fields{
+		"user":   auth.Caller(r).Username,
+		"userIP": ReadUserIP(r),
+	}).Error(message)
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"common/module/jwks"
+	"encoding/json"
+	"gateway/module/application/services"
+	"gateway/module/domain/dto"
+	"gateway/module/domain/model"
+	"gateway/module/openapi"
+	"github.com/graphql-go/graphql"
+	"net/http"
+)
+
+// RouteDocs documents the routes the gateway handles itself. The gateway
+// refuses to start while a route of the policy has no entry here, or isn't
+// generated from a service.
+var RouteDocs = map[string]openapi.Route{
+	"POST /users/auth/user": {
+		Tag:         "Authentication",
+		Summary:     "Check a password",
+		Description: "Returns a ticket for the second factor, or for /users/auth/user/regular when the account has none.",
+		Request:     dto.LoginRequest{},
+		Response:    dto.AuthenticateResponse{},
+	},
+	"POST /users/auth/user/regular": {
+		Tag:      "Authentication",
+		Summary:  "Log in with a ticket of an account without a second factor",
+		Request:  dto.MfaTicketRequest{},
+		Response: dto.LogInResponseDto{},
+	},
+	"POST /users/auth/refresh": {
+		Tag:         "Authentication",
+		Summary:     "Exchange a refresh token for new tokens",
+		Description: "Refresh tokens are single use; reusing one revokes its whole family.",
+		Request:     dto.RefreshTokenRequest{},
+		Response:    dto.LogInResponseDto{},
+	},
+	"POST /users/auth/logout": {
+		Tag:     "Authentication",
+		Summary: "Revoke the refresh token and, when sent, the access token",
+		Request: dto.RefreshTokenRequest{},
+	},
+	"POST /users/login/passwordless": {
+		Tag:     "Authentication",
+		Summary: "Email a one-time login link",
+		Request: dto.PasswordLessLoginRequest{},
+	},
+	"GET /users/login/passwordless/{id}": {
+		Tag:         "Authentication",
+		Summary:     "Log in with the code of a login link",
+		Description: "Accounts with a second factor get a ticket for it instead, shaped like the answer of /users/auth/user.",
+		Response:    dto.LogInResponseDto{},
+	},
+	"POST /users/login/unlock": {
+		Tag:         "Authentication",
+		Summary:     "Unlock an account locked after failed logins",
+		Description: "Takes the code mailed when the account got locked.",
+		Request:     dto.UnlockRequest{},
+	},
+	"POST /users/token/generate": {
+		Tag:         "UserService",
+		Summary:     "Issue an API token to share job offers with",
+		Description: "The token is valid for 30 days and only accepted by /users/share/jobOffer.",
+		Request:     dto.UsernameRequest{},
+		Response:    dto.ApiTokenResponse{},
+	},
+	"POST /2fa/authenticate": {
+		Tag:     "Two-factor authentication",
+		Summary: "Log in with a ticket and a TOTP or recovery code",
+		Description: "Not compatible with v1, which logged in with a username and a token: " +
+			"/v1/2fa/authenticate answers 410.",
+		Request:  dto.AuthenticateRequest{},
+		Response: dto.LogInResponseDto{},
+	},
+	"POST /2fa/check": {
+		Tag:      "Two-factor authentication",
+		Summary:  "Tell whether a user has TOTP enabled",
+		Request:  dto.UsernameRequest{},
+		Response: false,
+	},
+	"POST /2fa/enable": {
+		Tag:         "Two-factor authentication",
+		Summary:     "Start enrolling a TOTP authenticator",
+		Description: "The secret only becomes active once /2fa/confirm gets a code for it.",
+		Request:     dto.UsernameRequest{},
+		Response:    dto.Enable2FaResponse{},
+	},
+	"POST /2fa/disable": {
+		Tag:      "Two-factor authentication",
+		Summary:  "Turn TOTP off",
+		Request:  dto.UsernameRequest{},
+		Response: false,
+	},
+	"POST /2fa/confirm": {
+		Tag:      "Two-factor authentication",
+		Summary:  "Confirm a TOTP enrollment and get recovery codes",
+		Request:  dto.AuthenticateRequest{},
+		Response: dto.RecoveryCodesResponse{},
+	},
+	"POST /2fa/recovery-codes": {
+		Tag:         "Two-factor authentication",
+		Summary:     "Replace the recovery codes",
+		Description: "Needs a current TOTP code; the old codes stop working.",
+		Request:     dto.AuthenticateRequest{},
+		Response:    dto.RecoveryCodesResponse{},
+	},
+	"POST /webauthn/register/begin": {
+		Tag:         "WebAuthn",
+		Summary:     "Start registering a security key or passkey",
+		Description: "Takes the password, or a code from the authenticator app, again.",
+		Request:     dto.ReauthenticateRequest{},
+		Response:    dto.WebAuthnBeginResponse{},
+	},
+	"POST /webauthn/register/finish": {
+		Tag:         "WebAuthn",
+		Summary:     "Finish a registration with the browser's attestation",
+		Description: "The body is the credential navigator.credentials.create returned.",
+		Query:       []string{"session", "name"},
+		Request:     json.RawMessage{},
+		Response:    model.WebAuthnCredential{},
+		Status:      http.StatusCreated,
+	},
+	"GET /webauthn/credentials": {
+		Tag:      "WebAuthn",
+		Summary:  "List the caller's authenticators",
+		Response: []model.WebAuthnCredential{},
+	},
+	"PUT /webauthn/credentials/{id}": {
+		Tag:     "WebAuthn",
+		Summary: "Rename an authenticator",
+		Request: dto.WebAuthnCredentialName{},
+	},
+	"DELETE /webauthn/credentials/{id}": {
+		Tag:     "WebAuthn",
+		Summary: "Remove an authenticator",
+	},
+	"POST /webauthn/login/begin": {
+		Tag:         "WebAuthn",
+		Summary:     "Start a passkey login",
+		Description: "The username is optional; without it any discoverable passkey will do.",
+		Request:     dto.UsernameRequest{},
+		Response:    dto.WebAuthnBeginResponse{},
+	},
+	"POST /webauthn/login/finish": {
+		Tag:         "WebAuthn",
+		Summary:     "Log in with the browser's assertion",
+		Description: "The body is the credential navigator.credentials.get returned.",
+		Query:       []string{"session"},
+		Request:     json.RawMessage{},
+		Response:    dto.LogInResponseDto{},
+	},
+	"POST /webauthn/2fa/begin": {
+		Tag:      "WebAuthn",
+		Summary:  "Start using a security key as the second factor",
+		Request:  dto.MfaTicketRequest{},
+		Response: dto.WebAuthnBeginResponse{},
+	},
+	"POST /webauthn/2fa/finish": {
+		Tag:      "WebAuthn",
+		Summary:  "Log in with the browser's assertion as the second factor",
+		Query:    []string{"session"},
+		Request:  json.RawMessage{},
+		Response: dto.LogInResponseDto{},
+	},
+	"GET /users/sessions": {
+		Tag:      "Sessions",
+		Summary:  "List the caller's active sessions",
+		Response: []dto.SessionDto{},
+	},
+	"GET /users/sessions/history": {
+		Tag:      "Sessions",
+		Summary:  "List the caller's logins",
+		Response: []model.LoginSession{},
+	},
+	"DELETE /users/sessions/{id}": {
+		Tag:     "Sessions",
+		Summary: "Log a session out",
+	},
+	"GET /users/{username}/feed": {
+		Tag:         "Feed",
+		Summary:     "Get a page of the home feed",
+		Description: "mode is latest (the default) or top. Pass the nextCursor of a page to get the one after it.",
+		Query:       []string{"mode", "cursor", "limit"},
+		Response:    dto.FeedPostsResponseDto{},
+	},
+	"GET /.well-known/jwks.json": {
+		Tag:      "Keys",
+		Summary:  "Get the keys access tokens are signed with",
+		Response: jwks.KeySet{},
+	},
+	"GET /events": {
+		Tag:         "Realtime",
+		Summary:     "Stream the caller's notifications and messages as server-sent events",
+		Description: "Resume with the Last-Event-ID header or the lastEventId parameter.",
+		Query:       []string{"lastEventId"},
+		Response:    "",
+		ContentType: "text/event-stream",
+	},
+	"GET /events/ws": {
+		Tag:         "Realtime",
+		Summary:     "Stream the caller's notifications and messages over a WebSocket",
+		Description: "Every frame is a JSON event. Resume with the lastEventId parameter.",
+		Query:       []string{"lastEventId"},
+		Response:    dto.RealtimeEventDto{},
+		Status:      http.StatusSwitchingProtocols,
+	},
+	"GET /status": {
+		Tag:      "Status",
+		Summary:  "Report the circuit breakers of the backends",
+		Response: dto.StatusDto{},
+	},
+	"GET /permissions": {
+		Tag:      "Roles",
+		Summary:  "List the permissions roles can grant",
+		Response: []string{},
+	},
+	"GET /roles": {
+		Tag:      "Roles",
+		Summary:  "List roles",
+		Response: []dto.RoleDto{},
+	},
+	"PUT /roles/{name}": {
+		Tag:         "Roles",
+		Summary:     "Create or change a role",
+		Description: "Tokens carry only roles, so the change also applies to tokens already issued.",
+		Request:     dto.SaveRoleRequest{},
+	},
+	"DELETE /roles/{name}": {
+		Tag:     "Roles",
+		Summary: "Delete a role that isn't built in",
+	},
+	"GET /users/{username}/roles": {
+		Tag:      "Roles",
+		Summary:  "Get the roles of a user",
+		Response: dto.UserRolesDto{},
+	},
+	"PUT /users/{username}/roles": {
+		Tag:         "Roles",
+		Summary:     "Replace the roles of a user",
+		Description: "Logs the user out of every session, as the roles are part of their tokens.",
+		Request:     dto.UserRolesDto{},
+	},
+	"GET /openapi.json": {
+		Tag:      "Documentation",
+		Summary:  "Get this document",
+		Response: map[string]interface{}{},
+	},
+	"GET /docs": {
+		Tag:         "Documentation",
+		Summary:     "Browse this document",
+		Response:    "",
+		ContentType: "text/html",
+	},
+	"GET /docs/assets/{file}": {
+		Tag:         "Documentation",
+		Summary:     "Get a script or stylesheet of the documentation page",
+		Description: "Swagger UI's swagger-ui-bundle.js and swagger-ui.css, which the gateway image ships with.",
+		Response:    "",
+		ContentType: "application/octet-stream",
+	},
+	"POST /graphql": {
+		Tag:     "GraphQL",
+		Summary: "Run a GraphQL query",
+		Description: "Every field is authorized by the rule of the RPC it calls; fields the caller may not " +
+			"see come back null with an error. Queries deeper or more complex than the gateway allows are refused. " +
+			"A request calls an RPC once per distinct key, and the keys of a level of the query are fetched " +
+			"concurrently; they aren't batched into one call, so every post of a list still costs a call for " +
+			"each of its fields that needs a service.",
+		Request:  services.GraphqlQuery{},
+		Response: graphql.Result{},
+	},
+	"GET /graphql/schema": {
+		Tag:         "GraphQL",
+		Summary:     "Get the GraphQL schema",
+		Response:    "",
+		ContentType: "text/plain",
+	},
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/logger"
+	"encoding/json"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
+	"gateway/module/domain/dto"
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type SessionHandler struct {
+	logError       *logger.Logger
+	sessionService *services.SessionService
+}
+
+func NewSessionHandler(logError *logger.Logger, sessionService *services.SessionService) Handler {
+	return &SessionHandler{logError, sessionService}
+}
+
+func (s SessionHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("GET", "/users/sessions", s.GetActive)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("GET", "/users/sessions/history", s.GetHistory)
+	if err != nil {
+		panic(err)
+	}
+	err = mux.HandlePath("DELETE", "/users/sessions/{id}", s.Revoke)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (s SessionHandler) GetActive(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+
+	sessions, err := s.sessionService.GetActive(claims.Username)
+	if err != nil {
+		s.LogError(ReadUserIP(r), claims.Username, "LOADING ACTIVE SESSIONS: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	response := make([]dto.SessionDto, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, dto.SessionDto{
+			LoginSession: session,
+			Current:      session.ID.String() == claims.SessionId,
+		})
+	}
+	writeJson(rw, response)
+}
+
+func (s SessionHandler) GetHistory(rw http.ResponseWriter, r *http.Request, _ map[string]string) {
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+
+	history, err := s.sessionService.GetHistory(claims.Username)
+	if err != nil {
+		s.LogError(ReadUserIP(r), claims.Username, "LOADING LOGIN HISTORY: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	writeJson(rw, history)
+}
+
+func (s SessionHandler) Revoke(rw http.ResponseWriter, r *http.Request, params map[string]string) {
+	ip := ReadUserIP(r)
+	claims, err := bearerClaims(r)
+	if err != nil {
+		myerr.WriteProblem(rw, r, errUnauthenticated)
+		return
+	}
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		myerr.WriteProblem(rw, r, errInvalidId)
+		return
+	}
+
+	err = s.sessionService.Revoke(claims.Username, id)
+	if err == services.ErrSessionNotFound {
+		myerr.WriteProblem(rw, r, domainErrors.NotFound(myerr.CodeSessionNotFound, "Session not found"))
+		return
+	}
+	if err != nil {
+		s.LogError(ip, claims.Username, "REVOKING SESSION: "+err.Error())
+		myerr.WriteProblem(rw, r, domainErrors.Internal(err))
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s SessionHandler) LogError(ip string, username string, message string) {
+	s.logError.Logger.WithFields(logrus.Fields{
+		"user":   username,
+		"userIP": ip,
+	}).Error(message)
+}
+
+func writeJson(rw http.ResponseWriter, body interface{}) {
+	response, _ := json.Marshal(body)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write(response)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"gateway/module/domain/dto"
+	clients "gateway/module/infrastructure/api"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"net/http"
+)
+
+// StatusHandler reports the circuit breaker of every backend the gateway
+// called so far.
+type StatusHandler struct {
+	resilience *clients.Resilience
+}
+
+func NewStatusHandler(resilience *clients.Resilience) Handler {
+	return &StatusHandler{resilience}
+}
+
+func (h StatusHandler) Init(mux *runtime.ServeMux) {
+	err := mux.HandlePath("GET", "/status", h.GetStatus)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (h StatusHandler) GetStatus(rw http.ResponseWriter, _ *http.Request, _ map[string]string) {
+	response := dto.StatusDto{Status: "ok", Backends: []dto.BackendStatusDto{}}
+	for _, breaker := range h.resilience.Breakers() {
+		backend := dto.BackendStatusDto{
+			Backend:  breaker.Backend,
+			Breaker:  breaker.State,
+			Failures: breaker.Failures,
+		}
+		if breaker.State != clients.BreakerClosed {
+			response.Status = "degraded"
+			openedAt := breaker.OpenedAt
+			backend.OpenedAt = &openedAt
+		}
+		response.Backends = append(response.Backends, backend)
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJson(rw, response)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"common/module/logger"
+	saga "common/module/saga/messaging"
+	events "common/module/saga/timeline_events"
+	"gateway/module/application/services"
+	"github.com/sirupsen/logrus"
+)
+
+type TimelineEventHandler struct {
+	logError        *logger.Logger
+	timelineService *services.TimelineService
+	subscriber      saga.Subscriber
+}
+
+func NewTimelineEventHandler(logError *logger.Logger, timelineService *services.TimelineService, subscriber saga.Subscriber) (*TimelineEventHandler, error) {
+	h := &TimelineEventHandler{
+		logError:        logError,
+		timelineService: timelineService,
+		subscriber:      subscriber,
+	}
+	err := h.subscriber.Subscribe(h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *TimelineEventHandler) handle(event *events.TimelineEvent) {
+	var err error
+	switch event.Type {
+	case events.PostCreated:
+		err = h.timelineService.PostCreated(event)
+	case events.UsersConnected:
+		err = h.timelineService.UsersConnected(event.UserOne, event.UserTwo)
+	case events.UsersDisconnected:
+		err = h.timelineService.UsersDisconnected(event.UserOne, event.UserTwo)
+	default:
+		return
+	}
+	if err != nil {
+		h.logError.Logger.WithFields(logrus.Fields{
+			"event":   event.Id,
+			"type":    event.Type,
+			"postId":  event.Post,
+			"userOne": event.UserOne,
+			"userTwo": event.UserTwo,
+		}).Errorf("ERR:UPDATING TIMELINES: %v", err)
+	}
+}
@@ -1,37 +1,36 @@
 package handlers
 
 import (
+	domainErrors "common/module/errors"
 	"common/module/logger"
-	connectionPb "common/module/proto/connection_service"
-	postPb "common/module/proto/posts_service"
 	"context"
 	"encoding/json"
-	"fmt"
+	myerr "gateway/module/application/errors"
+	"gateway/module/application/services"
 	"gateway/module/domain/dto"
-	"gateway/module/domain/model"
-	clients "gateway/module/infrastructure/api"
-	"gateway/module/startup/config"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type UserFeedHandler struct {
-	logInfo                  *logger.Logger
-	logError                 *logger.Logger
-	config                   *config.Config
-	userServiceAddress       string
-	postServiceAddress       string
-	connectionServiceAddress string
+	logInfo     *logger.Logger
+	logError    *logger.Logger
+	feedService *services.FeedService
+	timeout     time.Duration
 }
 
-func NewUserFeedHandler(logInfo *logger.Logger, logError *logger.Logger, c *config.Config) Handler {
+func NewUserFeedHandler(logInfo *logger.Logger, logError *logger.Logger, feedService *services.FeedService, timeout time.Duration) Handler {
 	return &UserFeedHandler{
-		logInfo:                  logInfo,
-		logError:                 logError,
-		config:                   c,
-		userServiceAddress:       fmt.Sprintf("%s:%s", c.UserHost, c.UserPort),
-		postServiceAddress:       fmt.Sprintf("%s:%s", c.PostsHost, c.PostsPort),
-		connectionServiceAddress: fmt.Sprintf("%s:%s", c.ConnectionsHost, c.ConnectionsPort),
+		logInfo:     logInfo,
+		logError:    logError,
+		feedService: feedService,
+		timeout:     timeout,
 	}
 }
 
@@ -43,62 +42,75 @@ func (u UserFeedHandler) Init(mux *runtime.ServeMux) {
 
 }
 
+// GetFeedPostsForUser serves the feed a page at a time: ?limit= sets the page
+// size and ?cursor= takes the NextCursor of the previous page. ?mode=top ranks
+// the feed instead of serving it newest first. The request's deadline, cut to
+// the feed timeout, bounds every call to the services.
 func (u UserFeedHandler) GetFeedPostsForUser(rw http.ResponseWriter, r *http.Request, params map[string]string) {
-	fmt.Println("GetFeedPostsForUser HANDLER")
 	username := params["username"]
 	if username == "" {
-		rw.WriteHeader(http.StatusBadRequest)
+		myerr.WriteProblem(rw, r, invalidField("username", "is required"))
 		return
 	}
-	postsClient := clients.NewPostClient(u.postServiceAddress)
-	connectionClient := clients.NewConnectionClient(u.connectionServiceAddress)
+	limit := services.FeedPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > services.FeedMaxPageSize {
+			myerr.WriteProblem(rw, r, invalidField("limit", "must be between 1 and "+strconv.Itoa(services.FeedMaxPageSize)))
+			return
+		}
+		limit = parsed
+	}
 
-	connections, err := connectionClient.GetConnections(context.TODO(), &connectionPb.GetRequest{Username: username})
-	if err != nil {
-		rw.WriteHeader(http.StatusNotFound)
+	ctx, cancel := context.WithTimeout(r.Context(), u.timeout)
+	defer cancel()
+	// The services authorize the user who asked for the feed, not the gateway.
+	ctx = metadata.AppendToOutgoingContext(ctx, "Authorization", r.Header.Get("Authorization"))
+
+	page, err := u.feedService.GetFeed(ctx, username, r.URL.Query().Get("mode"), r.URL.Query().Get("cursor"), limit)
+	if err == services.ErrInvalidCursor {
+		myerr.WriteProblem(rw, r, domainErrors.InvalidArgument(myerr.CodeInvalidCursor, "Invalid feed cursor",
+			domainErrors.Field("cursor", "isn't the nextCursor of a page")))
 		return
 	}
-
-	var posts []model.Post
-	for _, user := range connections.Users {
-		postsPbs, err := postsClient.GetAllByUsername(context.TODO(), &postPb.GetRequest{Id: user.Username})
-		if err != nil {
-			rw.WriteHeader(http.StatusBadRequest)
-			return
+	if err == services.ErrInvalidMode {
+		myerr.WriteProblem(rw, r, invalidField("mode", "must be latest or top"))
+		return
+	}
+	if err != nil {
+		u.logError.Logger.WithFields(logrus.Fields{
+			"user":   username,
+			"userIP": ReadUserIP(r),
+		}).Errorf("ERR:LOADING FEED: %v", err)
+		problem := myerr.ProblemOf(r, err)
+		// Statuses are the services' answers, so their failures are the
+		// gateway's upstream failing.
+		if _, ok := status.FromError(err); ok {
+			switch status.Code(err) {
+			case codes.DeadlineExceeded:
+				problem.Status = http.StatusGatewayTimeout
+			case codes.Internal, codes.Unknown, codes.Unavailable:
+				problem.Status = http.StatusBadGateway
+			}
+			problem.Title = http.StatusText(problem.Status)
 		}
-		posts = append(posts, mapPbsToModel(postsPbs.Posts)...)
+		problem.Write(rw)
+		return
 	}
-	fmt.Println("duzina svih postova")
-	fmt.Println(len(posts))
 
 	postsDto := dto.FeedPostsResponseDto{
-		Feed: posts,
+		Feed:       page.Posts,
+		NextCursor: page.NextCursor,
+		Warnings:   page.Warnings,
 	}
-
 	postsDtoJson, _ := json.Marshal(postsDto)
-	rw.WriteHeader(http.StatusOK)
 	rw.Header().Set("Content-Type", "application/json")
+	if len(page.Warnings) > 0 {
+		rw.Header().Set("Warning", `199 api_gateway "partial feed"`)
+	}
+	rw.WriteHeader(http.StatusOK)
 	_, err = rw.Write(postsDtoJson)
 	if err != nil {
 		return
 	}
 }
-func mapPbsToModel(postsPb []*postPb.Post) []model.Post {
-	var posts []model.Post
-
-	for _, postPb := range postsPb {
-		var post model.Post
-		post.Id = postPb.Id
-		post.Username = postPb.Username
-		post.PostText = postPb.PostText
-		post.ImagePaths = postPb.ImagePaths
-		post.DatePosted = postPb.DatePosted
-		post.LikesNumber = postPb.LikesNumber
-		post.DislikesNumber = postPb.DislikesNumber
-		post.CommentsNumber = postPb.CommentsNumber
-		post.Links = model.Links{Comment: postPb.Links.Comment, Dislike: postPb.Links.Dislike, Like: postPb.Links.Like}
-
-		posts = append(posts, post)
-	}
-	return posts
-}
@@ -0,0 +1,62 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type LoginAttemptRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepositoryImpl(db *gorm.DB) repositories.LoginAttemptRepository {
+	return &LoginAttemptRepositoryImpl{db: db}
+}
+
+func (r LoginAttemptRepositoryImpl) Update(key string, fn func(attempt *model.LoginAttempt)) (*model.LoginAttempt, error) {
+	attempt := &model.LoginAttempt{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.LoginAttempt{Key: key}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(attempt, "key = ?", key).Error
+		if err != nil {
+			return err
+		}
+		fn(attempt)
+		return tx.Save(attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+func (r LoginAttemptRepositoryImpl) Get(key string) (*model.LoginAttempt, error) {
+	attempt := &model.LoginAttempt{}
+	if r.db.First(attempt, "key = ?", key).RowsAffected == 0 {
+		return &model.LoginAttempt{Key: key}, nil
+	}
+	return attempt, nil
+}
+
+func (r LoginAttemptRepositoryImpl) GetByUnlockCode(codeHash string) (*model.LoginAttempt, error) {
+	attempt := &model.LoginAttempt{}
+	if r.db.First(attempt, "unlock_code = ?", codeHash).RowsAffected == 0 {
+		return nil, errors.New("unlock code not found")
+	}
+	return attempt, nil
+}
+
+func (r LoginAttemptRepositoryImpl) Delete(key string) error {
+	return r.db.Delete(&model.LoginAttempt{}, "key = ?", key).Error
+}
+
+func (r LoginAttemptRepositoryImpl) DeleteIdleSince(before time.Time) error {
+	return r.db.Delete(&model.LoginAttempt{}, "last_attempt < ? AND locked_until < ?", before, before).Error
+}
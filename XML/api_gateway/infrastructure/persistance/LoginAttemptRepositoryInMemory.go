@@ -0,0 +1,76 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"sync"
+	"time"
+)
+
+// LoginAttemptRepositoryInMemory keeps attempts in the gateway process. It is
+// only correct with a single gateway instance and forgets everything on restart.
+type LoginAttemptRepositoryInMemory struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+func NewLoginAttemptRepositoryInMemory() repositories.LoginAttemptRepository {
+	return &LoginAttemptRepositoryInMemory{attempts: make(map[string]model.LoginAttempt)}
+}
+
+func (r *LoginAttemptRepositoryInMemory) Update(key string, fn func(attempt *model.LoginAttempt)) (*model.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key}
+	}
+	fn(&attempt)
+	r.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (r *LoginAttemptRepositoryInMemory) Get(key string) (*model.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key}
+	}
+	return &attempt, nil
+}
+
+func (r *LoginAttemptRepositoryInMemory) GetByUnlockCode(codeHash string) (*model.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, attempt := range r.attempts {
+		if attempt.UnlockCode != "" && attempt.UnlockCode == codeHash {
+			return &attempt, nil
+		}
+	}
+	return nil, errors.New("unlock code not found")
+}
+
+func (r *LoginAttemptRepositoryInMemory) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+func (r *LoginAttemptRepositoryInMemory) DeleteIdleSince(before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, attempt := range r.attempts {
+		if attempt.LastAttempt.Before(before) && attempt.LockedUntil.Before(before) {
+			delete(r.attempts, key)
+		}
+	}
+	return nil
+}
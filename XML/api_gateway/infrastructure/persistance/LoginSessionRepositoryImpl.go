@@ -0,0 +1,72 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type LoginSessionRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewLoginSessionRepositoryImpl(db *gorm.DB) repositories.LoginSessionRepository {
+	return &LoginSessionRepositoryImpl{db: db}
+}
+
+func (r LoginSessionRepositoryImpl) Create(session *model.LoginSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r LoginSessionRepositoryImpl) Get(id uuid.UUID) (*model.LoginSession, error) {
+	session := &model.LoginSession{}
+	if r.db.First(session, "id = ?", id).RowsAffected == 0 {
+		return nil, errors.New("session not found")
+	}
+	return session, nil
+}
+
+func (r LoginSessionRepositoryImpl) Touch(id uuid.UUID, ip string, at time.Time) error {
+	return r.db.Model(&model.LoginSession{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": at,
+		"last_seen_ip": ip,
+	}).Error
+}
+
+func (r LoginSessionRepositoryImpl) GetActive(username string, now time.Time) ([]model.LoginSession, error) {
+	var sessions []model.LoginSession
+	err := r.db.Where("username = ?", username).
+		Where("EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = login_sessions.id"+
+			" AND refresh_tokens.used = ? AND refresh_tokens.revoked = ? AND refresh_tokens.expires_at > ?)", false, false, now).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r LoginSessionRepositoryImpl) GetHistory(username string, limit int) ([]model.LoginSession, error) {
+	var sessions []model.LoginSession
+	err := r.db.Where("username = ?", username).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r LoginSessionRepositoryImpl) Known(username string, ip string, userAgent string) (bool, bool, bool, error) {
+	var known struct {
+		Logins      int64
+		IPKnown     bool
+		DeviceKnown bool
+	}
+	err := r.db.Model(&model.LoginSession{}).
+		Select("COUNT(*) AS logins, COALESCE(BOOL_OR(ip = ?), false) AS ip_known, COALESCE(BOOL_OR(user_agent = ?), false) AS device_known", ip, userAgent).
+		Where("username = ?", username).
+		Scan(&known).Error
+	if err != nil {
+		return false, false, false, err
+	}
+	return known.Logins > 0, known.IPKnown, known.DeviceKnown, nil
+}
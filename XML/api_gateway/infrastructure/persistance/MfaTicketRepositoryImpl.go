@@ -0,0 +1,52 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MfaTicketRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewMfaTicketRepositoryImpl(db *gorm.DB) repositories.MfaTicketRepository {
+	return &MfaTicketRepositoryImpl{db: db}
+}
+
+func (r MfaTicketRepositoryImpl) Create(ticket *model.MfaTicket) error {
+	return r.db.Create(ticket).Error
+}
+
+func (r MfaTicketRepositoryImpl) Get(id uuid.UUID) (*model.MfaTicket, error) {
+	ticket := &model.MfaTicket{}
+	if r.db.First(ticket, "id = ?", id).RowsAffected == 0 {
+		return nil, errors.New("mfa ticket not found")
+	}
+	return ticket, nil
+}
+
+func (r MfaTicketRepositoryImpl) MarkUsed(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&model.MfaTicket{}).
+		Where("id = ? AND used = ?", id, false).
+		Update("used", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r MfaTicketRepositoryImpl) IncrementAttempts(id uuid.UUID) (int, error) {
+	ticket := &model.MfaTicket{}
+	result := r.db.Model(ticket).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "attempts"}}}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return ticket.Attempts, nil
+}
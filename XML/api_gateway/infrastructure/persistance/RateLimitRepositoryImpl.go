@@ -0,0 +1,41 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type RateLimitRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRateLimitRepositoryImpl(db *gorm.DB) repositories.RateLimitRepository {
+	return &RateLimitRepositoryImpl{db: db}
+}
+
+func (r RateLimitRepositoryImpl) Update(key string, fn func(bucket *model.RateLimitBucket)) (*model.RateLimitBucket, error) {
+	bucket := &model.RateLimitBucket{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.RateLimitBucket{Key: key}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(bucket, "key = ?", key).Error
+		if err != nil {
+			return err
+		}
+		fn(bucket)
+		return tx.Save(bucket).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bucket, nil
+}
+
+func (r RateLimitRepositoryImpl) DeleteIdleSince(before time.Time) error {
+	return r.db.Delete(&model.RateLimitBucket{}, "refilled < ?", before).Error
+}
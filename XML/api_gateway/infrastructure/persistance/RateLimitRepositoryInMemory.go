@@ -0,0 +1,44 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"sync"
+	"time"
+)
+
+// RateLimitRepositoryInMemory keeps buckets in the gateway process. Every
+// gateway instance then limits callers on its own.
+type RateLimitRepositoryInMemory struct {
+	mu      sync.Mutex
+	buckets map[string]model.RateLimitBucket
+}
+
+func NewRateLimitRepositoryInMemory() repositories.RateLimitRepository {
+	return &RateLimitRepositoryInMemory{buckets: make(map[string]model.RateLimitBucket)}
+}
+
+func (r *RateLimitRepositoryInMemory) Update(key string, fn func(bucket *model.RateLimitBucket)) (*model.RateLimitBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = model.RateLimitBucket{Key: key}
+	}
+	fn(&bucket)
+	r.buckets[key] = bucket
+	return &bucket, nil
+}
+
+func (r *RateLimitRepositoryInMemory) DeleteIdleSince(before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, bucket := range r.buckets {
+		if bucket.Refilled.Before(before) {
+			delete(r.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepositoryImpl(db *gorm.DB) repositories.RefreshTokenRepository {
+	return &RefreshTokenRepositoryImpl{db: db}
+}
+
+func (r RefreshTokenRepositoryImpl) Create(token *model.RefreshToken) (*model.RefreshToken, error) {
+	result := r.db.Create(token)
+	return token, result.Error
+}
+
+func (r RefreshTokenRepositoryImpl) GetByHash(tokenHash string) (*model.RefreshToken, error) {
+	token := &model.RefreshToken{}
+	if r.db.First(token, "token_hash = ?", tokenHash).RowsAffected == 0 {
+		return nil, errors.New("refresh token not found")
+	}
+	return token, nil
+}
+
+// MarkUsed flips the used flag only if the token was still unused, so two
+// concurrent refreshes with the same token can't both succeed.
+func (r RefreshTokenRepositoryImpl) MarkUsed(token *model.RefreshToken) (bool, error) {
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND used = ?", token.ID, false).
+		Update("used", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r RefreshTokenRepositoryImpl) RevokeFamily(familyID uuid.UUID) error {
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("family_id = ?", familyID).
+		Update("revoked", true)
+	return result.Error
+}
+
+func (r RefreshTokenRepositoryImpl) RevokeAllForUser(username string) error {
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("username = ? AND revoked = ?", username, false).
+		Update("revoked", true)
+	return result.Error
+}
@@ -0,0 +1,70 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type ResponseCacheRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewResponseCacheRepositoryImpl(db *gorm.DB) repositories.ResponseCacheRepository {
+	return &ResponseCacheRepositoryImpl{db: db}
+}
+
+func (r ResponseCacheRepositoryImpl) Get(key string) (*model.CachedResponse, error) {
+	var responses []model.CachedResponse
+	err := r.db.Where("key = ?", key).Limit(1).Find(&responses).Error
+	if err != nil || len(responses) == 0 {
+		return nil, err
+	}
+	return &responses[0], nil
+}
+
+func (r ResponseCacheRepositoryImpl) Save(response *model.CachedResponse, tags []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(response).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&model.CachedResponseTag{}, "key = ?", response.Key).Error
+		if err != nil || len(tags) == 0 {
+			return err
+		}
+		rows := make([]model.CachedResponseTag, len(tags))
+		for i, tag := range tags {
+			rows[i] = model.CachedResponseTag{Tag: tag, Key: response.Key}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	})
+}
+
+func (r ResponseCacheRepositoryImpl) DeleteTagged(tag string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var keys []string
+		err := tx.Model(&model.CachedResponseTag{}).Where("tag = ?", tag).Pluck("key", &keys).Error
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		err = tx.Delete(&model.CachedResponse{}, "key IN ?", keys).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&model.CachedResponseTag{}, "key IN ?", keys).Error
+	})
+}
+
+func (r ResponseCacheRepositoryImpl) DeleteExpiredBefore(before time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&model.CachedResponse{}, "expires_at < ?", before).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("key NOT IN (?)", tx.Model(&model.CachedResponse{}).Select("key")).
+			Delete(&model.CachedResponseTag{}).Error
+	})
+}
@@ -0,0 +1,89 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"sync"
+	"time"
+)
+
+// ResponseCacheRepositoryInMemory keeps responses in the gateway process.
+// Every gateway instance then caches on its own, and drops what it cached
+// when it hears of a change.
+type ResponseCacheRepositoryInMemory struct {
+	mu        sync.Mutex
+	responses map[string]model.CachedResponse
+	tagged    map[string]map[string]bool
+	tags      map[string][]string
+}
+
+func NewResponseCacheRepositoryInMemory() repositories.ResponseCacheRepository {
+	return &ResponseCacheRepositoryInMemory{
+		responses: make(map[string]model.CachedResponse),
+		tagged:    make(map[string]map[string]bool),
+		tags:      make(map[string][]string),
+	}
+}
+
+func (r *ResponseCacheRepositoryInMemory) Get(key string) (*model.CachedResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	response, ok := r.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	return &response, nil
+}
+
+func (r *ResponseCacheRepositoryInMemory) Save(response *model.CachedResponse, tags []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delete(response.Key)
+	r.responses[response.Key] = *response
+	r.tags[response.Key] = tags
+	for _, tag := range tags {
+		keys, ok := r.tagged[tag]
+		if !ok {
+			keys = make(map[string]bool)
+			r.tagged[tag] = keys
+		}
+		keys[response.Key] = true
+	}
+	return nil
+}
+
+func (r *ResponseCacheRepositoryInMemory) DeleteTagged(tag string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.tagged[tag] {
+		r.delete(key)
+	}
+	return nil
+}
+
+func (r *ResponseCacheRepositoryInMemory) DeleteExpiredBefore(before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, response := range r.responses {
+		if response.ExpiresAt.Before(before) {
+			r.delete(key)
+		}
+	}
+	return nil
+}
+
+// delete expects r.mu to be held.
+func (r *ResponseCacheRepositoryInMemory) delete(key string) {
+	for _, tag := range r.tags[key] {
+		delete(r.tagged[tag], key)
+		if len(r.tagged[tag]) == 0 {
+			delete(r.tagged, tag)
+		}
+	}
+	delete(r.tags, key)
+	delete(r.responses, key)
+}
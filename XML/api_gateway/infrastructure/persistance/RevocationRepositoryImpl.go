@@ -0,0 +1,30 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type RevocationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRevocationRepositoryImpl(db *gorm.DB) repositories.RevocationRepository {
+	return &RevocationRepositoryImpl{db: db}
+}
+
+// Save ignores revocations that are already stored, since re-broadcast events
+// come back to us with the same id.
+func (r RevocationRepositoryImpl) Save(revocation *model.Revocation) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(revocation)
+	return result.Error
+}
+
+func (r RevocationRepositoryImpl) GetActive(now time.Time) ([]model.Revocation, error) {
+	var revocations []model.Revocation
+	result := r.db.Where("expires_at > ?", now).Find(&revocations)
+	return revocations, result.Error
+}
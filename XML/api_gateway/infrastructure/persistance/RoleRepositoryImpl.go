@@ -0,0 +1,101 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoleRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRoleRepositoryImpl(db *gorm.DB) repositories.RoleRepository {
+	return &RoleRepositoryImpl{db: db}
+}
+
+func (r RoleRepositoryImpl) GetAll() ([]model.RoleDefinition, error) {
+	var roles []model.RoleDefinition
+	result := r.db.Preload("Permissions").Order("name").Find(&roles)
+	return roles, result.Error
+}
+
+func (r RoleRepositoryImpl) Get(name string) (*model.RoleDefinition, error) {
+	role := &model.RoleDefinition{}
+	if r.db.Preload("Permissions").First(role, "name = ?", name).RowsAffected == 0 {
+		return nil, errors.New("role not found")
+	}
+	return role, nil
+}
+
+func (r RoleRepositoryImpl) Save(role *model.RoleDefinition, permissions []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description"}),
+		}).Omit("Permissions").Create(role).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&model.RolePermission{}, "role_name = ?", role.Name).Error
+		if err != nil {
+			return err
+		}
+		role.Permissions = nil
+		for _, permission := range permissions {
+			role.Permissions = append(role.Permissions, model.RolePermission{RoleName: role.Name, Permission: permission})
+		}
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+}
+
+func (r RoleRepositoryImpl) Delete(name string) error {
+	result := r.db.Delete(&model.RoleDefinition{}, "name = ?", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("role not found")
+	}
+	return nil
+}
+
+func (r RoleRepositoryImpl) GetUserRoles(username string) ([]string, error) {
+	var roles []string
+	result := r.db.Model(&model.UserRoleAssignment{}).
+		Where("username = ?", username).
+		Order("role_name").
+		Pluck("role_name", &roles)
+	return roles, result.Error
+}
+
+func (r RoleRepositoryImpl) GetUsersWithRoles(roles []string) ([]string, error) {
+	var usernames []string
+	result := r.db.Model(&model.UserRoleAssignment{}).
+		Distinct("username").
+		Where("role_name IN ?", roles).
+		Pluck("username", &usernames)
+	return usernames, result.Error
+}
+
+func (r RoleRepositoryImpl) SetUserRoles(username string, roles []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&model.UserRoleAssignment{}, "username = ?", username).Error
+		if err != nil {
+			return err
+		}
+		var assignments []model.UserRoleAssignment
+		for _, role := range roles {
+			assignments = append(assignments, model.UserRoleAssignment{Username: username, RoleName: role})
+		}
+		if len(assignments) == 0 {
+			return nil
+		}
+		return tx.Omit("Role").Create(&assignments).Error
+	})
+}
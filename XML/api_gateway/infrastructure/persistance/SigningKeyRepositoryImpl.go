@@ -0,0 +1,31 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"time"
+)
+
+type SigningKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepositoryImpl(db *gorm.DB) repositories.SigningKeyRepository {
+	return &SigningKeyRepositoryImpl{db: db}
+}
+
+func (r SigningKeyRepositoryImpl) Save(key *model.SigningKey) error {
+	return r.db.Create(key).Error
+}
+
+// GetCreatedAfter returns the keys newest first.
+func (r SigningKeyRepositoryImpl) GetCreatedAfter(t time.Time) ([]model.SigningKey, error) {
+	var keys []model.SigningKey
+	result := r.db.Where("created_at > ?", t).Order("created_at desc").Find(&keys)
+	return keys, result.Error
+}
+
+func (r SigningKeyRepositoryImpl) DeleteCreatedBefore(t time.Time) error {
+	return r.db.Where("created_at < ?", t).Delete(&model.SigningKey{}).Error
+}
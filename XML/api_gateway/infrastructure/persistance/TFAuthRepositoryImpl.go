@@ -18,28 +18,53 @@ func NewTFAuthRepositoryImpl(db *gorm.DB) repositories.TFAuthRepository {
 }
 
 func (t TFAuthRepositoryImpl) Check2FaForUser(username string) (bool, error) {
-	result := t.db.First(&model.QrCode{}, "username = ? AND is_valid = ?", username, true)
+	result := t.db.First(&model.QrCode{}, "username = ? AND is_valid = ? AND is_pending = ?", username, true, false)
 	if result.RowsAffected == 0 {
 		return false, nil
 	}
 	return true, nil
 }
 
+// Enable2FaForUser stores a new secret as pending, dropping any enrollment
+// the user started earlier but never confirmed.
 func (t TFAuthRepositoryImpl) Enable2FaForUser(username string, secret string) (bool, error) {
+	result := t.db.Model(&model.QrCode{}).
+		Where("username = ? AND is_valid = ? AND is_pending = ?", username, true, true).
+		Update("is_valid", false)
+	if result.Error != nil {
+		return false, result.Error
+	}
 	qr := model.QrCode{
-		ID:       uuid.New(),
-		Secret:   secret,
-		Username: username,
-		IsValid:  true,
+		ID:        uuid.New(),
+		Secret:    secret,
+		Username:  username,
+		IsValid:   true,
+		IsPending: true,
 	}
-	result := t.db.Create(&qr)
+	result = t.db.Create(&qr)
 	fmt.Print(result)
+	if result.Error != nil {
+		return false, result.Error
+	}
 	return true, nil
 }
 
+func (t TFAuthRepositoryImpl) Confirm2FaForUser(username string) error {
+	result := t.db.Model(&model.QrCode{}).
+		Where("username = ? AND is_valid = ? AND is_pending = ?", username, true, true).
+		Update("is_pending", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no pending 2fa enrollment")
+	}
+	return nil
+}
+
 func (t TFAuthRepositoryImpl) GetUserSecret(username string) (string, error) {
 	var result string = ""
-	t.db.Table("qr_codes").Select("secret").Where("username = ? AND is_valid = ?", username, true).Scan(&result)
+	t.db.Table("qr_codes").Select("secret").Where("username = ? AND is_valid = ? AND is_pending = ?", username, true, false).Scan(&result)
 	if result == "" {
 		return "", errors.New("user secret not found")
 	}
@@ -48,11 +73,61 @@ func (t TFAuthRepositoryImpl) GetUserSecret(username string) (string, error) {
 
 func (t TFAuthRepositoryImpl) GetUserQr(username string) (model.QrCode, error) {
 	var result model.QrCode
-	t.db.Table("qr_codes").Select("*").Where("username = ? AND is_valid = ?", username, true).Scan(&result)
+	t.db.Table("qr_codes").Select("*").Where("username = ? AND is_valid = ? AND is_pending = ?", username, true, false).Scan(&result)
 
 	return result, nil
 }
 
+func (t TFAuthRepositoryImpl) GetPendingQr(username string) (model.QrCode, error) {
+	var result model.QrCode
+	if t.db.First(&result, "username = ? AND is_valid = ? AND is_pending = ?", username, true, true).RowsAffected == 0 {
+		return result, errors.New("no pending 2fa enrollment")
+	}
+	return result, nil
+}
+
+// UseCounter records the time step of an accepted code, but only if it is
+// later than the last one, so the same code can't be accepted twice even by
+// concurrent requests.
+func (t TFAuthRepositoryImpl) UseCounter(qr model.QrCode, counter int) (bool, error) {
+	result := t.db.Model(&model.QrCode{}).
+		Where("id = ? AND last_used_counter < ?", qr.ID, counter).
+		Update("last_used_counter", counter)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (t TFAuthRepositoryImpl) ReplaceRecoveryCodes(username string, codes []model.RecoveryCode) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&model.RecoveryCode{}, "username = ?", username).Error
+		if err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (t TFAuthRepositoryImpl) GetUnusedRecoveryCodes(username string) ([]model.RecoveryCode, error) {
+	var codes []model.RecoveryCode
+	result := t.db.Where("username = ? AND used = ?", username, false).Find(&codes)
+	return codes, result.Error
+}
+
+func (t TFAuthRepositoryImpl) UseRecoveryCode(code model.RecoveryCode) (bool, error) {
+	result := t.db.Model(&model.RecoveryCode{}).
+		Where("id = ? AND used = ?", code.ID, false).
+		Update("used", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (t TFAuthRepositoryImpl) Disable2FaForUser(username string) (bool, error) {
 	qr, _ := t.GetUserQr(username)
 	result := t.db.Model(&qr).Update("is_valid", false)
@@ -60,5 +135,9 @@ func (t TFAuthRepositoryImpl) Disable2FaForUser(username string) (bool, error) {
 	if result.Error != nil {
 		return false, result.Error
 	}
+	err := t.ReplaceRecoveryCodes(username, nil)
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
@@ -0,0 +1,49 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type TimelineRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewTimelineRepositoryImpl(db *gorm.DB) repositories.TimelineRepository {
+	return &TimelineRepositoryImpl{db: db}
+}
+
+func (r TimelineRepositoryImpl) Add(entries []model.TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(entries, 500).Error
+}
+
+func (r TimelineRepositoryImpl) Page(owner string, after time.Time, afterPost string, limit int) ([]model.TimelineEntry, error) {
+	var entries []model.TimelineEntry
+	query := r.db.Where("owner = ?", owner)
+	if !after.IsZero() {
+		query = query.Where("date_posted < ? OR (date_posted = ? AND post_id < ?)", after, after, afterPost)
+	}
+	err := query.Order("date_posted desc, post_id desc").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+func (r TimelineRepositoryImpl) RemoveAuthor(owner string, author string) error {
+	return r.db.Delete(&model.TimelineEntry{}, "owner = ? AND author = ?", owner, author).Error
+}
+
+func (r TimelineRepositoryImpl) IsBuilt(owner string, since time.Time) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.TimelineState{}).Where("owner = ? AND built_at >= ?", owner, since.UTC()).Count(&count).Error
+	return count > 0, err
+}
+
+func (r TimelineRepositoryImpl) MarkBuilt(owner string) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&model.TimelineState{Owner: owner, BuiltAt: time.Now().UTC()}).Error
+}
@@ -0,0 +1,92 @@
+package persistance
+
+import (
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimelineRepositoryInMemory keeps timelines in the gateway process. It is
+// only correct with a single gateway instance; after a restart every
+// timeline is rebuilt on its owner's next read.
+type TimelineRepositoryInMemory struct {
+	mu        sync.Mutex
+	timelines map[string]map[string]model.TimelineEntry
+	built     map[string]time.Time
+}
+
+func NewTimelineRepositoryInMemory() repositories.TimelineRepository {
+	return &TimelineRepositoryInMemory{
+		timelines: make(map[string]map[string]model.TimelineEntry),
+		built:     make(map[string]time.Time),
+	}
+}
+
+func (r *TimelineRepositoryInMemory) Add(entries []model.TimelineEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range entries {
+		timeline, ok := r.timelines[entry.Owner]
+		if !ok {
+			timeline = make(map[string]model.TimelineEntry)
+			r.timelines[entry.Owner] = timeline
+		}
+		if _, ok := timeline[entry.PostId]; !ok {
+			timeline[entry.PostId] = entry
+		}
+	}
+	return nil
+}
+
+func (r *TimelineRepositoryInMemory) Page(owner string, after time.Time, afterPost string, limit int) ([]model.TimelineEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []model.TimelineEntry
+	for _, entry := range r.timelines[owner] {
+		if after.IsZero() || entry.DatePosted.Before(after) || (entry.DatePosted.Equal(after) && entry.PostId < afterPost) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DatePosted.Equal(entries[j].DatePosted) {
+			return entries[i].DatePosted.After(entries[j].DatePosted)
+		}
+		return entries[i].PostId > entries[j].PostId
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (r *TimelineRepositoryInMemory) RemoveAuthor(owner string, author string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, entry := range r.timelines[owner] {
+		if entry.Author == author {
+			delete(r.timelines[owner], id)
+		}
+	}
+	return nil
+}
+
+func (r *TimelineRepositoryInMemory) IsBuilt(owner string, since time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	builtAt, ok := r.built[owner]
+	return ok && !builtAt.Before(since), nil
+}
+
+func (r *TimelineRepositoryInMemory) MarkBuilt(owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.built[owner] = time.Now()
+	return nil
+}
@@ -63,3 +63,14 @@ func (r UserRepositoryImpl) GetUserRole(username string) (string, error) {
 	}
 	return "", errors.New("User role not found for username" + username)
 }
+
+func (r UserRepositoryImpl) GetUsernamesWithRole(role string) ([]string, error) {
+	var usernames []string
+	for _, candidate := range []model.Role{model.Regular, model.Admin, model.Agent} {
+		if candidate.String() == role {
+			result := r.db.Model(&model.User{}).Where("role = ?", candidate).Pluck("username", &usernames)
+			return usernames, result.Error
+		}
+	}
+	return usernames, nil
+}
@@ -0,0 +1,87 @@
+package persistance
+
+import (
+	"errors"
+	"gateway/module/domain/model"
+	"gateway/module/domain/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type WebAuthnRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnRepositoryImpl(db *gorm.DB) repositories.WebAuthnRepository {
+	return &WebAuthnRepositoryImpl{db: db}
+}
+
+func (r WebAuthnRepositoryImpl) CreateCredential(credential *model.WebAuthnCredential) error {
+	return r.db.Create(credential).Error
+}
+
+func (r WebAuthnRepositoryImpl) GetCredentials(username string) ([]model.WebAuthnCredential, error) {
+	var credentials []model.WebAuthnCredential
+	result := r.db.Where("username = ?", username).Order("created_at").Find(&credentials)
+	return credentials, result.Error
+}
+
+func (r WebAuthnRepositoryImpl) GetCredentialByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error) {
+	credential := &model.WebAuthnCredential{}
+	if r.db.First(credential, "credential_id = ?", credentialID).RowsAffected == 0 {
+		return nil, errors.New("credential not found")
+	}
+	return credential, nil
+}
+
+func (r WebAuthnRepositoryImpl) UpdateCredentialUse(id uuid.UUID, signCount uint32, usedAt time.Time) error {
+	return r.db.Model(&model.WebAuthnCredential{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": usedAt}).Error
+}
+
+func (r WebAuthnRepositoryImpl) RenameCredential(id uuid.UUID, username string, name string) error {
+	result := r.db.Model(&model.WebAuthnCredential{}).
+		Where("id = ? AND username = ?", id, username).
+		Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("credential not found")
+	}
+	return nil
+}
+
+func (r WebAuthnRepositoryImpl) DeleteCredential(id uuid.UUID, username string) error {
+	result := r.db.Delete(&model.WebAuthnCredential{}, "id = ? AND username = ?", id, username)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("credential not found")
+	}
+	return nil
+}
+
+func (r WebAuthnRepositoryImpl) CreateSession(session *model.WebAuthnSession) error {
+	err := r.db.Delete(&model.WebAuthnSession{}, "expires_at < ?", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	return r.db.Create(session).Error
+}
+
+func (r WebAuthnRepositoryImpl) TakeSession(id uuid.UUID) (*model.WebAuthnSession, error) {
+	var sessions []model.WebAuthnSession
+	result := r.db.Clauses(clause.Returning{}).Where("id = ?", id).Delete(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("webauthn session not found")
+	}
+	return &sessions[0], nil
+}
@@ -0,0 +1,271 @@
+package openapi
+
+import (
+	"common/module/policy"
+	_ "embed"
+	"fmt"
+	myerr "gateway/module/application/errors"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page is the interactive documentation, which renders /openapi.json.
+//
+//go:embed docs.html
+var Page []byte
+
+// Route documents a route the gateway handles itself. Request and Response
+// are values of the types the handler decodes and writes; a nil Request
+// means no body, a nil Response an empty one.
+type Route struct {
+	Summary     string
+	Description string
+	Tag         string
+	Query       []string
+	Request     interface{}
+	Response    interface{}
+	// Status defaults to 200, or 204 without a Response.
+	Status int
+	// ContentType defaults to application/json.
+	ContentType string
+}
+
+// Build describes every route of the gateway: those generated from the
+// google.api.http options of the services registered in this binary, and
+// routes, keyed like the policy ("METHOD /path/{param}"). Who may call an
+// operation comes from the policy. It fails when a route of the policy is
+// neither generated nor in routes, or routes documents one that isn't in the
+// policy, so documentation can't fall behind.
+func Build(p *policy.Policy, routes map[string]Route) (*Document, error) {
+	doc := &Document{
+		OpenApi: "3.0.3",
+		Info: Info{
+			Title:   "Dislinkt API",
+			Version: "1.0",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer":      {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"accessToken": {Type: "apiKey", In: "query", Name: "access_token"},
+			},
+		},
+	}
+	types := schemas(doc.Components.Schemas)
+
+	generated := map[string]bool{}
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				for key, operation := range rpcOperations(methods.Get(j), types) {
+					generated[key] = true
+					doc.add(p, key, operation)
+				}
+			}
+		}
+		return true
+	})
+
+	var problems []string
+	for key, route := range routes {
+		if _, ok := p.Routes[key]; !ok {
+			problems = append(problems, key+": documented, but not in the policy")
+			continue
+		}
+		doc.add(p, key, route.operation(key, types))
+	}
+	for key := range p.Routes {
+		if _, ok := routes[key]; !ok && !generated[key] {
+			problems = append(problems, key+": no documentation")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+
+	// Whatever fails, the gateway answers with a problem.
+	problem := Response{
+		Description: "Error",
+		Content: map[string]MediaType{
+			myerr.ProblemContentType: {Schema: types.value(reflect.TypeOf(myerr.Problem{}))},
+		},
+	}
+	for _, item := range doc.Paths {
+		for _, operation := range item {
+			operation.Responses["default"] = problem
+		}
+	}
+	return doc, nil
+}
+
+func (d *Document) add(p *policy.Policy, key string, operation *Operation) {
+	method, path, _ := strings.Cut(key, " ")
+	operation.Security = security(p, method, path)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = operation
+}
+
+func security(p *policy.Policy, method string, path string) *[]SecurityRequirement {
+	rule, _, ok := p.Route(method, path)
+	if ok && rule.Public {
+		return &[]SecurityRequirement{}
+	}
+	requirements := []SecurityRequirement{{"bearer": {}}}
+	if rule.QueryToken {
+		requirements = append(requirements, SecurityRequirement{"accessToken": {}})
+	}
+	return &requirements
+}
+
+// pathParam matches the parameters of path templates, with the pattern some
+// of them restrict their value to.
+var pathParam = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+func rpcOperations(method protoreflect.MethodDescriptor, types schemas) map[string]*Operation {
+	options := method.Options()
+	if !proto.HasExtension(options, annotations.E_Http) {
+		return nil
+	}
+	binding := proto.GetExtension(options, annotations.E_Http).(*annotations.HttpRule)
+	service := method.Parent().(protoreflect.ServiceDescriptor)
+	operations := map[string]*Operation{}
+	for i, b := range append([]*annotations.HttpRule{binding}, binding.GetAdditionalBindings()...) {
+		verb, template := httpPattern(b)
+		if template == "" {
+			continue
+		}
+		operation := &Operation{
+			OperationId: string(service.Name()) + "_" + string(method.Name()),
+			Tags:        []string{string(service.Name())},
+			Responses: map[string]Response{
+				"200": {Description: "OK", Content: jsonContent(types.message(method.Output()))},
+			},
+		}
+		if i > 0 {
+			operation.OperationId += strconv.Itoa(i + 1)
+		}
+
+		input := method.Input()
+		used := map[string]bool{}
+		for _, match := range pathParam.FindAllStringSubmatch(template, -1) {
+			name := match[1]
+			used[strings.Split(name, ".")[0]] = true
+			schema := &Schema{Type: "string"}
+			if field := fieldByPath(input, name); field != nil {
+				schema = types.singular(field)
+			}
+			operation.Parameters = append(operation.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		}
+
+		switch body := b.GetBody(); body {
+		case "":
+		case "*":
+			operation.RequestBody = &RequestBody{Required: true, Content: jsonContent(types.message(input))}
+		default:
+			used[body] = true
+			if field := input.Fields().ByName(protoreflect.Name(body)); field != nil {
+				operation.RequestBody = &RequestBody{Required: true, Content: jsonContent(types.field(field))}
+			}
+		}
+		if b.GetBody() != "*" {
+			fields := input.Fields()
+			for j := 0; j < fields.Len(); j++ {
+				field := fields.Get(j)
+				if used[string(field.Name())] || field.IsMap() || field.Kind() == protoreflect.MessageKind {
+					continue
+				}
+				operation.Parameters = append(operation.Parameters, Parameter{Name: field.JSONName(), In: "query", Schema: types.field(field)})
+			}
+		}
+		operations[verb+" "+pathParam.ReplaceAllString(template, "{$1}")] = operation
+	}
+	return operations
+}
+
+func fieldByPath(message protoreflect.MessageDescriptor, path string) protoreflect.FieldDescriptor {
+	var field protoreflect.FieldDescriptor
+	for _, name := range strings.Split(path, ".") {
+		if message == nil {
+			return nil
+		}
+		field = message.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			return nil
+		}
+		message = field.Message()
+	}
+	return field
+}
+
+func httpPattern(rule *annotations.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", pattern.Get
+	case *annotations.HttpRule_Post:
+		return "POST", pattern.Post
+	case *annotations.HttpRule_Put:
+		return "PUT", pattern.Put
+	case *annotations.HttpRule_Delete:
+		return "DELETE", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return "PATCH", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	}
+	return "", ""
+}
+
+func (r Route) operation(key string, types schemas) *Operation {
+	_, path, _ := strings.Cut(key, " ")
+	operation := &Operation{
+		Summary:     r.Summary,
+		Description: r.Description,
+		Responses:   map[string]Response{},
+	}
+	if r.Tag != "" {
+		operation.Tags = []string{r.Tag}
+	}
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		operation.Parameters = append(operation.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, name := range r.Query {
+		operation.Parameters = append(operation.Parameters, Parameter{Name: name, In: "query", Schema: &Schema{Type: "string"}})
+	}
+	if r.Request != nil {
+		operation.RequestBody = &RequestBody{Required: true, Content: jsonContent(types.value(reflect.TypeOf(r.Request)))}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+		if r.Response == nil {
+			status = http.StatusNoContent
+		}
+	}
+	response := Response{Description: http.StatusText(status)}
+	if r.Response != nil {
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		response.Content = map[string]MediaType{contentType: {Schema: types.value(reflect.TypeOf(r.Response))}}
+	}
+	operation.Responses[strconv.Itoa(status)] = response
+	return operation
+}
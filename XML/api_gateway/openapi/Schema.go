@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemas collects the component schemas operations refer to, from proto
+// messages (named by their full name, "post_service.Post") and from the Go
+// types of the gateway's own handlers ("dto.LoginRequest").
+type schemas map[string]*Schema
+
+func (s schemas) message(message protoreflect.MessageDescriptor) *Schema {
+	switch message.FullName() {
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "google.protobuf.Duration":
+		return &Schema{Type: "string"}
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.Any":
+		return &Schema{}
+	}
+	name := string(message.FullName())
+	if _, ok := s[name]; ok {
+		return ref(name)
+	}
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s[name] = schema
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		schema.Properties[field.JSONName()] = s.field(field)
+	}
+	return ref(name)
+}
+
+func (s schemas) field(field protoreflect.FieldDescriptor) *Schema {
+	if field.IsMap() {
+		return &Schema{Type: "object", AdditionalProperties: s.singular(field.MapValue())}
+	}
+	if field.IsList() {
+		return &Schema{Type: "array", Items: s.singular(field)}
+	}
+	return s.singular(field)
+}
+
+// singular is the schema of one value of field, as protojson writes it.
+func (s schemas) singular(field protoreflect.FieldDescriptor) *Schema {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return &Schema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &Schema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &Schema{Type: "integer", Format: "int64"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &Schema{Type: "string", Format: "int64"}
+	case protoreflect.FloatKind:
+		return &Schema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &Schema{Type: "number", Format: "double"}
+	case protoreflect.BytesKind:
+		return &Schema{Type: "string", Format: "byte"}
+	case protoreflect.EnumKind:
+		values := field.Enum().Values()
+		schema := &Schema{Type: "string"}
+		for i := 0; i < values.Len(); i++ {
+			schema.Enum = append(schema.Enum, string(values.Get(i).Name()))
+		}
+		return schema
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return s.message(field.Message())
+	}
+	return &Schema{Type: "string"}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	rawJsonType = reflect.TypeOf(json.RawMessage{})
+)
+
+// value is the schema of what encoding/json makes of t.
+func (s schemas) value(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawJsonType:
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.value(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.value(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.value(t.Elem())}
+	case reflect.Struct:
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := s[name]; ok {
+			return ref(name)
+		}
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		s[name] = schema
+		s.properties(t, schema)
+		return ref(name)
+	}
+	return &Schema{}
+}
+
+func (s schemas) properties(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.properties(field.Type, schema)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.value(field.Type)
+	}
+}
@@ -1,24 +1,42 @@
 package startup
 
 import (
+	"common/module/changes"
 	"common/module/logger"
+	"common/module/mailer"
+	"common/module/onetimecode"
+	"common/module/permissions"
+	"common/module/policy"
+	"common/module/ranking"
+	"common/module/realtime"
+	"common/module/revocation"
+	saga "common/module/saga/messaging"
+	"common/module/saga/messaging/nats"
+	servicetls "common/module/tls"
 	messageGw "common/module/proto/message_service"
 	notificationGw "common/module/proto/notification_service"
 	connGw "common/module/proto/connection_service"
 	postsGw "common/module/proto/posts_service"
 	userGw "common/module/proto/user_service"
 	"context"
+	"crypto/rand"
 	"fmt"
+	myerr "gateway/module/application/errors"
 	"gateway/module/application/helpers"
 	"gateway/module/application/services"
+	"gateway/module/auth"
 	"gateway/module/domain/model"
 	"gateway/module/domain/repositories"
+	clients "gateway/module/infrastructure/api"
 	"gateway/module/infrastructure/handlers"
 	"gateway/module/infrastructure/persistance"
+	"gateway/module/openapi"
 	cfg "gateway/module/startup/config"
 	gorilla_handlers "github.com/gorilla/handlers"
+	"github.com/go-webauthn/webauthn/webauthn"
 	runtime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"gopkg.in/go-playground/validator.v9"
 	"gorm.io/driver/postgres"
@@ -26,63 +44,77 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	RevocationQueueGroup = "api_gateway_revocation"
+	RoleQueueGroup       = "api_gateway_roles"
+	TimelineQueueGroup   = "api_gateway_timeline"
 )
 
 type Server struct {
-	config *cfg.Config
-	mux    *runtime.ServeMux // Part of grpcGateway library
+	config     *cfg.Config
+	mux        *runtime.ServeMux // Part of grpcGateway library
+	authorizer *auth.Authorizer
+	// identity is the certificate the gateway presents to the services, nil
+	// when gRPC runs without TLS.
+	identity      *servicetls.Identity
+	resilience    *clients.Resilience
+	rateLimiter   *handlers.RateLimiter
+	responseCache *handlers.ResponseCache
+	apiVersions   *handlers.ApiVersions
 }
 
 func NewServer(config *cfg.Config) *Server {
+	logInfo := logger.InitializeLogger("api-gateway", context.Background(), "Info")
+	logError := logger.InitializeLogger("api-gateway", context.Background(), "Error")
 	server := &Server{
 		config: config,
-		mux:    runtime.NewServeMux(),
+		mux:    runtime.NewServeMux(runtime.WithErrorHandler(myerr.ErrorHandler(logError))),
 	}
+	server.identity = server.InitTlsIdentity(logError)
+	server.resilience = server.InitResilience(logInfo, logError)
 	server.initHandlers()
-	server.initCustomHandlers()
+	server.initCustomHandlers(logInfo, logError)
 	return server
 }
 
 func (server *Server) initHandlers() {
 	//Povezuje sa grpc generisanim fajlovima
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(20*1024*1024),
-			grpc.MaxCallSendMsgSize(20*1024*1024)),
-	}
 	userEndpoint := fmt.Sprintf("%s:%s", server.config.UserHost, server.config.UserPort)
 	postsEndpoint := fmt.Sprintf("%s:%s", server.config.PostsHost, server.config.PostsPort)
 	messageEndpoint := fmt.Sprintf("%s:%s", server.config.MessageHost, server.config.MessagePort)
 	connectionsEndpoint := fmt.Sprintf("%s:%s", server.config.ConnectionsHost, server.config.ConnectionsPort)
 
-	err := userGw.RegisterUserServiceHandlerFromEndpoint(context.TODO(), server.mux, userEndpoint, opts)
+	err := userGw.RegisterUserServiceHandlerFromEndpoint(context.TODO(), server.mux, userEndpoint, server.dialOptions(server.config.UserHost))
 	if err != nil {
 		panic(err)
 	}
-	err = postsGw.RegisterPostServiceHandlerFromEndpoint(context.TODO(), server.mux, postsEndpoint, opts)
+	err = postsGw.RegisterPostServiceHandlerFromEndpoint(context.TODO(), server.mux, postsEndpoint, server.dialOptions(server.config.PostsHost))
 	if err != nil {
 		panic(err)
 	}
-	err = messageGw.RegisterMessageServiceHandlerFromEndpoint(context.TODO(), server.mux, messageEndpoint, opts)
+	err = messageGw.RegisterMessageServiceHandlerFromEndpoint(context.TODO(), server.mux, messageEndpoint, server.dialOptions(server.config.MessageHost))
 	if err != nil {
 		panic(err)
 	}
-	err = notificationGw.RegisterNotificationServiceHandlerFromEndpoint(context.TODO(), server.mux, messageEndpoint, opts)
+	err = notificationGw.RegisterNotificationServiceHandlerFromEndpoint(context.TODO(), server.mux, messageEndpoint, server.dialOptions(server.config.MessageHost))
 	if err != nil {
 		panic(err)
 	}
 	
-	err = connGw.RegisterConnectionServiceHandlerFromEndpoint(context.TODO(), server.mux, connectionsEndpoint, opts)
+	err = connGw.RegisterConnectionServiceHandlerFromEndpoint(context.TODO(), server.mux, connectionsEndpoint, server.dialOptions(server.config.ConnectionsHost))
 	if err != nil {
 		panic(err)
 	}
 }
 
 //Gateway ima svoje endpointe
-func (server *Server) initCustomHandlers() {
+func (server *Server) initCustomHandlers(logInfo *logger.Logger, logError *logger.Logger) {
+	server.InitTrustedProxies()
 
-	logInfo := logger.InitializeLogger("api-gateway", context.Background(), "Info")
-	logError := logger.InitializeLogger("api-gateway", context.Background(), "Error")
 	db = server.SetupDatabase()
 	userRepo := server.InitUserRepo(db)
 	tfauthRepo := server.InitTFAuthRepo(db)
@@ -90,17 +122,66 @@ func (server *Server) initCustomHandlers() {
 	l := log.New(os.Stdout, "gateway ", log.LstdFlags) // Logger koji dajemo handlerima
 	userService := server.InitUserService(l, logInfo, logError, userRepo)
 	tfauthService := server.InitTFAuthService(l, tfauthRepo)
-	lVerificationRepo := server.InitLoginVerificationRepo(db)
-	passwordlessService := server.InitPasswordlessService(logInfo, logError, lVerificationRepo)
+	mail := server.InitMailer(db, logError)
+	passwordlessService := server.InitPasswordlessService(logInfo, logError, server.InitOneTimeCodes(db, logError), mail)
+	refreshTokenRepo := server.InitRefreshTokenRepo(db)
+	refreshTokenService := server.InitRefreshTokenService(logInfo, logError, refreshTokenRepo)
+	keyManager := server.InitKeyManager(server.InitSigningKeyRepo(db), logError)
+	revocationRepo := server.InitRevocationRepo(db)
+	revocationPublisher := server.InitPublisher(server.config.RevocationSubject)
+	revocationService := server.InitRevocationService(logInfo, logError, revocationRepo, refreshTokenRepo, revocationPublisher)
+	revocationSubscriber := server.InitSubscriber(server.config.RevocationSubject, RevocationQueueGroup)
+	server.InitRevocationEventHandler(logError, revocationService, revocationSubscriber)
+	revocationList := server.InitRevocationList()
+	err := revocationService.Rebroadcast()
+	if err != nil {
+		logError.Logger.Errorf("ERR:REBROADCASTING REVOCATIONS: %v", err)
+	}
+
+	loginAttemptService := server.InitLoginAttemptService(logInfo, logError, server.InitLoginAttemptRepo(db), userRepo, mail)
+	mfaTicketService := server.InitMfaTicketService(logInfo, logError, server.InitMfaTicketRepo(db))
+	webAuthnService := server.InitWebAuthnService(logInfo, logError, server.InitWebAuthnRepo(db), userRepo)
+	sessionService := server.InitSessionService(logInfo, logError, server.InitLoginSessionRepo(db), revocationService)
+	authPolicy := server.InitPolicy()
+	roleService := server.InitRoleService(logInfo, logError, server.InitRoleRepo(db), userRepo, revocationService, authPolicy)
+	permissionCache := server.InitPermissionCache(authPolicy)
 
 	validator := validator.New()
 
 	passwordUtil := &helpers.PasswordUtil{}
 
-	authHandler := handlers.NewAuthenticationHandler(l, logInfo, logError, userService, tfauthService, validator, passwordUtil, passwordlessService)
+	authHandler := handlers.NewAuthenticationHandler(l, logInfo, logError, userService, tfauthService, validator, passwordUtil, passwordlessService, refreshTokenService, revocationService, keyManager, loginAttemptService, mfaTicketService, webAuthnService, sessionService, roleService)
 	authHandler.Init(server.mux)
-	userFeedHandler := handlers.NewUserFeedHandler(logInfo, logError, server.config)
+	jwksHandler := handlers.NewJwksHandler(keyManager)
+	jwksHandler.Init(server.mux)
+	sessionHandler := handlers.NewSessionHandler(logError, sessionService)
+	sessionHandler.Init(server.mux)
+	roleHandler := handlers.NewRoleHandler(logError, roleService)
+	roleHandler.Init(server.mux)
+	// Every feed request and the timeline worker share these connections.
+	postClient := clients.NewPostClient(fmt.Sprintf("%s:%s", server.config.PostsHost, server.config.PostsPort), server.dialOptions(server.config.PostsHost)...)
+	connectionClient := clients.NewConnectionClient(fmt.Sprintf("%s:%s", server.config.ConnectionsHost, server.config.ConnectionsPort), server.dialOptions(server.config.ConnectionsHost)...)
+	timelineRepo := server.InitTimelineRepo(db)
+	server.InitTimelineService(logInfo, logError, timelineRepo, postClient, connectionClient, keyManager)
+	feedService := server.InitFeedService(logInfo, logError, timelineRepo, postClient, connectionClient)
+	userFeedHandler := handlers.NewUserFeedHandler(logInfo, logError, feedService, server.InitFeedTimeout())
 	userFeedHandler.Init(server.mux)
+	realtimeHandler := handlers.NewRealtimeHandler(logInfo, server.InitRealtimeService(logInfo))
+	realtimeHandler.Init(server.mux)
+	statusHandler := handlers.NewStatusHandler(server.resilience)
+	statusHandler.Init(server.mux)
+	server.apiVersions = server.InitApiVersions(logInfo)
+	openApiHandler := handlers.NewOpenApiHandler(server.InitOpenApi(authPolicy), server.config.SwaggerUiDir)
+	openApiHandler.Init(server.mux)
+
+	server.authorizer = server.InitAuthorizer(authPolicy, keyManager, revocationList, permissionCache, logError)
+	// The GraphQL fields are authorized like the routes, so they need the authorizer.
+	graphqlHandler := handlers.NewGraphqlHandler(logError, server.InitGraphqlService(logError, postClient, connectionClient))
+	graphqlHandler.Init(server.mux)
+	rateLimitService := server.InitRateLimitService(logInfo, logError, server.InitRateLimitRepo(db))
+	server.rateLimiter = handlers.NewRateLimiter(logError, rateLimitService, authPolicy)
+	responseCacheService := server.InitResponseCacheService(logInfo, logError, server.InitResponseCacheRepo(db))
+	server.responseCache = handlers.NewResponseCache(logError, responseCacheService, server.InitCachedRoutes())
 }
 
 func (server *Server) Start() {
@@ -109,13 +190,24 @@ func (server *Server) Start() {
 		gorilla_handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
 		gorilla_handlers.AllowedHeaders([]string{"Accept", "Accept-Language", "Content-Type", "Content-Language", "Origin", "Authorization", "Access-Control-Allow-*", "Access-Control-Allow-Origin", "*"}),
 		gorilla_handlers.AllowCredentials(),
+		gorilla_handlers.ExposedHeaders([]string{"Deprecation", "Sunset", "Link", "ETag", "Age", "X-Cache"}),
 	)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", server.config.Port), cors(muxMiddleware(server))))
 }
 func muxMiddleware(server *Server) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		server.mux.ServeHTTP(w, r)
-	})
+	return server.apiVersions.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.rateLimiter.AllowAddress(w, r) {
+			return
+		}
+		r, ok := server.authorizer.Authorize(w, r)
+		if !ok {
+			return
+		}
+		if !server.rateLimiter.Allow(w, r) {
+			return
+		}
+		server.responseCache.Serve(w, r, server.mux)
+	}))
 }
 
 func (server *Server) InitUserService(l *log.Logger, logInfo *logger.Logger, logError *logger.Logger, repo repositories.UserRepository) *services.UserService {
@@ -154,16 +246,550 @@ func (server *Server) SetupDatabase() *gorm.DB {
 
 	db.AutoMigrate(&model.User{}) //This will not remove columns
 	db.AutoMigrate(&model.QrCode{})
-	db.AutoMigrate(&model.LoginVerification{}) //This will not remove columns
+	db.AutoMigrate(&model.RecoveryCode{})
+	db.AutoMigrate(&onetimecode.Code{})
+	db.AutoMigrate(&mailer.OutboxMessage{})
+	db.AutoMigrate(&model.RefreshToken{})
+	db.AutoMigrate(&model.Revocation{})
+	db.AutoMigrate(&model.SigningKey{})
+	db.AutoMigrate(&model.LoginAttempt{})
+	db.AutoMigrate(&model.RateLimitBucket{})
+	db.AutoMigrate(&model.MfaTicket{})
+	db.AutoMigrate(&model.WebAuthnCredential{})
+	db.AutoMigrate(&model.WebAuthnSession{})
+	db.AutoMigrate(&model.LoginSession{})
+	db.AutoMigrate(&model.RoleDefinition{})
+	db.AutoMigrate(&model.RolePermission{})
+	db.AutoMigrate(&model.UserRoleAssignment{})
+	db.AutoMigrate(&model.TimelineEntry{})
+	db.AutoMigrate(&model.TimelineState{})
+	db.AutoMigrate(&model.CachedResponse{})
+	db.AutoMigrate(&model.CachedResponseTag{})
 	//db.Create(users) // Use this only once to populate db with data
 
 	return db
 }
 
-func (server *Server) InitPasswordlessService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.LoginVerificationRepository) *services.PasswordLessService {
-	return services.NewPasswordLessService(logInfo, logError, repo)
+func (server *Server) InitPasswordlessService(logInfo *logger.Logger, logError *logger.Logger, codes *onetimecode.Manager, mail mailer.Mailer) *services.PasswordLessService {
+	return services.NewPasswordLessService(logInfo, logError, codes, mail)
+}
+
+func (server *Server) InitOneTimeCodes(db *gorm.DB, logError *logger.Logger) *onetimecode.Manager {
+	// A secret made up at startup would void every code mailed before a
+	// restart.
+	secret := []byte(server.config.OneTimeCodeSecret)
+	if len(secret) < onetimecode.MinSecretLength {
+		log.Fatalf("ONE_TIME_CODE_SECRET must be set to at least %d bytes", onetimecode.MinSecretLength)
+	}
+	return onetimecode.NewManager(onetimecode.NewGormStore(db), secret)
+}
+
+func (server *Server) InitMailer(db *gorm.DB, logError *logger.Logger) mailer.Mailer {
+	backend, err := mailer.New(mailer.Config{
+		Backend:      server.config.MailBackend,
+		From:         server.config.MailFrom,
+		SmtpHost:     server.config.SmtpHost,
+		SmtpPort:     server.config.SmtpPort,
+		SmtpUser:     server.config.SmtpUser,
+		SmtpPass:     server.config.SmtpPass,
+		CourierToken: server.config.CourierAuthToken,
+		File:         server.config.MailFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	outbox, err := mailer.NewOutbox(backend, mailer.NewGormOutboxStore(db), []byte(server.config.OneTimeCodeSecret), logError)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outbox.Start()
+	return outbox
+}
+
+func (server *Server) InitRefreshTokenRepo(db *gorm.DB) repositories.RefreshTokenRepository {
+	return persistance.NewRefreshTokenRepositoryImpl(db)
+}
+
+func (server *Server) InitRefreshTokenService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RefreshTokenRepository) *services.RefreshTokenService {
+	return services.NewRefreshTokenService(logInfo, logError, repo)
+}
+
+func (server *Server) InitRevocationRepo(db *gorm.DB) repositories.RevocationRepository {
+	return persistance.NewRevocationRepositoryImpl(db)
+}
+
+func (server *Server) InitRevocationService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RevocationRepository,
+	refreshTokenRepo repositories.RefreshTokenRepository, publisher saga.Publisher) *services.RevocationService {
+	return services.NewRevocationService(logInfo, logError, repo, refreshTokenRepo, revocation.NewRevoker(publisher))
+}
+
+func (server *Server) InitRevocationEventHandler(logError *logger.Logger, service *services.RevocationService, subscriber saga.Subscriber) *handlers.RevocationEventHandler {
+	handler, err := handlers.NewRevocationEventHandler(logError, service, subscriber)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	return handler
+}
+
+func (server *Server) InitPublisher(subject string) saga.Publisher {
+	publisher, err := nats.NewNATSPublisher(
+		server.config.NatsHost, server.config.NatsPort,
+		server.config.NatsUser, server.config.NatsPass, subject)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return publisher
+}
+
+func (server *Server) InitSubscriber(subject string, queueGroup string) saga.Subscriber {
+	subscriber, err := nats.NewNATSSubscriber(
+		server.config.NatsHost, server.config.NatsPort,
+		server.config.NatsUser, server.config.NatsPass, subject, queueGroup)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return subscriber
+}
+
+func (server *Server) InitSigningKeyRepo(db *gorm.DB) repositories.SigningKeyRepository {
+	return persistance.NewSigningKeyRepositoryImpl(db)
+}
+
+func (server *Server) InitKeyManager(repo repositories.SigningKeyRepository, logError *logger.Logger) *auth.KeyManager {
+	rotation, err := time.ParseDuration(server.config.KeyRotation)
+	if err != nil {
+		log.Fatalf("invalid key rotation interval: %v", err)
+	}
+	keyManager, err := auth.NewKeyManager(repo, server.config.SigningAlgorithm, rotation, logError)
+	if err != nil {
+		log.Fatalf("failed to initialize signing keys: %v", err)
+	}
+	keyManager.Start()
+	return keyManager
+}
+
+func (server *Server) InitLoginAttemptRepo(db *gorm.DB) repositories.LoginAttemptRepository {
+	switch server.config.LoginAttemptStore {
+	case "memory":
+		return persistance.NewLoginAttemptRepositoryInMemory()
+	case "postgres":
+		return persistance.NewLoginAttemptRepositoryImpl(db)
+	default:
+		log.Fatalf("unknown login attempt store: %s", server.config.LoginAttemptStore)
+		return nil
+	}
+}
+
+func (server *Server) InitRateLimitRepo(db *gorm.DB) repositories.RateLimitRepository {
+	switch server.config.RateLimitStore {
+	case "memory":
+		return persistance.NewRateLimitRepositoryInMemory()
+	case "postgres":
+		return persistance.NewRateLimitRepositoryImpl(db)
+	default:
+		log.Fatalf("unknown rate limit store: %s", server.config.RateLimitStore)
+		return nil
+	}
+}
+
+// InitTrustedProxies sets the proxies whose forwarding headers tell the
+// client's address. With none, clients are told apart by their connection.
+func (server *Server) InitTrustedProxies() {
+	err := handlers.TrustProxies(server.config.TrustedProxies)
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+}
+
+func (server *Server) InitRateLimitService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RateLimitRepository) *services.RateLimitService {
+	limits := map[string]services.RateLimit{}
+	for class, limit := range map[string]string{
+		services.RateLimitAnonymous:     server.config.AnonymousLimit,
+		services.RateLimitAuthenticated: server.config.UserLimit,
+		services.RateLimitApiToken:      server.config.ApiTokenLimit,
+		services.RateLimitAddress:       server.config.AddressLimit,
+	} {
+		parsed, err := services.ParseRateLimit(limit)
+		if err != nil {
+			log.Fatalf("invalid %s rate limit: %v", class, err)
+		}
+		limits[class] = parsed
+	}
+	service := services.NewRateLimitService(logInfo, logError, repo, limits)
+	service.Start()
+	return service
+}
+
+func (server *Server) InitLoginAttemptService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.LoginAttemptRepository,
+	userRepo repositories.UserRepository, mail mailer.Mailer) *services.LoginAttemptService {
+	service := services.NewLoginAttemptService(logInfo, logError, repo, userRepo, mail)
+	service.Start()
+	return service
+}
+
+func (server *Server) InitMfaTicketRepo(db *gorm.DB) repositories.MfaTicketRepository {
+	return persistance.NewMfaTicketRepositoryImpl(db)
+}
+
+func (server *Server) InitMfaTicketService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.MfaTicketRepository) *services.MfaTicketService {
+	secret := []byte(server.config.MfaTicketSecret)
+	if len(secret) == 0 {
+		// Fine for a single gateway; replicas have to share MFA_TICKET_SECRET.
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logError.Logger.Errorf("ERR:MFA_TICKET_SECRET NOT SET, USING A RANDOM ONE")
+	}
+	return services.NewMfaTicketService(logInfo, logError, repo, secret)
+}
+
+func (server *Server) InitWebAuthnRepo(db *gorm.DB) repositories.WebAuthnRepository {
+	return persistance.NewWebAuthnRepositoryImpl(db)
+}
+
+func (server *Server) InitWebAuthnService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.WebAuthnRepository,
+	userRepo repositories.UserRepository) *services.WebAuthnService {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPDisplayName: "Dislinkt",
+		RPID:          server.config.WebAuthnRPID,
+		RPOrigin:      server.config.WebAuthnRPOrigin,
+	})
+	if err != nil {
+		log.Fatalf("failed to configure webauthn: %v", err)
+	}
+	return services.NewWebAuthnService(logInfo, logError, webAuthn, repo, userRepo)
+}
+
+func (server *Server) InitLoginSessionRepo(db *gorm.DB) repositories.LoginSessionRepository {
+	return persistance.NewLoginSessionRepositoryImpl(db)
+}
+
+func (server *Server) InitSessionService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.LoginSessionRepository,
+	revocationService *services.RevocationService) *services.SessionService {
+	notifications := clients.NewNotificationClient(fmt.Sprintf("%s:%s", server.config.MessageHost, server.config.MessagePort), server.dialOptions(server.config.MessageHost)...)
+	return services.NewSessionService(logInfo, logError, repo, revocationService, notifications)
+}
+
+func (server *Server) InitRevocationList() *revocation.List {
+	list := revocation.NewList()
+	err := list.Listen(server.InitSubscriber(server.config.RevocationSubject, revocation.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return list
+}
+
+func (server *Server) InitPolicy() *policy.Policy {
+	authPolicy, err := policy.Load()
+	if err != nil {
+		log.Fatalf("failed to load policy: %v", err)
+	}
+	return authPolicy
+}
+
+// InitAuthorizer has to run after every handler is registered: it refuses to
+// start while a route generated from a gRPC method has no rule.
+func (server *Server) InitAuthorizer(authPolicy *policy.Policy, keyManager *auth.KeyManager, revocationList *revocation.List,
+	permissionCache *permissions.Cache, logError *logger.Logger) *auth.Authorizer {
+	err := authPolicy.CheckRoutes()
+	if err != nil {
+		log.Fatalf("failed to check policy: %v", err)
+	}
+	return auth.NewAuthorizer(authPolicy, keyManager, revocationList, permissionCache, logError)
+}
+
+func (server *Server) InitOpenApi(authPolicy *policy.Policy) *openapi.Document {
+	document, err := openapi.Build(authPolicy, handlers.RouteDocs)
+	if err != nil {
+		log.Fatalf("failed to document routes: %v", err)
+	}
+	document.Servers = server.apiVersions.Servers()
+	return document
+}
+
+// InitApiVersions mounts the routes under /v1 and /v2. v2 is served as the
+// handlers answer; v1, which paths without a version still get, is adapted.
+func (server *Server) InitApiVersions(logInfo *logger.Logger) *handlers.ApiVersions {
+	deprecated, err := time.Parse("2006-01-02", server.config.ApiV1Deprecated)
+	if err != nil {
+		log.Fatalf("invalid API_V1_DEPRECATED %q", server.config.ApiV1Deprecated)
+	}
+	sunset, err := time.Parse("2006-01-02", server.config.ApiV1Sunset)
+	if err != nil || !sunset.After(deprecated) {
+		log.Fatalf("invalid API_V1_SUNSET %q", server.config.ApiV1Sunset)
+	}
+	v1 := &handlers.ApiVersion{Name: "v1", Deprecated: deprecated, Sunset: sunset, Adapters: handlers.V1Adapters}
+	v2 := &handlers.ApiVersion{Name: "v2"}
+	return handlers.NewApiVersions(logInfo, "v1", v1, v2)
+}
+
+func (server *Server) InitRoleRepo(db *gorm.DB) repositories.RoleRepository {
+	return persistance.NewRoleRepositoryImpl(db)
+}
+
+func (server *Server) InitRoleService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.RoleRepository,
+	userRepo repositories.UserRepository, revocationService *services.RevocationService, authPolicy *policy.Policy) *services.RoleService {
+	service := services.NewRoleService(logInfo, logError, repo, userRepo,
+		permissions.NewBroadcaster(server.InitPublisher(server.config.RoleSubject)), revocationService, authPolicy)
+	err := service.Seed()
+	if err != nil {
+		log.Fatalf("failed to seed roles: %v", err)
+	}
+	_, err = handlers.NewRoleEventHandler(logError, service, server.InitSubscriber(server.config.RoleSubject, RoleQueueGroup))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	err = service.Rebroadcast()
+	if err != nil {
+		logError.Logger.Errorf("ERR:REBROADCASTING ROLES: %v", err)
+	}
+	return service
+}
+
+func (server *Server) InitPermissionCache(authPolicy *policy.Policy) *permissions.Cache {
+	cache := permissions.NewCache(authPolicy.Roles)
+	err := cache.Listen(server.InitSubscriber(server.config.RoleSubject, permissions.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cache
+}
+
+func (server *Server) InitFeedService(logInfo *logger.Logger, logError *logger.Logger, timelineRepo repositories.TimelineRepository,
+	posts postsGw.PostServiceClient, connections connGw.ConnectionServiceClient) *services.FeedService {
+	concurrency, err := strconv.Atoi(server.config.FeedConcurrency)
+	if err != nil || concurrency < 1 {
+		log.Fatalf("invalid FEED_CONCURRENCY %q", server.config.FeedConcurrency)
+	}
+	window, err := strconv.Atoi(server.config.FeedRankWindow)
+	if err != nil || window < 1 {
+		log.Fatalf("invalid FEED_RANK_WINDOW %q", server.config.FeedRankWindow)
+	}
+	ranker, err := ranking.Parse(server.config.FeedRanker)
+	if err != nil {
+		log.Fatalf("invalid FEED_RANKER: %v", err)
+	}
+	rebuildAfter, err := time.ParseDuration(server.config.TimelineRebuild)
+	if err != nil || rebuildAfter <= 0 {
+		log.Fatalf("invalid TIMELINE_REBUILD %q", server.config.TimelineRebuild)
+	}
+	users := clients.NewUserClient(fmt.Sprintf("%s:%s", server.config.UserHost, server.config.UserPort), server.dialOptions(server.config.UserHost)...)
+	return services.NewFeedService(logInfo, logError, timelineRepo, posts, connections, users, ranker, window, concurrency, rebuildAfter)
+}
+
+func (server *Server) InitFeedTimeout() time.Duration {
+	timeout, err := time.ParseDuration(server.config.FeedTimeout)
+	if err != nil || timeout <= 0 {
+		log.Fatalf("invalid FEED_TIMEOUT %q", server.config.FeedTimeout)
+	}
+	return timeout
+}
+
+func (server *Server) InitGraphqlService(logError *logger.Logger, posts postsGw.PostServiceClient,
+	connections connGw.ConnectionServiceClient) *services.GraphqlService {
+	depth, err := strconv.Atoi(server.config.GraphqlDepth)
+	if err != nil || depth < 1 {
+		log.Fatalf("invalid GRAPHQL_MAX_DEPTH %q", server.config.GraphqlDepth)
+	}
+	complexity, err := strconv.Atoi(server.config.GraphqlComplexity)
+	if err != nil || complexity < 1 {
+		log.Fatalf("invalid GRAPHQL_MAX_COMPLEXITY %q", server.config.GraphqlComplexity)
+	}
+	users := clients.NewUserClient(fmt.Sprintf("%s:%s", server.config.UserHost, server.config.UserPort), server.dialOptions(server.config.UserHost)...)
+	notifications := clients.NewNotificationClient(fmt.Sprintf("%s:%s", server.config.MessageHost, server.config.MessagePort), server.dialOptions(server.config.MessageHost)...)
+	return services.NewGraphqlService(logError, server.authorizer, users, posts, connections, notifications,
+		services.GraphqlLimits{Depth: depth, Complexity: complexity})
+}
+
+func (server *Server) InitTimelineRepo(db *gorm.DB) repositories.TimelineRepository {
+	switch server.config.TimelineStore {
+	case "memory":
+		return persistance.NewTimelineRepositoryInMemory()
+	case "postgres":
+		return persistance.NewTimelineRepositoryImpl(db)
+	default:
+		log.Fatalf("unknown timeline store: %s", server.config.TimelineStore)
+		return nil
+	}
+}
+
+// InitTimelineService starts the timeline worker. Gateway instances share
+// the work: each event is handled by one of them.
+func (server *Server) InitTimelineService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.TimelineRepository,
+	posts postsGw.PostServiceClient, connections connGw.ConnectionServiceClient, keyManager *auth.KeyManager) *services.TimelineService {
+	service := services.NewTimelineService(logInfo, logError, repo, posts, connections, keyManager)
+	_, err := handlers.NewTimelineEventHandler(logError, service, server.InitSubscriber(server.config.TimelineSubject, TimelineQueueGroup))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	return service
+}
+
+func (server *Server) InitResponseCacheRepo(db *gorm.DB) repositories.ResponseCacheRepository {
+	switch server.config.CacheStore {
+	case "memory":
+		return persistance.NewResponseCacheRepositoryInMemory()
+	case "postgres":
+		return persistance.NewResponseCacheRepositoryImpl(db)
+	default:
+		log.Fatalf("unknown response cache store: %s", server.config.CacheStore)
+		return nil
+	}
 }
 
-func (server *Server) InitLoginVerificationRepo(db *gorm.DB) repositories.LoginVerificationRepository {
-	return persistance.NewLoginVerificationRepositoryImpl(db)
+// InitResponseCacheService listens for changes to what the gateway caches.
+// Every instance hears of them all, as each may have cached what changed.
+func (server *Server) InitResponseCacheService(logInfo *logger.Logger, logError *logger.Logger,
+	repo repositories.ResponseCacheRepository) *services.ResponseCacheService {
+	service := services.NewResponseCacheService(logInfo, logError, repo)
+	service.Start()
+	_, err := handlers.NewChangeEventHandler(logError, service, server.InitSubscriber(server.config.ChangeSubject, changes.BroadcastGroup))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	return service
+}
+
+func (server *Server) InitCachedRoutes() map[string]services.CacheRoute {
+	ttls := map[string]string{
+		"CACHE_TTL_PROFILE":    server.config.CacheProfileTtl,
+		"CACHE_TTL_POST":       server.config.CachePostTtl,
+		"CACHE_TTL_JOB_OFFERS": server.config.CacheJobOfferTtl,
+	}
+	parsed := map[string]time.Duration{}
+	for name, ttl := range ttls {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid %s %q", name, ttl)
+		}
+		parsed[name] = d
+	}
+	return handlers.CachedRoutes(parsed["CACHE_TTL_PROFILE"], parsed["CACHE_TTL_POST"], parsed["CACHE_TTL_JOB_OFFERS"])
+}
+
+// InitRealtimeService listens for the events services push to users. A user
+// can be connected to any gateway instance, so each one receives them all,
+// and every revocation to close the streams it ends.
+func (server *Server) InitRealtimeService(logInfo *logger.Logger) *services.RealtimeService {
+	replay, err := strconv.Atoi(server.config.RealtimeReplay)
+	if err != nil || replay < 0 {
+		log.Fatalf("invalid REALTIME_REPLAY %q", server.config.RealtimeReplay)
+	}
+	retention, err := time.ParseDuration(server.config.RealtimeRetention)
+	if err != nil || retention <= 0 {
+		log.Fatalf("invalid REALTIME_RETENTION %q", server.config.RealtimeRetention)
+	}
+	service := services.NewRealtimeService(logInfo, replay, retention)
+	service.Start()
+	_, err = handlers.NewRealtimeEventHandler(service, server.InitSubscriber(server.config.RealtimeSubject, realtime.BroadcastGroup))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	_, err = handlers.NewRealtimeRevocationHandler(service, server.InitSubscriber(server.config.RevocationSubject, revocation.BroadcastGroup))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	return service
+}
+
+// InitTlsIdentity loads the certificate the gateway calls the services with.
+func (server *Server) InitTlsIdentity(logError *logger.Logger) *servicetls.Identity {
+	if server.config.GrpcTlsCert == "" {
+		if !server.insecureDev() {
+			log.Fatal("GRPC_TLS_CERT is not set; set GRPC_INSECURE_DEV=true to call the services without TLS in development")
+		}
+		logError.Logger.Errorf("ERR:GRPC_INSECURE_DEV SET, CALLING SERVICES WITHOUT TLS")
+		return nil
+	}
+	reload, err := time.ParseDuration(server.config.GrpcTlsReload)
+	if err != nil || reload <= 0 {
+		log.Fatalf("invalid GRPC_TLS_RELOAD %q", server.config.GrpcTlsReload)
+	}
+	identity, err := servicetls.LoadIdentity(server.config.GrpcTlsCert, server.config.GrpcTlsKey, server.config.GrpcTlsCa, logError)
+	if err != nil {
+		log.Fatalf("failed to load TLS identity: %v", err)
+	}
+	identity.CheckRevocation(server.InitRevocationChecker(logError))
+	identity.Watch(reload)
+	return identity
+}
+
+func (server *Server) InitRevocationChecker(logError *logger.Logger) *servicetls.RevocationChecker {
+	config, err := servicetls.ParseRevocationConfig(server.config.GrpcTlsCrlUrls, server.config.GrpcTlsOcspUrl,
+		server.config.GrpcTlsFailOpen, server.config.GrpcTlsRecheck)
+	if err != nil {
+		log.Fatalf("invalid certificate revocation settings: %v", err)
+	}
+	if !config.Enabled() {
+		logError.Logger.Errorf("ERR:GRPC_TLS_CRL_URLS AND GRPC_TLS_OCSP_URL NOT SET, NOT CHECKING CERTIFICATE REVOCATION")
+		return nil
+	}
+	return servicetls.NewRevocationChecker(config, logError)
+}
+
+func (server *Server) InitResilience(logInfo *logger.Logger, logError *logger.Logger) *clients.Resilience {
+	timeout, err := time.ParseDuration(server.config.GrpcTimeout)
+	if err != nil || timeout <= 0 {
+		log.Fatalf("invalid GRPC_TIMEOUT %q", server.config.GrpcTimeout)
+	}
+	timeouts, err := clients.ParseTimeouts(server.config.GrpcTimeouts)
+	if err != nil {
+		log.Fatalf("invalid GRPC_METHOD_TIMEOUTS: %v", err)
+	}
+	retries, err := strconv.Atoi(server.config.GrpcRetries)
+	if err != nil || retries < 0 {
+		log.Fatalf("invalid GRPC_RETRIES %q", server.config.GrpcRetries)
+	}
+	backoff, err := time.ParseDuration(server.config.GrpcRetryBackoff)
+	if err != nil || backoff < 0 {
+		log.Fatalf("invalid GRPC_RETRY_BACKOFF %q", server.config.GrpcRetryBackoff)
+	}
+	failures, err := strconv.Atoi(server.config.BreakerFailures)
+	if err != nil || failures < 1 {
+		log.Fatalf("invalid GRPC_BREAKER_FAILURES %q", server.config.BreakerFailures)
+	}
+	cooldown, err := time.ParseDuration(server.config.BreakerCooldown)
+	if err != nil || cooldown <= 0 {
+		log.Fatalf("invalid GRPC_BREAKER_COOLDOWN %q", server.config.BreakerCooldown)
+	}
+	return clients.NewResilience(clients.ResilienceConfig{
+		Timeout:         timeout,
+		Timeouts:        timeouts,
+		Retries:         retries,
+		Backoff:         backoff,
+		BreakerFailures: failures,
+		BreakerCooldown: cooldown,
+	}, logInfo, logError)
+}
+
+// insecureDev is the explicit opt-out from TLS for development setups
+// without certificates.
+func (server *Server) insecureDev() bool {
+	insecureDev, err := strconv.ParseBool(server.config.GrpcInsecure)
+	if err != nil {
+		log.Fatalf("invalid GRPC_INSECURE_DEV %q", server.config.GrpcInsecure)
+	}
+	return insecureDev
+}
+
+// dialOptions are how the gateway connects to the service at host, both for
+// the generated handlers and for its own clients.
+func (server *Server) dialOptions(host string) []grpc.DialOption {
+	return []grpc.DialOption{grpc.WithTransportCredentials(server.dialCredentials(host)),
+		grpc.WithChainUnaryInterceptor(server.resilience.Interceptor(host)),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(20*1024*1024),
+			grpc.MaxCallSendMsgSize(20*1024*1024)),
+	}
+}
+
+// dialCredentials secure calls to the service at host, which has to present
+// a certificate issued for that name.
+func (server *Server) dialCredentials(host string) credentials.TransportCredentials {
+	if server.identity == nil {
+		return insecure.NewCredentials()
+	}
+	return server.identity.ClientCredentials(host)
 }
@@ -1,39 +1,174 @@
 package config
 
-import "os"
+import (
+	"common/module/ranking"
+	"os"
+)
 
 type Config struct {
-	Port            string
-	UserHost        string
-	UserPort        string
-	PostsHost       string
-	PostsPort       string
-	UserDBHost      string
-	UserDBPort      string
-	UserDBName      string
-	UserDBUser      string
-	UserDBPass      string
-	MessageHost 	string
-	MessagePort 	string
-	ConnectionsHost string
-	ConnectionsPort string
+	Port              string
+	UserHost          string
+	UserPort          string
+	PostsHost         string
+	PostsPort         string
+	UserDBHost        string
+	UserDBPort        string
+	UserDBName        string
+	UserDBUser        string
+	UserDBPass        string
+	MessageHost       string
+	MessagePort       string
+	ConnectionsHost   string
+	ConnectionsPort   string
+	NatsHost          string
+	NatsPort          string
+	NatsUser          string
+	NatsPass          string
+	RevocationSubject string
+	RoleSubject       string
+	TimelineSubject   string
+	TimelineStore     string
+	TimelineRebuild   string
+	SigningAlgorithm  string
+	KeyRotation       string
+	LoginAttemptStore string
+	MfaTicketSecret   string
+	WebAuthnRPID      string
+	WebAuthnRPOrigin  string
+	OneTimeCodeSecret string
+	MailBackend       string
+	MailFrom          string
+	SmtpHost          string
+	SmtpPort          string
+	SmtpUser          string
+	SmtpPass          string
+	CourierAuthToken  string
+	MailFile          string
+	FeedTimeout       string
+	FeedConcurrency   string
+	FeedRanker        string
+	FeedRankWindow    string
+	RealtimeSubject   string
+	RealtimeReplay    string
+	RealtimeRetention string
+	GrpcTlsCert       string
+	GrpcTlsKey        string
+	GrpcTlsCa         string
+	GrpcTlsReload     string
+	GrpcTlsCrlUrls    string
+	GrpcTlsOcspUrl    string
+	GrpcTlsFailOpen   string
+	GrpcTlsRecheck    string
+	GrpcInsecure      string
+	GrpcTimeout       string
+	GrpcTimeouts      string
+	GrpcRetries       string
+	GrpcRetryBackoff  string
+	BreakerFailures   string
+	BreakerCooldown   string
+	RateLimitStore    string
+	AnonymousLimit    string
+	UserLimit         string
+	ApiTokenLimit     string
+	AddressLimit      string
+	SwaggerUiDir      string
+	TrustedProxies    string
+	GraphqlDepth      string
+	GraphqlComplexity string
+	ApiV1Deprecated   string
+	ApiV1Sunset       string
+	ChangeSubject     string
+	CacheStore        string
+	CacheProfileTtl   string
+	CachePostTtl      string
+	CacheJobOfferTtl  string
 }
 
 func NewConfig() *Config {
 	return &Config{
-		Port:            os.Getenv("GATEWAY_PORT"),
-		UserHost:        os.Getenv("USER_SERVICE_HOST"),
-		UserPort:        os.Getenv("USER_SERVICE_PORT"),
-		PostsHost:       os.Getenv("POST_SERVICE_HOST"),
-		PostsPort:       os.Getenv("POST_SERVICE_PORT"),
-		MessageHost: 	os.Getenv("MESSAGE_SERVICE_HOST"),
-		MessagePort: 	os.Getenv("MESSAGE_SERVICE_PORT"),
-		UserDBHost:      os.Getenv("USER_DB_HOST"),
-		UserDBPort:      os.Getenv("USER_DB_PORT"),
-		UserDBName:      os.Getenv("USER_DB_NAME"),
-		UserDBUser:      os.Getenv("USER_DB_USER"),
-		UserDBPass:      os.Getenv("USER_DB_PASS"),
-		ConnectionsPort: "8084",
-		ConnectionsHost: "connection_service",
+		Port:              os.Getenv("GATEWAY_PORT"),
+		UserHost:          os.Getenv("USER_SERVICE_HOST"),
+		UserPort:          os.Getenv("USER_SERVICE_PORT"),
+		PostsHost:         os.Getenv("POST_SERVICE_HOST"),
+		PostsPort:         os.Getenv("POST_SERVICE_PORT"),
+		MessageHost:       os.Getenv("MESSAGE_SERVICE_HOST"),
+		MessagePort:       os.Getenv("MESSAGE_SERVICE_PORT"),
+		UserDBHost:        os.Getenv("USER_DB_HOST"),
+		UserDBPort:        os.Getenv("USER_DB_PORT"),
+		UserDBName:        os.Getenv("USER_DB_NAME"),
+		UserDBUser:        os.Getenv("USER_DB_USER"),
+		UserDBPass:        os.Getenv("USER_DB_PASS"),
+		ConnectionsPort:   "8084",
+		ConnectionsHost:   "connection_service",
+		NatsHost:          os.Getenv("NATS_HOST"),
+		NatsPort:          os.Getenv("NATS_PORT"),
+		NatsUser:          os.Getenv("NATS_USER"),
+		NatsPass:          os.Getenv("NATS_PASS"),
+		RevocationSubject: os.Getenv("REVOCATION_SUBJECT"),
+		RoleSubject:       os.Getenv("ROLE_SUBJECT"),
+		TimelineSubject:   os.Getenv("TIMELINE_SUBJECT"),
+		TimelineStore:     getEnvOrDefault("TIMELINE_STORE", "postgres"),
+		TimelineRebuild:   getEnvOrDefault("TIMELINE_REBUILD", "1h"),
+		SigningAlgorithm:  getEnvOrDefault("JWT_SIGNING_ALG", "RS256"),
+		KeyRotation:       getEnvOrDefault("JWT_KEY_ROTATION", "24h"),
+		LoginAttemptStore: getEnvOrDefault("LOGIN_ATTEMPT_STORE", "postgres"),
+		MfaTicketSecret:   os.Getenv("MFA_TICKET_SECRET"),
+		WebAuthnRPID:      getEnvOrDefault("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPOrigin:  getEnvOrDefault("WEBAUTHN_RP_ORIGIN", "https://localhost:4200"),
+		OneTimeCodeSecret: os.Getenv("ONE_TIME_CODE_SECRET"),
+		MailBackend:       getEnvOrDefault("MAIL_BACKEND", "file"),
+		MailFrom:          os.Getenv("MAIL_FROM"),
+		SmtpHost:          os.Getenv("SMTP_HOST"),
+		SmtpPort:          getEnvOrDefault("SMTP_PORT", "587"),
+		SmtpUser:          os.Getenv("SMTP_USER"),
+		SmtpPass:          os.Getenv("SMTP_PASS"),
+		CourierAuthToken:  os.Getenv("COURIER_AUTH_TOKEN"),
+		MailFile:          os.Getenv("MAIL_FILE"),
+		FeedTimeout:       getEnvOrDefault("FEED_TIMEOUT", "3s"),
+		FeedConcurrency:   getEnvOrDefault("FEED_CONCURRENCY", "8"),
+		FeedRanker:        getEnvOrDefault("FEED_RANKER", ranking.Top),
+		FeedRankWindow:    getEnvOrDefault("FEED_RANK_WINDOW", "200"),
+		RealtimeSubject:   os.Getenv("REALTIME_SUBJECT"),
+		RealtimeReplay:    getEnvOrDefault("REALTIME_REPLAY", "100"),
+		RealtimeRetention: getEnvOrDefault("REALTIME_RETENTION", "10m"),
+		GrpcTlsCert:       os.Getenv("GRPC_TLS_CERT"),
+		GrpcTlsKey:        os.Getenv("GRPC_TLS_KEY"),
+		GrpcTlsCa:         os.Getenv("GRPC_TLS_CA"),
+		GrpcTlsReload:     getEnvOrDefault("GRPC_TLS_RELOAD", "1m"),
+		GrpcTlsCrlUrls:    os.Getenv("GRPC_TLS_CRL_URLS"),
+		GrpcTlsOcspUrl:    os.Getenv("GRPC_TLS_OCSP_URL"),
+		GrpcTlsFailOpen:   getEnvOrDefault("GRPC_TLS_FAIL_OPEN", "false"),
+		GrpcTlsRecheck:    getEnvOrDefault("GRPC_TLS_REVOCATION_REFRESH", "10m"),
+		GrpcInsecure:      getEnvOrDefault("GRPC_INSECURE_DEV", "false"),
+		GrpcTimeout:       getEnvOrDefault("GRPC_TIMEOUT", "5s"),
+		GrpcTimeouts:      os.Getenv("GRPC_METHOD_TIMEOUTS"),
+		GrpcRetries:       getEnvOrDefault("GRPC_RETRIES", "2"),
+		GrpcRetryBackoff:  getEnvOrDefault("GRPC_RETRY_BACKOFF", "100ms"),
+		BreakerFailures:   getEnvOrDefault("GRPC_BREAKER_FAILURES", "5"),
+		BreakerCooldown:   getEnvOrDefault("GRPC_BREAKER_COOLDOWN", "30s"),
+		RateLimitStore:    getEnvOrDefault("RATE_LIMIT_STORE", "postgres"),
+		AnonymousLimit:    getEnvOrDefault("RATE_LIMIT_ANONYMOUS", "60/1m"),
+		UserLimit:         getEnvOrDefault("RATE_LIMIT_AUTHENTICATED", "300/1m"),
+		ApiTokenLimit:     getEnvOrDefault("RATE_LIMIT_API_TOKEN", "30/1m"),
+		AddressLimit:      getEnvOrDefault("RATE_LIMIT_ADDRESS", "600/1m"),
+		SwaggerUiDir:      getEnvOrDefault("SWAGGER_UI_DIR", "swagger-ui"),
+		TrustedProxies:    os.Getenv("TRUSTED_PROXIES"),
+		GraphqlDepth:      getEnvOrDefault("GRAPHQL_MAX_DEPTH", "8"),
+		GraphqlComplexity: getEnvOrDefault("GRAPHQL_MAX_COMPLEXITY", "1000"),
+		ApiV1Deprecated:   getEnvOrDefault("API_V1_DEPRECATED", "2026-10-17"),
+		ApiV1Sunset:       getEnvOrDefault("API_V1_SUNSET", "2027-04-30"),
+		ChangeSubject:     os.Getenv("CHANGE_SUBJECT"),
+		CacheStore:        getEnvOrDefault("RESPONSE_CACHE_STORE", "memory"),
+		CacheProfileTtl:   getEnvOrDefault("CACHE_TTL_PROFILE", "30s"),
+		CachePostTtl:      getEnvOrDefault("CACHE_TTL_POST", "1m"),
+		CacheJobOfferTtl:  getEnvOrDefault("CACHE_TTL_JOB_OFFERS", "5m"),
 	}
 }
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,25 @@
+#!/bin/sh
+# Issues a development CA and a certificate for every service, named by its
+# compose hostname. Deployments can mount CLIENT certificates from the PKI
+# here instead, as PEM: ca.crt plus <service>.crt and <service>.key. The
+# service is the certificate's common name, which the PKI copies into the
+# DNS SAN the services check; certificates and CAs the PKI issued before it
+# added extensions are refused and have to be reissued.
+# Running it again rotates the service certificates; services pick them up
+# within GRPC_TLS_RELOAD.
+set -e
+cd "$(dirname "$0")"
+
+if [ ! -f ca.key ]; then
+  openssl req -x509 -newkey rsa:4096 -sha256 -nodes -days 3650 \
+    -keyout ca.key -out ca.crt -subj "/CN=Dislinkt development CA"
+fi
+
+for service in api_gateway user_service post_service message_service connection_service; do
+  openssl req -newkey rsa:2048 -sha256 -nodes \
+    -keyout "$service.key" -out "$service.csr" -subj "/CN=$service"
+  printf "subjectAltName=DNS:%s\nextendedKeyUsage=serverAuth,clientAuth\n" "$service" > "$service.ext"
+  openssl x509 -req -sha256 -days 90 -in "$service.csr" -CA ca.crt -CAkey ca.key \
+    -CAcreateserial -extfile "$service.ext" -out "$service.crt"
+  rm "$service.csr" "$service.ext"
+done
@@ -102,3 +102,8 @@ func BadPaths(input []string) bool {
 	}
 	return matched
 }
+
+func BadLinkToken(input string) bool {
+	justToken, _ := regexp.MatchString(`[^a-zA-Z0-9\-_\.]`, input)
+	return justToken
+}
@@ -0,0 +1,49 @@
+package changes
+
+import (
+	events "common/module/saga/change_events"
+	saga "common/module/saga/messaging"
+	"github.com/google/uuid"
+	"time"
+)
+
+// BroadcastGroup is the queue group gateways subscribe with: every instance
+// may have cached what changed.
+const BroadcastGroup = ""
+
+// Publisher announces changes to what the services answer with, so the
+// gateway can drop the responses it cached.
+type Publisher struct {
+	publisher saga.Publisher
+}
+
+func NewPublisher(publisher saga.Publisher) *Publisher {
+	return &Publisher{publisher: publisher}
+}
+
+func (p *Publisher) UserUpdated(username string) error {
+	return p.publish(events.UserUpdated, username, "")
+}
+
+func (p *Publisher) PostCreated(post string, author string) error {
+	return p.publish(events.PostCreated, author, post)
+}
+
+// PostUpdated is published when a post gets a comment or a reaction too.
+func (p *Publisher) PostUpdated(post string, author string) error {
+	return p.publish(events.PostUpdated, author, post)
+}
+
+func (p *Publisher) JobOfferCreated(publisher string) error {
+	return p.publish(events.JobOfferCreated, publisher, "")
+}
+
+func (p *Publisher) publish(eventType events.ChangeEventType, username string, post string) error {
+	return p.publisher.Publish(&events.ChangeEvent{
+		Id:        uuid.New(),
+		Type:      eventType,
+		Username:  username,
+		Post:      post,
+		ChangedAt: time.Now(),
+	})
+}
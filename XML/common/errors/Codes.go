@@ -0,0 +1,72 @@
+package errors
+
+import "google.golang.org/grpc/codes"
+
+// The codes shared by more than one service. Codes are never renamed once
+// callers have seen them.
+const (
+	CodeInvalidArgument     = "INVALID_ARGUMENT"
+	CodeNotFound            = "NOT_FOUND"
+	CodeAlreadyExists       = "ALREADY_EXISTS"
+	CodeFailedPrecondition  = "FAILED_PRECONDITION"
+	CodeUnauthenticated     = "UNAUTHENTICATED"
+	CodePermissionDenied    = "PERMISSION_DENIED"
+	CodeResourceExhausted   = "RESOURCE_EXHAUSTED"
+	CodeDeadlineExceeded    = "DEADLINE_EXCEEDED"
+	CodeCanceled            = "CANCELED"
+	CodeUnavailable         = "UNAVAILABLE"
+	CodeUnimplemented       = "UNIMPLEMENTED"
+	CodeInternal            = "INTERNAL"
+	CodeMalformedRequest    = "MALFORMED_REQUEST"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeUnsafeInput         = "UNSAFE_INPUT"
+	CodeRouteNotFound       = "ROUTE_NOT_FOUND"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeUserNotFound        = "USER_NOT_FOUND"
+	CodeUsernameTaken       = "USERNAME_TAKEN"
+	CodeEmailTaken          = "EMAIL_TAKEN"
+	CodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	CodeAccountNotActivated = "ACCOUNT_NOT_ACTIVATED"
+	CodeInvalidCode         = "INVALID_CODE"
+	CodeWeakPassword        = "WEAK_PASSWORD"
+)
+
+// codeOf is the code of statuses sent without one.
+func codeOf(status codes.Code) string {
+	switch status {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return CodeInvalidArgument
+	case codes.NotFound:
+		return CodeNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return CodeAlreadyExists
+	case codes.FailedPrecondition:
+		return CodeFailedPrecondition
+	case codes.Unauthenticated:
+		return CodeUnauthenticated
+	case codes.PermissionDenied:
+		return CodePermissionDenied
+	case codes.ResourceExhausted:
+		return CodeResourceExhausted
+	case codes.DeadlineExceeded:
+		return CodeDeadlineExceeded
+	case codes.Canceled:
+		return CodeCanceled
+	case codes.Unavailable:
+		return CodeUnavailable
+	case codes.Unimplemented:
+		return CodeUnimplemented
+	}
+	return CodeInternal
+}
+
+// genericMessages stand in for the messages of errors that would leak.
+var genericMessages = map[codes.Code]string{
+	codes.Internal:         "Internal error",
+	codes.Unknown:          "Internal error",
+	codes.DataLoss:         "Internal error",
+	codes.Unimplemented:    "Not implemented",
+	codes.Unavailable:      "Service unavailable, try again later",
+	codes.DeadlineExceeded: "The request timed out",
+	codes.Canceled:         "The request was canceled",
+}
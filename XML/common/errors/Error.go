@@ -0,0 +1,170 @@
+// Package errors is the error model shared by the services and the gateway.
+// An Error carries a stable code callers can branch on, the gRPC status it
+// travels as, and a message that is safe to show; what caused it stays on
+// the side that logged it.
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain names the error codes in the ErrorInfo details of a status.
+const Domain = "dislinkt"
+
+type Error struct {
+	// Code is stable: callers may branch on it, unlike on Message.
+	Code    string
+	Status  codes.Code
+	Message string
+	Fields  []FieldViolation
+	cause   error
+}
+
+// FieldViolation tells which field of a request is invalid and why.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+func Field(field string, description string) FieldViolation {
+	return FieldViolation{Field: field, Description: description}
+}
+
+func New(status codes.Code, code string, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+func InvalidArgument(code string, message string, fields ...FieldViolation) *Error {
+	return &Error{Code: code, Status: codes.InvalidArgument, Message: message, Fields: fields}
+}
+
+func NotFound(code string, message string) *Error {
+	return New(codes.NotFound, code, message)
+}
+
+func AlreadyExists(code string, message string, fields ...FieldViolation) *Error {
+	return &Error{Code: code, Status: codes.AlreadyExists, Message: message, Fields: fields}
+}
+
+func FailedPrecondition(code string, message string) *Error {
+	return New(codes.FailedPrecondition, code, message)
+}
+
+func Unauthenticated(code string, message string) *Error {
+	return New(codes.Unauthenticated, code, message)
+}
+
+func PermissionDenied(code string, message string) *Error {
+	return New(codes.PermissionDenied, code, message)
+}
+
+func ResourceExhausted(code string, message string) *Error {
+	return New(codes.ResourceExhausted, code, message)
+}
+
+// Internal hides cause behind a generic message.
+func Internal(cause error) *Error {
+	return &Error{Code: CodeInternal, Status: codes.Internal, Message: genericMessages[codes.Internal], cause: cause}
+}
+
+// Error is the message, never the cause, so it can't leak by being printed.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Cause is what the error came from, for logs; nil when it's its own cause.
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+// WithCause returns a copy of e that keeps cause for the logs.
+func (e *Error) WithCause(cause error) *Error {
+	copied := *e
+	copied.cause = cause
+	return &copied
+}
+
+// Leaks tells whether the error is the server's fault rather than the
+// caller's, which is when its cause has to be logged.
+func (e *Error) Leaks() bool {
+	switch e.Status {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// GRPCStatus lets grpc send e as a status: the code goes in an ErrorInfo,
+// the fields in a BadRequest.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Status, e.Message)
+	info := &errdetails.ErrorInfo{Reason: e.Code, Domain: Domain}
+	var err error
+	var withDetails *status.Status
+	if len(e.Fields) == 0 {
+		withDetails, err = st.WithDetails(info)
+	} else {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(e.Fields))
+		for i, field := range e.Fields {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Description}
+		}
+		withDetails, err = st.WithDetails(info, &errdetails.BadRequest{FieldViolations: violations})
+	}
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// FromError turns any error into an Error. Errors of this package and
+// statuses carrying their details come back as they were sent. Statuses of
+// other servers keep their message only when it's about the request; for
+// anything else, and for errors that aren't statuses, the message is
+// replaced and the error kept as the cause.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if stderrors.As(err, &typed) {
+		return typed
+	}
+	if stderrors.Is(err, context.DeadlineExceeded) || stderrors.Is(err, context.Canceled) {
+		st := status.FromContextError(err)
+		return &Error{Code: codeOf(st.Code()), Status: st.Code(), Message: genericMessages[st.Code()], cause: err}
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return Internal(err)
+	}
+
+	e := &Error{Code: codeOf(st.Code()), Status: st.Code(), Message: st.Message()}
+	typedStatus := false
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.Domain == Domain {
+				e.Code, typedStatus = detail.Reason, true
+			}
+		case *errdetails.BadRequest:
+			for _, violation := range detail.FieldViolations {
+				e.Fields = append(e.Fields, Field(violation.Field, violation.Description))
+			}
+		}
+	}
+	if e.Status == codes.Unknown {
+		e.Status, e.Code = codes.Internal, CodeInternal
+	}
+	if e.Leaks() && !typedStatus {
+		e.Message, e.cause = genericMessages[e.Status], err
+	}
+	return e
+}
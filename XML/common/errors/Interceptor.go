@@ -0,0 +1,34 @@
+package errors
+
+import (
+	"common/module/logger"
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor sends every error a handler returns as an Error,
+// so what caused it never reaches the caller. Errors that are the server's
+// fault are logged with their cause.
+func UnaryServerInterceptor(logError *logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		response, err := handler(ctx, req)
+		if err == nil {
+			return response, nil
+		}
+		e := FromError(err)
+		if e.Leaks() {
+			Log(logError, e, logrus.Fields{"method": info.FullMethod})
+		}
+		return nil, e
+	}
+}
+
+// Log logs e with its cause.
+func Log(logError *logger.Logger, e *Error, fields logrus.Fields) {
+	cause := e.cause
+	if cause == nil {
+		cause = e
+	}
+	logError.Logger.WithFields(fields).Errorf("ERR:%s: %v", e.Code, cause)
+}
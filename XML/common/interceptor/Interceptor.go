@@ -2,8 +2,8 @@ package interceptor
 
 import (
 	"common/module/logger"
+	"common/module/policy"
 	"context"
-	"crypto/rsa"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/sirupsen/logrus"
@@ -11,28 +11,50 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
-	"os"
 	"strings"
 )
 
+// RevocationChecker reports whether a token was revoked before it expired,
+// either on its own (by jti), with the session it belongs to, or together
+// with all sessions of its user.
+type RevocationChecker interface {
+	IsRevoked(tokenId string, sessionId string, username string, issuedAt int64) bool
+}
+
+// PermissionResolver finds the permissions of the roles a token carries.
+type PermissionResolver interface {
+	Resolve(roles []string) []string
+}
+
+// KeySource resolves the public key a token was signed with from the kid in
+// its header. Implementations must only return keys of the given algorithm.
+type KeySource interface {
+	VerificationKey(kid string, alg string) (interface{}, error)
+}
+
 type AuthInterceptor struct {
-	accessibleRoles map[string][]string
-	publicKey       *rsa.PublicKey
-	logError        *logger.Logger
+	policy      *policy.Policy
+	keys        KeySource
+	revocations RevocationChecker
+	permissions PermissionResolver
+	logError    *logger.Logger
 }
 
-func NewAuthInterceptor(accessibleRoles map[string][]string, publicKey *rsa.PublicKey, logError *logger.Logger) *AuthInterceptor {
+func NewAuthInterceptor(policy *policy.Policy, keys KeySource, revocations RevocationChecker, permissions PermissionResolver,
+	logError *logger.Logger) *AuthInterceptor {
 	return &AuthInterceptor{
-		accessibleRoles: accessibleRoles,
-		publicKey:       publicKey,
-		logError:        logError,
+		policy:      policy,
+		keys:        keys,
+		revocations: revocations,
+		permissions: permissions,
+		logError:    logError,
 	}
 }
 
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		fmt.Println(info.FullMethod)
-		ctx, err := interceptor.Authorize(ctx, info.FullMethod)
+		ctx, err := interceptor.Authorize(ctx, info.FullMethod, req)
 		if err != nil {
 
 			return nil, err
@@ -45,10 +67,16 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 type LoggedInUserKey struct {
 }
 
-func (interceptor *AuthInterceptor) Authorize(ctx context.Context, method string) (context.Context, error) {
+// Authorize checks a call against the rule of its method. Methods without a
+// rule are refused; servers check at startup that there are none.
+func (interceptor *AuthInterceptor) Authorize(ctx context.Context, method string, req interface{}) (context.Context, error) {
 
-	accessibleRoles, ok := interceptor.accessibleRoles[method]
+	rule, ok := interceptor.policy.Rpc(method)
 	if !ok {
+		interceptor.logError.Logger.Errorf("ERR:FORBIDEN:NO POLICY FOR %s", method)
+		return ctx, status.Errorf(codes.PermissionDenied, "Forbidden")
+	}
+	if rule.Public {
 		return ctx, nil
 	}
 
@@ -66,29 +94,46 @@ func (interceptor *AuthInterceptor) Authorize(ctx context.Context, method string
 
 	}
 
-	err, claimsRoles := TokenIsValid(ctx, tokenString)
-	if err != nil {
+	claims, err := VerifyToken(tokenString, interceptor.keys)
+	if err != nil || claims.Valid() != nil {
 		interceptor.logError.Logger.Errorf("ERR:UNOTHORIZED:TOKEN INVALID")
 		return ctx, status.Errorf(codes.Unauthenticated, "Unauthorized")
 	}
 
-	userName := getUsernameFromClaim(tokenString)
+	userName := claims.Username
 
-	for _, claimsRole := range claimsRoles {
-		for _, role := range accessibleRoles {
-			if role == claimsRole {
-				fmt.Println(role)
-				//k := loggedInUser("loggedIn")
-				return context.WithValue(ctx, LoggedInUserKey{}, userName), nil
-				//return context.WithValue(ctx, "loggedIn", getUsernameClaim(tokenString)), nil //zamjenila sam da umesto role ide username
-			}
-		}
+	if interceptor.revocations != nil && interceptor.revocations.IsRevoked(claims.Id, claims.SessionId, claims.Username, claims.IssuedAt) {
+		interceptor.logError.Logger.WithFields(logrus.Fields{
+			"user": userName,
+			"jti":  claims.Id,
+		}).Errorf("ERR:UNOTHORIZED:TOKEN REVOKED")
+		return ctx, status.Errorf(codes.Unauthenticated, "Unauthorized")
+	}
+
+	if !rule.Allows(PermissionsOf(claims, interceptor.permissions)) {
+		interceptor.logError.Logger.WithFields(logrus.Fields{
+			"user": userName,
+		}).Errorf("ERR:FORBIDEN")
+		return ctx, status.Errorf(codes.PermissionDenied, "Forbidden")
 	}
 
-	interceptor.logError.Logger.WithFields(logrus.Fields{
-		"user": userName,
-	}).Errorf("ERR:FORBIDEN")
-	return ctx, status.Errorf(codes.PermissionDenied, "Forbidden")
+	err = rule.CheckOwner(req, userName)
+	if err != nil {
+		interceptor.logError.Logger.WithFields(logrus.Fields{
+			"user":   userName,
+			"method": method,
+		}).Errorf("ERR:FORBIDEN:NOT OWNER")
+		return ctx, status.Errorf(codes.PermissionDenied, "Forbidden")
+	}
+	return context.WithValue(ctx, LoggedInUserKey{}, userName), nil
+}
+
+// PermissionsOf resolves the permissions of the roles claims carry.
+func PermissionsOf(claims *JwtClaims, resolver PermissionResolver) []string {
+	if resolver == nil {
+		return nil
+	}
+	return resolver.Resolve(claims.Roles)
 }
 
 func parseToken(md metadata.MD, logError *logger.Logger) (error, string) {
@@ -109,9 +154,9 @@ func parseToken(md metadata.MD, logError *logger.Logger) (error, string) {
 	return nil, parts[1]
 }
 
-func TokenIsValid(ctx context.Context, tokenString string) (error, []string) {
+func TokenIsValid(ctx context.Context, tokenString string, keys KeySource) (error, []string) {
 
-	claims, err := VerifyToken(tokenString)
+	claims, err := VerifyToken(tokenString, keys)
 
 	if err != nil {
 		return status.Errorf(codes.Unauthenticated, "Unauthorized"), nil
@@ -124,14 +169,44 @@ func TokenIsValid(ctx context.Context, tokenString string) (error, []string) {
 	return nil, claims.Roles
 }
 
-func VerifyToken(tokenString string) (*JwtClaims, error) {
+// VerifyToken checks an access token. API tokens are refused, so that one
+// can't be used to call anything but the routes that take it in the request.
+func VerifyToken(tokenString string, keys KeySource) (*JwtClaims, error) {
+	claims, err := verifySignature(tokenString, keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Audience == ApiTokenAudience {
+		return nil, fmt.Errorf("an API token isn't an access token")
+	}
+	return claims, nil
+}
+
+// VerifyApiToken checks a token the gateway issued for ShareJobOffer.
+func VerifyApiToken(tokenString string, keys KeySource) (*JwtClaims, error) {
+	claims, err := verifySignature(tokenString, keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Audience != ApiTokenAudience {
+		return nil, fmt.Errorf("not an API token")
+	}
+	return claims, nil
+}
+
+func verifySignature(tokenString string, keys KeySource) (*JwtClaims, error) {
 	claims := &JwtClaims{}
 	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		//Make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		//Only asymmetric algorithms, so that verifying a token doesn't mean being able to mint one
+		alg := token.Method.Alg()
+		if alg != "RS256" && alg != "EdDSA" {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("SECRET")), nil
+		kid, ok := token.Header["kid"].(string)
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("token has no kid")
+		}
+		return keys.VerificationKey(kid, alg)
 	})
 	if err != nil {
 		fmt.Println("Error parsing claims")
@@ -140,18 +215,3 @@ func VerifyToken(tokenString string) (*JwtClaims, error) {
 
 	return claims, nil
 }
-
-func getUsernameFromClaim(tokenString string) string {
-	myClaims := &JwtClaims{}
-	_, err := jwt.ParseWithClaims(tokenString, myClaims, func(token *jwt.Token) (interface{}, error) {
-		return []byte("<YOUR VERIFICATION KEY>"), nil
-	})
-	fmt.Println(err)
-	//fmt.Println(myToken)
-	//for key, val := range myClaims {
-	//	if key == "username" {
-	//		return my
-	//	}
-	//}
-	return myClaims.Username
-}
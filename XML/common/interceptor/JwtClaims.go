@@ -7,9 +7,19 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
+// ApiTokenAudience is the audience of the long-lived API tokens agents use
+// to share job offers. Access tokens have no audience.
+const ApiTokenAudience = "api"
+
 type JwtClaims struct {
-	Username string   `json:"username,omitempty"`
-	Roles    []string `json:"roles,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Roles, not their permissions, go in the token: every service resolves
+	// them through its permission cache, so changing a role also changes
+	// what the tokens already issued allow.
+	Roles []string `json:"roles,omitempty"`
+	// SessionId ties an access token to the login it came from, so that one
+	// session can be revoked without logging the user out everywhere.
+	SessionId string `json:"sid,omitempty"`
 	jwt.StandardClaims
 	/**
 	Audience  string `json:"aud,omitempty"`
@@ -0,0 +1,101 @@
+package jwks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	refreshInterval    = 10 * time.Minute
+	minRefreshInterval = 10 * time.Second
+)
+
+type cachedKey struct {
+	alg       string
+	publicKey interface{}
+}
+
+// Cache holds the gateway's public signing keys fetched from its JWKS
+// endpoint. An unknown kid triggers a refetch, so a freshly rotated key is
+// picked up on the first token signed with it.
+type Cache struct {
+	url       string
+	client    *http.Client
+	mutex     sync.RWMutex
+	keys      map[string]cachedKey
+	lastFetch time.Time
+}
+
+func NewCache(url string) *Cache {
+	return &Cache{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]cachedKey),
+	}
+}
+
+func (c *Cache) VerificationKey(kid string, alg string) (interface{}, error) {
+	key, found, stale := c.lookup(kid)
+	if !found || stale {
+		err := c.refresh()
+		if err != nil && !found {
+			return nil, err
+		}
+		key, found, _ = c.lookup(kid)
+	}
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	if key.alg != alg {
+		return nil, fmt.Errorf("key %s is not an %s key", kid, alg)
+	}
+	return key.publicKey, nil
+}
+
+func (c *Cache) lookup(kid string) (cachedKey, bool, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	key, found := c.keys[kid]
+	return key, found, time.Since(c.lastFetch) > refreshInterval
+}
+
+func (c *Cache) refresh() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Since(c.lastFetch) < minRefreshInterval {
+		return nil
+	}
+	c.lastFetch = time.Now()
+
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching jwks: %s", resp.Status)
+	}
+
+	var keySet KeySet
+	err = json.NewDecoder(resp.Body).Decode(&keySet)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]cachedKey)
+	for _, k := range keySet.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		publicKey, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = cachedKey{alg: k.Alg, publicKey: publicKey}
+	}
+	c.keys = keys
+	return nil
+}
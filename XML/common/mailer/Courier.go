@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const courierSendUrl = "https://api.courier.com/send"
+
+// CourierMailer sends through Courier's REST API.
+type CourierMailer struct {
+	token  string
+	client *http.Client
+}
+
+func NewCourierMailer(token string) *CourierMailer {
+	return &CourierMailer{
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *CourierMailer) Send(ctx context.Context, message Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"to": map[string]string{
+				"email": message.To,
+			},
+			"content": map[string]string{
+				"title": message.Subject,
+				"body":  message.Text,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, courierSendUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("courier: %s: %s", response.Status, detail)
+	}
+	return nil
+}
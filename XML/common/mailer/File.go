@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer appends every message to an mbox file instead of sending it,
+// for development and for running without network access.
+type FileMailer struct {
+	path  string
+	from  string
+	mutex sync.Mutex
+}
+
+func NewFileMailer(path string, from string) *FileMailer {
+	return &FileMailer{path: path, from: from}
+}
+
+func (f *FileMailer) Send(ctx context.Context, message Message) error {
+	now := time.Now()
+	raw, err := message.bytes(f.from, now)
+	if err != nil {
+		return err
+	}
+
+	var entry bytes.Buffer
+	entry.WriteString("From MAILER-DAEMON " + now.UTC().Format(time.ANSIC) + "\n")
+	for _, line := range bytes.Split(bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")), []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			entry.WriteByte('>')
+		}
+		entry.Write(line)
+		entry.WriteByte('\n')
+	}
+	entry.WriteByte('\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	err = os.MkdirAll(filepath.Dir(f.path), 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(entry.Bytes())
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// GormOutboxStore keeps the outbox in the outbox_messages table of a service
+// database. Claim relies on FOR UPDATE SKIP LOCKED, so it needs PostgreSQL.
+type GormOutboxStore struct {
+	db *gorm.DB
+}
+
+func NewGormOutboxStore(db *gorm.DB) OutboxStore {
+	return &GormOutboxStore{db: db}
+}
+
+func (r GormOutboxStore) Add(message *OutboxMessage) error {
+	return r.db.Create(message).Error
+}
+
+func (r GormOutboxStore) Claim(now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := r.db.Raw(`UPDATE outbox_messages SET next_attempt_at = ?
+		WHERE id IN (SELECT id FROM outbox_messages WHERE next_attempt_at <= ?
+			ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(lease), now, limit).Scan(&messages).Error
+	return messages, err
+}
+
+func (r GormOutboxStore) Delete(id uuid.UUID) error {
+	return r.db.Delete(&OutboxMessage{}, "id = ?", id).Error
+}
+
+func (r GormOutboxStore) DeleteExpired(now time.Time) error {
+	return r.db.Delete(&OutboxMessage{}, "expires_at > ? AND expires_at <= ?", time.Time{}, now).Error
+}
+
+func (r GormOutboxStore) Reschedule(id uuid.UUID, attempts int, next time.Time, lastError string) error {
+	return r.db.Model(&OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": next,
+		"last_error":      lastError,
+	}).Error
+}
@@ -0,0 +1,119 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"time"
+)
+
+const (
+	BackendSMTP    = "smtp"
+	BackendCourier = "courier"
+	BackendFile    = "file"
+
+	defaultFrom = "Dislinkt <no-reply@dislinkt.local>"
+	defaultFile = "mail.mbox"
+)
+
+var ErrUnknownBackend = errors.New("unknown mail backend")
+
+// Message is a rendered email, ready for any backend. A message with an
+// ExpiresAt is dropped instead of sent once the code in it has expired.
+type Message struct {
+	To        string
+	Subject   string
+	Text      string
+	HTML      string
+	ExpiresAt time.Time
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Config picks and configures a backend. Backend defaults to "file", so a
+// service without any mail settings writes its mail to a local mbox.
+type Config struct {
+	Backend      string
+	From         string
+	SmtpHost     string
+	SmtpPort     string
+	SmtpUser     string
+	SmtpPass     string
+	CourierToken string
+	File         string
+}
+
+func New(config Config) (Mailer, error) {
+	from := config.From
+	if from == "" {
+		from = defaultFrom
+	}
+	switch config.Backend {
+	case BackendSMTP:
+		if config.SmtpHost == "" {
+			return nil, errors.New("smtp backend needs a host")
+		}
+		port := config.SmtpPort
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPMailer(config.SmtpHost, port, config.SmtpUser, config.SmtpPass, from), nil
+	case BackendCourier:
+		if config.CourierToken == "" {
+			return nil, errors.New("courier backend needs an auth token")
+		}
+		return NewCourierMailer(config.CourierToken), nil
+	case BackendFile, "":
+		file := config.File
+		if file == "" {
+			file = defaultFile
+		}
+		return NewFileMailer(file, from), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, config.Backend)
+}
+
+// bytes renders message as a MIME multipart/alternative email.
+func (m Message) bytes(from string, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		if part.content == "" {
+			continue
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := parts.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %s\r\n", from)
+	fmt.Fprintf(&out, "To: %s\r\n", m.To)
+	fmt.Fprintf(&out, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&out, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&out, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&out, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,254 @@
+package mailer
+
+import (
+	"common/module/logger"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	MaxDeliveryAttempts = 8
+	retryBase           = 30 * time.Second
+	retryMax            = time.Hour
+	claimLease          = 2 * time.Minute
+	pollInterval        = 15 * time.Second
+	batchSize           = 20
+)
+
+var errNoOutboxSecret = errors.New("the outbox needs a secret to seal messages with")
+
+// OutboxMessage is a message waiting to be delivered. Text and HTML are
+// sealed, since they carry codes and login links. Messages are deleted once
+// delivered, once they run out of attempts and once they expire.
+type OutboxMessage struct {
+	ID            uuid.UUID `json:"id" gorm:"primaryKey"`
+	Recipient     string    `json:"recipient" gorm:"not null"`
+	Subject       string    `json:"subject" gorm:"not null"`
+	Text          string    `json:"text"`
+	HTML          string    `json:"html"`
+	Attempts      int       `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time `json:"nextAttemptAt" gorm:"not null;index"`
+	ExpiresAt     time.Time `json:"expiresAt" gorm:"index"`
+	LastError     string    `json:"lastError"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// OutboxStore persists the outbox. Claim has to hand every due message to a
+// single caller only, by pushing its NextAttemptAt out by lease.
+// DeleteExpired drops the messages whose ExpiresAt, when set, is before now.
+type OutboxStore interface {
+	Add(message *OutboxMessage) error
+	Claim(now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error)
+	Delete(id uuid.UUID) error
+	DeleteExpired(now time.Time) error
+	Reschedule(id uuid.UUID, attempts int, next time.Time, lastError string) error
+}
+
+// Outbox is a Mailer that stores every message before handing it to the
+// backend, and keeps retrying with backoff until the backend takes it.
+type Outbox struct {
+	backend  Mailer
+	store    OutboxStore
+	aead     cipher.AEAD
+	logError *logger.Logger
+	wake     chan struct{}
+}
+
+// NewOutbox seals the stored bodies with a key derived from secret, so the
+// table alone gives away none of the codes and links in them.
+func NewOutbox(backend Mailer, store OutboxStore, secret []byte, logError *logger.Logger) (*Outbox, error) {
+	if len(secret) == 0 {
+		return nil, errNoOutboxSecret
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("outbox"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{
+		backend:  backend,
+		store:    store,
+		aead:     aead,
+		logError: logError,
+		wake:     make(chan struct{}, 1),
+	}, nil
+}
+
+// Send queues message and returns once it is stored; delivery happens in the
+// background.
+func (o *Outbox) Send(ctx context.Context, message Message) error {
+	id := uuid.New()
+	text, err := o.seal(id, message.Text)
+	if err != nil {
+		return err
+	}
+	html, err := o.seal(id, message.HTML)
+	if err != nil {
+		return err
+	}
+	err = o.store.Add(&OutboxMessage{
+		ID:            id,
+		Recipient:     message.To,
+		Subject:       message.Subject,
+		Text:          text,
+		HTML:          html,
+		Attempts:      0,
+		NextAttemptAt: time.Now(),
+		ExpiresAt:     message.ExpiresAt,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *Outbox) Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			o.deliverDue()
+			select {
+			case <-ticker.C:
+			case <-o.wake:
+			}
+		}
+	}()
+}
+
+func (o *Outbox) deliverDue() {
+	err := o.store.DeleteExpired(time.Now())
+	if err != nil {
+		o.logError.Logger.Errorf("ERR:REMOVING EXPIRED OUTBOX MESSAGES: %v", err)
+	}
+	for {
+		now := time.Now()
+		messages, err := o.store.Claim(now, claimLease, batchSize)
+		if err != nil {
+			o.logError.Logger.Errorf("ERR:CLAIMING OUTBOX MESSAGES: %v", err)
+			return
+		}
+		for _, message := range messages {
+			o.deliver(message)
+		}
+		if len(messages) < batchSize {
+			return
+		}
+	}
+}
+
+func (o *Outbox) deliver(message OutboxMessage) {
+	fields := o.logError.Logger.WithFields(logrus.Fields{
+		"recipient": message.Recipient,
+		"subject":   message.Subject,
+		"attempts":  message.Attempts,
+	})
+	if !message.ExpiresAt.IsZero() && !message.ExpiresAt.After(time.Now()) {
+		fields.Errorf("ERR:SENDING MAIL, EXPIRED UNSENT")
+		o.remove(message.ID)
+		return
+	}
+	text, err := o.open(message.ID, message.Text)
+	var html string
+	if err == nil {
+		html, err = o.open(message.ID, message.HTML)
+	}
+	if err != nil {
+		fields.Errorf("ERR:SENDING MAIL, CAN'T OPEN IT: %v", err)
+		o.remove(message.ID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), claimLease/2)
+	defer cancel()
+	err = o.backend.Send(ctx, Message{
+		To:      message.Recipient,
+		Subject: message.Subject,
+		Text:    text,
+		HTML:    html,
+	})
+	if err == nil {
+		o.remove(message.ID)
+		return
+	}
+
+	attempts := message.Attempts + 1
+	fields = fields.WithField("attempts", attempts)
+	if attempts >= MaxDeliveryAttempts {
+		fields.Errorf("ERR:SENDING MAIL, GIVING UP: %v", err)
+		o.remove(message.ID)
+		return
+	}
+	fields.Errorf("ERR:SENDING MAIL, WILL RETRY: %v", err)
+	err = o.store.Reschedule(message.ID, attempts, time.Now().Add(retryDelay(attempts)), err.Error())
+	if err != nil {
+		o.logError.Logger.Errorf("ERR:RESCHEDULING OUTBOX MESSAGE %s: %v", message.ID, err)
+	}
+}
+
+func (o *Outbox) remove(id uuid.UUID) {
+	err := o.store.Delete(id)
+	if err != nil {
+		o.logError.Logger.Errorf("ERR:REMOVING OUTBOX MESSAGE %s: %v", id, err)
+	}
+}
+
+// seal encrypts a body, bound to the message it belongs to.
+func (o *Outbox) seal(id uuid.UUID, body string) (string, error) {
+	nonce := make([]byte, o.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := o.aead.Seal(nonce, nonce, []byte(body), id[:])
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (o *Outbox) open(id uuid.UUID, sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < o.aead.NonceSize() {
+		return "", errors.New("sealed body too short")
+	}
+	body, err := o.aead.Open(nil, raw[:o.aead.NonceSize()], raw[o.aead.NonceSize():], id[:])
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMax {
+			return retryMax
+		}
+	}
+	return delay
+}
@@ -0,0 +1,208 @@
+package mailer
+
+import (
+	"common/module/logger"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type outboxStoreInMemory struct {
+	mutex    sync.Mutex
+	messages map[uuid.UUID]OutboxMessage
+}
+
+func (s *outboxStoreInMemory) Add(message *OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.messages[message.ID] = *message
+	return nil
+}
+
+func (s *outboxStoreInMemory) Claim(now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var claimed []OutboxMessage
+	for id, message := range s.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if !message.NextAttemptAt.After(now) {
+			claimed = append(claimed, message)
+			message.NextAttemptAt = now.Add(lease)
+			s.messages[id] = message
+		}
+	}
+	return claimed, nil
+}
+
+func (s *outboxStoreInMemory) Delete(id uuid.UUID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.messages, id)
+	return nil
+}
+
+func (s *outboxStoreInMemory) DeleteExpired(now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, message := range s.messages {
+		if !message.ExpiresAt.IsZero() && !message.ExpiresAt.After(now) {
+			delete(s.messages, id)
+		}
+	}
+	return nil
+}
+
+func (s *outboxStoreInMemory) Reschedule(id uuid.UUID, attempts int, next time.Time, lastError string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message := s.messages[id]
+	message.Attempts = attempts
+	// Due again right away, so the test doesn't have to wait out the backoff.
+	message.NextAttemptAt = time.Now()
+	message.LastError = lastError
+	s.messages[id] = message
+	return nil
+}
+
+func (s *outboxStoreInMemory) only(t *testing.T) OutboxMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.messages) != 1 {
+		t.Fatalf("%d messages in the outbox, want 1", len(s.messages))
+	}
+	for _, message := range s.messages {
+		return message
+	}
+	return OutboxMessage{}
+}
+
+type backendInMemory struct {
+	err  error
+	sent []Message
+}
+
+func (b *backendInMemory) Send(_ context.Context, message Message) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.sent = append(b.sent, message)
+	return nil
+}
+
+func newTestOutbox(t *testing.T, backend Mailer) (*Outbox, *outboxStoreInMemory) {
+	l, _ := logtest.NewNullLogger()
+	store := &outboxStoreInMemory{messages: map[uuid.UUID]OutboxMessage{}}
+	outbox, err := NewOutbox(backend, store, []byte("0123456789abcdef0123456789abcdef"), &logger.Logger{Logger: l})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox, store
+}
+
+func activationMessage(t *testing.T, expiresIn time.Duration) Message {
+	message, err := ActivationEmail("alice@example.com", ActivationData{Username: "alice", Code: "424242", ExpiresIn: expiresIn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestOutboxSealsStoredBodies(t *testing.T) {
+	backend := &backendInMemory{}
+	outbox, store := newTestOutbox(t, backend)
+	message := activationMessage(t, time.Hour)
+	if err := outbox.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := store.only(t)
+	if strings.Contains(stored.Text, "424242") || strings.Contains(stored.HTML, "424242") {
+		t.Fatal("the outbox stored the code in plaintext")
+	}
+	if stored.ExpiresAt.IsZero() {
+		t.Fatal("the message doesn't expire with its code")
+	}
+
+	outbox.deliverDue()
+	if len(backend.sent) != 1 || backend.sent[0].Text != message.Text || backend.sent[0].HTML != message.HTML {
+		t.Fatalf("sent %+v, want the message as rendered", backend.sent)
+	}
+	if len(store.messages) != 0 {
+		t.Fatal("the delivered message stayed in the outbox")
+	}
+}
+
+func TestOutboxDropsMessagesThatRunOutOfAttempts(t *testing.T) {
+	outbox, store := newTestOutbox(t, &backendInMemory{err: errors.New("connection refused")})
+	if err := outbox.Send(context.Background(), activationMessage(t, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < MaxDeliveryAttempts; i++ {
+		outbox.deliverDue()
+		if stored := store.only(t); stored.Attempts != i || stored.LastError != "connection refused" {
+			t.Fatalf("attempt %d: stored %d attempts and error %q", i, stored.Attempts, stored.LastError)
+		}
+	}
+	outbox.deliverDue()
+	if len(store.messages) != 0 {
+		t.Fatalf("the message stayed in the outbox after %d attempts", MaxDeliveryAttempts)
+	}
+}
+
+func TestOutboxDropsExpiredMessages(t *testing.T) {
+	backend := &backendInMemory{}
+	outbox, store := newTestOutbox(t, backend)
+	expired := activationMessage(t, time.Hour)
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if err := outbox.Send(context.Background(), expired); err != nil {
+		t.Fatal(err)
+	}
+	outbox.deliverDue()
+	if len(backend.sent) != 0 || len(store.messages) != 0 {
+		t.Fatalf("sent %d and kept %d expired messages", len(backend.sent), len(store.messages))
+	}
+
+	// A message claimed before it expired is dropped when it comes up again.
+	message := activationMessage(t, time.Hour)
+	if err := outbox.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+	stored := store.only(t)
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	outbox.deliver(stored)
+	if len(backend.sent) != 0 || len(store.messages) != 0 {
+		t.Fatalf("sent %d and kept %d expired messages", len(backend.sent), len(store.messages))
+	}
+}
+
+func TestOutboxRefusesTamperedBodies(t *testing.T) {
+	backend := &backendInMemory{}
+	outbox, store := newTestOutbox(t, backend)
+	if err := outbox.Send(context.Background(), activationMessage(t, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	stored := store.only(t)
+	// A body moved over from another message doesn't open.
+	stored.ID = uuid.New()
+	store.messages = map[uuid.UUID]OutboxMessage{stored.ID: stored}
+
+	outbox.deliverDue()
+	if len(backend.sent) != 0 || len(store.messages) != 0 {
+		t.Fatalf("sent %d and kept %d tampered messages", len(backend.sent), len(store.messages))
+	}
+}
+
+func TestNewOutboxNeedsASecret(t *testing.T) {
+	l, _ := logtest.NewNullLogger()
+	_, err := NewOutbox(&backendInMemory{}, &outboxStoreInMemory{}, nil, &logger.Logger{Logger: l})
+	if err != errNoOutboxSecret {
+		t.Fatalf("got %v, want %v", err, errNoOutboxSecret)
+	}
+}
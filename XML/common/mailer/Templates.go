@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmlTemplate "html/template"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var templateFuncs = map[string]interface{}{
+	"minutes": func(d time.Duration) int {
+		return int(d.Round(time.Minute) / time.Minute)
+	},
+}
+
+type ActivationData struct {
+	Username  string
+	Code      string
+	ExpiresIn time.Duration
+}
+
+type RecoveryData struct {
+	Username  string
+	Code      string
+	ExpiresIn time.Duration
+}
+
+type PasswordlessData struct {
+	Username  string
+	Link      string
+	ExpiresIn time.Duration
+}
+
+// NotificationData is for anything that just tells the user something.
+// Code and Link are optional; ExpiresIn is how long they hold, if they
+// expire.
+type NotificationData struct {
+	Username  string
+	Title     string
+	Message   string
+	Code      string
+	Link      string
+	ExpiresIn time.Duration
+}
+
+func ActivationEmail(to string, data ActivationData) (Message, error) {
+	return render("activation", to, "Activate your Dislinkt account", data, data.ExpiresIn)
+}
+
+func RecoveryEmail(to string, data RecoveryData) (Message, error) {
+	return render("recovery", to, "Password recovery code", data, data.ExpiresIn)
+}
+
+func PasswordlessEmail(to string, data PasswordlessData) (Message, error) {
+	return render("passwordless", to, "Passwordless login", data, data.ExpiresIn)
+}
+
+func NotificationEmail(to string, data NotificationData) (Message, error) {
+	return render("notification", to, data.Title, data, data.ExpiresIn)
+}
+
+var (
+	htmlTemplates = map[string]*htmlTemplate.Template{}
+	textTemplates = map[string]*textTemplate.Template{}
+)
+
+func init() {
+	for _, name := range []string{"activation", "recovery", "passwordless", "notification"} {
+		htmlTemplates[name] = htmlTemplate.Must(htmlTemplate.New(name).Funcs(templateFuncs).
+			ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html"))
+		textTemplates[name] = textTemplate.Must(textTemplate.New(name).Funcs(templateFuncs).
+			ParseFS(templateFiles, "templates/"+name+".txt"))
+	}
+}
+
+func render(name string, to string, subject string, data interface{}, expiresIn time.Duration) (Message, error) {
+	var html, text bytes.Buffer
+	err := htmlTemplates[name].ExecuteTemplate(&html, "layout", data)
+	if err != nil {
+		return Message{}, err
+	}
+	err = textTemplates[name].ExecuteTemplate(&text, name+".txt", data)
+	if err != nil {
+		return Message{}, err
+	}
+	message := Message{
+		To:      to,
+		Subject: subject,
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}
+	if expiresIn > 0 {
+		message.ExpiresAt = time.Now().Add(expiresIn)
+	}
+	return message, nil
+}
@@ -0,0 +1,67 @@
+package onetimecode
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormStore keeps codes in the one_time_codes table of a service database.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) Store {
+	return &GormStore{db: db}
+}
+
+func (r GormStore) Replace(code *Code) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("purpose = ? AND subject = ?", code.Purpose, code.Subject).
+			Delete(&Code{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+func (r GormStore) Latest(purpose Purpose, subject string) (*Code, error) {
+	code := &Code{}
+	if r.db.Where("purpose = ? AND subject = ?", purpose, subject).
+		Order("created_at desc").First(code).RowsAffected == 0 {
+		return nil, errors.New("one-time code not found")
+	}
+	return code, nil
+}
+
+func (r GormStore) Get(id uuid.UUID) (*Code, error) {
+	code := &Code{}
+	if r.db.First(code, "id = ?", id).RowsAffected == 0 {
+		return nil, errors.New("one-time code not found")
+	}
+	return code, nil
+}
+
+func (r GormStore) IncrementAttempts(id uuid.UUID) (int, error) {
+	code := &Code{}
+	result := r.db.Model(code).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "attempts"}}}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return code.Attempts, nil
+}
+
+func (r GormStore) MarkUsed(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&Code{}).
+		Where("id = ? AND used = ?", id, false).
+		Update("used", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,181 @@
+package onetimecode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// MinSecretLength is the shortest secret a Manager may be keyed with.
+const MinSecretLength = 32
+
+// Manager issues and redeems one-time codes. Codes are either typed by the
+// user (a few digits, guarded by the attempt limit) or sent as signed magic
+// links carrying a long random secret.
+type Manager struct {
+	store  Store
+	secret []byte
+}
+
+func NewManager(store Store, secret []byte) *Manager {
+	return &Manager{store: store, secret: secret}
+}
+
+// Issue creates a numeric code for subject. Any code issued to subject for
+// the same purpose before stops working.
+func (m *Manager) Issue(policy Policy, subject string) (string, error) {
+	code, err := newDigits(policy.Digits)
+	if err != nil {
+		return "", err
+	}
+	err = m.save(policy, uuid.New(), subject, code, time.Now().Add(policy.TTL))
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Redeem checks code against the newest code issued to subject and uses it
+// up when it matches.
+func (m *Manager) Redeem(policy Policy, subject string, code string) error {
+	stored, err := m.store.Latest(policy.Purpose, subject)
+	if err != nil {
+		return ErrInvalidCode
+	}
+	return m.redeem(policy, stored, code)
+}
+
+type linkPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Subject   string    `json:"sub"`
+	Purpose   Purpose   `json:"pur"`
+	ExpiresAt int64     `json:"exp"`
+	Secret    string    `json:"sec"`
+}
+
+// IssueLink creates a magic-link token for subject, to be put in a URL.
+func (m *Manager) IssueLink(policy Policy, subject string) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(policy.TTL)
+	payload := linkPayload{
+		ID:        uuid.New(),
+		Subject:   subject,
+		Purpose:   policy.Purpose,
+		ExpiresAt: expiresAt.Unix(),
+		Secret:    base64.RawURLEncoding.EncodeToString(secret),
+	}
+	err = m.save(policy, payload.ID, subject, payload.Secret, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	return encoded + "." + m.sign(encoded), nil
+}
+
+// ParseLink checks a token's signature and expiry without going to the store
+// and returns the subject it was issued to. It does not redeem the token.
+func (m *Manager) ParseLink(policy Policy, token string) (string, error) {
+	payload, err := m.parseLink(policy, token)
+	if err != nil {
+		return "", err
+	}
+	return payload.Subject, nil
+}
+
+// RedeemLink uses up a magic-link token and returns its subject.
+func (m *Manager) RedeemLink(policy Policy, token string) (string, error) {
+	payload, err := m.parseLink(policy, token)
+	if err != nil {
+		return "", err
+	}
+	stored, err := m.store.Get(payload.ID)
+	if err != nil || stored.Purpose != policy.Purpose || stored.Subject != payload.Subject {
+		return "", ErrInvalidLink
+	}
+	err = m.redeem(policy, stored, payload.Secret)
+	if err == ErrInvalidCode {
+		return "", ErrInvalidLink
+	}
+	if err != nil {
+		return "", err
+	}
+	return payload.Subject, nil
+}
+
+func (m *Manager) save(policy Policy, id uuid.UUID, subject string, code string, expiresAt time.Time) error {
+	return m.store.Replace(&Code{
+		ID:        id,
+		Purpose:   policy.Purpose,
+		Subject:   subject,
+		Hash:      hash(m.secret, policy.Purpose, subject, code),
+		ExpiresAt: expiresAt,
+		Attempts:  0,
+		Used:      false,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (m *Manager) redeem(policy Policy, stored *Code, code string) error {
+	if stored.Used {
+		return ErrCodeUsed
+	}
+	if !stored.ExpiresAt.After(time.Now()) {
+		return ErrCodeExpired
+	}
+	// Counted before comparing, so parallel guesses can't get past the limit.
+	attempts, err := m.store.IncrementAttempts(stored.ID)
+	if err != nil {
+		return err
+	}
+	if policy.MaxAttempts > 0 && attempts > policy.MaxAttempts {
+		return ErrTooManyAttempts
+	}
+	if !hmac.Equal([]byte(hash(m.secret, policy.Purpose, stored.Subject, code)), []byte(stored.Hash)) {
+		return ErrInvalidCode
+	}
+	marked, err := m.store.MarkUsed(stored.ID)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return ErrCodeUsed
+	}
+	return nil
+}
+
+func (m *Manager) parseLink(policy Policy, token string) (*linkPayload, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(m.sign(parts[0])), []byte(parts[1])) {
+		return nil, ErrInvalidLink
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidLink
+	}
+	payload := &linkPayload{}
+	err = json.Unmarshal(raw, payload)
+	if err != nil || payload.Purpose != policy.Purpose {
+		return nil, ErrInvalidLink
+	}
+	if time.Now().Unix() >= payload.ExpiresAt {
+		return nil, ErrCodeExpired
+	}
+	return payload, nil
+}
+
+func (m *Manager) sign(encoded string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte("link\x00" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
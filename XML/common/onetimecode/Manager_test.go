@@ -0,0 +1,276 @@
+package onetimecode
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type storeInMemory struct {
+	mutex sync.Mutex
+	codes map[uuid.UUID]*Code
+}
+
+func newStoreInMemory() *storeInMemory {
+	return &storeInMemory{codes: map[uuid.UUID]*Code{}}
+}
+
+func (s *storeInMemory) Replace(code *Code) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, stored := range s.codes {
+		if stored.Purpose == code.Purpose && stored.Subject == code.Subject {
+			delete(s.codes, id)
+		}
+	}
+	copied := *code
+	s.codes[code.ID] = &copied
+	return nil
+}
+
+func (s *storeInMemory) Latest(purpose Purpose, subject string) (*Code, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, stored := range s.codes {
+		if stored.Purpose == purpose && stored.Subject == subject {
+			copied := *stored
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("code not found")
+}
+
+func (s *storeInMemory) Get(id uuid.UUID) (*Code, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.codes[id]
+	if !ok {
+		return nil, errors.New("code not found")
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (s *storeInMemory) IncrementAttempts(id uuid.UUID) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.codes[id]
+	if !ok {
+		return 0, errors.New("code not found")
+	}
+	stored.Attempts++
+	return stored.Attempts, nil
+}
+
+func (s *storeInMemory) MarkUsed(id uuid.UUID) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.codes[id]
+	if !ok || stored.Used {
+		return false, nil
+	}
+	stored.Used = true
+	return true, nil
+}
+
+var (
+	testSecret   = []byte("0123456789abcdef0123456789abcdef")
+	typedCode    = Policy{Purpose: Activation, Digits: 6, TTL: time.Hour, MaxAttempts: 3}
+	magicLink    = Policy{Purpose: PasswordlessLogin, TTL: time.Hour}
+	recoveryLink = Policy{Purpose: PasswordRecovery, TTL: time.Hour}
+)
+
+// wrong returns a code of the same length that differs from code.
+func wrong(code string) string {
+	if code[0] == '0' {
+		return "1" + code[1:]
+	}
+	return "0" + code[1:]
+}
+
+// flip changes the first character of an encoded part.
+func flip(part string) string {
+	if part[0] == 'A' {
+		return "B" + part[1:]
+	}
+	return "A" + part[1:]
+}
+
+func TestRedeemIsSingleUse(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	code, err := manager.Issue(typedCode, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != typedCode.Digits {
+		t.Fatalf("got code %q, want %d digits", code, typedCode.Digits)
+	}
+	if err := manager.Redeem(typedCode, "alice", code); err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	if err := manager.Redeem(typedCode, "alice", code); err != ErrCodeUsed {
+		t.Fatalf("got %v redeeming twice, want %v", err, ErrCodeUsed)
+	}
+}
+
+func TestRedeemChecksSubjectAndPurpose(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	code, err := manager.Issue(typedCode, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Redeem(typedCode, "bob", code); err != ErrInvalidCode {
+		t.Fatalf("got %v for another subject, want %v", err, ErrInvalidCode)
+	}
+	otherPurpose := typedCode
+	otherPurpose.Purpose = PasswordRecovery
+	if err := manager.Redeem(otherPurpose, "alice", code); err != ErrInvalidCode {
+		t.Fatalf("got %v for another purpose, want %v", err, ErrInvalidCode)
+	}
+	if err := manager.Redeem(typedCode, "alice", code); err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+}
+
+func TestRedeemExpired(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	expired := typedCode
+	expired.TTL = -time.Second
+	code, err := manager.Issue(expired, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Redeem(expired, "alice", code); err != ErrCodeExpired {
+		t.Fatalf("got %v, want %v", err, ErrCodeExpired)
+	}
+}
+
+func TestRedeemAttemptLimit(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	code, err := manager.Issue(typedCode, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < typedCode.MaxAttempts; i++ {
+		if err := manager.Redeem(typedCode, "alice", wrong(code)); err != ErrInvalidCode {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, ErrInvalidCode)
+		}
+	}
+	if err := manager.Redeem(typedCode, "alice", code); err != ErrTooManyAttempts {
+		t.Fatalf("got %v after %d wrong codes, want %v", err, typedCode.MaxAttempts, ErrTooManyAttempts)
+	}
+}
+
+func TestIssueReplacesEarlierCodes(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	first, err := manager.Issue(typedCode, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := manager.Issue(typedCode, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		if err := manager.Redeem(typedCode, "alice", first); err != ErrInvalidCode {
+			t.Fatalf("got %v for a replaced code, want %v", err, ErrInvalidCode)
+		}
+	}
+	if err := manager.Redeem(typedCode, "alice", second); err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+}
+
+func TestRedeemLink(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	link, err := manager.IssueLink(magicLink, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := manager.ParseLink(magicLink, link)
+	if err != nil || subject != "alice" {
+		t.Fatalf("parsed %q: %v", subject, err)
+	}
+	subject, err = manager.RedeemLink(magicLink, link)
+	if err != nil || subject != "alice" {
+		t.Fatalf("redeemed %q: %v", subject, err)
+	}
+	if _, err := manager.RedeemLink(magicLink, link); err != ErrCodeUsed {
+		t.Fatalf("got %v redeeming twice, want %v", err, ErrCodeUsed)
+	}
+}
+
+func TestRedeemLinkRefusesTamperedLinks(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	link, err := manager.IssueLink(magicLink, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(link, ".")
+	forged, err := NewManager(newStoreInMemory(), []byte("another secret of thirty-two b..")).IssueLink(magicLink, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"no signature":       parts[0],
+		"changed payload":    flip(parts[0]) + "." + parts[1],
+		"changed signature":  parts[0] + "." + flip(parts[1]),
+		"another secret":     forged,
+		"not a link":         "a.b.c",
+		"signed garbage":     "e30." + manager.sign("e30"),
+		"payload not base64": "!!." + manager.sign("!!"),
+	}
+	for name, token := range cases {
+		if _, err := manager.RedeemLink(magicLink, token); err != ErrInvalidLink {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidLink)
+		}
+	}
+	if _, err := manager.RedeemLink(magicLink, link); err != nil {
+		t.Fatalf("the untampered link was refused: %v", err)
+	}
+}
+
+func TestRedeemLinkChecksPurpose(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	link, err := manager.IssueLink(magicLink, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.RedeemLink(recoveryLink, link); err != ErrInvalidLink {
+		t.Fatalf("got %v for another purpose, want %v", err, ErrInvalidLink)
+	}
+	if _, err := manager.ParseLink(recoveryLink, link); err != ErrInvalidLink {
+		t.Fatalf("parse got %v for another purpose, want %v", err, ErrInvalidLink)
+	}
+}
+
+func TestRedeemLinkExpired(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	expired := magicLink
+	expired.TTL = -time.Second
+	link, err := manager.IssueLink(expired, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.RedeemLink(expired, link); err != ErrCodeExpired {
+		t.Fatalf("got %v, want %v", err, ErrCodeExpired)
+	}
+}
+
+func TestRedeemLinkReplacedByALaterOne(t *testing.T) {
+	manager := NewManager(newStoreInMemory(), testSecret)
+	first, err := manager.IssueLink(magicLink, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.IssueLink(magicLink, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.RedeemLink(magicLink, first); err != ErrInvalidLink {
+		t.Fatalf("got %v for a replaced link, want %v", err, ErrInvalidLink)
+	}
+}
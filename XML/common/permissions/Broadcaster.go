@@ -0,0 +1,45 @@
+package permissions
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/role_events"
+	"github.com/google/uuid"
+)
+
+// BroadcastGroup is used as the queue group for role cache subscribers so
+// that every service instance receives every event.
+const BroadcastGroup = ""
+
+type Broadcaster struct {
+	publisher saga.Publisher
+}
+
+func NewBroadcaster(publisher saga.Publisher) *Broadcaster {
+	return &Broadcaster{publisher: publisher}
+}
+
+func (b *Broadcaster) RoleUpdated(role string, permissions []string) error {
+	return b.publisher.Publish(&events.RoleEvent{
+		Id:          uuid.New(),
+		Type:        events.RoleUpdated,
+		Role:        role,
+		Permissions: permissions,
+	})
+}
+
+func (b *Broadcaster) RoleDeleted(role string) error {
+	return b.publisher.Publish(&events.RoleEvent{
+		Id:   uuid.New(),
+		Type: events.RoleDeleted,
+		Role: role,
+	})
+}
+
+// RequestSync asks the gateway to re-broadcast every role, so a freshly
+// started service learns about the ones admins created.
+func (b *Broadcaster) RequestSync() error {
+	return b.publisher.Publish(&events.RoleEvent{
+		Id:   uuid.New(),
+		Type: events.RoleSyncRequest,
+	})
+}
@@ -0,0 +1,63 @@
+package permissions
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/role_events"
+	"sort"
+	"sync"
+)
+
+// Cache maps roles to their permissions for tokens that carry only roles.
+// It starts from the roles built into the policy and follows the changes
+// admins make, which the gateway broadcasts over NATS.
+type Cache struct {
+	mutex sync.RWMutex
+	roles map[string][]string
+}
+
+func NewCache(defaults map[string][]string) *Cache {
+	roles := make(map[string][]string, len(defaults))
+	for role, permissions := range defaults {
+		roles[role] = permissions
+	}
+	return &Cache{roles: roles}
+}
+
+func (c *Cache) Listen(subscriber saga.Subscriber) error {
+	return subscriber.Subscribe(c.handle)
+}
+
+func (c *Cache) handle(event *events.RoleEvent) {
+	c.Apply(event)
+}
+
+func (c *Cache) Apply(event *events.RoleEvent) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch event.Type {
+	case events.RoleUpdated:
+		c.roles[event.Role] = event.Permissions
+	case events.RoleDeleted:
+		delete(c.roles, event.Role)
+	}
+}
+
+// Resolve returns the union of the permissions of roles, sorted.
+func (c *Cache) Resolve(roles []string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	seen := map[string]bool{}
+	var result []string
+	for _, role := range roles {
+		for _, permission := range c.roles[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				result = append(result, permission)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,199 @@
+package policy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"sort"
+	"strings"
+)
+
+//go:embed policy.json
+var policyFile []byte
+
+var ErrNotOwner = errors.New("caller does not own the resource")
+
+// Rule says who may call an RPC or a route. Public rules need no token at
+// all; otherwise the caller needs a valid token granting Permission (if set)
+// and, when Owner is set, has to be the user that Owner names. For RPCs
+// Owner is a dotted path of request fields, for routes it is a path parameter.
+// QueryToken lets a route take the token from its access_token query
+// parameter, for browser clients like EventSource that can't set headers.
+// ApiToken marks public rules whose callers authenticate with an API token
+// the service checks itself; the gateway rate limits them separately.
+type Rule struct {
+	Public     bool   `json:"public,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+	QueryToken bool   `json:"queryToken,omitempty"`
+	ApiToken   bool   `json:"apiToken,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+// Policy is the authorization policy of the whole system: a rule for every
+// gRPC method, keyed by its full name, and for every route the gateway
+// handles itself, keyed by "METHOD /path/{param}". Routes the gateway
+// generates from the google.api.http options of a method inherit that
+// method's rule unless they are listed explicitly. Roles are the built-in
+// roles and their permissions; admins can change them at runtime.
+type Policy struct {
+	Rpcs   map[string]Rule     `json:"rpcs"`
+	Routes map[string]Rule     `json:"routes"`
+	Roles  map[string][]string `json:"roles"`
+	routes []route
+}
+
+// Load parses the policy file built into common and derives the routes of
+// every gRPC method registered in this binary.
+func Load() (*Policy, error) {
+	return Parse(policyFile)
+}
+
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	err = p.buildRoutes()
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) Rpc(fullMethod string) (Rule, bool) {
+	rule, ok := p.Rpcs[fullMethod]
+	return rule, ok
+}
+
+// Allows reports whether permissions include the one r requires.
+func (r Rule) Allows(permissions []string) bool {
+	if r.Permission == "" {
+		return true
+	}
+	for _, permission := range permissions {
+		if permission == r.Permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists every permission a rule or a built-in role mentions.
+// Roles can only be given permissions from this list.
+func (p *Policy) Permissions() []string {
+	seen := map[string]bool{}
+	for _, rule := range p.Rpcs {
+		seen[rule.Permission] = true
+	}
+	for _, rule := range p.Routes {
+		seen[rule.Permission] = true
+	}
+	for _, permissions := range p.Roles {
+		for _, permission := range permissions {
+			seen[permission] = true
+		}
+	}
+	delete(seen, "")
+	result := make([]string, 0, len(seen))
+	for permission := range seen {
+		result = append(result, permission)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// CheckOwner verifies that the request field named by r.Owner holds username.
+// Requests that don't have the field are refused.
+func (r Rule) CheckOwner(request interface{}, username string) error {
+	if r.Owner == "" {
+		return nil
+	}
+	message, ok := request.(interface{ ProtoReflect() protoreflect.Message })
+	if !ok {
+		return ErrNotOwner
+	}
+	owner, ok := fieldValue(message.ProtoReflect(), r.Owner)
+	if !ok || owner == "" || owner != username {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// CheckServer fails when a method served by server has no rule, or its rule
+// names an owner field its request doesn't have. Servers call it before
+// serving, so a new RPC can't ship unprotected by accident.
+func (p *Policy) CheckServer(server *grpc.Server) error {
+	var problems []string
+	for service, info := range server.GetServiceInfo() {
+		descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+		if err != nil {
+			return fmt.Errorf("policy: %w", err)
+		}
+		methods := descriptor.(protoreflect.ServiceDescriptor).Methods()
+		for _, method := range info.Methods {
+			fullMethod := "/" + service + "/" + method.Name
+			rule, ok := p.Rpcs[fullMethod]
+			if !ok {
+				problems = append(problems, fullMethod+": no rule")
+				continue
+			}
+			if rule.Owner == "" {
+				continue
+			}
+			input := methods.ByName(protoreflect.Name(method.Name)).Input()
+			if !hasStringField(input, rule.Owner) {
+				problems = append(problems, fmt.Sprintf("%s: %s has no string field %s", fullMethod, input.FullName(), rule.Owner))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("policy: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func fieldValue(message protoreflect.Message, path string) (string, bool) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		field := message.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			return "", false
+		}
+		if i == len(names)-1 {
+			if field.Kind() != protoreflect.StringKind || field.IsList() {
+				return "", false
+			}
+			return message.Get(field).String(), true
+		}
+		if field.Message() == nil || field.IsList() || !message.Has(field) {
+			return "", false
+		}
+		message = message.Get(field).Message()
+	}
+	return "", false
+}
+
+func hasStringField(message protoreflect.MessageDescriptor, path string) bool {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		field := message.Fields().ByName(protoreflect.Name(name))
+		if field == nil || field.IsList() {
+			return false
+		}
+		if i == len(names)-1 {
+			return field.Kind() == protoreflect.StringKind
+		}
+		if field.Message() == nil {
+			return false
+		}
+		message = field.Message()
+	}
+	return false
+}
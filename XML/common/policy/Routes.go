@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"fmt"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"sort"
+	"strings"
+)
+
+type segment struct {
+	literal string
+	param   string
+	rest    bool
+}
+
+type route struct {
+	method   string
+	key      string
+	segments []segment
+	rule     Rule
+	// missing is set for generated routes whose method has no rule.
+	missing string
+}
+
+// Route finds the rule of the route that serves method and path. Literal
+// segments win over parameters, so /users/sessions beats /users/{id}.
+func (p *Policy) Route(method string, path string) (Rule, map[string]string, bool) {
+	parts := splitPath(path)
+	var best *route
+	var bestParams map[string]string
+	for i := range p.routes {
+		candidate := &p.routes[i]
+		if candidate.method != method {
+			continue
+		}
+		params, ok := candidate.match(parts)
+		if !ok {
+			continue
+		}
+		if best == nil || moreSpecific(candidate, best) {
+			best, bestParams = candidate, params
+		}
+	}
+	if best == nil || best.missing != "" {
+		return Rule{}, nil, false
+	}
+	return best.rule, bestParams, true
+}
+
+// CheckRoutes fails when a route generated from a gRPC method has no rule.
+// The gateway calls it at startup, after every service is registered.
+func (p *Policy) CheckRoutes() error {
+	var problems []string
+	for _, r := range p.routes {
+		if r.missing != "" {
+			problems = append(problems, r.key+" ("+r.missing+"): no rule")
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("policy: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (p *Policy) buildRoutes() error {
+	for key, rule := range p.Routes {
+		r, err := parseRoute(key)
+		if err != nil {
+			return err
+		}
+		if rule.Owner != "" && !r.hasParam(rule.Owner) {
+			return fmt.Errorf("policy: %s has no path parameter %s", key, rule.Owner)
+		}
+		r.rule = rule
+		p.routes = append(p.routes, r)
+	}
+
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				p.addGeneratedRoutes(methods.Get(j))
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(p.routes, func(i, j int) bool {
+		return p.routes[i].key < p.routes[j].key
+	})
+	return nil
+}
+
+func (p *Policy) addGeneratedRoutes(method protoreflect.MethodDescriptor) {
+	options := method.Options()
+	if !proto.HasExtension(options, annotations.E_Http) {
+		return
+	}
+	binding := proto.GetExtension(options, annotations.E_Http).(*annotations.HttpRule)
+	fullMethod := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+	rule, known := p.Rpcs[fullMethod]
+
+	for _, b := range append([]*annotations.HttpRule{binding}, binding.GetAdditionalBindings()...) {
+		verb, path := httpPattern(b)
+		if path == "" {
+			continue
+		}
+		key := verb + " " + path
+		if _, explicit := p.Routes[key]; explicit {
+			continue
+		}
+		r, err := parseRoute(key)
+		if err != nil {
+			continue
+		}
+		if !known {
+			r.missing = fullMethod
+		} else {
+			r.rule = rule
+			// Owners in request bodies are checked by the service itself.
+			if !r.hasParam(rule.Owner) {
+				r.rule.Owner = ""
+			}
+		}
+		p.routes = append(p.routes, r)
+	}
+}
+
+func httpPattern(rule *annotations.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", pattern.Get
+	case *annotations.HttpRule_Post:
+		return "POST", pattern.Post
+	case *annotations.HttpRule_Put:
+		return "PUT", pattern.Put
+	case *annotations.HttpRule_Delete:
+		return "DELETE", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return "PATCH", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	}
+	return "", ""
+}
+
+func parseRoute(key string) (route, error) {
+	parts := strings.SplitN(key, " ", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+		return route{}, fmt.Errorf("policy: bad route %q, want \"METHOD /path\"", key)
+	}
+	r := route{method: parts[0], key: key}
+	for _, part := range splitPath(parts[1]) {
+		if !strings.HasPrefix(part, "{") {
+			r.segments = append(r.segments, segment{literal: part})
+			continue
+		}
+		if !strings.HasSuffix(part, "}") {
+			return route{}, fmt.Errorf("policy: bad route %q", key)
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+		rest := strings.HasSuffix(name, "=**")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "=**"), "=*")
+		r.segments = append(r.segments, segment{param: name, rest: rest})
+	}
+	return r, nil
+}
+
+func (r *route) match(parts []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, s := range r.segments {
+		if s.rest {
+			params[s.param] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		if s.param == "" {
+			if s.literal != parts[i] {
+				return nil, false
+			}
+			continue
+		}
+		params[s.param] = parts[i]
+	}
+	return params, len(parts) == len(r.segments)
+}
+
+func (r *route) hasParam(name string) bool {
+	for _, s := range r.segments {
+		if s.param != "" && s.param == name {
+			return true
+		}
+	}
+	return false
+}
+
+func moreSpecific(a *route, b *route) bool {
+	for i := 0; i < len(a.segments) && i < len(b.segments); i++ {
+		aLiteral, bLiteral := a.segments[i].param == "", b.segments[i].param == ""
+		if aLiteral != bLiteral {
+			return aLiteral
+		}
+	}
+	return false
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
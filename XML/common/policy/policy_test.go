@@ -0,0 +1,207 @@
+package policy
+
+import (
+	connectionService "common/module/proto/connection_service"
+	messageService "common/module/proto/message_service"
+	notificationService "common/module/proto/notification_service"
+	postService "common/module/proto/posts_service"
+	userService "common/module/proto/user_service"
+	"encoding/json"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"strings"
+	"testing"
+)
+
+// services are the descriptors of every service in the system. Importing
+// their packages registers them in protoregistry.
+var services = []protoreflect.FullName{
+	"user_service.UserService",
+	"post_service.PostService",
+	"connection_service.ConnectionService",
+	"message_service.MessageService",
+	"notification_service.NotificationService",
+}
+
+func load(t *testing.T) *Policy {
+	p, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// reparse builds a policy from p after edit changed its rules.
+func reparse(t *testing.T, p *Policy, edit func(p *Policy)) *Policy {
+	edit(p)
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changed
+}
+
+func serviceDescriptor(t *testing.T, name protoreflect.FullName) protoreflect.ServiceDescriptor {
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatalf("%s is not registered: %v", name, err)
+	}
+	return descriptor.(protoreflect.ServiceDescriptor)
+}
+
+func TestEveryRpcHasARule(t *testing.T) {
+	p := load(t)
+	for _, name := range services {
+		methods := serviceDescriptor(t, name).Methods()
+		for i := 0; i < methods.Len(); i++ {
+			method := methods.Get(i)
+			fullMethod := "/" + string(name) + "/" + string(method.Name())
+			rule, ok := p.Rpc(fullMethod)
+			if !ok {
+				t.Errorf("%s: no rule", fullMethod)
+				continue
+			}
+			if rule.Owner != "" && !hasStringField(method.Input(), rule.Owner) {
+				t.Errorf("%s: %s has no string field %s", fullMethod, method.Input().FullName(), rule.Owner)
+			}
+			if rule.Public && rule.Permission != "" {
+				t.Errorf("%s: public rules can't require a permission", fullMethod)
+			}
+		}
+	}
+}
+
+func TestEveryRuleHasAnRpc(t *testing.T) {
+	p := load(t)
+	for fullMethod := range p.Rpcs {
+		parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+		if len(parts) != 2 {
+			t.Errorf("%s: not a full method name", fullMethod)
+			continue
+		}
+		methods := serviceDescriptor(t, protoreflect.FullName(parts[0])).Methods()
+		if methods.ByName(protoreflect.Name(parts[1])) == nil {
+			t.Errorf("%s: no such method", fullMethod)
+		}
+	}
+}
+
+func TestRolesOnlyGrantKnownPermissions(t *testing.T) {
+	p := load(t)
+	required := map[string]bool{}
+	for _, rule := range p.Rpcs {
+		required[rule.Permission] = true
+	}
+	for _, rule := range p.Routes {
+		required[rule.Permission] = true
+	}
+	for role, permissions := range p.Roles {
+		for _, permission := range permissions {
+			if !required[permission] {
+				t.Errorf("role %s grants %s, which no rule requires", role, permission)
+			}
+		}
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	p := load(t)
+	err := p.CheckRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := reparse(t, load(t), func(p *Policy) {
+		delete(p.Rpcs, "/user_service.UserService/GetAll")
+	})
+	err = missing.CheckRoutes()
+	if err == nil || !strings.Contains(err.Error(), "GET /users (/user_service.UserService/GetAll): no rule") {
+		t.Fatalf("got %v, want the route of GetAll reported", err)
+	}
+	_, _, ok := missing.Route("GET", "/users")
+	if ok {
+		t.Fatal("a route without a rule was matched")
+	}
+}
+
+func TestCheckServer(t *testing.T) {
+	server := grpc.NewServer()
+	userService.RegisterUserServiceServer(server, &userService.UnimplementedUserServiceServer{})
+	postService.RegisterPostServiceServer(server, &postService.UnimplementedPostServiceServer{})
+	connectionService.RegisterConnectionServiceServer(server, &connectionService.UnimplementedConnectionServiceServer{})
+	messageService.RegisterMessageServiceServer(server, &messageService.UnimplementedMessageServiceServer{})
+	notificationService.RegisterNotificationServiceServer(server, &notificationService.UnimplementedNotificationServiceServer{})
+
+	err := load(t).CheckServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := reparse(t, load(t), func(p *Policy) {
+		delete(p.Rpcs, "/post_service.PostService/create")
+	})
+	err = missing.CheckServer(server)
+	if err == nil || !strings.Contains(err.Error(), "/post_service.PostService/create: no rule") {
+		t.Fatalf("got %v, want the method without a rule reported", err)
+	}
+
+	badOwner := reparse(t, load(t), func(p *Policy) {
+		rule := p.Rpcs["/user_service.UserService/EditUserDetails"]
+		rule.Owner = "userDetails.owner"
+		p.Rpcs["/user_service.UserService/EditUserDetails"] = rule
+	})
+	err = badOwner.CheckServer(server)
+	if err == nil || !strings.Contains(err.Error(), "has no string field userDetails.owner") {
+		t.Fatalf("got %v, want the unresolved owner reported", err)
+	}
+}
+
+func TestCheckOwner(t *testing.T) {
+	rule, _ := load(t).Rpc("/user_service.UserService/EditUserDetails")
+	request := &userService.UserDetailsRequest{UserDetails: &userService.UserDetails{Username: "alice"}}
+	if err := rule.CheckOwner(request, "alice"); err != nil {
+		t.Fatalf("owner refused: %v", err)
+	}
+	if err := rule.CheckOwner(request, "bob"); err != ErrNotOwner {
+		t.Fatalf("got %v for another user, want ErrNotOwner", err)
+	}
+	if err := rule.CheckOwner(&userService.UserDetailsRequest{}, ""); err != ErrNotOwner {
+		t.Fatalf("got %v for a request without an owner, want ErrNotOwner", err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	p := load(t)
+
+	rule, params, ok := p.Route("GET", "/users/alice/feed")
+	if !ok || rule.Owner != "username" || params["username"] != "alice" {
+		t.Fatalf("got %+v %v %v, want the feed owned by {username}", rule, params, ok)
+	}
+
+	rule, _, ok = p.Route("GET", "/users/sessions")
+	if !ok || rule.Public || rule.Owner != "" {
+		t.Fatalf("got %+v %v, want the session list, not a {username} route", rule, ok)
+	}
+
+	rule, _, ok = p.Route("GET", "/users")
+	if !ok || !rule.Public {
+		t.Fatalf("got %+v %v, want the public route generated from GetAll", rule, ok)
+	}
+
+	_, _, ok = p.Route("GET", "/nowhere")
+	if ok {
+		t.Fatal("an unknown route was matched")
+	}
+}
+
+func TestParseRejectsOwnerThatIsNotAPathParameter(t *testing.T) {
+	_, err := Parse([]byte(`{"routes": {"GET /users/{username}/feed": {"owner": "user"}}}`))
+	if err == nil {
+		t.Fatal("an owner that isn't a path parameter was accepted")
+	}
+}
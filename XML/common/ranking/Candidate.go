@@ -0,0 +1,22 @@
+package ranking
+
+import "time"
+
+// Candidate is a post that could be shown in a feed, with everything the
+// scorers look at. Callers fill in what they know; features left at zero
+// simply don't raise the score.
+type Candidate struct {
+	Id       string
+	Author   string
+	Posted   time.Time
+	Likes    int
+	Dislikes int
+	Comments int
+	// MutualConnections counts the users connected to both the reader and
+	// the author.
+	MutualConnections int
+	// SharedSkills and SharedInterests count what the reader's and the
+	// author's profiles have in common.
+	SharedSkills    int
+	SharedInterests int
+}
@@ -0,0 +1,68 @@
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+// Session is one reader replayed by an evaluation: the posts their feed
+// could have shown and the ones they went on to engage with.
+type Session struct {
+	Reader     string
+	Candidates []Candidate
+	Relevant   map[string]bool
+}
+
+// Result summarizes how well a ranker put the relevant posts of every
+// session in its top K.
+type Result struct {
+	Ranker   string
+	Sessions int
+	K        int
+	// HitRate is the share of sessions with a relevant post in the top K.
+	HitRate float64
+	// Precision is the mean share of the top K that is relevant.
+	Precision float64
+	// NDCG is the mean normalized discounted cumulative gain at K.
+	NDCG float64
+}
+
+// Evaluate ranks every session's candidates as of now and scores the result.
+// Sessions without relevant posts are skipped.
+func Evaluate(r *Ranker, sessions []Session, k int, now time.Time) Result {
+	result := Result{Ranker: r.String(), K: k}
+	for _, session := range sessions {
+		if len(session.Relevant) == 0 {
+			continue
+		}
+		candidates := append([]Candidate(nil), session.Candidates...)
+		r.Rank(candidates, now)
+
+		hits, gain, ideal := 0, 0.0, 0.0
+		for i := 0; i < k && i < len(candidates); i++ {
+			discount := 1 / math.Log2(float64(i+2))
+			if session.Relevant[candidates[i].Id] {
+				hits++
+				gain += discount
+			}
+			if i < len(session.Relevant) {
+				ideal += discount
+			}
+		}
+		result.Sessions++
+		if hits > 0 {
+			result.HitRate++
+		}
+		result.Precision += float64(hits) / float64(k)
+		if ideal > 0 {
+			result.NDCG += gain / ideal
+		}
+	}
+	if result.Sessions > 0 {
+		n := float64(result.Sessions)
+		result.HitRate /= n
+		result.Precision /= n
+		result.NDCG /= n
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package ranking
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Latest orders a feed newest first.
+	Latest = "recency:1"
+	// Top is the ranker the feed's "top" mode uses unless configured.
+	Top = "recency:1,engagement:0.6,closeness:0.4,overlap:0.2"
+)
+
+type weighted struct {
+	name   string
+	scorer Scorer
+	weight float64
+}
+
+// Ranker orders candidates by the weighted sum of its scorers.
+type Ranker struct {
+	spec    string
+	scorers []weighted
+}
+
+// Parse builds a ranker from a spec such as "recency:1,engagement:0.5",
+// naming registered scorers and their weights.
+func Parse(spec string) (*Ranker, error) {
+	r := &Ranker{spec: spec}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		nameWeight := strings.SplitN(part, ":", 2)
+		name := strings.TrimSpace(nameWeight[0])
+		scorer, ok := scorers[name]
+		if !ok {
+			return nil, fmt.Errorf("ranking: unknown scorer %q, want one of %s", name, strings.Join(Scorers(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("ranking: scorer %q given twice", name)
+		}
+		seen[name] = true
+		weight := 1.0
+		if len(nameWeight) == 2 {
+			var err error
+			weight, err = strconv.ParseFloat(strings.TrimSpace(nameWeight[1]), 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("ranking: bad weight for %q", name)
+			}
+		}
+		r.scorers = append(r.scorers, weighted{name, scorer, weight})
+	}
+	if len(r.scorers) == 0 {
+		return nil, fmt.Errorf("ranking: empty ranker %q", spec)
+	}
+	return r, nil
+}
+
+func (r *Ranker) String() string {
+	return r.spec
+}
+
+// Uses reports whether the scorer called name counts in r, so callers can
+// skip gathering features nothing looks at.
+func (r *Ranker) Uses(name string) bool {
+	for _, s := range r.scorers {
+		if s.name == name && s.weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Ranker) Score(candidate Candidate, now time.Time) float64 {
+	score := 0.0
+	for _, s := range r.scorers {
+		if s.weight > 0 {
+			score += s.weight * s.scorer(candidate, now)
+		}
+	}
+	return score
+}
+
+// Rank sorts candidates in place, best first. Equal scores fall back to the
+// newest post, then to the id, so the order is stable between calls.
+func (r *Ranker) Rank(candidates []Candidate, now time.Time) {
+	scores := make(map[string]float64, len(candidates))
+	for _, candidate := range candidates {
+		scores[candidate.Id] = r.Score(candidate, now)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if scores[a.Id] != scores[b.Id] {
+			return scores[a.Id] > scores[b.Id]
+		}
+		if !a.Posted.Equal(b.Posted) {
+			return a.Posted.After(b.Posted)
+		}
+		return a.Id > b.Id
+	})
+}
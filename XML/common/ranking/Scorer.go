@@ -0,0 +1,67 @@
+package ranking
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// A Scorer rates a candidate between 0 and 1, higher meaning more worth
+// showing at now.
+type Scorer func(candidate Candidate, now time.Time) float64
+
+// RecencyHalfLife is how long it takes a post to lose half its recency score.
+var RecencyHalfLife = 24 * time.Hour
+
+var scorers = map[string]Scorer{
+	"recency":    Recency,
+	"engagement": Engagement,
+	"closeness":  Closeness,
+	"overlap":    Overlap,
+}
+
+// Register makes scorer usable in ranker specs under name, replacing any
+// scorer registered under it before. Call it before parsing specs.
+func Register(name string, scorer Scorer) {
+	scorers[name] = scorer
+}
+
+// Scorers lists the names specs can use.
+func Scorers() []string {
+	names := make([]string, 0, len(scorers))
+	for name := range scorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Recency(candidate Candidate, now time.Time) float64 {
+	age := now.Sub(candidate.Posted)
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(RecencyHalfLife))
+}
+
+// Engagement favours posts people reacted to and discussed; a comment counts
+// twice as much as a like and a dislike takes a like away.
+func Engagement(candidate Candidate, _ time.Time) float64 {
+	return saturate(float64(candidate.Likes+2*candidate.Comments-candidate.Dislikes), 10)
+}
+
+func Closeness(candidate Candidate, _ time.Time) float64 {
+	return saturate(float64(candidate.MutualConnections), 5)
+}
+
+func Overlap(candidate Candidate, _ time.Time) float64 {
+	return saturate(float64(candidate.SharedSkills+candidate.SharedInterests), 3)
+}
+
+// saturate maps [0, inf) onto [0, 1), reaching 1/2 at half.
+func saturate(value float64, half float64) float64 {
+	if value <= 0 {
+		return 0
+	}
+	return value / (value + half)
+}
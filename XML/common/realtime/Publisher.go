@@ -0,0 +1,39 @@
+package realtime
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/realtime_events"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// BroadcastGroup is the queue group gateways subscribe with: a user can be
+// connected to any instance, so every instance sees every event.
+const BroadcastGroup = ""
+
+// Publisher hands events for connected users to the gateway, which streams
+// them to the recipient's open connections.
+type Publisher struct {
+	publisher saga.Publisher
+}
+
+func NewPublisher(publisher saga.Publisher) *Publisher {
+	return &Publisher{publisher: publisher}
+}
+
+// Publish sends payload, encoded as JSON, to recipient as an event of type
+// eventType.
+func (p *Publisher) Publish(recipient string, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return p.publisher.Publish(&events.RealtimeEvent{
+		Id:        uuid.New(),
+		Recipient: recipient,
+		Type:      eventType,
+		Payload:   data,
+		CreatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,102 @@
+package revocation
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/revocation_events"
+	"sync"
+	"time"
+)
+
+// List is the per-service cache of revoked tokens and sessions, kept current
+// by the revocation events broadcast over NATS.
+type List struct {
+	mutex     sync.RWMutex
+	tokens    map[string]time.Time
+	sessions  map[string]time.Time
+	users     map[string]time.Time
+	userUntil map[string]time.Time
+}
+
+func NewList() *List {
+	return &List{
+		tokens:    make(map[string]time.Time),
+		sessions:  make(map[string]time.Time),
+		users:     make(map[string]time.Time),
+		userUntil: make(map[string]time.Time),
+	}
+}
+
+func (l *List) Listen(subscriber saga.Subscriber) error {
+	return subscriber.Subscribe(l.handle)
+}
+
+func (l *List) handle(event *events.RevocationEvent) {
+	l.Apply(event)
+}
+
+func (l *List) Apply(event *events.RevocationEvent) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	switch event.Type {
+	case events.RevokeToken:
+		if event.TokenId != "" {
+			l.tokens[event.TokenId] = event.ExpiresAt
+		}
+	case events.RevokeSession:
+		if event.SessionId != "" {
+			l.sessions[event.SessionId] = event.ExpiresAt
+		}
+	case events.RevokeUserSessions:
+		if event.Username == "" {
+			return
+		}
+		if revokedAt, ok := l.users[event.Username]; !ok || event.RevokedAt.After(revokedAt) {
+			l.users[event.Username] = event.RevokedAt
+			l.userUntil[event.Username] = event.ExpiresAt
+		}
+	}
+	l.prune(time.Now())
+}
+
+func (l *List) IsRevoked(tokenId string, sessionId string, username string, issuedAt int64) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if tokenId != "" {
+		if _, ok := l.tokens[tokenId]; ok {
+			return true
+		}
+	}
+	if sessionId != "" {
+		if _, ok := l.sessions[sessionId]; ok {
+			return true
+		}
+	}
+	// Tokens only carry whole seconds, so a token issued in the second of a
+	// revocation is kept: that is the one a user gets by logging in again
+	// right after changing their password.
+	if revokedAt, ok := l.users[username]; ok && issuedAt < revokedAt.Unix() {
+		return true
+	}
+	return false
+}
+
+func (l *List) prune(now time.Time) {
+	for tokenId, expiresAt := range l.tokens {
+		if expiresAt.Before(now) {
+			delete(l.tokens, tokenId)
+		}
+	}
+	for sessionId, expiresAt := range l.sessions {
+		if expiresAt.Before(now) {
+			delete(l.sessions, sessionId)
+		}
+	}
+	for username, until := range l.userUntil {
+		if until.Before(now) {
+			delete(l.users, username)
+			delete(l.userUntil, username)
+		}
+	}
+}
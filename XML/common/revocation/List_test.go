@@ -0,0 +1,47 @@
+package revocation
+
+import (
+	events "common/module/saga/revocation_events"
+	"testing"
+	"time"
+)
+
+func TestIsRevoked(t *testing.T) {
+	now := time.Now()
+	list := NewList()
+	list.Apply(&events.RevocationEvent{Type: events.RevokeToken, TokenId: "token", ExpiresAt: now.Add(time.Hour)})
+	list.Apply(&events.RevocationEvent{Type: events.RevokeSession, SessionId: "session", ExpiresAt: now.Add(time.Hour)})
+	list.Apply(&events.RevocationEvent{Type: events.RevokeUserSessions, Username: "alice", RevokedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	cases := []struct {
+		name      string
+		tokenId   string
+		sessionId string
+		username  string
+		issuedAt  int64
+		revoked   bool
+	}{
+		{"revoked token", "token", "", "bob", now.Unix(), true},
+		{"revoked session", "other", "session", "bob", now.Unix(), true},
+		{"other token", "other", "other", "bob", now.Unix(), false},
+		{"issued before the user's revocation", "other", "other", "alice", now.Unix() - 1, true},
+		{"issued in the second of the user's revocation", "other", "other", "alice", now.Unix(), false},
+		{"issued after the user's revocation", "other", "other", "alice", now.Unix() + 1, false},
+	}
+	for _, c := range cases {
+		if revoked := list.IsRevoked(c.tokenId, c.sessionId, c.username, c.issuedAt); revoked != c.revoked {
+			t.Errorf("%s: revoked %v, want %v", c.name, revoked, c.revoked)
+		}
+	}
+}
+
+func TestApplyKeepsTheLatestUserRevocation(t *testing.T) {
+	now := time.Now()
+	list := NewList()
+	list.Apply(&events.RevocationEvent{Type: events.RevokeUserSessions, Username: "alice", RevokedAt: now, ExpiresAt: now.Add(time.Hour)})
+	list.Apply(&events.RevocationEvent{Type: events.RevokeUserSessions, Username: "alice", RevokedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)})
+
+	if !list.IsRevoked("", "", "alice", now.Unix()-1) {
+		t.Fatal("an older revocation replaced a newer one")
+	}
+}
@@ -0,0 +1,71 @@
+package revocation
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/revocation_events"
+	"github.com/google/uuid"
+	"time"
+)
+
+// BroadcastGroup is used as the queue group for revocation subscribers so
+// that every service instance receives every event instead of sharing them.
+const BroadcastGroup = ""
+
+// SessionLifetime is the longest lifetime of any token we issue (API tokens),
+// after which a "revoke all sessions" entry no longer matches anything.
+const SessionLifetime = 720 * time.Hour
+
+type Revoker struct {
+	publisher saga.Publisher
+}
+
+func NewRevoker(publisher saga.Publisher) *Revoker {
+	return &Revoker{publisher: publisher}
+}
+
+func (r *Revoker) RevokeToken(tokenId string, expiresAt time.Time) error {
+	return r.publisher.Publish(&events.RevocationEvent{
+		Id:        uuid.New(),
+		Type:      events.RevokeToken,
+		TokenId:   tokenId,
+		RevokedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RevokeSession invalidates every access token issued for one login.
+// expiresAt is when the last of them expires on its own.
+func (r *Revoker) RevokeSession(sessionId string, expiresAt time.Time) error {
+	return r.publisher.Publish(&events.RevocationEvent{
+		Id:        uuid.New(),
+		Type:      events.RevokeSession,
+		SessionId: sessionId,
+		RevokedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RevokeUserSessions invalidates every token issued to the user up to now.
+func (r *Revoker) RevokeUserSessions(username string) error {
+	now := time.Now().UTC()
+	return r.publisher.Publish(&events.RevocationEvent{
+		Id:        uuid.New(),
+		Type:      events.RevokeUserSessions,
+		Username:  username,
+		RevokedAt: now,
+		ExpiresAt: now.Add(SessionLifetime),
+	})
+}
+
+// RequestSync asks the owner of the revocation store to re-broadcast every
+// revocation that is still active, so a freshly started service catches up.
+func (r *Revoker) RequestSync() error {
+	return r.publisher.Publish(&events.RevocationEvent{
+		Id:   uuid.New(),
+		Type: events.SyncRequest,
+	})
+}
+
+func (r *Revoker) Publish(event *events.RevocationEvent) error {
+	return r.publisher.Publish(event)
+}
@@ -0,0 +1,27 @@
+package change_events
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type ChangeEventType int8
+
+const (
+	UserUpdated ChangeEventType = iota
+	PostCreated
+	PostUpdated
+	JobOfferCreated
+	UnknownChangeEvent
+)
+
+// ChangeEvent tells the gateway that something it may have cached changed.
+// User events name the user in Username; post events name the post in Post
+// and its author in Username; job offer events name the publisher.
+type ChangeEvent struct {
+	Id        uuid.UUID
+	Type      ChangeEventType
+	Username  string
+	Post      string
+	ChangedAt time.Time
+}
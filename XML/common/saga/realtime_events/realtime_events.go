@@ -0,0 +1,24 @@
+package realtime_events
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Names of the events clients listen for.
+const (
+	Notification = "notification"
+	Message      = "message"
+)
+
+// RealtimeEvent is something a service wants one user to see right away.
+// The gateway delivers it to the connections of Recipient only; Type is the
+// event name clients listen for and Payload its JSON body.
+type RealtimeEvent struct {
+	Id        uuid.UUID
+	Recipient string
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
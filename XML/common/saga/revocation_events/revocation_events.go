@@ -0,0 +1,26 @@
+package revocation_events
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type RevocationEventType int8
+
+const (
+	RevokeToken RevocationEventType = iota
+	RevokeUserSessions
+	SyncRequest
+	RevokeSession
+	UnknownEvent
+)
+
+type RevocationEvent struct {
+	Id        uuid.UUID
+	Type      RevocationEventType
+	TokenId   string
+	SessionId string
+	Username  string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,21 @@
+package role_events
+
+import (
+	"github.com/google/uuid"
+)
+
+type RoleEventType int8
+
+const (
+	RoleUpdated RoleEventType = iota
+	RoleDeleted
+	RoleSyncRequest
+	UnknownRoleEvent
+)
+
+type RoleEvent struct {
+	Id          uuid.UUID
+	Type        RoleEventType
+	Role        string
+	Permissions []string
+}
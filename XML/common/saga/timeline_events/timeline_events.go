@@ -0,0 +1,28 @@
+package timeline_events
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type TimelineEventType int8
+
+const (
+	PostCreated TimelineEventType = iota
+	UsersConnected
+	UsersDisconnected
+	UnknownTimelineEvent
+)
+
+// TimelineEvent is published by the services that change what belongs in a
+// user's home timeline. Post events fill in Post, Author and DatePosted;
+// connection events name the two users in UserOne and UserTwo.
+type TimelineEvent struct {
+	Id         uuid.UUID
+	Type       TimelineEventType
+	Post       string
+	Author     string
+	DatePosted time.Time
+	UserOne    string
+	UserTwo    string
+}
@@ -0,0 +1,48 @@
+package timeline
+
+import (
+	saga "common/module/saga/messaging"
+	events "common/module/saga/timeline_events"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Publisher tells the timeline worker about posts and connections. The
+// worker keeps the timelines, so the services only describe what happened.
+type Publisher struct {
+	publisher saga.Publisher
+}
+
+func NewPublisher(publisher saga.Publisher) *Publisher {
+	return &Publisher{publisher: publisher}
+}
+
+func (p *Publisher) PostCreated(post string, author string, datePosted time.Time) error {
+	return p.publisher.Publish(&events.TimelineEvent{
+		Id:         uuid.New(),
+		Type:       events.PostCreated,
+		Post:       post,
+		Author:     author,
+		DatePosted: datePosted,
+	})
+}
+
+func (p *Publisher) UsersConnected(userOne string, userTwo string) error {
+	return p.publisher.Publish(&events.TimelineEvent{
+		Id:      uuid.New(),
+		Type:    events.UsersConnected,
+		UserOne: userOne,
+		UserTwo: userTwo,
+	})
+}
+
+// UsersDisconnected is published when two users stop being connected, which
+// blocking does too; each of them loses the other's posts.
+func (p *Publisher) UsersDisconnected(userOne string, userTwo string) error {
+	return p.publisher.Publish(&events.TimelineEvent{
+		Id:      uuid.New(),
+		Type:    events.UsersDisconnected,
+		UserOne: userOne,
+		UserTwo: userTwo,
+	})
+}
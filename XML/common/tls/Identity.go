@@ -0,0 +1,178 @@
+package tls
+
+import (
+	"common/module/logger"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("CA bundle holds no certificates")
+
+// Identity is the certificate a service presents to its peers, its key, and
+// the CA bundle it trusts theirs with. Certificates are issued by the PKI and
+// stored as PEM files; Watch reloads them when they are rotated, so new
+// connections use the new ones without a restart.
+type Identity struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	logError *logger.Logger
+
+	// revocation is nil when revocation isn't checked.
+	revocation *RevocationChecker
+
+	mutex       sync.RWMutex
+	certificate *gotls.Certificate
+	roots       *x509.CertPool
+	loaded      map[string]time.Time
+}
+
+func LoadIdentity(certFile string, keyFile string, caFile string, logError *logger.Logger) (*Identity, error) {
+	identity := &Identity{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		logError: logError,
+	}
+	err := identity.load()
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// Watch checks the files every interval and reloads them when one changed.
+// A broken rotation is logged and the identity keeps what it had.
+func (i *Identity) Watch(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if !i.changed() {
+				continue
+			}
+			err := i.load()
+			if err != nil {
+				i.logError.Logger.WithFields(logrus.Fields{
+					"cert": i.certFile,
+					"ca":   i.caFile,
+				}).Errorf("ERR:RELOADING TLS IDENTITY: %v", err)
+			}
+		}
+	}()
+}
+
+// CheckRevocation makes handshakes refuse peers whose certificate, or one
+// of its issuers, the checker finds revoked. Call it before handing out
+// credentials.
+func (i *Identity) CheckRevocation(checker *RevocationChecker) {
+	i.revocation = checker
+}
+
+// ServerCredentials accept only clients whose certificate chains to the CA
+// bundle and names one of allowed.
+func (i *Identity) ServerCredentials(allowed []string) credentials.TransportCredentials {
+	return credentials.NewTLS(&gotls.Config{
+		MinVersion: gotls.VersionTLS12,
+		ClientAuth: gotls.RequireAnyClientCert,
+		GetCertificate: func(*gotls.ClientHelloInfo) (*gotls.Certificate, error) {
+			return i.current()
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return i.verifyPeer(rawCerts, x509.ExtKeyUsageClientAuth, allowed)
+		},
+	})
+}
+
+// ClientCredentials present the identity to the service named peer and
+// accept only a server certificate that names it.
+func (i *Identity) ClientCredentials(peer string) credentials.TransportCredentials {
+	return credentials.NewTLS(&gotls.Config{
+		MinVersion: gotls.VersionTLS12,
+		// The chain and the name are checked in VerifyPeerCertificate, against
+		// the CA bundle loaded last.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*gotls.CertificateRequestInfo) (*gotls.Certificate, error) {
+			return i.current()
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return i.verifyPeer(rawCerts, x509.ExtKeyUsageServerAuth, []string{peer})
+		},
+	})
+}
+
+func (i *Identity) current() (*gotls.Certificate, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.certificate, nil
+}
+
+func (i *Identity) pool() *x509.CertPool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.roots
+}
+
+func (i *Identity) load() error {
+	loaded := i.modTimes()
+	certificate, err := gotls.LoadX509KeyPair(i.certFile, i.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	bundle, err := os.ReadFile(i.caFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		return fmt.Errorf("tls: %s: %w", i.caFile, ErrNoCertificates)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.certificate = &certificate
+	i.roots = roots
+	i.loaded = loaded
+	return nil
+}
+
+func (i *Identity) changed() bool {
+	current := i.modTimes()
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	for file, modified := range current {
+		if !modified.Equal(i.loaded[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Identity) modTimes() map[string]time.Time {
+	times := map[string]time.Time{}
+	for _, file := range []string{i.certFile, i.keyFile, i.caFile} {
+		info, err := os.Stat(file)
+		if err == nil {
+			times[file] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// Peers parses a comma separated allow-list of peer names.
+func Peers(list string) []string {
+	var peers []string
+	for _, peer := range strings.Split(list, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
@@ -0,0 +1,256 @@
+package tls
+
+import (
+	"bytes"
+	"common/module/logger"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRevoked           = errors.New("certificate is revoked")
+	ErrRevocationUnknown = errors.New("revocation status is unknown")
+)
+
+// revocationFetchTimeout bounds each CRL download and OCSP request, which
+// run while a handshake waits.
+const revocationFetchTimeout = 5 * time.Second
+
+// RevocationConfig says where revocation is published. CRLs are downloaded
+// from every CrlUrls entry, OCSP requests go to OcspUrl. Answers are cached
+// until their next update, but never longer than Refresh. A CRL that can't
+// be downloaded again is used for one more Refresh; after that the status
+// of the certificates it covers is unknown. With FailOpen a
+// certificate whose status can't be learned is accepted; otherwise it is
+// refused. Revoked certificates are always refused.
+type RevocationConfig struct {
+	CrlUrls  []string
+	OcspUrl  string
+	FailOpen bool
+	Refresh  time.Duration
+}
+
+// ParseRevocationConfig reads the configuration from the strings services
+// keep in their environment.
+func ParseRevocationConfig(crlUrls string, ocspUrl string, failOpen string, refresh string) (RevocationConfig, error) {
+	config := RevocationConfig{CrlUrls: Peers(crlUrls), OcspUrl: ocspUrl}
+	var err error
+	config.FailOpen, err = strconv.ParseBool(failOpen)
+	if err != nil {
+		return config, fmt.Errorf("tls: fail open: %w", err)
+	}
+	config.Refresh, err = time.ParseDuration(refresh)
+	if err != nil || config.Refresh <= 0 {
+		return config, fmt.Errorf("tls: invalid refresh %q", refresh)
+	}
+	return config, nil
+}
+
+// Enabled reports whether anything publishes revocation to check against.
+func (c RevocationConfig) Enabled() bool {
+	return len(c.CrlUrls) > 0 || c.OcspUrl != ""
+}
+
+type cachedCrl struct {
+	list    *pkix.CertificateList
+	expires time.Time
+	// stale is when the list stops being used even while its publisher
+	// is down.
+	stale time.Time
+}
+
+type cachedOcsp struct {
+	status  int
+	expires time.Time
+}
+
+// RevocationChecker learns whether peer certificates were revoked, from
+// OCSP first and from CRLs when the responder can't tell.
+type RevocationChecker struct {
+	config   RevocationConfig
+	client   *http.Client
+	logError *logger.Logger
+	mutex    sync.Mutex
+	crls     map[string]cachedCrl
+	ocsp     map[string]cachedOcsp
+}
+
+func NewRevocationChecker(config RevocationConfig, logError *logger.Logger) *RevocationChecker {
+	return &RevocationChecker{
+		config:   config,
+		client:   &http.Client{Timeout: revocationFetchTimeout},
+		logError: logError,
+		crls:     map[string]cachedCrl{},
+		ocsp:     map[string]cachedOcsp{},
+	}
+}
+
+// CheckChain checks every certificate of a verified chain but its root.
+func (c *RevocationChecker) CheckChain(chain []*x509.Certificate) error {
+	for i := 0; i+1 < len(chain); i++ {
+		err := c.Check(chain[i], chain[i+1])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check checks certificate, which issuer signed.
+func (c *RevocationChecker) Check(certificate *x509.Certificate, issuer *x509.Certificate) error {
+	fields := logrus.Fields{
+		"serial": certificate.SerialNumber.String(),
+		"names":  Names(certificate),
+	}
+	status, source, err := c.status(certificate, issuer)
+	switch {
+	case status == ocsp.Revoked:
+		fields["source"] = source
+		c.logError.Logger.WithFields(fields).Errorf("ERR:PEER CERTIFICATE REVOKED")
+		return ErrRevoked
+	case status == ocsp.Good:
+		return nil
+	case c.config.FailOpen:
+		c.logError.Logger.WithFields(fields).Errorf("ERR:REVOCATION STATUS UNKNOWN, ACCEPTING PEER: %v", err)
+		return nil
+	default:
+		c.logError.Logger.WithFields(fields).Errorf("ERR:REVOCATION STATUS UNKNOWN, REFUSING PEER: %v", err)
+		return ErrRevocationUnknown
+	}
+}
+
+func (c *RevocationChecker) status(certificate *x509.Certificate, issuer *x509.Certificate) (int, string, error) {
+	var problems []error
+	if c.config.OcspUrl != "" {
+		status, err := c.ocspStatus(certificate, issuer)
+		if err != nil {
+			problems = append(problems, err)
+		} else if status != ocsp.Unknown {
+			return status, "ocsp", nil
+		}
+	}
+
+	checked := false
+	for _, url := range c.config.CrlUrls {
+		list, err := c.crl(url)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		// A CRL another CA signed says nothing about certificate.
+		if issuer.CheckCRLSignature(list) != nil {
+			continue
+		}
+		checked = true
+		for _, revoked := range list.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+				return ocsp.Revoked, "crl", nil
+			}
+		}
+	}
+	if checked {
+		return ocsp.Good, "crl", nil
+	}
+	if len(problems) == 0 {
+		problems = append(problems, errors.New("no CRL from its issuer"))
+	}
+	return ocsp.Unknown, "", fmt.Errorf("%v", problems)
+}
+
+func (c *RevocationChecker) ocspStatus(certificate *x509.Certificate, issuer *x509.Certificate) (int, error) {
+	key := string(issuer.RawSubjectPublicKeyInfo) + certificate.SerialNumber.String()
+	c.mutex.Lock()
+	cached, ok := c.ocsp[key]
+	c.mutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.status, nil
+	}
+
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	body, err := c.fetch(http.MethodPost, c.config.OcspUrl, request)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	response, err := ocsp.ParseResponseForCert(body, certificate, issuer)
+	if err != nil {
+		return ocsp.Unknown, fmt.Errorf("ocsp: %w", err)
+	}
+	c.mutex.Lock()
+	c.ocsp[key] = cachedOcsp{status: response.Status, expires: c.expiry(response.NextUpdate)}
+	c.mutex.Unlock()
+	return response.Status, nil
+}
+
+func (c *RevocationChecker) crl(url string) (*pkix.CertificateList, error) {
+	c.mutex.Lock()
+	cached, ok := c.crls[url]
+	c.mutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.list, nil
+	}
+
+	body, err := c.fetch(http.MethodGet, url, nil)
+	if err != nil {
+		// An expired CRL beats none while its publisher is down, but not
+		// for long: certificates revoked since wouldn't be noticed.
+		if ok && time.Now().Before(cached.stale) {
+			c.logError.Logger.WithFields(logrus.Fields{
+				"url": url,
+			}).Errorf("ERR:CRL NOT REFRESHED, USING THE CACHED ONE: %v", err)
+			return cached.list, nil
+		}
+		return nil, err
+	}
+	list, err := x509.ParseCRL(body)
+	if err != nil {
+		return nil, fmt.Errorf("crl %s: %w", url, err)
+	}
+	expires := c.expiry(list.TBSCertList.NextUpdate)
+	stale := expires.Add(c.config.Refresh)
+	if time.Now().After(stale) {
+		return nil, fmt.Errorf("crl %s: out of date since %s", url, list.TBSCertList.NextUpdate)
+	}
+	c.mutex.Lock()
+	c.crls[url] = cachedCrl{list: list, expires: expires, stale: stale}
+	c.mutex.Unlock()
+	return list, nil
+}
+
+func (c *RevocationChecker) expiry(nextUpdate time.Time) time.Time {
+	expires := time.Now().Add(c.config.Refresh)
+	if !nextUpdate.IsZero() && nextUpdate.Before(expires) {
+		return nextUpdate
+	}
+	return expires
+}
+
+func (c *RevocationChecker) fetch(method string, url string, body []byte) ([]byte, error) {
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		request.Header.Set("Content-Type", "application/ocsp-request")
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", method, url, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
@@ -0,0 +1,352 @@
+package tls
+
+import (
+	"common/module/logger"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/ocsp"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCa struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCa(t *testing.T, name string) *testCa {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCa{certificate, key}
+}
+
+func (ca *testCa) issue(t *testing.T, serial int64, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+// crl lists revoked, signed by ca, valid until nextUpdate.
+func (ca *testCa) crl(t *testing.T, nextUpdate time.Time, revoked ...*big.Int) []byte {
+	var entries []pkix.RevokedCertificate
+	for _, serial := range revoked {
+		entries = append(entries, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	thisUpdate := time.Now().Add(-time.Minute)
+	if nextUpdate.Before(thisUpdate) {
+		thisUpdate = nextUpdate.Add(-time.Minute)
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:          thisUpdate,
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: entries,
+	}, ca.certificate, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// publisher is an OCSP responder or a CRL server. It answers with whatever
+// respond returns, or fails while it is down, and counts its requests.
+type publisher struct {
+	mutex    sync.Mutex
+	respond  func(body []byte) []byte
+	down     bool
+	requests int
+	server   *httptest.Server
+}
+
+func newPublisher(t *testing.T, respond func(body []byte) []byte) *publisher {
+	p := &publisher{respond: respond}
+	p.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.requests++
+		if p.down {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = rw.Write(p.respond(body))
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *publisher) setDown(down bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.down = down
+}
+
+func (p *publisher) count() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.requests
+}
+
+// ocspResponder answers every request for a certificate of ca with status.
+func ocspResponder(t *testing.T, ca *testCa, status int, nextUpdate time.Time) *publisher {
+	return newPublisher(t, func(body []byte) []byte {
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			t.Errorf("ocsp request: %v", err)
+			return nil
+		}
+		template := ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   nextUpdate,
+		}
+		if status == ocsp.Revoked {
+			template.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		response, err := ocsp.CreateResponse(ca.certificate, ca.certificate, template, ca.key)
+		if err != nil {
+			t.Errorf("ocsp response: %v", err)
+		}
+		return response
+	})
+}
+
+func crlServer(t *testing.T, crl []byte) *publisher {
+	return newPublisher(t, func([]byte) []byte {
+		return crl
+	})
+}
+
+func newTestChecker(config RevocationConfig) *RevocationChecker {
+	l, _ := logtest.NewNullLogger()
+	if config.Refresh == 0 {
+		config.Refresh = time.Hour
+	}
+	return NewRevocationChecker(config, &logger.Logger{Logger: l})
+}
+
+func TestOcspStatuses(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	cases := []struct {
+		name     string
+		status   int
+		failOpen bool
+		want     error
+	}{
+		{"good", ocsp.Good, false, nil},
+		{"revoked", ocsp.Revoked, false, ErrRevoked},
+		{"revoked with fail open", ocsp.Revoked, true, ErrRevoked},
+		{"unknown", ocsp.Unknown, false, ErrRevocationUnknown},
+		{"unknown with fail open", ocsp.Unknown, true, nil},
+	}
+	for _, c := range cases {
+		responder := ocspResponder(t, ca, c.status, time.Now().Add(time.Hour))
+		checker := newTestChecker(RevocationConfig{OcspUrl: responder.server.URL, FailOpen: c.failOpen})
+		err := checker.Check(leaf, ca.certificate)
+		if err != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestCrlStatuses(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	good := ca.issue(t, 2, "user_service")
+	revoked := ca.issue(t, 3, "post_service")
+	server := crlServer(t, ca.crl(t, time.Now().Add(time.Hour), revoked.SerialNumber))
+	checker := newTestChecker(RevocationConfig{CrlUrls: []string{server.server.URL}})
+
+	if err := checker.Check(good, ca.certificate); err != nil {
+		t.Errorf("good certificate: %v", err)
+	}
+	if err := checker.Check(revoked, ca.certificate); err != ErrRevoked {
+		t.Errorf("revoked certificate: got %v, want ErrRevoked", err)
+	}
+	if server.count() != 1 {
+		t.Errorf("the CRL was downloaded %d times, want once", server.count())
+	}
+}
+
+func TestOcspUnknownFallsBackToCrl(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	responder := ocspResponder(t, ca, ocsp.Unknown, time.Now().Add(time.Hour))
+	server := crlServer(t, ca.crl(t, time.Now().Add(time.Hour), leaf.SerialNumber))
+	checker := newTestChecker(RevocationConfig{OcspUrl: responder.server.URL, CrlUrls: []string{server.server.URL}})
+
+	if err := checker.Check(leaf, ca.certificate); err != ErrRevoked {
+		t.Fatalf("got %v, want the revocation from the CRL", err)
+	}
+}
+
+func TestUnreachablePublishers(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	responder := ocspResponder(t, ca, ocsp.Good, time.Now().Add(time.Hour))
+	responder.setDown(true)
+	server := crlServer(t, ca.crl(t, time.Now().Add(time.Hour)))
+	server.setDown(true)
+	config := RevocationConfig{OcspUrl: responder.server.URL, CrlUrls: []string{server.server.URL}}
+
+	if err := newTestChecker(config).Check(leaf, ca.certificate); err != ErrRevocationUnknown {
+		t.Errorf("fail closed: got %v, want ErrRevocationUnknown", err)
+	}
+	config.FailOpen = true
+	if err := newTestChecker(config).Check(leaf, ca.certificate); err != nil {
+		t.Errorf("fail open: got %v, want the peer accepted", err)
+	}
+}
+
+func TestCrlFromAnotherIssuerIsIgnored(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	other := newTestCa(t, "other")
+	leaf := ca.issue(t, 2, "user_service")
+	// The other CA's list names the same serial, which says nothing about
+	// a certificate it didn't issue.
+	server := crlServer(t, other.crl(t, time.Now().Add(time.Hour), leaf.SerialNumber))
+	config := RevocationConfig{CrlUrls: []string{server.server.URL}}
+
+	if err := newTestChecker(config).Check(leaf, ca.certificate); err != ErrRevocationUnknown {
+		t.Errorf("fail closed: got %v, want ErrRevocationUnknown", err)
+	}
+	config.FailOpen = true
+	if err := newTestChecker(config).Check(leaf, ca.certificate); err != nil {
+		t.Errorf("fail open: got %v, want the peer accepted", err)
+	}
+}
+
+func TestCacheExpiresAtRefresh(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	responder := ocspResponder(t, ca, ocsp.Good, time.Now().Add(time.Hour))
+	server := crlServer(t, ca.crl(t, time.Now().Add(time.Hour)))
+	ocspChecker := newTestChecker(RevocationConfig{OcspUrl: responder.server.URL, Refresh: 200 * time.Millisecond})
+	crlChecker := newTestChecker(RevocationConfig{CrlUrls: []string{server.server.URL}, Refresh: 200 * time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		_ = ocspChecker.Check(leaf, ca.certificate)
+		_ = crlChecker.Check(leaf, ca.certificate)
+	}
+	if responder.count() != 1 || server.count() != 1 {
+		t.Fatalf("%d OCSP requests and %d CRL downloads before Refresh, want one each", responder.count(), server.count())
+	}
+	time.Sleep(300 * time.Millisecond)
+	_ = ocspChecker.Check(leaf, ca.certificate)
+	_ = crlChecker.Check(leaf, ca.certificate)
+	if responder.count() != 2 || server.count() != 2 {
+		t.Fatalf("%d OCSP requests and %d CRL downloads after Refresh, want two each", responder.count(), server.count())
+	}
+}
+
+func TestCacheExpiresAtNextUpdate(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	// Both answers are already past their next update, so neither may be
+	// served from the cache, however long Refresh is.
+	responder := ocspResponder(t, ca, ocsp.Good, time.Now().Add(-time.Second))
+	server := crlServer(t, ca.crl(t, time.Now().Add(-time.Second)))
+	ocspChecker := newTestChecker(RevocationConfig{OcspUrl: responder.server.URL})
+	crlChecker := newTestChecker(RevocationConfig{CrlUrls: []string{server.server.URL}})
+
+	for i := 0; i < 2; i++ {
+		if err := ocspChecker.Check(leaf, ca.certificate); err != nil {
+			t.Fatal(err)
+		}
+		if err := crlChecker.Check(leaf, ca.certificate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if responder.count() != 2 || server.count() != 2 {
+		t.Fatalf("%d OCSP requests and %d CRL downloads, want two each", responder.count(), server.count())
+	}
+
+	checker := newTestChecker(RevocationConfig{})
+	nextUpdate := time.Now().Add(time.Minute)
+	if expires := checker.expiry(nextUpdate); !expires.Equal(nextUpdate) {
+		t.Errorf("cached until %v, want the next update %v", expires, nextUpdate)
+	}
+	if expires := checker.expiry(time.Now().Add(2 * time.Hour)); expires.After(time.Now().Add(time.Hour)) {
+		t.Errorf("cached until %v, longer than Refresh", expires)
+	}
+}
+
+func TestStaleCrlIsUsedForOneMoreRefresh(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	server := crlServer(t, ca.crl(t, time.Now().Add(time.Hour)))
+	checker := newTestChecker(RevocationConfig{CrlUrls: []string{server.server.URL}, Refresh: 200 * time.Millisecond})
+
+	if err := checker.Check(leaf, ca.certificate); err != nil {
+		t.Fatal(err)
+	}
+	server.setDown(true)
+	time.Sleep(300 * time.Millisecond)
+	if err := checker.Check(leaf, ca.certificate); err != nil {
+		t.Fatalf("got %v from a CRL that expired a moment ago, want it still used", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := checker.Check(leaf, ca.certificate); err != ErrRevocationUnknown {
+		t.Fatalf("got %v from a CRL that is too old, want ErrRevocationUnknown", err)
+	}
+}
+
+func TestOutOfDateCrlIsRefused(t *testing.T) {
+	ca := newTestCa(t, "ca")
+	leaf := ca.issue(t, 2, "user_service")
+	server := crlServer(t, ca.crl(t, time.Now().Add(-2*time.Hour)))
+	checker := newTestChecker(RevocationConfig{CrlUrls: []string{server.server.URL}})
+
+	err := checker.Check(leaf, ca.certificate)
+	if !errors.Is(err, ErrRevocationUnknown) {
+		t.Fatalf("got %v, want ErrRevocationUnknown", err)
+	}
+}
@@ -0,0 +1,67 @@
+package tls
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoPeerCertificate = errors.New("peer sent no certificate")
+	ErrPeerNotAllowed    = errors.New("peer is not allowed")
+)
+
+// verifyPeer checks that the chain the peer sent leads to the CA bundle, is
+// meant for usage, wasn't revoked and that the leaf names one of allowed. Names are the DNS
+// and URI subject alternative names, so a service can be named by its
+// hostname ("user_service") or a URI ("spiffe://dislinkt/user_service").
+func (i *Identity) verifyPeer(rawCerts [][]byte, usage x509.ExtKeyUsage, allowed []string) error {
+	if len(rawCerts) == 0 {
+		return ErrNoPeerCertificate
+	}
+	certificates := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	leaf := certificates[0]
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         i.pool(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if i.revocation != nil {
+		err = i.revocation.CheckChain(chains[0])
+		if err != nil {
+			return fmt.Errorf("tls: %v: %w", Names(leaf), err)
+		}
+	}
+
+	for _, name := range Names(leaf) {
+		for _, peer := range allowed {
+			if name == peer {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("tls: %v: %w", Names(leaf), ErrPeerNotAllowed)
+}
+
+// Names returns the identities certificate was issued for.
+func Names(certificate *x509.Certificate) []string {
+	names := append([]string{}, certificate.DNSNames...)
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
@@ -0,0 +1,132 @@
+package tls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// pkiKey is shared by the test certificates: RSA keys are slow to generate.
+var pkiKey *rsa.PrivateKey
+
+func testPkiKey(t *testing.T) *rsa.PrivateKey {
+	if pkiKey == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkiKey = key
+	}
+	return pkiKey
+}
+
+// pkiSubject is the subject the PKI builds from a user: CN, O, OU, C and E.
+func pkiSubject(commonName string) pkix.Name {
+	return pkix.Name{
+		CommonName:         commonName,
+		Organization:       []string{"Dislinkt"},
+		OrganizationalUnit: []string{"Backend"},
+		Country:            []string{"RS"},
+		ExtraNames: []pkix.AttributeTypeAndValue{
+			{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}, Value: "backend@dislinkt.rs"},
+		},
+	}
+}
+
+// pkiIssue signs template the way the PKI does, with SHA256WithRSA, and
+// adds nothing the template doesn't set. parent is nil for a root.
+func pkiIssue(t *testing.T, template *x509.Certificate, parent *x509.Certificate) *x509.Certificate {
+	key := testPkiKey(t)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func identityTrusting(root *x509.Certificate) *Identity {
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &Identity{roots: roots}
+}
+
+func TestVerifyPeerRefusesCasWithoutBasicConstraints(t *testing.T) {
+	// What the PKI issued before it added extensions: a root and a client
+	// certificate with nothing but a subject. They have to be reissued.
+	root := pkiIssue(t, &x509.Certificate{Subject: pkiSubject("Dislinkt root")}, nil)
+	leaf := pkiIssue(t, &x509.Certificate{Subject: pkiSubject("user_service")}, root)
+	err := identityTrusting(root).verifyPeer([][]byte{leaf.Raw}, x509.ExtKeyUsageClientAuth, []string{"user_service"})
+	if err == nil {
+		t.Fatal("accepted a certificate signed by a CA without basic constraints")
+	}
+}
+
+func TestVerifyPeerAcceptsPkiChains(t *testing.T) {
+	// What the PKI issues now: CAs with basic constraints, and client
+	// certificates naming their service as a DNS SAN for both usages.
+	root := pkiIssue(t, &x509.Certificate{
+		Subject:               pkiSubject("Dislinkt root"),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, nil)
+	intermediate := pkiIssue(t, &x509.Certificate{
+		Subject:               pkiSubject("Dislinkt services"),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, root)
+	leaf := pkiIssue(t, &x509.Certificate{
+		Subject:               pkiSubject("user_service"),
+		DNSNames:              []string{"user_service"},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}, intermediate)
+	identity := identityTrusting(root)
+
+	chain := [][]byte{leaf.Raw, intermediate.Raw}
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		if err := identity.verifyPeer(chain, usage, []string{"user_service"}); err != nil {
+			t.Fatalf("usage %v: %v", usage, err)
+		}
+	}
+	err := identity.verifyPeer(chain, x509.ExtKeyUsageClientAuth, []string{"post_service"})
+	if !errors.Is(err, ErrPeerNotAllowed) {
+		t.Fatalf("got %v for another service, want %v", err, ErrPeerNotAllowed)
+	}
+	if err := identity.verifyPeer([][]byte{leaf.Raw}, x509.ExtKeyUsageClientAuth, []string{"user_service"}); err == nil {
+		t.Fatal("accepted a chain missing its intermediate")
+	}
+}
+
+func TestVerifyPeerChecksUsage(t *testing.T) {
+	root := pkiIssue(t, &x509.Certificate{
+		Subject:               pkiSubject("Dislinkt root"),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, nil)
+	leaf := pkiIssue(t, &x509.Certificate{
+		Subject:     pkiSubject("user_service"),
+		DNSNames:    []string{"user_service"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, root)
+	err := identityTrusting(root).verifyPeer([][]byte{leaf.Raw}, x509.ExtKeyUsageClientAuth, []string{"user_service"})
+	if err == nil {
+		t.Fatal("accepted a server certificate from a client")
+	}
+}
@@ -2,10 +2,12 @@ package services
 
 import (
 	"common/module/logger"
+	"common/module/timeline"
 	"connection/module/domain/dto"
 	"connection/module/domain/model"
 	"connection/module/domain/repositories"
 	"connection/module/infrastructure/orchestrators"
+	"github.com/sirupsen/logrus"
 )
 
 type ConnectionService struct {
@@ -13,22 +15,31 @@ type ConnectionService struct {
 	logInfo        *logger.Logger
 	logError       *logger.Logger
 	orchestrator   *orchestrators.ConnectionOrchestrator
+	timeline       *timeline.Publisher
 }
 
-func NewConnectionService(connectionRepo repositories.ConnectionRepository, logInfo *logger.Logger, logError *logger.Logger, orchestrator *orchestrators.ConnectionOrchestrator) *ConnectionService {
-	return &ConnectionService{connectionRepo, logInfo, logError, orchestrator}
+func NewConnectionService(connectionRepo repositories.ConnectionRepository, logInfo *logger.Logger, logError *logger.Logger, orchestrator *orchestrators.ConnectionOrchestrator, timeline *timeline.Publisher) *ConnectionService {
+	return &ConnectionService{connectionRepo, logInfo, logError, orchestrator, timeline}
 }
 
 func (s ConnectionService) CreateConnection(connection *model.Connection, sender string, receiver string) (*dto.ConnectionResponse, error) {
 	response, err := s.connectionRepo.CreateConnection(connection)
 	status, _ := s.connectionRepo.ConnectionStatusForUsers(connection.UserOneUID, connection.UserTwoUID)
 	s.orchestrator.Connect(sender, receiver, status.ConnectionStatus)
+	// Public profiles accept requests right away.
+	if err == nil && status.ConnectionStatus == "CONNECTED" {
+		s.publishTimeline(s.timeline.UsersConnected(sender, receiver), sender, receiver)
+	}
 	return response, err
 }
 
 func (s ConnectionService) AcceptConnection(connection *model.Connection, sender string, receiver string) (*dto.ConnectionResponse, error) {
 	s.orchestrator.AcceptConnection(sender, receiver)
-	return s.connectionRepo.AcceptConnection(connection)
+	response, err := s.connectionRepo.AcceptConnection(connection)
+	if err == nil {
+		s.publishTimeline(s.timeline.UsersConnected(sender, receiver), sender, receiver)
+	}
+	return response, err
 }
 
 func (s ConnectionService) GetAllConnectionForUser(userUid string) (userNodes []*model.User, error1 error) {
@@ -44,11 +55,25 @@ func (s ConnectionService) ConnectionStatusForUsers(senderId string, receiverId
 	return s.connectionRepo.ConnectionStatusForUsers(senderId, receiverId)
 }
 
-func (s ConnectionService) BlockUser(con *model.Connection) (*dto.ConnectionResponse, error) {
+func (s ConnectionService) BlockUser(con *model.Connection, sender string, receiver string) (*dto.ConnectionResponse, error) {
 	response, err := s.connectionRepo.BlockUser(con)
+	if err == nil {
+		s.publishTimeline(s.timeline.UsersDisconnected(sender, receiver), sender, receiver)
+	}
 	return response, err
 }
 
+// publishTimeline logs a failed timeline event; the connection change itself
+// already happened and stands.
+func (s ConnectionService) publishTimeline(err error, sender string, receiver string) {
+	if err != nil {
+		s.logError.Logger.WithFields(logrus.Fields{
+			"userSenderUsername":   sender,
+			"userReceiverUsername": receiver,
+		}).Errorf("ERR:PUBLISHING TIMELINE EVENT: %v", err)
+	}
+}
+
 func (s ConnectionService) GetRecommendedNewConnections(userId string) (userNodes []*model.User, error1 error) {
 	return s.connectionRepo.GetRecommendedNewConnections(userId)
 }
@@ -337,7 +337,7 @@ func (c ConnectionHandler) BlockUser(ctx context.Context, connection *pb.NewConn
 		UserOneUID: userSenderId,
 		UserTwoUID: userReceiverId,
 	}
-	conResult, err := c.connectionService.BlockUser(con)
+	conResult, err := c.connectionService.BlockUser(con, connection.Connection.UserSender, connection.Connection.UserReceiver)
 	if err != nil {
 		c.logError.Logger.WithFields(logrus.Fields{
 			"userSenderUsername": connection.Connection.UserSender,
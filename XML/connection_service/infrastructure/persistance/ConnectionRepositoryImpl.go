@@ -1,11 +1,11 @@
 package persistance
 
 import (
+	domainErrors "common/module/errors"
 	"common/module/logger"
 	"connection/module/domain/dto"
 	"connection/module/domain/model"
 	"connection/module/domain/repositories"
-	"errors"
 	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,6 +13,9 @@ import (
 	"time"
 )
 
+// errUserNotFound is returned when a user of a connection isn't in the graph.
+var errUserNotFound = domainErrors.NotFound(domainErrors.CodeUserNotFound, "User not found")
+
 type ConnectionRepositoryImpl struct {
 	db       *neo4j.Driver
 	logInfo  *logger.Logger
@@ -201,7 +204,7 @@ func (r ConnectionRepositoryImpl) AcceptConnection(connection *model.Connection)
 				UserOneUID:       "",
 				UserTwoUID:       "",
 				ConnectionStatus: "",
-			}, errors.New("user does not exist")
+			}, errUserNotFound
 
 		}
 
@@ -362,7 +365,7 @@ func (r ConnectionRepositoryImpl) ConnectionStatusForUsers(senderId string, rece
 				UserOneUID:       "",
 				UserTwoUID:       "",
 				ConnectionStatus: "",
-			}, errors.New("user does not exist")
+			}, errUserNotFound
 		}
 
 	})
@@ -372,7 +375,7 @@ func (r ConnectionRepositoryImpl) ConnectionStatusForUsers(senderId string, rece
 			UserOneUID:       "",
 			UserTwoUID:       "",
 			ConnectionStatus: "",
-		}, errors.New("error extracting connection status")
+		}, domainErrors.FromError(err)
 	}
 
 	return result.(*dto.ConnectionResponse), err
@@ -523,7 +526,7 @@ func (r ConnectionRepositoryImpl) BlockUser(con *model.Connection) (*dto.Connect
 				UserOneUID:       "",
 				UserTwoUID:       "",
 				ConnectionStatus: "",
-			}, errors.New("user does not exist")
+			}, errUserNotFound
 
 		}
 		return &dto.ConnectionResponse{
@@ -1,6 +1,7 @@
 package persistance
 
 import (
+	domainErrors "common/module/errors"
 	"common/module/logger"
 	connectionModel "connection/module/domain/model"
 	"connection/module/domain/repositories"
@@ -98,7 +99,7 @@ func (u UserRepositoryImpl) Create(job *connectionModel.JobOffer) (connectionMod
 		return connectionModel.JobOffer{}, err
 	}
 	if result == nil {
-		return connectionModel.JobOffer{}, errors.New("result empty")
+		return connectionModel.JobOffer{}, domainErrors.Internal(errors.New("result empty"))
 	}
 
 	return connectionModel.JobOffer{
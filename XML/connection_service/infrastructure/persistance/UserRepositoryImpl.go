@@ -4,7 +4,6 @@ import (
 	"common/module/logger"
 	connectionModel "connection/module/domain/model"
 	"connection/module/domain/repositories"
-	"errors"
 	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 	"time"
@@ -238,8 +237,11 @@ func (u UserRepositoryImpl) UpdateUserProfessionalDetails(user *connectionModel.
 		}
 		return user.UserUID, nil
 	})
+	if err != nil {
+		return err
+	}
 	if result == nil {
-		return errors.New("user doesn't exist")
+		return errUserNotFound
 	}
 	err = u.updateSkills(user.UserUID, details.Skills)
 	if err != nil {
@@ -1,11 +1,18 @@
 package startup
 
 import (
+	domainErrors "common/module/errors"
 	"common/module/interceptor"
+	"common/module/jwks"
 	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
 	connectionProto "common/module/proto/connection_service"
+	"common/module/revocation"
 	saga "common/module/saga/messaging"
 	"common/module/saga/messaging/nats"
+	"common/module/timeline"
+	servicetls "common/module/tls"
 	"connection/module/application/services"
 	"connection/module/domain/repositories"
 	"connection/module/infrastructure/handlers"
@@ -14,11 +21,14 @@ import (
 	"connection/module/startup/config"
 	"context"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"log"
 	"net"
+	"strconv"
+	"time"
 )
 
 type Server struct {
@@ -67,7 +77,8 @@ func (server *Server) Start() {
 	jobReplyPublisher := server.InitPublisher(server.config.JobReplySubject)
 	server.InitCreateJobOfferCommandHandler(jobService, jobReplyPublisher, jobCommandSubscriber)
 
-	server.StartGrpcServer(connectionHandler, logError)
+	revocationList := server.InitRevocationList()
+	server.StartGrpcServer(connectionHandler, revocationList, logError)
 
 }
 
@@ -79,19 +90,21 @@ func (server *Server) SetupDatabase() *neo4j.Driver {
 	return client
 }
 
-func (server *Server) StartGrpcServer(handler *handlers.ConnectionHandler, logError *logger.Logger) {
+func (server *Server) StartGrpcServer(handler *handlers.ConnectionHandler, revocationList *revocation.List, logError *logger.Logger) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", server.config.Port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(server.config.PublicKey))
-	if err != nil {
-		log.Fatalf("failed to parse public key: %v", err)
-	}
-	interceptor := interceptor.NewAuthInterceptor(config.AccessibleRoles(), publicKey, logError)
+	keys := jwks.NewCache(server.config.JwksUrl)
+	authPolicy := server.InitPolicy()
+	interceptor := interceptor.NewAuthInterceptor(authPolicy, keys, revocationList, server.InitPermissionCache(authPolicy), logError)
 
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()))
+	grpcServer := grpc.NewServer(grpc.Creds(server.InitTransportCredentials(logError)), grpc.ChainUnaryInterceptor(domainErrors.UnaryServerInterceptor(logError), interceptor.Unary()))
 	connectionProto.RegisterConnectionServiceServer(grpcServer, handler)
+	err = authPolicy.CheckServer(grpcServer)
+	if err != nil {
+		log.Fatalf("failed to check policy: %v", err)
+	}
 	if err := grpcServer.Serve(listener); err != nil {
 		log.Fatalf("failed to serve: %s", err)
 	}
@@ -113,7 +126,8 @@ func (server *Server) InitConnectionHandler(conSer *services.ConnectionService,
 	return handlers.NewConnectionHandler(conSer, userSer, logInfo, logError)
 }
 func (server *Server) InitConnectionService(repo repositories.ConnectionRepository, logInfo *logger.Logger, logError *logger.Logger, orchestrator *orchestrators.ConnectionOrchestrator) *services.ConnectionService {
-	return services.NewConnectionService(repo, logInfo, logError, orchestrator)
+	return services.NewConnectionService(repo, logInfo, logError, orchestrator,
+		timeline.NewPublisher(server.InitPublisher(server.config.TimelineSubject)))
 }
 
 func (server *Server) InitConnectionRepository(client *neo4j.Driver, logInfo *logger.Logger, logError *logger.Logger) repositories.ConnectionRepository {
@@ -181,3 +195,81 @@ func (server *Server) InitJobRepository(client *neo4j.Driver, info *logger.Logge
 func (server *Server) InitJobService(repo repositories.JobOfferRepository, info *logger.Logger, logError *logger.Logger) *services.JobOfferService {
 	return services.NewJobOfferService(repo, info, logError)
 }
+
+func (server *Server) InitRevocationList() *revocation.List {
+	list := revocation.NewList()
+	err := list.Listen(server.InitSubscriber(server.config.RevocationSubject, revocation.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = revocation.NewRevoker(server.InitPublisher(server.config.RevocationSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return list
+}
+
+func (server *Server) InitPolicy() *policy.Policy {
+	authPolicy, err := policy.Load()
+	if err != nil {
+		log.Fatalf("failed to load policy: %v", err)
+	}
+	return authPolicy
+}
+
+func (server *Server) InitPermissionCache(authPolicy *policy.Policy) *permissions.Cache {
+	cache := permissions.NewCache(authPolicy.Roles)
+	err := cache.Listen(server.InitSubscriber(server.config.RoleSubject, permissions.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = permissions.NewBroadcaster(server.InitPublisher(server.config.RoleSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return cache
+}
+
+func (server *Server) InitTransportCredentials(logError *logger.Logger) credentials.TransportCredentials {
+	if server.config.GrpcTlsCert == "" {
+		if !server.insecureDev() {
+			log.Fatal("GRPC_TLS_CERT is not set; set GRPC_INSECURE_DEV=true to serve gRPC without TLS in development")
+		}
+		logError.Logger.Errorf("ERR:GRPC_INSECURE_DEV SET, SERVING GRPC WITHOUT TLS")
+		return insecure.NewCredentials()
+	}
+	reload, err := time.ParseDuration(server.config.GrpcTlsReload)
+	if err != nil || reload <= 0 {
+		log.Fatalf("invalid GRPC_TLS_RELOAD %q", server.config.GrpcTlsReload)
+	}
+	identity, err := servicetls.LoadIdentity(server.config.GrpcTlsCert, server.config.GrpcTlsKey, server.config.GrpcTlsCa, logError)
+	if err != nil {
+		log.Fatalf("failed to load TLS identity: %v", err)
+	}
+	identity.CheckRevocation(server.InitRevocationChecker(logError))
+	identity.Watch(reload)
+	return identity.ServerCredentials(servicetls.Peers(server.config.GrpcAllowedPeers))
+}
+
+// insecureDev is the explicit opt-out from TLS for development setups
+// without certificates.
+func (server *Server) insecureDev() bool {
+	insecureDev, err := strconv.ParseBool(server.config.GrpcInsecure)
+	if err != nil {
+		log.Fatalf("invalid GRPC_INSECURE_DEV %q", server.config.GrpcInsecure)
+	}
+	return insecureDev
+}
+
+func (server *Server) InitRevocationChecker(logError *logger.Logger) *servicetls.RevocationChecker {
+	config, err := servicetls.ParseRevocationConfig(server.config.GrpcTlsCrlUrls, server.config.GrpcTlsOcspUrl,
+		server.config.GrpcTlsFailOpen, server.config.GrpcTlsRecheck)
+	if err != nil {
+		log.Fatalf("invalid certificate revocation settings: %v", err)
+	}
+	if !config.Enabled() {
+		logError.Logger.Errorf("ERR:GRPC_TLS_CRL_URLS AND GRPC_TLS_OCSP_URL NOT SET, NOT CHECKING CERTIFICATE REVOCATION")
+		return nil
+	}
+	return servicetls.NewRevocationChecker(config, logError)
+}
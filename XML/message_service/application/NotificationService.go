@@ -2,23 +2,25 @@ package application
 
 import (
 	"common/module/logger"
+	"common/module/realtime"
+	events "common/module/saga/realtime_events"
 	"fmt"
-	"github.com/pusher/pusher-http-go"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"message/module/domain/model"
 	"message/module/domain/repositories"
 )
 
 type NotificationService struct {
-	logInfo            *logger.Logger
-	logError           *logger.Logger
-	notificationRepo   repositories.NotificationRepository
-	notificationPusher *pusher.Client
-	userService        *UserService
+	logInfo          *logger.Logger
+	logError         *logger.Logger
+	notificationRepo repositories.NotificationRepository
+	realtime         *realtime.Publisher
+	userService      *UserService
 }
 
-func NewNotificationService(logInfo *logger.Logger, logError *logger.Logger, notificationRepo repositories.NotificationRepository, pusher *pusher.Client, userService *UserService) *NotificationService {
-	return &NotificationService{logInfo: logInfo, logError: logError, notificationRepo: notificationRepo, notificationPusher: pusher, userService: userService}
+func NewNotificationService(logInfo *logger.Logger, logError *logger.Logger, notificationRepo repositories.NotificationRepository, realtime *realtime.Publisher, userService *UserService) *NotificationService {
+	return &NotificationService{logInfo: logInfo, logError: logError, notificationRepo: notificationRepo, realtime: realtime, userService: userService}
 }
 
 func (service *NotificationService) Create(notification *model.Notification) (*model.Notification, error) {
@@ -26,12 +28,27 @@ func (service *NotificationService) Create(notification *model.Notification) (*m
 	fmt.Println(result)
 	if result {
 		noti, err := service.notificationRepo.Create(notification)
-		service.notificationPusher.Trigger("notifications", "notification", noti)
-		return noti, err
+		if err != nil {
+			return nil, err
+		}
+		service.Push(noti.NotificationTo, events.Notification, noti)
+		return noti, nil
 	}
 	return nil, nil
 }
 
+// Push streams payload to the open connections of recipient. The stored
+// notification is what counts, so a failed push is only logged.
+func (service *NotificationService) Push(recipient string, eventType string, payload interface{}) {
+	err := service.realtime.Publish(recipient, eventType, payload)
+	if err != nil {
+		service.logError.Logger.WithFields(logrus.Fields{
+			"recipient": recipient,
+			"type":      eventType,
+		}).Errorf("ERR:PUBLISHING REALTIME EVENT: %v", err)
+	}
+}
+
 func (service *NotificationService) GetAllForUser(username string) ([]*model.Notification, error) {
 	return service.notificationRepo.GetAllForUser(username)
 }
@@ -45,6 +45,10 @@ func (s UserService) ChangeSettingsForUser(username string, newSettings *model.N
 }
 
 func (s UserService) AllowedNotificationForUser(username string, notificationType model.NotificationType) (result bool, err error) {
+	// Security notices, like a login from a new device, can't be turned off.
+	if notificationType == model.SECURITY {
+		return true, nil
+	}
 	settings, err := s.repository.GetSettingsForUser(username)
 	switch notificationType {
 	case model.PROFILE:
@@ -11,6 +11,7 @@ const (
 	PROFILE NotificationType = iota
 	POST
 	MESSAGE
+	SECURITY
 )
 
 type Notification struct {
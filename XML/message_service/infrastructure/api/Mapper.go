@@ -165,6 +165,8 @@ func mapNotificationTypeToString(notificationType model.NotificationType) string
 	}
 	if notificationType == model.MESSAGE {
 		return "MESSAGE"
+	} else if notificationType == model.SECURITY {
+		return "SECURITY"
 	} else {
 		return "PROFILE"
 	}
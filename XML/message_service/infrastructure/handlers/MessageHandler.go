@@ -3,9 +3,9 @@ package handlers
 import (
 	"common/module/logger"
 	pb "common/module/proto/message_service"
+	events "common/module/saga/realtime_events"
 	"context"
 	"fmt"
-	"github.com/pusher/pusher-http-go"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"message/module/application"
@@ -20,11 +20,10 @@ type MessageHandler struct {
 	notificationService *application.NotificationService
 	logInfo             *logger.Logger
 	logError            *logger.Logger
-	pusher              *pusher.Client
 }
 
-func NewMessageHandler(messageService *application.MessageService, userService *application.UserService, notificationService *application.NotificationService, logInfo *logger.Logger, logError *logger.Logger, pusher *pusher.Client) *MessageHandler {
-	return &MessageHandler{messageService: messageService, userService: userService, notificationService: notificationService, logInfo: logInfo, logError: logError, pusher: pusher}
+func NewMessageHandler(messageService *application.MessageService, userService *application.UserService, notificationService *application.NotificationService, logInfo *logger.Logger, logError *logger.Logger) *MessageHandler {
+	return &MessageHandler{messageService: messageService, userService: userService, notificationService: notificationService, logInfo: logInfo, logError: logError}
 }
 
 func (m MessageHandler) MustEmbedUnimplementedMessageServiceServer() {
@@ -107,7 +106,7 @@ func (m MessageHandler) SendMessage(_ context.Context, request *pb.SendMessageRe
 		Type:             model.MESSAGE,
 	}
 	m.notificationService.Create(nnn)
-	m.pusher.Trigger("messages", "message", request.Message)
+	m.notificationService.Push(request.Message.ReceiverUsername, events.Message, request.Message)
 	response := api.MapMessageReply(message, request.Message.ReceiverUsername, request.Message.SenderUsername)
 	return &pb.MessageSentResponse{Message: response}, nil
 }
@@ -5,7 +5,6 @@ import (
 	pb "common/module/proto/notification_service"
 	"context"
 	"fmt"
-	"github.com/pusher/pusher-http-go"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"message/module/application"
 	"message/module/domain/model"
@@ -16,7 +15,6 @@ import (
 type NotificationHandler struct {
 	logInfo             *logger.Logger
 	logError            *logger.Logger
-	notificationPusher  *pusher.Client
 	notificationService *application.NotificationService
 	userService         *application.UserService
 }
@@ -24,13 +22,13 @@ type NotificationHandler struct {
 func (n NotificationHandler) MustEmbedUnimplementedNotificationServiceServer() {
 }
 
-func NewNotificationHandler(logInfo *logger.Logger, logError *logger.Logger, notificationPusher *pusher.Client, notificationService *application.NotificationService, userService *application.UserService) *NotificationHandler {
-	return &NotificationHandler{logInfo, logError, notificationPusher, notificationService, userService}
+func NewNotificationHandler(logInfo *logger.Logger, logError *logger.Logger, notificationService *application.NotificationService, userService *application.UserService) *NotificationHandler {
+	return &NotificationHandler{logInfo, logError, notificationService, userService}
 }
 
 func (n NotificationHandler) Create(ctx context.Context, newNotificationReq *pb.NewNotificationRequest) (*pb.NewNotificationResponse, error) {
 	// create Notification object and store it in the database
-	// trigger pusher
+	// push it to the recipient
 	// check if this notification is blocked for that user
 
 	notiType := model.PROFILE
@@ -38,6 +36,8 @@ func (n NotificationHandler) Create(ctx context.Context, newNotificationReq *pb.
 		notiType = model.MESSAGE
 	} else if newNotificationReq.NewNotification.NotificationType == "POST" {
 		notiType = model.POST
+	} else if newNotificationReq.NewNotification.NotificationType == "SECURITY" {
+		notiType = model.SECURITY
 	}
 
 	result, _ := n.userService.AllowedNotificationForUser(newNotificationReq.NewNotification.To, notiType)
@@ -1,7 +0,0 @@
-package config
-
-func AccessibleRoles() map[string][]string {
-	const postService = "/message_service.MessageService/"
-
-	return map[string][]string{}
-}
@@ -6,27 +6,30 @@ type Config struct {
 	Port                                 string
 	MessageDBHost                        string
 	MessageDBPort                        string
-	PublicKey                            string
+	JwksUrl                              string
 	UserCommandSubject                   string
 	UserReplySubject                     string
 	NatsHost                             string
 	NatsUser                             string
 	NatsPort                             string
 	NatsPass                             string
-	NotificationAppID                    string
-	NotificationKey                      string
-	NotificationSecret                   string
-	NotificationCluster                  string
-	NotificationSecure                   bool
 	PostNotificationCommandSubject       string
 	PostNotificationReplySubject         string
 	ConnectionNotificationCommandSubject string
 	ConnectionNotificationReplySubject   string
-	MessageAppID                         string
-	MessageKey                           string
-	MessageSecret                        string
-	MessageCluster                       string
-	MessageSecure                        bool
+	RevocationSubject                    string
+	RoleSubject                          string
+	RealtimeSubject                      string
+	GrpcTlsCert                          string
+	GrpcTlsKey                           string
+	GrpcTlsCa                            string
+	GrpcTlsReload                        string
+	GrpcTlsCrlUrls                       string
+	GrpcTlsOcspUrl                       string
+	GrpcTlsFailOpen                      string
+	GrpcTlsRecheck                       string
+	GrpcInsecure                         string
+	GrpcAllowedPeers                     string
 }
 
 func NewConfig() *Config {
@@ -35,7 +38,7 @@ func NewConfig() *Config {
 		Port:                                 os.Getenv("MESSAGE_SERVICE_PORT"),
 		MessageDBHost:                        os.Getenv("MESSAGE_DB_HOST"),
 		MessageDBPort:                        os.Getenv("MESSAGE_DB_PORT"),
-		PublicKey:                            "PostService",
+		JwksUrl:                              os.Getenv("JWKS_URL"),
 		UserCommandSubject:                   os.Getenv("USER_COMMAND_SUBJECT"),
 		UserReplySubject:                     os.Getenv("USER_REPLY_SUBJECT"),
 		NatsPort:                             os.Getenv("NATS_PORT"),
@@ -46,15 +49,26 @@ func NewConfig() *Config {
 		PostNotificationReplySubject:         os.Getenv("POST_NOTIFICATION_REPLY_SUBJECT"),
 		ConnectionNotificationCommandSubject: os.Getenv("CONNECTION_NOTIFICATION_COMMAND_SUBJECT"),
 		ConnectionNotificationReplySubject:   os.Getenv("CONNECTION_NOTIFICATION_REPLY_SUBJECT"),
-		NotificationAppID:                    "1435187",
-		NotificationKey:                      "e92e3e6334c6de83b489",
-		NotificationSecret:                   "da4e7a87d5c3f8dd99d0",
-		NotificationCluster:                  "eu",
-		NotificationSecure:                   true,
-		MessageAppID:                         "1435191",
-		MessageKey:                           "e49d7a86a937f12da028",
-		MessageSecret:                        "cdd023488f9e1881f4be",
-		MessageCluster:                       "eu",
-		MessageSecure:                        true,
+		RevocationSubject:                    os.Getenv("REVOCATION_SUBJECT"),
+		RoleSubject:                          os.Getenv("ROLE_SUBJECT"),
+		RealtimeSubject:                      os.Getenv("REALTIME_SUBJECT"),
+		GrpcTlsCert:                          os.Getenv("GRPC_TLS_CERT"),
+		GrpcTlsKey:                           os.Getenv("GRPC_TLS_KEY"),
+		GrpcTlsCa:                            os.Getenv("GRPC_TLS_CA"),
+		GrpcTlsReload:                        getEnvOrDefault("GRPC_TLS_RELOAD", "1m"),
+		GrpcTlsCrlUrls:                       os.Getenv("GRPC_TLS_CRL_URLS"),
+		GrpcTlsOcspUrl:                       os.Getenv("GRPC_TLS_OCSP_URL"),
+		GrpcTlsFailOpen:                      getEnvOrDefault("GRPC_TLS_FAIL_OPEN", "false"),
+		GrpcTlsRecheck:                       getEnvOrDefault("GRPC_TLS_REVOCATION_REFRESH", "10m"),
+		GrpcInsecure:                         getEnvOrDefault("GRPC_INSECURE_DEV", "false"),
+		GrpcAllowedPeers:                     getEnvOrDefault("GRPC_ALLOWED_PEERS", "api_gateway"),
 	}
 }
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
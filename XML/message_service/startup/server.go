@@ -1,18 +1,25 @@
 package startup
 
 import (
+	domainErrors "common/module/errors"
 	"common/module/interceptor"
+	"common/module/jwks"
 	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
 	messagesProto "common/module/proto/message_service"
 	notificationProto "common/module/proto/notification_service"
+	"common/module/realtime"
+	"common/module/revocation"
 	saga "common/module/saga/messaging"
 	"common/module/saga/messaging/nats"
+	servicetls "common/module/tls"
 	"context"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
-	"github.com/pusher/pusher-http-go"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"log"
 	"message/module/application"
 	"message/module/domain/repositories"
@@ -20,6 +27,8 @@ import (
 	"message/module/infrastructure/persistence"
 	"message/module/startup/config"
 	"net"
+	"strconv"
+	"time"
 )
 
 type Server struct {
@@ -41,8 +50,7 @@ func (server *Server) Start() {
 	logError := logger.InitializeLogger("post-service", context.Background(), "Error")
 
 	mongoClient := server.InitMongoClient()
-	notificationPusher := server.InitNotificationPusher()
-	messagePusher := server.InitMessagePusher()
+	realtimePublisher := server.InitRealtimePublisher()
 
 	messageRepo := server.InitMessageRepo(mongoClient)
 	messageService := server.InitMessageService(messageRepo, logInfo, logError)
@@ -52,10 +60,10 @@ func (server *Server) Start() {
 	replyPublisher := server.InitPublisher(server.config.UserReplySubject)
 	userRepo := server.InitUserRepo(mongoClient)
 	userService := server.InitUserService(userRepo, logInfo, logError)
-	notificationService := server.InitNotificationService(logInfo, logError, notificationRepo, &notificationPusher, userService)
+	notificationService := server.InitNotificationService(logInfo, logError, notificationRepo, realtimePublisher, userService)
 
-	messageHandler := server.InitMessageHandler(messageService, userService, notificationService, logInfo, logError, &messagePusher)
-	notificationHandler := server.InitNotificationHandler(logInfo, logError, &notificationPusher, notificationService, userService)
+	messageHandler := server.InitMessageHandler(messageService, userService, notificationService, logInfo, logError)
+	notificationHandler := server.InitNotificationHandler(logInfo, logError, notificationService, userService)
 	server.InitCreateUserCommandHandler(userService, messageService, replyPublisher, commandSubscriber)
 
 	postReplyPublisher := server.InitPublisher(server.config.PostNotificationReplySubject)
@@ -68,7 +76,8 @@ func (server *Server) Start() {
 
 	server.InitConnectionNotificationCommandHandler(notificationService, connectionReplyPublisher, connectionCommandSubscriber)
 
-	server.StartGrpcServer(messageHandler, notificationHandler, logError)
+	revocationList := server.InitRevocationList()
+	server.StartGrpcServer(messageHandler, notificationHandler, revocationList, logError)
 }
 
 func (server *Server) InitMongoClient() *mongo.Client {
@@ -117,8 +126,8 @@ func (server *Server) InitUserService(repo repositories.UserRepository, logInfo
 	return application.NewUserService(repo, logInfo, logError)
 }
 
-func (server *Server) InitMessageHandler(messageService *application.MessageService, userService *application.UserService, notificationService *application.NotificationService, logInfo *logger.Logger, logError *logger.Logger, pusher *pusher.Client) *handlers.MessageHandler {
-	return handlers.NewMessageHandler(messageService, userService, notificationService, logInfo, logError, pusher)
+func (server *Server) InitMessageHandler(messageService *application.MessageService, userService *application.UserService, notificationService *application.NotificationService, logInfo *logger.Logger, logError *logger.Logger) *handlers.MessageHandler {
+	return handlers.NewMessageHandler(messageService, userService, notificationService, logInfo, logError)
 }
 
 func (server *Server) InitCreateUserCommandHandler(userService *application.UserService, postService *application.MessageService, publisher saga.Publisher,
@@ -148,53 +157,120 @@ func (server *Server) InitConnectionNotificationCommandHandler(service *applicat
 	return handler
 }
 
-func (server *Server) StartGrpcServer(messageHandler *handlers.MessageHandler, notificationHandler *handlers.NotificationHandler, logError *logger.Logger) {
+func (server *Server) StartGrpcServer(messageHandler *handlers.MessageHandler, notificationHandler *handlers.NotificationHandler, revocationList *revocation.List, logError *logger.Logger) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", server.config.Port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(server.config.PublicKey))
-	intercept := interceptor.NewAuthInterceptor(config.AccessibleRoles(), publicKey, logError)
+	keys := jwks.NewCache(server.config.JwksUrl)
+	authPolicy := server.InitPolicy()
+	intercept := interceptor.NewAuthInterceptor(authPolicy, keys, revocationList, server.InitPermissionCache(authPolicy), logError)
 
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(intercept.Unary()))
+	grpcServer := grpc.NewServer(grpc.Creds(server.InitTransportCredentials(logError)), grpc.ChainUnaryInterceptor(domainErrors.UnaryServerInterceptor(logError), intercept.Unary()))
 	messagesProto.RegisterMessageServiceServer(grpcServer, messageHandler)
 	notificationProto.RegisterNotificationServiceServer(grpcServer, notificationHandler)
 
+	err = authPolicy.CheckServer(grpcServer)
+	if err != nil {
+		log.Fatalf("failed to check policy: %v", err)
+	}
 	if err := grpcServer.Serve(listener); err != nil {
 		log.Fatalf("failed to serve: %s", err)
 	}
 }
 
-func (server *Server) InitNotificationPusher() pusher.Client {
-	pusherClient := pusher.Client{
-		AppID:   server.config.NotificationAppID,
-		Key:     server.config.NotificationKey,
-		Secret:  server.config.NotificationSecret,
-		Cluster: server.config.NotificationCluster,
-		Secure:  server.config.NotificationSecure,
+// InitRealtimePublisher sends notifications and messages to the gateway,
+// which streams them to the recipient.
+func (server *Server) InitRealtimePublisher() *realtime.Publisher {
+	return realtime.NewPublisher(server.InitPublisher(server.config.RealtimeSubject))
+}
+
+func (server *Server) InitNotificationRepo(client *mongo.Client) repositories.NotificationRepository {
+	return persistence.NewNotificationRepositoryImpl(client)
+}
+
+func (server *Server) InitNotificationService(info *logger.Logger, logError *logger.Logger, repo repositories.NotificationRepository, realtimePublisher *realtime.Publisher, userService *application.UserService) *application.NotificationService {
+	return application.NewNotificationService(info, logError, repo, realtimePublisher, userService)
+}
+
+func (server *Server) InitNotificationHandler(info *logger.Logger, logError *logger.Logger, service *application.NotificationService, userService *application.UserService) *handlers.NotificationHandler {
+	return handlers.NewNotificationHandler(info, logError, service, userService)
+}
+
+func (server *Server) InitRevocationList() *revocation.List {
+	list := revocation.NewList()
+	err := list.Listen(server.InitSubscriber(server.config.RevocationSubject, revocation.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
 	}
-	return pusherClient
+	err = revocation.NewRevoker(server.InitPublisher(server.config.RevocationSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return list
 }
 
-func (server *Server) InitMessagePusher() pusher.Client {
-	pusherClient := pusher.Client{
-		AppID:   server.config.MessageAppID,
-		Key:     server.config.MessageKey,
-		Secret:  server.config.MessageSecret,
-		Cluster: server.config.MessageCluster,
-		Secure:  server.config.MessageSecure,
+func (server *Server) InitPolicy() *policy.Policy {
+	authPolicy, err := policy.Load()
+	if err != nil {
+		log.Fatalf("failed to load policy: %v", err)
 	}
-	return pusherClient
+	return authPolicy
 }
 
-func (server *Server) InitNotificationRepo(client *mongo.Client) repositories.NotificationRepository {
-	return persistence.NewNotificationRepositoryImpl(client)
+func (server *Server) InitPermissionCache(authPolicy *policy.Policy) *permissions.Cache {
+	cache := permissions.NewCache(authPolicy.Roles)
+	err := cache.Listen(server.InitSubscriber(server.config.RoleSubject, permissions.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = permissions.NewBroadcaster(server.InitPublisher(server.config.RoleSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return cache
 }
 
-func (server *Server) InitNotificationService(info *logger.Logger, logError *logger.Logger, repo repositories.NotificationRepository, pusher *pusher.Client, userService *application.UserService) *application.NotificationService {
-	return application.NewNotificationService(info, logError, repo, pusher, userService)
+func (server *Server) InitTransportCredentials(logError *logger.Logger) credentials.TransportCredentials {
+	if server.config.GrpcTlsCert == "" {
+		if !server.insecureDev() {
+			log.Fatal("GRPC_TLS_CERT is not set; set GRPC_INSECURE_DEV=true to serve gRPC without TLS in development")
+		}
+		logError.Logger.Errorf("ERR:GRPC_INSECURE_DEV SET, SERVING GRPC WITHOUT TLS")
+		return insecure.NewCredentials()
+	}
+	reload, err := time.ParseDuration(server.config.GrpcTlsReload)
+	if err != nil || reload <= 0 {
+		log.Fatalf("invalid GRPC_TLS_RELOAD %q", server.config.GrpcTlsReload)
+	}
+	identity, err := servicetls.LoadIdentity(server.config.GrpcTlsCert, server.config.GrpcTlsKey, server.config.GrpcTlsCa, logError)
+	if err != nil {
+		log.Fatalf("failed to load TLS identity: %v", err)
+	}
+	identity.CheckRevocation(server.InitRevocationChecker(logError))
+	identity.Watch(reload)
+	return identity.ServerCredentials(servicetls.Peers(server.config.GrpcAllowedPeers))
+}
+
+// insecureDev is the explicit opt-out from TLS for development setups
+// without certificates.
+func (server *Server) insecureDev() bool {
+	insecureDev, err := strconv.ParseBool(server.config.GrpcInsecure)
+	if err != nil {
+		log.Fatalf("invalid GRPC_INSECURE_DEV %q", server.config.GrpcInsecure)
+	}
+	return insecureDev
 }
 
-func (server *Server) InitNotificationHandler(info *logger.Logger, logError *logger.Logger, notificationPusher *pusher.Client, service *application.NotificationService, userService *application.UserService) *handlers.NotificationHandler {
-	return handlers.NewNotificationHandler(info, logError, notificationPusher, service, userService)
+func (server *Server) InitRevocationChecker(logError *logger.Logger) *servicetls.RevocationChecker {
+	config, err := servicetls.ParseRevocationConfig(server.config.GrpcTlsCrlUrls, server.config.GrpcTlsOcspUrl,
+		server.config.GrpcTlsFailOpen, server.config.GrpcTlsRecheck)
+	if err != nil {
+		log.Fatalf("invalid certificate revocation settings: %v", err)
+	}
+	if !config.Enabled() {
+		logError.Logger.Errorf("ERR:GRPC_TLS_CRL_URLS AND GRPC_TLS_OCSP_URL NOT SET, NOT CHECKING CERTIFICATE REVOCATION")
+		return nil
+	}
+	return servicetls.NewRevocationChecker(config, logError)
 }
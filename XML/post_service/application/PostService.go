@@ -1,8 +1,11 @@
 package application
 
 import (
+	"common/module/changes"
 	"common/module/logger"
+	"common/module/timeline"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"post/module/domain/model"
 	"post/module/domain/repositories"
@@ -15,10 +18,12 @@ type PostService struct {
 	logError         *logger.Logger
 	postOrchestrator *orchestrators.PostOrchestrator
 	jobOrchestrator  *orchestrators.JobOrchestrator
+	timeline         *timeline.Publisher
+	changes          *changes.Publisher
 }
 
-func NewPostService(repository repositories.PostRepository, logInfo *logger.Logger, logError *logger.Logger, porchestrator *orchestrators.PostOrchestrator, jorchestrator *orchestrators.JobOrchestrator) *PostService {
-	return &PostService{repository: repository, logInfo: logInfo, logError: logError, postOrchestrator: porchestrator, jobOrchestrator: jorchestrator}
+func NewPostService(repository repositories.PostRepository, logInfo *logger.Logger, logError *logger.Logger, porchestrator *orchestrators.PostOrchestrator, jorchestrator *orchestrators.JobOrchestrator, timeline *timeline.Publisher, changes *changes.Publisher) *PostService {
+	return &PostService{repository: repository, logInfo: logInfo, logError: logError, postOrchestrator: porchestrator, jobOrchestrator: jorchestrator, timeline: timeline, changes: changes}
 }
 
 func (service *PostService) Get(id primitive.ObjectID) (*model.Post, error) {
@@ -29,8 +34,23 @@ func (service *PostService) GetAll() ([]*model.Post, error) {
 	return service.repository.GetAll()
 }
 
+// Create stores post and announces it to the timeline worker. The post is
+// created even if the announcement fails; the author's connections then see
+// it once the gateway rebuilds their timelines, at most TIMELINE_REBUILD
+// after it last did.
 func (service *PostService) Create(post *model.Post) error {
-	return service.repository.Create(post)
+	err := service.repository.Create(post)
+	if err != nil {
+		return err
+	}
+	err = service.timeline.PostCreated(post.Id.Hex(), post.Username, post.DatePosted)
+	if err != nil {
+		service.logError.Logger.WithFields(logrus.Fields{
+			"postId": post.Id.Hex(),
+		}).Errorf("ERR:PUBLISHING POST TO TIMELINES: %v", err)
+	}
+	service.published(post.Id.Hex(), service.changes.PostCreated(post.Id.Hex(), post.Username))
+	return nil
 }
 
 func (service *PostService) GetAllByUsername(username string) ([]*model.Post, error) {
@@ -39,22 +59,40 @@ func (service *PostService) GetAllByUsername(username string) ([]*model.Post, er
 
 func (service *PostService) CreateComment(post *model.Post, comment *model.Comment) error {
 	service.postOrchestrator.CommentPost(post.Id, comment.Username, post.Username)
-	return service.repository.CreateComment(post, comment)
+	err := service.repository.CreateComment(post, comment)
+	if err != nil {
+		return err
+	}
+	service.published(post.Id.Hex(), service.changes.PostUpdated(post.Id.Hex(), post.Username))
+	return nil
 }
 
 func (service *PostService) LikePost(post *model.Post, userId uuid.UUID, likerUsername string) error {
 	service.postOrchestrator.LikePost(post.Id, likerUsername, post.Username)
-	return service.repository.LikePost(post, userId)
+	err := service.repository.LikePost(post, userId)
+	if err != nil {
+		return err
+	}
+	service.published(post.Id.Hex(), service.changes.PostUpdated(post.Id.Hex(), post.Username))
+	return nil
 }
 
 func (service *PostService) DislikePost(post *model.Post, userId uuid.UUID, haterUsername string) error {
 	service.postOrchestrator.DislikePost(post.Id, haterUsername, post.Username)
-	return service.repository.DislikePost(post, userId)
+	err := service.repository.DislikePost(post, userId)
+	if err != nil {
+		return err
+	}
+	service.published(post.Id.Hex(), service.changes.PostUpdated(post.Id.Hex(), post.Username))
+	return nil
 }
 
 func (service *PostService) CreateJobOffer(offer *model.JobOffer) error {
 	offer, err := service.repository.CreateJobOffer(offer)
 	service.jobOrchestrator.CreateJobOffer(*offer)
+	if err == nil {
+		service.published(offer.Id.Hex(), service.changes.JobOfferCreated(offer.Publisher))
+	}
 	return err
 }
 
@@ -73,3 +111,13 @@ func (service *PostService) CheckLikedStatus(id primitive.ObjectID, userId uuid.
 func (service *PostService) GetUsersJobOffers(username string) ([]*model.JobOffer, error) {
 	return service.repository.GetUsersJobOffers(username)
 }
+
+// published logs a change the gateway wasn't told about; its cache then
+// serves the old response until it expires.
+func (service *PostService) published(id string, err error) {
+	if err != nil {
+		service.logError.Logger.WithFields(logrus.Fields{
+			"id": id,
+		}).Errorf("ERR:PUBLISHING CHANGE: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Command rankeval replays the posts, reactions and comments stored in
+// post_service's database to compare feed rankers offline.
+//
+// Every user who liked or commented on someone else's post becomes a reader.
+// Their candidates are the other users' posts, scored without the reader's
+// own reactions and comments, and the posts they engaged with are the ones a
+// good ranker puts first. Connections, skills and interests live in other
+// services; pass them with -profiles to let the closeness and overlap
+// scorers take part:
+//
+//	{"connections": {"ana": ["bob"]}, "skills": {"ana": ["go"]}, "interests": {"ana": ["music"]}}
+//
+// Usage:
+//
+//	rankeval [-k 10] [-at 2022-06-20T00:00:00Z] [-profiles profiles.json] [-ranker name=spec]...
+package main
+
+import (
+	"common/module/ranking"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"post/module/domain/model"
+	"post/module/infrastructure/persistence"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type profiles struct {
+	Connections map[string][]string `json:"connections"`
+	Skills      map[string][]string `json:"skills"`
+	Interests   map[string][]string `json:"interests"`
+}
+
+type rankerFlags []string
+
+func (r *rankerFlags) String() string {
+	return strings.Join(*r, " ")
+}
+
+func (r *rankerFlags) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+func main() {
+	k := flag.Int("k", 10, "how many top posts each reader would see")
+	at := flag.String("at", "", "replay time, RFC 3339 (default: the newest post)")
+	profilesFile := flag.String("profiles", "", "JSON file with connections, skills and interests")
+	host := flag.String("host", os.Getenv("POST_DB_HOST"), "post database host")
+	port := flag.String("port", os.Getenv("POST_DB_PORT"), "post database port")
+	var specs rankerFlags
+	flag.Var(&specs, "ranker", "name=spec of a ranker to compare, e.g. top=recency:1,engagement:0.5 (repeatable)")
+	flag.Parse()
+	if len(specs) == 0 {
+		specs = rankerFlags{"latest=" + ranking.Latest, "top=" + ranking.Top}
+	}
+
+	names := make([]string, 0, len(specs))
+	rankers := make([]*ranking.Ranker, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("bad -ranker %q, want name=spec", spec)
+		}
+		ranker, err := ranking.Parse(parts[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		names = append(names, parts[0])
+		rankers = append(rankers, ranker)
+	}
+
+	var extra profiles
+	if *profilesFile != "" {
+		data, err := os.ReadFile(*profilesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = json.Unmarshal(data, &extra)
+		if err != nil {
+			log.Fatalf("reading %s: %v", *profilesFile, err)
+		}
+	}
+
+	client, err := persistence.GetClient(*host, *port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := persistence.NewPostRepositoryImpl(client).GetAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users := persistence.NewUserRepositoryImpl(client)
+	usernames := map[string]string{}
+	usernameOf := func(userId string) string {
+		if username, ok := usernames[userId]; ok {
+			return username
+		}
+		id, err := uuid.Parse(userId)
+		if err == nil {
+			found, err := users.GetByUserId(id)
+			if err == nil && len(found) > 0 {
+				usernames[userId] = found[0].Username
+			}
+		}
+		return usernames[userId]
+	}
+
+	now := newest(posts)
+	if *at != "" {
+		now, err = time.Parse(time.RFC3339, *at)
+		if err != nil {
+			log.Fatalf("bad -at: %v", err)
+		}
+	}
+	sessions := replay(posts, usernameOf, extra)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ranker\treaders\thit@%d\tprecision@%d\tndcg@%d\tspec\n", *k, *k, *k)
+	for i, ranker := range rankers {
+		result := ranking.Evaluate(ranker, sessions, *k, now)
+		fmt.Fprintf(w, "%s\t%d\t%.3f\t%.3f\t%.3f\t%s\n", names[i], result.Sessions, result.HitRate, result.Precision, result.NDCG, result.Ranker)
+	}
+	w.Flush()
+}
+
+// replay turns the stored posts into one session per reader.
+func replay(posts []*model.Post, usernameOf func(string) string, extra profiles) []ranking.Session {
+	type engagement struct {
+		liked     bool
+		disliked  bool
+		commented int
+	}
+	// engaged[reader][post] is what reader did to post.
+	engaged := map[string]map[string]*engagement{}
+	touch := func(reader string, post string) *engagement {
+		if engaged[reader] == nil {
+			engaged[reader] = map[string]*engagement{}
+		}
+		if engaged[reader][post] == nil {
+			engaged[reader][post] = &engagement{}
+		}
+		return engaged[reader][post]
+	}
+
+	var base []ranking.Candidate
+	for _, post := range posts {
+		if post.IsDeleted {
+			continue
+		}
+		id := post.Id.Hex()
+		candidate := ranking.Candidate{Id: id, Author: post.Username, Posted: post.DatePosted, Comments: len(post.Comments)}
+		for _, reaction := range post.Reactions {
+			reader := usernameOf(reaction.UserId)
+			switch reaction.Reaction {
+			case model.LIKED:
+				candidate.Likes++
+				if reader != "" {
+					touch(reader, id).liked = true
+				}
+			case model.DISLIKED:
+				candidate.Dislikes++
+				if reader != "" {
+					touch(reader, id).disliked = true
+				}
+			}
+		}
+		for _, comment := range post.Comments {
+			touch(comment.Username, id).commented++
+		}
+		base = append(base, candidate)
+	}
+
+	readers := make([]string, 0, len(engaged))
+	for reader := range engaged {
+		readers = append(readers, reader)
+	}
+	sort.Strings(readers)
+
+	var sessions []ranking.Session
+	for _, reader := range readers {
+		connected := set(extra.Connections[reader])
+		session := ranking.Session{Reader: reader, Relevant: map[string]bool{}}
+		for _, candidate := range base {
+			if candidate.Author == reader || (len(connected) > 0 && !connected[candidate.Author]) {
+				continue
+			}
+			// The reader's own engagement is what is being predicted.
+			if e := engaged[reader][candidate.Id]; e != nil {
+				if e.liked {
+					candidate.Likes--
+					session.Relevant[candidate.Id] = true
+				}
+				if e.disliked {
+					candidate.Dislikes--
+				}
+				if e.commented > 0 {
+					candidate.Comments -= e.commented
+					session.Relevant[candidate.Id] = true
+				}
+			}
+			candidate.MutualConnections = shared(extra.Connections[candidate.Author], connected)
+			candidate.SharedSkills = shared(extra.Skills[candidate.Author], set(extra.Skills[reader]))
+			candidate.SharedInterests = shared(extra.Interests[candidate.Author], set(extra.Interests[reader]))
+			session.Candidates = append(session.Candidates, candidate)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func newest(posts []*model.Post) time.Time {
+	var latest time.Time
+	for _, post := range posts {
+		if post.DatePosted.After(latest) {
+			latest = post.DatePosted
+		}
+	}
+	if latest.IsZero() {
+		return time.Now()
+	}
+	return latest
+}
+
+func set(values []string) map[string]bool {
+	result := make(map[string]bool, len(values))
+	for _, value := range values {
+		result[strings.ToLower(value)] = true
+	}
+	return result
+}
+
+func shared(values []string, with map[string]bool) int {
+	count := 0
+	for _, value := range values {
+		if with[strings.ToLower(value)] {
+			count++
+		}
+	}
+	return count
+}
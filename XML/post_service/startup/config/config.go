@@ -6,7 +6,7 @@ type Config struct {
 	Port                           string
 	PostDBHost                     string
 	PostDBPort                     string
-	PublicKey                      string
+	JwksUrl                        string
 	UserCommandSubject             string
 	UserReplySubject               string
 	NatsHost                       string
@@ -15,8 +15,22 @@ type Config struct {
 	NatsPass                       string
 	PostNotificationCommandSubject string
 	PostNotificationReplySubject   string
-	JobCommandSubject  			   string
-	JobReplySubject    			   string
+	JobCommandSubject              string
+	JobReplySubject                string
+	RevocationSubject              string
+	RoleSubject                    string
+	TimelineSubject                string
+	ChangeSubject                  string
+	GrpcTlsCert                    string
+	GrpcTlsKey                     string
+	GrpcTlsCa                      string
+	GrpcTlsReload                  string
+	GrpcTlsCrlUrls                 string
+	GrpcTlsOcspUrl                 string
+	GrpcTlsFailOpen                string
+	GrpcTlsRecheck                 string
+	GrpcInsecure                   string
+	GrpcAllowedPeers               string
 }
 
 func NewConfig() *Config {
@@ -25,7 +39,7 @@ func NewConfig() *Config {
 		Port:                           os.Getenv("POST_SERVICE_PORT"),
 		PostDBHost:                     os.Getenv("POST_DB_HOST"),
 		PostDBPort:                     os.Getenv("POST_DB_PORT"),
-		PublicKey:                      "PostService",
+		JwksUrl:                        os.Getenv("JWKS_URL"),
 		UserCommandSubject:             os.Getenv("USER_COMMAND_SUBJECT"),
 		UserReplySubject:               os.Getenv("USER_REPLY_SUBJECT"),
 		NatsPort:                       os.Getenv("NATS_PORT"),
@@ -34,7 +48,29 @@ func NewConfig() *Config {
 		NatsUser:                       os.Getenv("NATS_USER"),
 		PostNotificationCommandSubject: os.Getenv("POST_NOTIFICATION_COMMAND_SUBJECT"),
 		PostNotificationReplySubject:   os.Getenv("POST_NOTIFICATION_REPLY_SUBJECT"),
-		JobCommandSubject:  			os.Getenv("JOB_COMMAND_SUBJECT"),
-		JobReplySubject:    			os.Getenv("JOB_REPLY_SUBJECT"),
+		JobCommandSubject:              os.Getenv("JOB_COMMAND_SUBJECT"),
+		JobReplySubject:                os.Getenv("JOB_REPLY_SUBJECT"),
+		RevocationSubject:              os.Getenv("REVOCATION_SUBJECT"),
+		RoleSubject:                    os.Getenv("ROLE_SUBJECT"),
+		TimelineSubject:                os.Getenv("TIMELINE_SUBJECT"),
+		ChangeSubject:                  os.Getenv("CHANGE_SUBJECT"),
+		GrpcTlsCert:                    os.Getenv("GRPC_TLS_CERT"),
+		GrpcTlsKey:                     os.Getenv("GRPC_TLS_KEY"),
+		GrpcTlsCa:                      os.Getenv("GRPC_TLS_CA"),
+		GrpcTlsReload:                  getEnvOrDefault("GRPC_TLS_RELOAD", "1m"),
+		GrpcTlsCrlUrls:                 os.Getenv("GRPC_TLS_CRL_URLS"),
+		GrpcTlsOcspUrl:                 os.Getenv("GRPC_TLS_OCSP_URL"),
+		GrpcTlsFailOpen:                getEnvOrDefault("GRPC_TLS_FAIL_OPEN", "false"),
+		GrpcTlsRecheck:                 getEnvOrDefault("GRPC_TLS_REVOCATION_REFRESH", "10m"),
+		GrpcInsecure:                   getEnvOrDefault("GRPC_INSECURE_DEV", "false"),
+		GrpcAllowedPeers:               getEnvOrDefault("GRPC_ALLOWED_PEERS", "api_gateway"),
 	}
 }
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -1,16 +1,25 @@
 package startup
 
 import (
+	"common/module/changes"
+	domainErrors "common/module/errors"
 	"common/module/interceptor"
+	"common/module/jwks"
 	"common/module/logger"
+	"common/module/permissions"
+	"common/module/policy"
 	postsProto "common/module/proto/posts_service"
+	"common/module/revocation"
 	saga "common/module/saga/messaging"
 	"common/module/saga/messaging/nats"
+	"common/module/timeline"
+	servicetls "common/module/tls"
 	"context"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"log"
 	"net"
 	"post/module/application"
@@ -19,6 +28,8 @@ import (
 	"post/module/infrastructure/orchestrators"
 	"post/module/infrastructure/persistence"
 	"post/module/startup/config"
+	"strconv"
+	"time"
 )
 
 type Server struct {
@@ -60,7 +71,8 @@ func (server *Server) Start() {
 	postHandler := server.InitPostHandler(postService, userService, logInfo, logError)
 	server.InitCreateUserCommandHandler(userService, postService, replyPublisher, commandSubscriber)
 
-	server.StartGrpcServer(postHandler, logError)
+	revocationList := server.InitRevocationList()
+	server.StartGrpcServer(postHandler, revocationList, logError)
 }
 
 func (server *Server) InitMongoClient() *mongo.Client {
@@ -87,7 +99,9 @@ func (server *Server) InitPostsRepo(client *mongo.Client) repositories.PostRepos
 }
 
 func (server *Server) InitPostService(repo repositories.PostRepository, logInfo *logger.Logger, logError *logger.Logger, porchestrator *orchestrators.PostOrchestrator, jorchestrator *orchestrators.JobOrchestrator) *application.PostService {
-	return application.NewPostService(repo, logInfo, logError, porchestrator, jorchestrator)
+	return application.NewPostService(repo, logInfo, logError, porchestrator, jorchestrator,
+		timeline.NewPublisher(server.InitPublisher(server.config.TimelineSubject)),
+		changes.NewPublisher(server.InitPublisher(server.config.ChangeSubject)))
 }
 
 func (server *Server) InitPostHandler(postService *application.PostService, userService *application.UserService, logInfo *logger.Logger, logError *logger.Logger) *handlers.PostHandler {
@@ -131,17 +145,22 @@ func (server *Server) InitCreateUserCommandHandler(userService *application.User
 	return handler
 }
 
-func (server *Server) StartGrpcServer(postHandler *handlers.PostHandler, logError *logger.Logger) {
+func (server *Server) StartGrpcServer(postHandler *handlers.PostHandler, revocationList *revocation.List, logError *logger.Logger) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", server.config.Port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(server.config.PublicKey))
-	intercept := interceptor.NewAuthInterceptor(config.AccessibleRoles(), publicKey, logError)
+	keys := jwks.NewCache(server.config.JwksUrl)
+	authPolicy := server.InitPolicy()
+	intercept := interceptor.NewAuthInterceptor(authPolicy, keys, revocationList, server.InitPermissionCache(authPolicy), logError)
 
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(intercept.Unary()))
+	grpcServer := grpc.NewServer(grpc.Creds(server.InitTransportCredentials(logError)), grpc.ChainUnaryInterceptor(domainErrors.UnaryServerInterceptor(logError), intercept.Unary()))
 	postsProto.RegisterPostServiceServer(grpcServer, postHandler)
 
+	err = authPolicy.CheckServer(grpcServer)
+	if err != nil {
+		log.Fatalf("failed to check policy: %v", err)
+	}
 	if err := grpcServer.Serve(listener); err != nil {
 		log.Fatalf("failed to serve: %s", err)
 	}
@@ -154,3 +173,81 @@ func (server *Server) InitJobOrchestrator(publisher saga.Publisher, subscriber s
 	}
 	return orchestrator
 }
+
+func (server *Server) InitRevocationList() *revocation.List {
+	list := revocation.NewList()
+	err := list.Listen(server.InitSubscriber(server.config.RevocationSubject, revocation.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = revocation.NewRevoker(server.InitPublisher(server.config.RevocationSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return list
+}
+
+func (server *Server) InitPolicy() *policy.Policy {
+	authPolicy, err := policy.Load()
+	if err != nil {
+		log.Fatalf("failed to load policy: %v", err)
+	}
+	return authPolicy
+}
+
+func (server *Server) InitPermissionCache(authPolicy *policy.Policy) *permissions.Cache {
+	cache := permissions.NewCache(authPolicy.Roles)
+	err := cache.Listen(server.InitSubscriber(server.config.RoleSubject, permissions.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = permissions.NewBroadcaster(server.InitPublisher(server.config.RoleSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return cache
+}
+
+func (server *Server) InitTransportCredentials(logError *logger.Logger) credentials.TransportCredentials {
+	if server.config.GrpcTlsCert == "" {
+		if !server.insecureDev() {
+			log.Fatal("GRPC_TLS_CERT is not set; set GRPC_INSECURE_DEV=true to serve gRPC without TLS in development")
+		}
+		logError.Logger.Errorf("ERR:GRPC_INSECURE_DEV SET, SERVING GRPC WITHOUT TLS")
+		return insecure.NewCredentials()
+	}
+	reload, err := time.ParseDuration(server.config.GrpcTlsReload)
+	if err != nil || reload <= 0 {
+		log.Fatalf("invalid GRPC_TLS_RELOAD %q", server.config.GrpcTlsReload)
+	}
+	identity, err := servicetls.LoadIdentity(server.config.GrpcTlsCert, server.config.GrpcTlsKey, server.config.GrpcTlsCa, logError)
+	if err != nil {
+		log.Fatalf("failed to load TLS identity: %v", err)
+	}
+	identity.CheckRevocation(server.InitRevocationChecker(logError))
+	identity.Watch(reload)
+	return identity.ServerCredentials(servicetls.Peers(server.config.GrpcAllowedPeers))
+}
+
+// insecureDev is the explicit opt-out from TLS for development setups
+// without certificates.
+func (server *Server) insecureDev() bool {
+	insecureDev, err := strconv.ParseBool(server.config.GrpcInsecure)
+	if err != nil {
+		log.Fatalf("invalid GRPC_INSECURE_DEV %q", server.config.GrpcInsecure)
+	}
+	return insecureDev
+}
+
+func (server *Server) InitRevocationChecker(logError *logger.Logger) *servicetls.RevocationChecker {
+	config, err := servicetls.ParseRevocationConfig(server.config.GrpcTlsCrlUrls, server.config.GrpcTlsOcspUrl,
+		server.config.GrpcTlsFailOpen, server.config.GrpcTlsRecheck)
+	if err != nil {
+		log.Fatalf("invalid certificate revocation settings: %v", err)
+	}
+	if !config.Enabled() {
+		logError.Logger.Errorf("ERR:GRPC_TLS_CRL_URLS AND GRPC_TLS_OCSP_URL NOT SET, NOT CHECKING CERTIFICATE REVOCATION")
+		return nil
+	}
+	return servicetls.NewRevocationChecker(config, logError)
+}
@@ -1,16 +1,18 @@
 package services
 
 import (
+	"common/module/changes"
+	domainErrors "common/module/errors"
 	"common/module/logger"
+	"common/module/mailer"
+	"common/module/onetimecode"
+	"common/module/revocation"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/trycourier/courier-go/v2"
-	"math/rand"
 	"net"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 	"user/module/domain/dto"
@@ -24,25 +26,45 @@ type UserService struct {
 	logInfo        *logger.Logger
 	logError       *logger.Logger
 	userRepository repositories.UserRepository
-	emailRepo      repositories.EmailVerificationRepository
-	recoveryRepo   repositories.PasswordRecoveryRequestRepository
+	codes          *onetimecode.Manager
+	mail           mailer.Mailer
 	orchestrator   *orchestrators.UserOrchestrator
+	revoker        *revocation.Revoker
+	changes        *changes.Publisher
 }
 
 var (
-	EmailFormatInvalid     = errors.New("EMAIL FORMAT INVALID")
-	EmailDomainInvalid     = errors.New("EMAIL DOMAIN INVALID")
+	ActivationCodePolicy = onetimecode.Policy{
+		Purpose:     onetimecode.Activation,
+		Digits:      8,
+		TTL:         time.Hour,
+		MaxAttempts: 5,
+	}
+	RecoveryCodePolicy = onetimecode.Policy{
+		Purpose:     onetimecode.PasswordRecovery,
+		Digits:      8,
+		TTL:         15 * time.Minute,
+		MaxAttempts: 5,
+	}
+)
+
+var (
+	EmailTaken = domainErrors.AlreadyExists(domainErrors.CodeEmailTaken, "Email already exists",
+		domainErrors.Field("email", "is taken"))
 	ErrorEmailVerification = errors.New("ERROR EMAIL VERIFICATION")
 	ErrorOrchestrator      = errors.New("ORCHESTRATOR")
 	DbError                = errors.New("DB ERROR")
-	ErrorCreatingUser      = errors.New("ERROR CREATING USER:check your email, you cant use the same email for 2 accounts")
-	subject                = "Activation code"
-	body                   = "Welcome to Dislinkt! Here is your activation code:"
 )
 
-func NewUserService(logInfo *logger.Logger, logError *logger.Logger, repository repositories.UserRepository, emailRepo repositories.EmailVerificationRepository,
-	recoveryRepo repositories.PasswordRecoveryRequestRepository, orchestrator *orchestrators.UserOrchestrator) *UserService {
-	return &UserService{logInfo, logError, repository, emailRepo, recoveryRepo, orchestrator}
+// invalidEmail tells the caller why their email address was refused.
+func invalidEmail(description string) *domainErrors.Error {
+	return domainErrors.InvalidArgument(domainErrors.CodeValidationFailed, "Email address is not valid",
+		domainErrors.Field("email", description))
+}
+
+func NewUserService(logInfo *logger.Logger, logError *logger.Logger, repository repositories.UserRepository, codes *onetimecode.Manager,
+	mail mailer.Mailer, orchestrator *orchestrators.UserOrchestrator, revoker *revocation.Revoker, changes *changes.Publisher) *UserService {
+	return &UserService{logInfo, logError, repository, codes, mail, orchestrator, revoker, changes}
 }
 
 func (u UserService) GetUsers() ([]model.User, error) {
@@ -51,7 +73,7 @@ func (u UserService) GetUsers() ([]model.User, error) {
 	if err != nil {
 		fmt.Sprintln("evo ovde sam puko - service")
 		u.logError.Logger.Errorf("ERR:CANT GET USERS")
-		return nil, errors.New("cant get users")
+		return nil, domainErrors.Internal(err)
 	}
 
 	return users, err
@@ -105,38 +127,42 @@ func (u UserService) CreateRegisteredUser(user *model.User) (*model.User, error)
 
 	var er = checkEmailValid(user.Email)
 	if er != nil {
-		u.logError.Logger.Println(EmailFormatInvalid)
-		return nil, EmailFormatInvalid
+		u.logError.Logger.Errorf("ERR:EMAIL FORMAT INVALID")
+		return nil, er
 	}
 	var domEr = checkEmailDomain(user.Email)
 	if domEr != nil {
-		u.logError.Logger.Println(EmailDomainInvalid)
-		return nil, EmailDomainInvalid
+		u.logError.Logger.Errorf("ERR:EMAIL DOMAIN INVALID")
+		return nil, domEr
+	}
+	if u.CheckIfEmailExists(user.ID, user.Email) {
+		u.logError.Logger.Errorf("ERR:EMAIL ALREADY EXISTS")
+		return nil, EmailTaken
 	}
-
-	rand.Seed(time.Now().UnixNano())
-	rn := rand.Intn(100000)
 
 	regUser, err := u.userRepository.CreateRegisteredUser(user)
 	if err != nil {
 		u.logError.Logger.Println(DbError)
-		return regUser, ErrorCreatingUser
-	}
-	emailVerification := model.EmailVerification{
-		ID:       uuid.New(),
-		Username: user.Username,
-		Email:    user.Email,
-		VerCode:  rn,
-		Time:     time.Now(),
+		return regUser, domainErrors.Internal(err)
 	}
 
-	_, e := u.emailRepo.CreateEmailVerification(&emailVerification)
-	fmt.Println(e)
+	code, e := u.codes.Issue(ActivationCodePolicy, user.Username)
 	if e != nil {
 		u.logError.Logger.Println(ErrorEmailVerification)
-		return nil, ErrorEmailVerification
+		return nil, domainErrors.Internal(e)
+	}
+	message, e := mailer.ActivationEmail(user.Email, mailer.ActivationData{
+		Username:  user.Username,
+		Code:      code,
+		ExpiresIn: ActivationCodePolicy.TTL,
+	})
+	if e == nil {
+		e = u.mail.Send(context.TODO(), message)
+	}
+	if e != nil {
+		u.logError.Logger.Errorf("ERR:SENDING ACTIVATION MAIL: %v", e)
+		return nil, domainErrors.Internal(e)
 	}
-	sendMailWithCourier(user.Email, strconv.Itoa(rn), subject, body, u.logError)
 
 	err = u.orchestrator.CreateUser(user)
 	if err != nil {
@@ -153,80 +179,36 @@ func (u UserService) CreateRegisteredUser(user *model.User) (*model.User, error)
 	return regUser, nil
 }
 
-func (u UserService) ActivateUserAccount(username string, verCode int) (bool, error) {
+func (u UserService) ActivateUserAccount(username string, verCode string) (bool, error) {
 
-	var allVerForUsername []model.EmailVerification
-	var dbEr error
-	allVerForUsername, dbEr = u.emailRepo.GetVerificationByUsername(username)
-	if dbEr != nil {
-		u.logError.Logger.Errorf("ERR:DB:CODE DOES NOT EXIST FOR USER")
-		return false, dbEr
-	}
-	codeInfoForUsername, err := findMostRecent(allVerForUsername)
+	err := u.codes.Redeem(ActivationCodePolicy, username, verCode)
 	if err != nil {
-		u.logError.Logger.Errorf("ERR:NO VERIFICATION FOR USER")
+		u.logError.Logger.Errorf("ERR:ACTIVATION CODE REJECTED: " + err.Error())
 		return false, err
 	}
 
-	if codeInfoForUsername.VerCode == verCode {
-
-		if codeInfoForUsername.Time.Add(time.Hour).After(time.Now()) {
-			user, err := u.userRepository.GetByUsername(context.TODO(), username)
-			if err != nil {
-				fmt.Println(err)
-				u.logError.Logger.Errorf("ERR:DB")
-				return false, err
-			}
-			user.IsConfirmed = true
-			activated, actErr := u.userRepository.ActivateUserAccount(user)
-			err = u.orchestrator.ActivateUserAccount(user)
-			if err != nil {
-				return false, err
-			}
-
-			if actErr != nil {
-				u.logError.Logger.Errorf("ERR:WHILE ACTIVATING USER")
-				return false, actErr
-			}
-			if !activated {
-				u.logError.Logger.Errorf("ERR:ACTIVATION FAILED")
-				return false, errors.New("user not activated")
-			}
-			fmt.Println("uspeoo sam da ga aktiviram")
-			return true, nil
-
-		} else {
-			u.logError.Logger.Errorf("ERR:CODE EXPIRED")
-			return false, errors.New("code expired")
-		}
-	} else {
-		u.logError.Logger.Errorf("ERR:WRONG CODE")
-		return false, errors.New("wrong code")
+	user, err := u.userRepository.GetByUsername(context.TODO(), username)
+	if err != nil {
+		fmt.Println(err)
+		u.logError.Logger.Errorf("ERR:DB")
+		return false, err
 	}
-}
-
-func findMostRecent(verifications []model.EmailVerification) (*model.EmailVerification, error) {
-
-	if len(verifications) > 1 {
-		latest := verifications[0]
-		latestIdx := 0
-		fmt.Println(latest)
-		fmt.Println(latestIdx)
-		for i, ver := range verifications {
-			if ver.Time.After(latest.Time) {
-				latest = ver
-				latestIdx = i
-			}
-		}
-		return &latest, nil
-	} else {
-		if len(verifications) > 0 {
-			return &verifications[0], nil
-		} else {
-			return nil, errors.New("verifications array empty ")
-		}
+	user.IsConfirmed = true
+	activated, actErr := u.userRepository.ActivateUserAccount(user)
+	err = u.orchestrator.ActivateUserAccount(user)
+	if err != nil {
+		return false, err
 	}
 
+	if actErr != nil {
+		u.logError.Logger.Errorf("ERR:WHILE ACTIVATING USER")
+		return false, actErr
+	}
+	if !activated {
+		u.logError.Logger.Errorf("ERR:ACTIVATION FAILED")
+		return false, domainErrors.Internal(errors.New("user not activated"))
+	}
+	return true, nil
 }
 
 func (u UserService) SendCodeToRecoveryMail(username string) (bool, error) {
@@ -238,28 +220,8 @@ func (u UserService) SendCodeToRecoveryMail(username string) (bool, error) {
 		return false, err
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	rn := rand.Intn(100000)
-	recovery := model.PasswordRecoveryRequest{
-		ID:            uuid.New(),
-		Username:      username,
-		Email:         user.Email,
-		RecoveryEmail: user.RecoveryEmail,
-		IsUsed:        false,
-		Time:          time.Now(),
-		RecoveryCode:  rn,
-	}
-
-	fmt.Println(recovery)
-
-	//obrisi prethodni zahtev ako postoji jer eto da uvijek samo poslednji ima u bazi
-	deleteErr := u.recoveryRepo.ClearOutRequestsForUsername(username)
-	if deleteErr != nil {
-		return false, deleteErr
-	}
-	_, e := u.recoveryRepo.CreatePasswordRecoveryRequest(&recovery)
-
-	fmt.Println(e)
+	// Issuing a new code drops the previous one, so only the last request counts.
+	code, e := u.codes.Issue(RecoveryCodePolicy, username)
 	if e != nil {
 		u.logError.Logger.Println("ERR:PASS RECOVERY REQ")
 		return false, e
@@ -267,103 +229,83 @@ func (u UserService) SendCodeToRecoveryMail(username string) (bool, error) {
 		u.logInfo.Logger.Infof("INFO:CREATED PASS RECOVERY")
 	}
 
-	//mzd staviti da ovo vraca bool i da ima parametar poruku i zaglavlje
-	sendMailWithCourier(user.RecoveryEmail, strconv.Itoa(rn), "Password recovery code", "Here is your code:", u.logInfo)
+	message, e := mailer.RecoveryEmail(user.RecoveryEmail, mailer.RecoveryData{
+		Username:  username,
+		Code:      code,
+		ExpiresIn: RecoveryCodePolicy.TTL,
+	})
+	if e == nil {
+		e = u.mail.Send(context.TODO(), message)
+	}
+	if e != nil {
+		u.logError.Logger.Errorf("ERR:SENDING RECOVERY MAIL: %v", e)
+		return false, e
+	}
 	return true, nil
 }
 
 func (u UserService) CreateNewPassword(username string, newHashedPassword string, code string) (bool, error) {
 
-	var passwordRecoveryRequest *model.PasswordRecoveryRequest
-	var dbEr error
-	passwordRecoveryRequest, dbEr = u.recoveryRepo.GetPasswordRecoveryRequestByUsername(username)
-
-	if dbEr != nil {
-		u.logError.Logger.Errorf("ERR:THERE IS NOT A PASS RECOVERY REQUEST IN DATABASE FOR USER:" + username)
-		fmt.Println(dbEr)
-
-		return false, dbEr
-	}
-	fmt.Println("verCode:", passwordRecoveryRequest.RecoveryCode)
-
-	var codeInt, convErr = strconv.Atoi(code)
-	if convErr != nil {
-		u.logError.Logger.Errorf("ERR:CONVERTING CODE TO INT")
-		return false, errors.New("error converting code to int")
-	}
-	if passwordRecoveryRequest.RecoveryCode == codeInt {
-		//kao dala sam kodu trajanje od 1h
-		fmt.Println("kod se poklapa")
-		if passwordRecoveryRequest.Time.Add(time.Minute * 3).After(time.Now()) {
-			if !passwordRecoveryRequest.IsUsed {
-				fmt.Println("vreme se uklapa")
-				//ako je kod ok i ako je u okviru vremena trajanja mjenjamo mu status
-				user, err := u.userRepository.GetByUsername(context.TODO(), username)
-				if err != nil {
-					fmt.Println(err)
-					u.logError.Logger.Errorf("ERR:NO USER")
-					fmt.Println("error u get by username kod ucitavanja usera")
-					return false, err
-				}
-
-				fmt.Println(user.Username)
-
-				//sacuvati izmjene korisnika,tj izmjenjen password
-				changePassErr := u.userRepository.ChangePassword(user, newHashedPassword)
-				if changePassErr != nil {
-					fmt.Println("error pri cuvanju novog pass")
-					u.logError.Logger.Errorf("ERR:SAVING NEW PASSWORD")
-					return false, changePassErr
-				}
-				//staviti iskoristen kod na true
-
-				//service.Repo.ActivateUserAccount(user)
-				_, er := u.userRepository.GetByUsername(context.TODO(), username)
-				if er != nil {
-					fmt.Println(er)
-
-					u.logError.Logger.Errorf("ERR:NO USER")
-					fmt.Println("FAK MAJ LAJF 2")
-					return false, er
-				}
-				return true, nil
-			} else {
-				fmt.Println("kod iskoristen")
-				u.logError.Logger.Errorf("ERR:CODE USED")
-				return false, errors.New("code used")
-			}
-
-		} else {
-			fmt.Println("istekao kod")
-			u.logError.Logger.Errorf("ERR:CODE EXPIRED")
-			return false, errors.New("code expired")
-		}
+	err := u.codes.Redeem(RecoveryCodePolicy, username, code)
+	if err != nil {
+		u.logError.Logger.Errorf("ERR:RECOVERY CODE REJECTED FOR USER:" + username + ": " + err.Error())
+		return false, err
+	}
 
-	} else {
-		fmt.Println("ne valjda kod")
-		u.logError.Logger.Errorf("ERR:WRONG CODE")
-		return false, errors.New("wrong code")
+	user, err := u.userRepository.GetByUsername(context.TODO(), username)
+	if err != nil {
+		fmt.Println(err)
+		u.logError.Logger.Errorf("ERR:NO USER")
+		return false, err
+	}
+
+	changePassErr := u.userRepository.ChangePassword(user, newHashedPassword)
+	if changePassErr != nil {
+		u.logError.Logger.Errorf("ERR:SAVING NEW PASSWORD")
+		return false, changePassErr
+	}
+	u.RevokeAllSessions(user.Username)
+	return true, nil
+}
+
+// PublishUserUpdated tells the gateway to drop what it cached about the
+// user. The change is made already, so failing to announce it only logs.
+func (u UserService) PublishUserUpdated(username string) {
+	err := u.changes.UserUpdated(username)
+	if err != nil {
+		u.logError.Logger.Errorf("ERR:PUBLISHING USER UPDATED:" + username)
 	}
 }
 
+// RevokeAllSessions logs the user out everywhere; every token issued to them
+// so far is rejected by the services from now on.
+func (u UserService) RevokeAllSessions(username string) {
+	err := u.revoker.RevokeUserSessions(username)
+	if err != nil {
+		u.logError.Logger.Errorf("ERR:REVOKING SESSIONS FOR USER:" + username)
+		return
+	}
+	u.logInfo.Logger.Infof("INFO:REVOKED ALL SESSIONS FOR USER:" + username)
+}
+
 func checkEmailValid(email string) error {
 	// check email syntax is valid
 	//func MustCompile(str string) *Regexp
 	emailRegex, err := regexp.Compile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	if err != nil {
 		fmt.Println(err)
-		return errors.New("sorry, something went wrong")
+		return domainErrors.Internal(err)
 	}
 	rg := emailRegex.MatchString(email)
 	if !rg {
-		return errors.New("email address is not a valid syntax, please check again")
+		return invalidEmail("is not a valid email address")
 	}
 	// check email length
 	if len(email) < 4 {
-		return errors.New("email length is too short")
+		return invalidEmail("is too short")
 	}
 	if len(email) > 253 {
-		return errors.New("email length is too long")
+		return invalidEmail("is too long")
 	}
 	return nil
 }
@@ -374,40 +316,11 @@ func checkEmailDomain(email string) error {
 	// func LookupMX(name string) ([]*MX, error)
 	_, err := net.LookupMX(host)
 	if err != nil {
-		err = errors.New("eould not find email's domain server, please chack and try again")
-		return err
+		return invalidEmail("has a domain without a mail server")
 	}
 	return nil
 }
 
-func sendMailWithCourier(email string, code string, subject string, body string, logErr *logger.Logger) {
-	client := courier.CreateClient("pk_prod_0FQXVBPMDHMZ3VJ3WN6CYC12KNMH", nil)
-	fmt.Println(code)
-	requestID, err := client.SendMessage(
-		context.Background(),
-		courier.SendMessageRequestBody{
-			Message: map[string]interface{}{
-				"to": map[string]string{
-					"email": email,
-				},
-				"content": map[string]string{
-					"title": subject,
-					"body":  body + code,
-				},
-				"data": map[string]string{
-					"joke": "What did C++ say to C? You have no class.",
-					"code": code,
-				},
-			},
-		})
-
-	if err != nil {
-		logErr.Logger.Println("ERR:SENDING MAIL")
-		fmt.Println(err)
-	}
-	fmt.Println(requestID)
-}
-
 func (u UserService) EditUser(userDetails *dto.UserDetails) (*model.User, error) {
 	user, err := u.GetByUsername(context.TODO(), userDetails.Username)
 	if err != nil {
@@ -419,7 +332,7 @@ func (u UserService) EditUser(userDetails *dto.UserDetails) (*model.User, error)
 		return nil, e
 	}
 	if !edited {
-		return nil, errors.New("user was not edited")
+		return nil, domainErrors.Internal(errors.New("user was not edited"))
 	}
 	err = u.orchestrator.UpdateUser(user)
 	if err != nil {
@@ -429,6 +342,7 @@ func (u UserService) EditUser(userDetails *dto.UserDetails) (*model.User, error)
 	if err != nil {
 		return nil, err
 	}
+	u.PublishUserUpdated(user.Username)
 	return user, nil
 }
 
@@ -443,12 +357,13 @@ func (u UserService) ChangeProfileStatus(username string, newStatus string) (*mo
 		return nil, e
 	}
 	if !edited {
-		return nil, errors.New("user status was not edited")
+		return nil, domainErrors.Internal(errors.New("user status was not edited"))
 	}
 	err = u.orchestrator.ChangeProfileStatus(user)
 	if err != nil {
 		return nil, err
 	}
+	u.PublishUserUpdated(user.Username)
 	return user, nil
 }
 
@@ -463,13 +378,14 @@ func (u UserService) EditUserPersonalDetails(userPersonalDetails *dto.UserPerson
 		return nil, e
 	}
 	if !edited {
-		return nil, errors.New("user was not edited")
+		return nil, domainErrors.Internal(errors.New("user was not edited"))
 	}
 	err = u.orchestrator.EditConnectionUser(user)
 	if err != nil {
 		return nil, err
 	}
 	err = u.orchestrator.UpdateUser(user)
+	u.PublishUserUpdated(user.Username)
 	return user, nil
 }
 
@@ -490,8 +406,9 @@ func (u UserService) EditUserProfessionalDetails(userProfessionalDetails *dto.Us
 		return nil, e
 	}
 	if !edited {
-		return nil, errors.New("user was not edited")
+		return nil, domainErrors.Internal(errors.New("user was not edited"))
 	}
+	u.PublishUserUpdated(user.Username)
 	//err = u.orchestrator.EditConnectionUser(user)
 	//if err != nil {
 	//	return nil, err
@@ -545,6 +462,8 @@ func (u UserService) UpdateEmail(ctx context.Context, user *model.User) (*model.
 		if er != nil {
 			return nil, er
 		}
+		u.RevokeAllSessions(user.Username)
+		u.PublishUserUpdated(user.Username)
 		return user, nil
 	} else {
 		return nil, nil
@@ -552,12 +471,18 @@ func (u UserService) UpdateEmail(ctx context.Context, user *model.User) (*model.
 }
 
 func (u UserService) UpdateUsername(ctx context.Context, user *model.User) (*model.User, error) {
+	previous, err := u.userRepository.GetById(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
 	result, err := u.userRepository.UpdateUsername(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 	if result {
 		user, _ := u.userRepository.GetById(ctx, user.ID)
+		u.PublishUserUpdated(previous.Username)
+		u.PublishUserUpdated(user.Username)
 		return user, nil
 	} else {
 		return nil, nil
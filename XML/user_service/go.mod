@@ -13,7 +13,6 @@ require (
 	github.com/mattevans/pwned-passwords v0.5.0
 	github.com/microcosm-cc/bluemonday v1.0.18
 	github.com/sirupsen/logrus v1.8.1
-	github.com/trycourier/courier-go/v2 v2.5.0
 	golang.org/x/crypto v0.0.0-20220315160706-3147a52a75dd
 	google.golang.org/grpc v1.46.2
 	gopkg.in/go-playground/validator.v9 v9.31.0
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	domainErrors "common/module/errors"
+	"common/module/onetimecode"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"gopkg.in/go-playground/validator.v9"
+	"strings"
+)
+
+var (
+	errUnsafeInput = domainErrors.InvalidArgument(domainErrors.CodeUnsafeInput,
+		"Fields are empty or contain characters that aren't allowed")
+	errUserNotFound = domainErrors.NotFound(domainErrors.CodeUserNotFound, "User not found")
+	errWeakPassword = domainErrors.InvalidArgument(domainErrors.CodeWeakPassword, "Password format is not valid",
+		domainErrors.Field("password", "needs an upper and a lower case letter, a digit and a special character, and no spaces"))
+	errApiTokensAtGateway = domainErrors.New(codes.Unimplemented, domainErrors.CodeUnimplemented,
+		"API tokens are issued by the gateway")
+)
+
+// validationError lists the fields the validator rejected, by their JSON
+// names.
+func validationError(err error) *domainErrors.Error {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return domainErrors.Internal(err)
+	}
+	fields := make([]domainErrors.FieldViolation, len(invalid))
+	for i, field := range invalid {
+		name := field.Field()
+		fields[i] = domainErrors.Field(strings.ToLower(name[:1])+name[1:], "failed the "+field.Tag()+" check")
+	}
+	return domainErrors.InvalidArgument(domainErrors.CodeValidationFailed, "Some fields are invalid", fields...)
+}
+
+// codeError tells the caller why a one-time code was refused.
+func codeError(err error) *domainErrors.Error {
+	switch {
+	case errors.Is(err, onetimecode.ErrTooManyAttempts):
+		return domainErrors.ResourceExhausted(domainErrors.CodeInvalidCode, "Too many attempts, request a new code")
+	case errors.Is(err, onetimecode.ErrInvalidCode), errors.Is(err, onetimecode.ErrCodeExpired),
+		errors.Is(err, onetimecode.ErrCodeUsed), errors.Is(err, onetimecode.ErrInvalidLink):
+		return domainErrors.InvalidArgument(domainErrors.CodeInvalidCode, "The code is invalid or expired")
+	}
+	return domainErrors.Internal(err)
+}
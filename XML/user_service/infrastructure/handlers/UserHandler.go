@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	common "common/module"
+	domainErrors "common/module/errors"
 	"common/module/interceptor"
 	"common/module/logger"
 	pb "common/module/proto/user_service"
@@ -15,13 +16,10 @@ import (
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"gopkg.in/go-playground/validator.v9"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"strconv"
 	"strings"
 	"user/module/application/helpers"
 	"user/module/application/services"
@@ -48,44 +46,10 @@ func NewUserHandler(logInfo *logger.Logger, logError *logger.Logger, service *se
 	return &UserHandler{logInfo, logError, service, jsonConv, validator, passwordUtil, pwnedClient, tokenService}
 }
 
+// GenerateAPIToken is served by the gateway, which signs API tokens with its
+// own keys; the route generated for it never reaches this service.
 func (u UserHandler) GenerateAPIToken(ctx context.Context, request *pb.GenerateTokenRequest) (*pb.ApiToken, error) {
-	username := request.Username.Username
-	policy := bluemonday.UGCPolicy()
-	username = strings.TrimSpace(policy.Sanitize(username))
-	sqlInj := common.BadUsername(username)
-	userNameCtx := fmt.Sprintf(ctx.Value(interceptor.LoggedInUserKey{}).(string))
-	if username == "" {
-		u.logError.Logger.WithFields(logrus.Fields{
-			"user": userNameCtx,
-		}).Errorf("ERR:XSS")
-		return nil, status.Error(codes.FailedPrecondition, "fields are empty or xss happened")
-	} else if sqlInj {
-		u.logError.Logger.WithFields(logrus.Fields{
-			"user": userNameCtx,
-		}).Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		return nil, status.Error(codes.FailedPrecondition, "there is chance of sql injection happening")
-	} else {
-		u.logInfo.Logger.WithFields(logrus.Fields{
-			"user": userNameCtx,
-		}).Infof("INFO:GenerateAPIToken")
-	}
-	existsErr := u.service.UserExists(username)
-	if existsErr != nil {
-		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST:" + username)
-		return nil, status.Error(codes.Internal, existsErr.Error())
-	}
-	user, er := u.service.GetByUsername(context.TODO(), username)
-	if er != nil {
-		return nil, status.Error(codes.Internal, er.Error())
-	}
-	token, tokenErr := u.tokenService.GenerateApiToken(user)
-	if tokenErr != nil {
-		u.logError.Logger.WithFields(logrus.Fields{
-			"user": userNameCtx,
-		}).Errorf("ERR:GEN TOKEN")
-		return nil, status.Error(codes.Internal, tokenErr.Error())
-	}
-	return &pb.ApiToken{ApiToken: token}, nil
+	return nil, errApiTokensAtGateway
 }
 
 func (u UserHandler) ShareJobOffer(ctx context.Context, request *pb.ShareJobOfferRequest) (*pb.EmptyRequest, error) {
@@ -125,7 +89,7 @@ func (u UserHandler) ShareJobOffer(ctx context.Context, request *pb.ShareJobOffe
 	}
 	if !hasAccess {
 		u.logError.Logger.Errorf("ERR:DOES NOT HAVE ACCCESS")
-		return &pb.EmptyRequest{}, errors.New("you don't have access")
+		return &pb.EmptyRequest{}, domainErrors.PermissionDenied(domainErrors.CodePermissionDenied, "The API token doesn't grant access")
 	}
 
 	postBody, _ := json.Marshal(map[string]any{
@@ -159,7 +123,7 @@ func (u UserHandler) ActivateUserAccount(ctx context.Context, request *pb.Activa
 	err := u.validator.Struct(requestDto)
 	if err != nil {
 		u.logError.Logger.Errorf("ERR:INVALID REQ FIELDS")
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, err
+		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, validationError(err)
 	}
 	policy := bluemonday.UGCPolicy()
 	requestDto.Username = strings.TrimSpace(policy.Sanitize(requestDto.Username))
@@ -169,31 +133,25 @@ func (u UserHandler) ActivateUserAccount(ctx context.Context, request *pb.Activa
 	p2 := common.BadNumber(requestDto.Code)
 	if requestDto.Username == "" || requestDto.Code == "" {
 		u.logError.Logger.Errorf("ERR:XSS")
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, errors.New("fields are empty or xss happened")
+		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, errUnsafeInput
 	} else if p1 || p2 {
 		u.logError.Logger.Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, errors.New("there is chance of sql injection happening")
+		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, errUnsafeInput
 	} else {
 		u.logInfo.Logger.Infof("INFO:Handling ActivateUserAccount")
 	}
 	existsErr := u.service.UserExists(requestDto.Username)
 	if existsErr != nil {
 		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, existsErr
+		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, errUserNotFound
 	}
 
-	var code int
-	code, convertError := strconv.Atoi(requestDto.Code)
-	if convertError != nil {
-		u.logError.Logger.Errorf("ERR:CONVERT")
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, convertError
-	}
-	activated, e := u.service.ActivateUserAccount(requestDto.Username, code)
+	activated, e := u.service.ActivateUserAccount(requestDto.Username, requestDto.Code)
 	if e != nil {
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, e
+		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, codeError(e)
 	}
 	if !activated {
-		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, errors.New("account activation failed")
+		return &pb.ActivationResponse{Activated: false, Username: requestDto.Username}, domainErrors.Internal(errors.New("account activation failed"))
 	}
 	return &pb.ActivationResponse{Activated: activated, Username: requestDto.Username}, nil
 }
@@ -206,7 +164,7 @@ func (u UserHandler) GetAll(ctx context.Context, request *pb.EmptyRequest) (*pb.
 	users, err := u.service.GetUsers()
 	if err != nil {
 		fmt.Sprintln("evo ovde sam puko - handler")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, domainErrors.FromError(err)
 	}
 	response := &pb.GetAllResponse{
 		Users: []*pb.User{},
@@ -231,17 +189,18 @@ func (u UserHandler) RegisterUser(ctx context.Context, request *pb.RegisterUserR
 	newUser := api.MapPbUserToNewUserDto(request)
 	if err := u.validator.Struct(newUser); err != nil {
 		u.logError.Logger.Errorf("ERR:INVALID REQ FILEDS")
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
+		return nil, validationError(err)
 	}
 	log := api.SanitizeUser(newUser)
 	if log != "" {
 		u.logError.Logger.Errorf(log)
-		return nil, status.Error(codes.FailedPrecondition, log)
+		return nil, errUnsafeInput
 	}
 	err := u.service.UserExists(newUser.Username)
 	if err == nil {
 		u.logError.Logger.Errorf("USER ALREADY EXISTS")
-		return nil, status.Error(codes.AlreadyExists, "user already exists")
+		return nil, domainErrors.AlreadyExists(domainErrors.CodeUsernameTaken, "Username already exists",
+			domainErrors.Field("username", "is taken"))
 	}
 	var hashedSaltedPassword = ""
 	validPassword := u.passwordUtil.IsValidPassword(newUser.Password)
@@ -251,18 +210,20 @@ func (u UserHandler) RegisterUser(ctx context.Context, request *pb.RegisterUserR
 		if err != nil {
 			fmt.Println(err)
 			u.logError.Logger.Errorf("ERR:BCRYPT")
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, domainErrors.Internal(err)
 		}
 		hashedSaltedPassword = string(pass)
 	} else {
 		u.logError.Logger.Errorf("ERR:PASSWORD FORMAT NOT VALID")
-		return nil, status.Error(codes.FailedPrecondition, "password format is not valid")
+		return nil, errWeakPassword
 	}
 	newUser.Password = hashedSaltedPassword
 	registeredUser, er := u.service.CreateRegisteredUser(api.MapDtoToUser(newUser))
 
+	// The service tells invalid and taken email addresses apart from its own
+	// failures, which FromError hides.
 	if er != nil {
-		return nil, status.Error(codes.Internal, er.Error())
+		return nil, domainErrors.FromError(er)
 	}
 
 	return &pb.RegisterUserResponse{RegisteredUser: api.MapUserToPbResponseUser(registeredUser)}, nil
@@ -275,17 +236,17 @@ func (u UserHandler) SendRequestForPasswordRecovery(ctx context.Context, request
 	sqlInj := common.BadUsername(requestUsername)
 	if requestUsername == "" {
 		u.logError.Logger.Errorf("ERR:XSS")
-		return &pb.PasswordRecoveryResponse{CodeSent: false}, errors.New("fields are empty or xss happened")
+		return &pb.PasswordRecoveryResponse{CodeSent: false}, errUnsafeInput
 	} else if sqlInj {
 		u.logError.Logger.Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		return nil, errors.New("there is chance for sql injection")
+		return nil, errUnsafeInput
 	} else {
 		u.logInfo.Logger.Println("INFO:Handling PASSWORD RECOVERY ")
 	}
 	existsErr := u.service.UserExists(requestUsername)
 	if existsErr != nil {
 		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
-		return &pb.PasswordRecoveryResponse{CodeSent: false}, existsErr
+		return &pb.PasswordRecoveryResponse{CodeSent: false}, errUserNotFound
 	}
 
 	codeSent, codeErr := u.service.SendCodeToRecoveryMail(requestUsername)
@@ -295,7 +256,7 @@ func (u UserHandler) SendRequestForPasswordRecovery(ctx context.Context, request
 	}
 	if !codeSent {
 		u.logError.Logger.Errorf("ERR:ACCOUNT ACTIVATION FAILED")
-		return &pb.PasswordRecoveryResponse{CodeSent: false}, errors.New("account activation failed")
+		return &pb.PasswordRecoveryResponse{CodeSent: false}, domainErrors.Internal(errors.New("recovery code not sent"))
 	}
 
 	return &pb.PasswordRecoveryResponse{CodeSent: true}, nil
@@ -307,7 +268,7 @@ func (u UserHandler) RecoverPassword(ctx context.Context, request *pb.NewPasswor
 	err := u.validator.Struct(requestDto)
 	if err != nil {
 		u.logError.Logger.Error("ERR:INVALID REQ FIELDS")
-		return &pb.NewPasswordResponse{PasswordChanged: false}, err
+		return &pb.NewPasswordResponse{PasswordChanged: false}, validationError(err)
 	}
 	policy := bluemonday.UGCPolicy()
 	//sanitize everything
@@ -320,10 +281,10 @@ func (u UserHandler) RecoverPassword(ctx context.Context, request *pb.NewPasswor
 	p3 := common.BadPassword(requestDto.NewPassword)
 	if requestDto.Username == "" || requestDto.Code == "" || requestDto.NewPassword == "" {
 		u.logError.Logger.Error("ERR:XSS")
-		return &pb.NewPasswordResponse{PasswordChanged: false}, errors.New("fields are empty or xss happened")
+		return &pb.NewPasswordResponse{PasswordChanged: false}, errUnsafeInput
 	} else if p1 || p2 || p3 {
 		u.logError.Logger.Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		return nil, errors.New("there is chance for sql injection")
+		return nil, errUnsafeInput
 	} else {
 		u.logInfo.Logger.Println("INFO:Handling RecoverPassword")
 	}
@@ -331,7 +292,7 @@ func (u UserHandler) RecoverPassword(ctx context.Context, request *pb.NewPasswor
 	existsErr := u.service.UserExists(requestDto.Username)
 	if existsErr != nil {
 		u.logError.Logger.Errorf("USER DOES NOT EXIST")
-		return &pb.NewPasswordResponse{PasswordChanged: false}, existsErr
+		return &pb.NewPasswordResponse{PasswordChanged: false}, errUserNotFound
 	}
 	///////////////////
 	var hashedSaltedPassword = ""
@@ -342,7 +303,7 @@ func (u UserHandler) RecoverPassword(ctx context.Context, request *pb.NewPasswor
 		if err != nil {
 			fmt.Println(err)
 			u.logError.Logger.Errorf("ERR:BCRYPT")
-			return &pb.NewPasswordResponse{PasswordChanged: false}, err
+			return &pb.NewPasswordResponse{PasswordChanged: false}, domainErrors.Internal(err)
 		}
 
 		hashedSaltedPassword = string(pass)
@@ -350,17 +311,17 @@ func (u UserHandler) RecoverPassword(ctx context.Context, request *pb.NewPasswor
 	} else {
 		fmt.Println("Password format is not valid!")
 		u.logError.Logger.Errorf("ERR:PASSWORD FORMAT NOT VALID")
-		return &pb.NewPasswordResponse{PasswordChanged: false}, errors.New("password format is not valid")
+		return &pb.NewPasswordResponse{PasswordChanged: false}, errWeakPassword
 	}
 	passChanged, err := u.service.CreateNewPassword(requestDto.Username, hashedSaltedPassword, requestDto.Code)
 	if err != nil {
 		//http.Error(rw, err.Error(), http.StatusConflict) //409
-		return &pb.NewPasswordResponse{PasswordChanged: false}, err
+		return &pb.NewPasswordResponse{PasswordChanged: false}, codeError(err)
 	}
 	if !passChanged {
 		//http.Error(rw, "error changing password", http.StatusConflict) //409
 		u.logError.Logger.Errorf("ERR:CHANGING PASSWORD")
-		return &pb.NewPasswordResponse{PasswordChanged: false}, errors.New("error changing password")
+		return &pb.NewPasswordResponse{PasswordChanged: false}, domainErrors.Internal(errors.New("password not changed"))
 	}
 	return &pb.NewPasswordResponse{PasswordChanged: true}, nil
 }
@@ -374,10 +335,10 @@ func (u UserHandler) PwnedPassword(ctx context.Context, request *pb.PwnedRequest
 	if pwnedPassword == "" {
 		u.logError.Logger.Errorf("XSS")
 		//http.Error(rw, "Fields are empty or xss attack happened! error:"+err.Error(), http.StatusExpectationFailed) //400
-		return &pb.PwnedResponse{Pwned: true, Message: "fields are empty or xss happened"}, errors.New("fields are empty or xss happened")
+		return &pb.PwnedResponse{Pwned: true, Message: "fields are empty or xss happened"}, errUnsafeInput
 	} else if sqlInj {
 		u.logError.Logger.Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		return nil, errors.New("there is chance for sql injection")
+		return nil, errUnsafeInput
 	} else {
 		u.logInfo.Logger.Println("INFO:Handling PWNED PASSWORD")
 	}
@@ -385,7 +346,7 @@ func (u UserHandler) PwnedPassword(ctx context.Context, request *pb.PwnedRequest
 	pwned, err := u.pwnedClient.Compromised(pwnedPassword)
 	if err != nil {
 		u.logError.Logger.Errorf("ERR:PWNED CLIENT")
-		return &pb.PwnedResponse{Pwned: pwned, Message: "error checking if password is pwned"}, errors.New("error checkinf if password is pwaned")
+		return &pb.PwnedResponse{Pwned: pwned, Message: "error checking if password is pwned"}, domainErrors.Internal(err)
 	}
 	var mess string
 	if pwned {
@@ -410,12 +371,12 @@ func (u UserHandler) GetUserDetails(ctx context.Context, request *pb.GetUserDeta
 		//u.logError.Logger.WithFields(logrus.Fields{
 		//	"user": userNameCtx,
 		//}).Errorf("ERR:XSS")
-		return nil, errors.New("fields are empty or xss happened")
+		return nil, errUnsafeInput
 	} else if sqlInj {
 		//u.logError.Logger.WithFields(logrus.Fields{
 		//	"user": userNameCtx,
 		//}).Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
-		return nil, errors.New("chance for injection")
+		return nil, errUnsafeInput
 	}
 	// else {
 	//u.logInfo.Logger.WithFields(logrus.Fields{
@@ -427,13 +388,13 @@ func (u UserHandler) GetUserDetails(ctx context.Context, request *pb.GetUserDeta
 		fmt.Println(err)
 		//u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
 		//return nil, err //ne postoji user
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, errUserNotFound
 	}
 	user, er := u.service.GetByUsername(context.TODO(), username)
 	fmt.Println(user.Skills)
 	if er != nil {
 		fmt.Println(er)
-		return nil, status.Error(codes.Internal, er.Error())
+		return nil, domainErrors.FromError(er)
 	}
 	return api.MapUserToUserDetails(user), nil
 	//return nil, nil
@@ -447,7 +408,7 @@ func (u UserHandler) EditUserDetails(ctx context.Context, request *pb.UserDetail
 	if err := u.validator.Struct(userDetails); err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:INVALID REQ FILEDS")
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
+		return nil, validationError(err)
 	}
 	policy := bluemonday.UGCPolicy()
 	userDetails.Username = strings.TrimSpace(policy.Sanitize(userDetails.Username))
@@ -470,7 +431,7 @@ func (u UserHandler) EditUserDetails(ctx context.Context, request *pb.UserDetail
 		userDetails.Gender == "" || userDetails.DateOfBirth == "" || userDetails.PhoneNumber == "" { /* ||
 		userDetails.Biography == ""*/
 		u.logError.Logger.Errorf("ERR:XSS")
-		return nil, status.Error(codes.FailedPrecondition, "fields are empty or xss happened")
+		return nil, errUnsafeInput
 		/*} else if p1 || p2 || p3 || p4 || p5 || p6 || p7 {
 		u.logError.Logger.Errorf("ERR:BAD VALIDATION: POSIBLE INJECTION")
 		return nil, status.Error(codes.FailedPrecondition, "there is chance for sql injection")*/
@@ -484,12 +445,12 @@ func (u UserHandler) EditUserDetails(ctx context.Context, request *pb.UserDetail
 	if err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, errUserNotFound
 	}
 	editedUser, er := u.service.EditUser(userDetails)
 	if er != nil {
 		fmt.Println(er)
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, domainErrors.FromError(er)
 	}
 	return api.MapUserToUserDetails(editedUser), nil
 }
@@ -500,19 +461,19 @@ func (u UserHandler) EditUserPersonalDetails(ctx context.Context, request *pb.Us
 	if err := u.validator.Struct(userPersonalDetails); err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:INVALID REQ FILEDS")
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
+		return nil, validationError(err)
 	}
 
 	err := u.service.UserExists(userPersonalDetails.Username)
 	if err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, errUserNotFound
 	}
 	editedUser, er := u.service.EditUserPersonalDetails(userPersonalDetails)
 	if er != nil {
 		fmt.Println(er)
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, domainErrors.FromError(er)
 	}
 	return api.MapUserToUserPersonalDetails(editedUser), nil
 }
@@ -523,19 +484,19 @@ func (u UserHandler) EditUserProfessionalDetails(ctx context.Context, request *p
 	if err := u.validator.Struct(userProfessionalDetails); err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:INVALID REQ FILEDS")
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
+		return nil, validationError(err)
 	}
 
 	err := u.service.UserExists(userProfessionalDetails.Username)
 	if err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, errUserNotFound
 	}
 	editedUser, er := u.service.EditUserProfessionalDetails(userProfessionalDetails)
 	if er != nil {
 		fmt.Println(er)
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, domainErrors.FromError(er)
 	}
 	return api.MapUserToUserProfessionalDetails(editedUser), nil
 }
@@ -546,7 +507,7 @@ func (u UserHandler) ChangeProfileStatus(ctx context.Context, request *pb.Change
 
 	if newStatus == "" || username == "" {
 		u.logError.Logger.Errorf("ERR:XSS")
-		return nil, status.Error(codes.FailedPrecondition, "fields are empty or xss happened")
+		return nil, errUnsafeInput
 	} else {
 		u.logInfo.Logger.Infof("INFO:Handling EditUserDetails")
 	}
@@ -555,12 +516,12 @@ func (u UserHandler) ChangeProfileStatus(ctx context.Context, request *pb.Change
 	if err != nil {
 		fmt.Println(err)
 		u.logError.Logger.Errorf("ERR:USER DOES NOT EXIST")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, errUserNotFound
 	}
 	editedUser, er := u.service.ChangeProfileStatus(username, newStatus)
 	if er != nil {
 		fmt.Println(er)
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, domainErrors.FromError(er)
 	}
 	return &pb.ChangeStatus{NewStatus: string(editedUser.ProfileStatus), Username: username}, nil
 }
@@ -579,7 +540,8 @@ func (u UserHandler) ChangeEmail(ctx context.Context, request *pb.ChangeEmailReq
 	id, _ := uuid.Parse(request.UserId)
 	exists := u.service.CheckIfEmailExists(id, request.Email.Email)
 	if exists {
-		return nil, status.Error(codes.AlreadyExists, "Email already exists!")
+		return nil, domainErrors.AlreadyExists(domainErrors.CodeEmailTaken, "Email already exists",
+			domainErrors.Field("email", "is taken"))
 	}
 
 	user, err := u.service.GetById(ctx, id)
@@ -599,7 +561,8 @@ func (u UserHandler) ChangeUsername(ctx context.Context, request *pb.ChangeUsern
 	id, _ := uuid.Parse(request.UserId)
 	exists := u.service.CheckIfUsernameExists(id, request.Username.Username)
 	if exists {
-		return nil, status.Error(codes.AlreadyExists, "Username already exists!")
+		return nil, domainErrors.AlreadyExists(domainErrors.CodeUsernameTaken, "Username already exists",
+			domainErrors.Field("username", "is taken"))
 	}
 	user, err := u.service.GetById(ctx, id)
 	if err != nil {
@@ -1,6 +1,7 @@
 package persistance
 
 import (
+	domainErrors "common/module/errors"
 	"context"
 	"errors"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"user/module/domain/repositories"
 )
 
+var errUserNotFound = domainErrors.NotFound(domainErrors.CodeUserNotFound, "User not found")
+
 type UserRepositoryImpl struct {
 	db *gorm.DB
 }
@@ -53,7 +56,7 @@ func (r UserRepositoryImpl) GetUsers() ([]model.User, error) {
 func (r UserRepositoryImpl) GetByUsername(ctx context.Context, username string) (*model.User, error) {
 	user := &model.User{}
 	if r.db.Preload("Skills").Preload("Interests").Preload("Educations").Preload("Experiences").First(&user, "username = ?", username).RowsAffected == 0 {
-		return nil, errors.New("user not found")
+		return nil, errUserNotFound
 
 	}
 	return user, nil
@@ -69,7 +72,7 @@ func (r UserRepositoryImpl) CreateRegisteredUser(user *model.User) (*model.User,
 
 func (r UserRepositoryImpl) UserExists(username string) error {
 	if r.db.First(&model.User{}, "username = ?", username).RowsAffected == 0 {
-		return errors.New("user does not exist")
+		return errUserNotFound
 
 	}
 	return nil
@@ -79,7 +82,7 @@ func (r UserRepositoryImpl) GetUserSalt(username string) (string, error) {
 	var result string = ""
 	r.db.Table("users").Select("salt").Where("username = ?", username).Scan(&result)
 	if result == "" {
-		return "", errors.New("User salt not found!")
+		return "", errUserNotFound
 	}
 	return result, nil
 }
@@ -98,7 +101,7 @@ func (r UserRepositoryImpl) GetUserRole(username string) (string, error) {
 	if result == 2 {
 		return "Agent", nil
 	}
-	return "", errors.New("User role not found for username" + username)
+	return "", domainErrors.Internal(errors.New("User role not found for username" + username))
 }
 
 func (r UserRepositoryImpl) ChangePassword(user *model.User, password string) error {
@@ -120,7 +123,7 @@ func (r UserRepositoryImpl) ChangeProfileStatus(user *model.User) (bool, error)
 func (r UserRepositoryImpl) GetById(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	user := &model.User{}
 	if r.db.Preload("Skills").Preload("Interests").Preload("Educations").Preload("Experiences").First(&user, "id = ?", id).RowsAffected == 0 {
-		return nil, errors.New("user not found")
+		return nil, errUserNotFound
 
 	}
 	return user, nil
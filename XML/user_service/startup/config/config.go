@@ -9,13 +9,35 @@ type Config struct {
 	UserDBUser         string
 	UserDBPass         string
 	UserDBName         string
-	PublicKey          string
+	JwksUrl            string
 	NatsHost           string
 	NatsPort           string
 	NatsUser           string
 	NatsPass           string
 	UserCommandSubject string
 	UserReplySubject   string
+	RevocationSubject  string
+	RoleSubject        string
+	ChangeSubject      string
+	OneTimeCodeSecret  string
+	MailBackend        string
+	MailFrom           string
+	SmtpHost           string
+	SmtpPort           string
+	SmtpUser           string
+	SmtpPass           string
+	CourierAuthToken   string
+	MailFile           string
+	GrpcTlsCert        string
+	GrpcTlsKey         string
+	GrpcTlsCa          string
+	GrpcTlsReload      string
+	GrpcTlsCrlUrls     string
+	GrpcTlsOcspUrl     string
+	GrpcTlsFailOpen    string
+	GrpcTlsRecheck     string
+	GrpcInsecure       string
+	GrpcAllowedPeers   string
 }
 
 func NewConfig() *Config {
@@ -33,14 +55,36 @@ func NewConfig() *Config {
 		NatsUser:           os.Getenv("NATS_USER"),
 		UserCommandSubject: os.Getenv("USER_COMMAND_SUBJECT"),
 		UserReplySubject:   os.Getenv("USER_REPLY_SUBJECT"),
-		PublicKey: "-----BEGIN PUBLIC KEY-----\n" +
-			"MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA0AzWYJTc9jiPn+RMNjMJ\n" +
-			"hscn8hg/Mt0U22efM6IvM83CyQCiFHP1Z8rs2HFqRbid/hQxW23HrXQzKx5hGPdU\n" +
-			"14ncF8oN7utDQxdq6ivTsF1tMQtHWb2jnYmpKwTyelbMMGKLHj3yy2j59Y/X94EX\n" +
-			"PNtQtgAO9FF5gKzjkaBu6KzLU2RJC9bADVd5sotM/JP/Ce5D/97XV7i1KStTUDiV\n" +
-			"fDBWCkDylBTQTmI1rO9MdayVduuAzNdWXRfyqKcWI2i4pA1aaskiaViVsIhF3ksm\n" +
-			"YW4Bu0RxK5SP2byHj7pv93XsabA+QXZ37QRhYzBxx6nS0x/dNtAxIltIBZaeSTN0\n" +
-			"gQIDAQAB\n" +
-			"-----END PUBLIC KEY-----",
+		JwksUrl:            os.Getenv("JWKS_URL"),
+		RevocationSubject:  os.Getenv("REVOCATION_SUBJECT"),
+		RoleSubject:        os.Getenv("ROLE_SUBJECT"),
+		ChangeSubject:      os.Getenv("CHANGE_SUBJECT"),
+		OneTimeCodeSecret:  os.Getenv("ONE_TIME_CODE_SECRET"),
+		MailBackend:        os.Getenv("MAIL_BACKEND"),
+		MailFrom:           os.Getenv("MAIL_FROM"),
+		SmtpHost:           os.Getenv("SMTP_HOST"),
+		SmtpPort:           os.Getenv("SMTP_PORT"),
+		SmtpUser:           os.Getenv("SMTP_USER"),
+		SmtpPass:           os.Getenv("SMTP_PASS"),
+		CourierAuthToken:   os.Getenv("COURIER_AUTH_TOKEN"),
+		MailFile:           os.Getenv("MAIL_FILE"),
+		GrpcTlsCert:        os.Getenv("GRPC_TLS_CERT"),
+		GrpcTlsKey:         os.Getenv("GRPC_TLS_KEY"),
+		GrpcTlsCa:          os.Getenv("GRPC_TLS_CA"),
+		GrpcTlsReload:      getEnvOrDefault("GRPC_TLS_RELOAD", "1m"),
+		GrpcTlsCrlUrls:     os.Getenv("GRPC_TLS_CRL_URLS"),
+		GrpcTlsOcspUrl:     os.Getenv("GRPC_TLS_OCSP_URL"),
+		GrpcTlsFailOpen:    getEnvOrDefault("GRPC_TLS_FAIL_OPEN", "false"),
+		GrpcTlsRecheck:     getEnvOrDefault("GRPC_TLS_REVOCATION_REFRESH", "10m"),
+		GrpcInsecure:       getEnvOrDefault("GRPC_INSECURE_DEV", "false"),
+		GrpcAllowedPeers:   getEnvOrDefault("GRPC_ALLOWED_PEERS", "api_gateway"),
 	}
 }
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
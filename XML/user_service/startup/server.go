@@ -1,23 +1,35 @@
 package startup
 
 import (
+	"common/module/changes"
+	domainErrors "common/module/errors"
 	"common/module/interceptor"
+	"common/module/jwks"
 	"common/module/logger"
+	"common/module/mailer"
+	"common/module/onetimecode"
+	"common/module/permissions"
+	"common/module/policy"
 	userProto "common/module/proto/user_service"
+	"common/module/revocation"
 	saga "common/module/saga/messaging"
 	"common/module/saga/messaging/nats"
+	servicetls "common/module/tls"
 	"context"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	hibp "github.com/mattevans/pwned-passwords"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"gopkg.in/go-playground/validator.v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
 	"net"
+	"strconv"
+	"time"
 	"user/module/application/helpers"
 	"user/module/application/services"
 	"user/module/domain/model"
@@ -48,15 +60,19 @@ func (server *Server) Start() {
 	pwnedClient := hibp.NewClient()
 	db = server.SetupDatabase()
 	userRepo := server.InitUserRepo(db)
-	emailVerRepo := server.InitEmailVerRepo(db)
-	recoveryRepo := server.InitRecoveryRepo(db)
+	codes := server.InitOneTimeCodes(db, logError)
+	mail := server.InitMailer(db, logError)
 
 	commandPublisher := server.InitPublisher(server.config.UserCommandSubject)
 	replySubscriber := server.InitSubscriber(server.config.UserReplySubject, QueueGroup)
 	orchestrator := server.InitOrchestrator(commandPublisher, replySubscriber)
 
-	userService := server.InitUserService(logInfo, logError, userRepo, emailVerRepo, recoveryRepo, orchestrator)
-	apiTokenService := server.InitApiTokenService(logInfo, logError, userService)
+	revoker := revocation.NewRevoker(server.InitPublisher(server.config.RevocationSubject))
+	changePublisher := changes.NewPublisher(server.InitPublisher(server.config.ChangeSubject))
+	userService := server.InitUserService(logInfo, logError, userRepo, codes, mail, orchestrator, revoker, changePublisher)
+	revocationList := server.InitRevocationList()
+	keys := jwks.NewCache(server.config.JwksUrl)
+	apiTokenService := server.InitApiTokenService(logInfo, logError, keys, revocationList)
 
 	validator := validator.New()
 	jsonConverters := helpers.NewJsonConverters(logInfo)
@@ -64,24 +80,25 @@ func (server *Server) Start() {
 
 	userHandler := server.InitUserHandler(logInfo, logError, userService, validator, jsonConverters, &utils, pwnedClient, apiTokenService)
 
-	server.StartGrpcServer(userHandler, logError)
+	server.StartGrpcServer(userHandler, keys, revocationList, logError)
 
 }
 
-func (server *Server) StartGrpcServer(handler *handlers.UserHandler, logError *logger.Logger) {
+func (server *Server) StartGrpcServer(handler *handlers.UserHandler, keys *jwks.Cache, revocationList *revocation.List, logError *logger.Logger) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", server.config.Port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(server.config.PublicKey))
-	if err != nil {
-		log.Fatalf("failed to parse public key: %v", err)
-	}
-	interceptor := interceptor.NewAuthInterceptor(config.AccessibleRoles(), publicKey, logError)
+	authPolicy := server.InitPolicy()
+	interceptor := interceptor.NewAuthInterceptor(authPolicy, keys, revocationList, server.InitPermissionCache(authPolicy), logError)
 
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()))
+	grpcServer := grpc.NewServer(grpc.Creds(server.InitTransportCredentials(logError)), grpc.ChainUnaryInterceptor(domainErrors.UnaryServerInterceptor(logError), interceptor.Unary()))
 	userProto.RegisterUserServiceServer(grpcServer, handler)
+	err = authPolicy.CheckServer(grpcServer)
+	if err != nil {
+		log.Fatalf("failed to check policy: %v", err)
+	}
 	if err := grpcServer.Serve(listener); err != nil {
 		log.Fatalf("failed to serve: %s", err)
 	}
@@ -93,24 +110,50 @@ func (server *Server) InitUserHandler(logInfo *logger.Logger, logError *logger.L
 }
 
 func (server *Server) InitUserService(logInfo *logger.Logger, logError *logger.Logger, repo repositories.UserRepository,
-	emailRepo repositories.EmailVerificationRepository, recoveryRepo repositories.PasswordRecoveryRequestRepository, orchestrator *orchestrators.UserOrchestrator) *services.UserService {
-	return services.NewUserService(logInfo, logError, repo, emailRepo, recoveryRepo, orchestrator)
+	codes *onetimecode.Manager, mail mailer.Mailer, orchestrator *orchestrators.UserOrchestrator, revoker *revocation.Revoker,
+	changePublisher *changes.Publisher) *services.UserService {
+	return services.NewUserService(logInfo, logError, repo, codes, mail, orchestrator, revoker, changePublisher)
 }
 
-func (server *Server) InitApiTokenService(logInfo *logger.Logger, logError *logger.Logger, userService *services.UserService) *services.ApiTokenService {
-	return services.NewApiTokenService(logInfo, logError, userService)
+func (server *Server) InitApiTokenService(logInfo *logger.Logger, logError *logger.Logger, keys *jwks.Cache,
+	revocations *revocation.List) *services.ApiTokenService {
+	return services.NewApiTokenService(logInfo, logError, keys, revocations)
 }
 
 func (server *Server) InitUserRepo(db *gorm.DB) repositories.UserRepository {
 	return persistance.NewUserRepositoryImpl(db)
 }
 
-func (server *Server) InitEmailVerRepo(db *gorm.DB) repositories.EmailVerificationRepository {
-	return persistance.NewEmailVerificationRepositoryImpl(db)
+func (server *Server) InitOneTimeCodes(db *gorm.DB, logError *logger.Logger) *onetimecode.Manager {
+	// A secret made up at startup would void every code mailed before a
+	// restart.
+	secret := []byte(server.config.OneTimeCodeSecret)
+	if len(secret) < onetimecode.MinSecretLength {
+		log.Fatalf("ONE_TIME_CODE_SECRET must be set to at least %d bytes", onetimecode.MinSecretLength)
+	}
+	return onetimecode.NewManager(onetimecode.NewGormStore(db), secret)
 }
 
-func (server *Server) InitRecoveryRepo(d *gorm.DB) repositories.PasswordRecoveryRequestRepository {
-	return persistance.NewPasswordRecoveryRequestRepositoryImpl(d)
+func (server *Server) InitMailer(db *gorm.DB, logError *logger.Logger) mailer.Mailer {
+	backend, err := mailer.New(mailer.Config{
+		Backend:      server.config.MailBackend,
+		From:         server.config.MailFrom,
+		SmtpHost:     server.config.SmtpHost,
+		SmtpPort:     server.config.SmtpPort,
+		SmtpUser:     server.config.SmtpUser,
+		SmtpPass:     server.config.SmtpPass,
+		CourierToken: server.config.CourierAuthToken,
+		File:         server.config.MailFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	outbox, err := mailer.NewOutbox(backend, mailer.NewGormOutboxStore(db), []byte(server.config.OneTimeCodeSecret), logError)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outbox.Start()
+	return outbox
 }
 
 func (server *Server) InitPublisher(subject string) saga.Publisher {
@@ -161,8 +204,8 @@ func (server *Server) SetupDatabase() *gorm.DB {
 	}
 
 	db.AutoMigrate(&model.User{}) //This will not remove columns
-	db.AutoMigrate(&model.EmailVerification{})
-	db.AutoMigrate(&model.PasswordRecoveryRequest{})
+	db.AutoMigrate(&onetimecode.Code{})
+	db.AutoMigrate(&mailer.OutboxMessage{})
 	db.AutoMigrate(&model.Skill{})
 	db.AutoMigrate(&model.Experience{})
 	db.AutoMigrate(&model.Education{})
@@ -171,3 +214,81 @@ func (server *Server) SetupDatabase() *gorm.DB {
 
 	return db
 }
+
+func (server *Server) InitRevocationList() *revocation.List {
+	list := revocation.NewList()
+	err := list.Listen(server.InitSubscriber(server.config.RevocationSubject, revocation.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = revocation.NewRevoker(server.InitPublisher(server.config.RevocationSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return list
+}
+
+func (server *Server) InitPolicy() *policy.Policy {
+	authPolicy, err := policy.Load()
+	if err != nil {
+		log.Fatalf("failed to load policy: %v", err)
+	}
+	return authPolicy
+}
+
+func (server *Server) InitPermissionCache(authPolicy *policy.Policy) *permissions.Cache {
+	cache := permissions.NewCache(authPolicy.Roles)
+	err := cache.Listen(server.InitSubscriber(server.config.RoleSubject, permissions.BroadcastGroup))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = permissions.NewBroadcaster(server.InitPublisher(server.config.RoleSubject)).RequestSync()
+	if err != nil {
+		log.Println(err)
+	}
+	return cache
+}
+
+func (server *Server) InitTransportCredentials(logError *logger.Logger) credentials.TransportCredentials {
+	if server.config.GrpcTlsCert == "" {
+		if !server.insecureDev() {
+			log.Fatal("GRPC_TLS_CERT is not set; set GRPC_INSECURE_DEV=true to serve gRPC without TLS in development")
+		}
+		logError.Logger.Errorf("ERR:GRPC_INSECURE_DEV SET, SERVING GRPC WITHOUT TLS")
+		return insecure.NewCredentials()
+	}
+	reload, err := time.ParseDuration(server.config.GrpcTlsReload)
+	if err != nil || reload <= 0 {
+		log.Fatalf("invalid GRPC_TLS_RELOAD %q", server.config.GrpcTlsReload)
+	}
+	identity, err := servicetls.LoadIdentity(server.config.GrpcTlsCert, server.config.GrpcTlsKey, server.config.GrpcTlsCa, logError)
+	if err != nil {
+		log.Fatalf("failed to load TLS identity: %v", err)
+	}
+	identity.CheckRevocation(server.InitRevocationChecker(logError))
+	identity.Watch(reload)
+	return identity.ServerCredentials(servicetls.Peers(server.config.GrpcAllowedPeers))
+}
+
+// insecureDev is the explicit opt-out from TLS for development setups
+// without certificates.
+func (server *Server) insecureDev() bool {
+	insecureDev, err := strconv.ParseBool(server.config.GrpcInsecure)
+	if err != nil {
+		log.Fatalf("invalid GRPC_INSECURE_DEV %q", server.config.GrpcInsecure)
+	}
+	return insecureDev
+}
+
+func (server *Server) InitRevocationChecker(logError *logger.Logger) *servicetls.RevocationChecker {
+	config, err := servicetls.ParseRevocationConfig(server.config.GrpcTlsCrlUrls, server.config.GrpcTlsOcspUrl,
+		server.config.GrpcTlsFailOpen, server.config.GrpcTlsRecheck)
+	if err != nil {
+		log.Fatalf("invalid certificate revocation settings: %v", err)
+	}
+	if !config.Enabled() {
+		logError.Logger.Errorf("ERR:GRPC_TLS_CRL_URLS AND GRPC_TLS_OCSP_URL NOT SET, NOT CHECKING CERTIFICATE REVOCATION")
+		return nil
+	}
+	return servicetls.NewRevocationChecker(config, logError)
+}
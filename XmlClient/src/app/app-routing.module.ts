@@ -11,7 +11,6 @@ import { TwofaPageComponent } from './pages/twofa-page/twofa-page.component';
 import { AuthGuardRegular } from './AuthGuard/AuthGuardRegular';
 import { MyProfileComponent } from './components/my-profile/my-profile.component';
 import { ProfileListComponent } from './components/profile-list/profile-list.component';
-import { PusherComponent } from './components/pusher/pusher.component';
 import { PostsViewComponent } from './components/posts-view/posts-view.component';
 import { PostCreateFileComponent } from './components/post-create-file/post-create-file.component';
 import { PublicProfileComponent } from './components/public-profile/public-profile.component';
@@ -80,10 +79,6 @@ const routes: Routes = [
     path: 'myProfile',
     component: MyProfileComponent, canActivate: [AuthGuardRegular]
   },
-  {
-    path: 'pusher',
-    component: PusherComponent
-  },
   {
     path: 'myMessages',
     component: MessagesPageComponent,canActivate: [AuthGuardRegular]
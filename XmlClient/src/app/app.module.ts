@@ -75,7 +75,6 @@ import { EducationDialogComponent } from './components/dialogs/education-dialog/
 import { ProfilePreviewComponent } from './components/profile-preview/profile-preview.component';
 import { ProfileListComponent } from './components/profile-list/profile-list.component';
 import { ProfileSearchPipe } from './pipes/profile-search.pipe';
-import { PusherComponent } from './components/pusher/pusher.component';
 import { MessagesPageComponent } from './pages/messages-page/messages-page/messages-page.component';
 import { MessagePreviewComponent } from './components/message-preview/message-preview/message-preview.component';
 import { MessageCreateComponent } from './components/message-create/message-create/message-create.component';
@@ -133,7 +132,6 @@ import { RecommendedProfilesComponent } from './components/recommended-profiles/
     ProfilePreviewComponent,
     ProfileListComponent,
     ProfileSearchPipe,
-    PusherComponent,
     MessagesPageComponent,
     MessagePreviewComponent,
     MessageCreateComponent,
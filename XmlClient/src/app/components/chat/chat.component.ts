@@ -2,9 +2,9 @@ import { DatePipe } from '@angular/common';
 import { Component, ElementRef, Input, OnChanges, OnInit, SimpleChanges } from '@angular/core';
 import { FormBuilder, FormGroup, Validators } from '@angular/forms';
 import { Router } from '@angular/router';
-import Pusher from 'pusher-js';
 import { IMesssage } from 'src/app/interfaces/message';
 import { MessageService } from 'src/app/services/messsage-service/messaage.service';
+import { RealtimeService } from 'src/app/services/realtime-service/realtime.service';
 
 @Component({
   selector: 'app-chat',
@@ -22,7 +22,7 @@ export class ChatComponent implements OnInit, OnChanges  {
 
 
   constructor(private _router : Router, private _service : MessageService, private _datepipe: DatePipe,
-    private _formBuilder: FormBuilder) { 
+    private _formBuilder: FormBuilder, private _realtimeService: RealtimeService) { 
 
     this.messages.forEach((m : any) => m = {} as IMesssage)
   }
@@ -42,21 +42,8 @@ export class ChatComponent implements OnInit, OnChanges  {
     
     this.messages = []
 
-    Pusher.logToConsole = true;
-
-    const pusher = new Pusher('e49d7a86a937f12da028', {
-      cluster: 'eu'
-    });
-
-    console.log('evo ti ga pushhher ')
-    console.log(pusher)
-
-    const channel = pusher.subscribe('messages');
-    channel.bind('message', (data: never) => {
-    
-
-      let receivedMsg = data as IMesssage
-      if(receivedMsg.ReceiverUsername == this.sender) {
+    this._realtimeService.on<IMesssage>('message').subscribe(receivedMsg => {
+      if(receivedMsg.SenderUsername == this.receiver) {
         this.messages.push(receivedMsg);
       }
     });
@@ -1,8 +1,8 @@
 import { Component, EventEmitter, OnInit, Output } from '@angular/core';
-import Pusher from 'pusher-js';
 import { INotification } from 'src/app/interfaces/notification';
-import { PusherNotification } from 'src/app/interfaces/pusher-notification';
+import { RealtimeNotification } from 'src/app/interfaces/realtime-notification';
 import { NotificationService } from 'src/app/services/notification-service/notification.service';
+import { RealtimeService } from 'src/app/services/realtime-service/realtime.service';
 
 @Component({
   selector: 'app-notification-list',
@@ -17,7 +17,7 @@ export class NotificationListComponent implements OnInit {
   noOfNotReadNot = 0;
 
 
-  constructor(private _notificationService: NotificationService) {
+  constructor(private _notificationService: NotificationService, private _realtimeService: RealtimeService) {
     this.notifications.forEach(n => {
       n = {} as INotification
     })
@@ -52,17 +52,7 @@ export class NotificationListComponent implements OnInit {
       }
     )
 
-    Pusher.logToConsole = true;
-
-    const pusher = new Pusher('e92e3e6334c6de83b489', {
-      cluster: 'eu'
-    });
-
-    const channel = pusher.subscribe('notifications');
-    channel.bind('notification', (data: never) => {
-      
-      
-      let recieved = data as PusherNotification
+    this._realtimeService.on<RealtimeNotification>('notification').subscribe(recieved => {
 
       let receivedCasted = {
         id : recieved.Id,
@@ -76,11 +66,9 @@ export class NotificationListComponent implements OnInit {
 
       } as INotification
       
-      if(receivedCasted.to === localStorage.getItem('username')){
-        this.notifications.unshift(receivedCasted);
+      this.notifications.unshift(receivedCasted);
 
-        this.newNotifications.emit(++this.noOfNotReadNot);
-      }
+      this.newNotifications.emit(++this.noOfNotReadNot);
     });
   }
 
@@ -1,4 +1,4 @@
 export interface IAuthenticate {
-    username : string;
-    token : number;
+    ticket : string;
+    code : string;
 }
@@ -0,0 +1,3 @@
+export interface IMfaTicket {
+    ticket : string;
+}
@@ -1,4 +1,4 @@
-export interface PusherNotification {
+export interface RealtimeNotification {
     Id : string,
     Content : string,
     NotificationFrom : string,
@@ -19,6 +19,8 @@ export class FeedComponent implements OnInit {
   username = localStorage.getItem('username');
   suggested! : UserDetails[];
   myInfo! : UserDetails;
+  nextCursor? : string;
+  mode : string = 'latest';
 
   constructor(private _postService : PostService, private _userService : UserService, 
     private _matDialog : MatDialog, private _connectionService : ConnectionService) { }
@@ -31,17 +33,36 @@ export class FeedComponent implements OnInit {
       }
     )
 
-    this._postService.getUsersFeed(this.username!).subscribe(
+    this.loadFeed()
+
+    this._connectionService.getUsersRecommendation(this.username!).subscribe(
+      res => {
+        this.suggested = res.users
+        if(this.suggested.length > 5) this.suggested = this.suggested.slice(0, 5);
+      }
+    )
+  }
+
+  loadFeed(){
+    this._postService.getUsersFeed(this.username!, undefined, this.mode).subscribe(
       res => {
         this.posts = res.Feed
+        this.nextCursor = res.NextCursor
         console.log(res)
       }
     )
+  }
 
-    this._connectionService.getUsersRecommendation(this.username!).subscribe(
+  setMode(mode : string){
+    this.mode = mode;
+    this.loadFeed();
+  }
+
+  loadMore(){
+    this._postService.getUsersFeed(this.username!, this.nextCursor, this.mode).subscribe(
       res => {
-        this.suggested = res.users
-        if(this.suggested.length > 5) this.suggested = this.suggested.slice(0, 5);
+        this.posts = this.posts.concat(res.Feed)
+        this.nextCursor = res.NextCursor
       }
     )
   }
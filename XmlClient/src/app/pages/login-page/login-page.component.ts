@@ -2,7 +2,7 @@ import { HttpErrorResponse } from '@angular/common/http';
 import { Component, OnInit } from '@angular/core';
 import { FormBuilder, FormControl, FormGroup, Validators } from '@angular/forms';
 import { MatSnackBar } from '@angular/material/snack-bar';
-import { Router } from '@angular/router';
+import { ActivatedRoute, Router } from '@angular/router';
 import { ILoginRequest } from 'src/app/interfaces/login-request';
 import { IUsername } from 'src/app/interfaces/username';
 import { AuthService } from 'src/app/services/auth-service/auth.service';
@@ -28,6 +28,7 @@ export class LoginPageComponent implements OnInit {
     private authService: AuthService,
     private _snackBar: MatSnackBar,
     private _router: Router,
+    private _route: ActivatedRoute,
     private formBuilder: FormBuilder) {
     this.siteKey = "6Lcht3AgAAAAABAzzhnpricVg4eDjZmX-HBFbm6u"
     this.loginReq = {} as ILoginRequest
@@ -50,12 +51,24 @@ export class LoginPageComponent implements OnInit {
       code : new FormControl('', 
       Validators.required)
     });
+
+    const magic = this._route.snapshot.queryParamMap.get('magic');
+    if (magic != null) {
+      this.passwordless = true;
+      this.showCode = true;
+      this.formPL.patchValue({ code: magic });
+      this.submitPL();
+    }
   }
 
   submitPL(){
 
     const plObserver = {
-      next: () => {
+      next: (res: any) => {
+        if (res && res.ticket) {
+          this.twoFaLogin()
+          return
+        }
         this._router.navigate(['myProfile']);
         this._snackBar.open(
           'Welcome!',
@@ -70,7 +83,7 @@ export class LoginPageComponent implements OnInit {
 
     const sendCodeObserver = {
       next: (x: any) => {
-        this._snackBar.open("Code is sent to your mail!", '', {duration : 3000,panelClass: ['snack-bar']});
+        this._snackBar.open("Login link is sent to your mail!", '', {duration : 3000,panelClass: ['snack-bar']});
         this.showCode = true;
       },
       error: (err: HttpErrorResponse) => {
@@ -98,7 +111,7 @@ export class LoginPageComponent implements OnInit {
 
     const loginObserver = {
       next: (res: any) => {
-        if (res.twofa == true) {
+        if (res.totp || res.webauthn) {
           this.twoFaLogin()
 
         } else {
@@ -143,12 +156,9 @@ export class LoginPageComponent implements OnInit {
       },
     }
 
-    this.username = localStorage.getItem('username')!
-    if (this.username != null) {
-      this.usernameReq = {
-        username: this.username
-      }
-      this.authService.login(this.loginReq).subscribe(nextLoginOserver);
+    const ticket = localStorage.getItem('mfaTicket')
+    if (ticket != null) {
+      this.authService.login({ ticket: ticket }).subscribe(nextLoginOserver);
     }
   }
 
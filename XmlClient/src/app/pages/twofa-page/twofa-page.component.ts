@@ -50,11 +50,11 @@ export class TwofaPageComponent implements OnInit {
         this._snackBar.open("Error happend!", '',{duration : 3000,panelClass: ['snack-bar']});
       },
     };
-    this.username = localStorage.getItem('username')!
-    if (this.username != null) {
+    const ticket = localStorage.getItem('mfaTicket')
+    if (ticket != null) {
       this.request = {
-        username: this.username,
-        token: this.createForm.value.code
+        ticket: ticket,
+        code: String(this.createForm.value.code)
       }
 
       this.authService.authenticate2FA(this.request).subscribe(loginObserver);
@@ -12,6 +12,6 @@ export class ApiKeyService {
    }
 
    generateApiKey(username : string) : Observable<any> {
-     return this.http.post("http://localhost:9090/users/token/generate", {username});
+     return this.http.post("http://localhost:9090/v2/users/token/generate", {username});
    }
 }
@@ -8,6 +8,7 @@ import { LoggedUser } from 'src/app/interfaces/logged-user';
 import { ILoginRequest } from 'src/app/interfaces/login-request';
 import { UserData } from 'src/app/interfaces/subject-data';
 import { IUsername } from 'src/app/interfaces/username';
+import { IMfaTicket } from 'src/app/interfaces/mfa-ticket';
 
 @Injectable({
   providedIn: 'root'
@@ -33,11 +34,12 @@ export class AuthService {
 
   auth(loginReq: ILoginRequest): Observable<any> {
     return this._http
-      .post(`http://localhost:9090/users/auth/user`, loginReq)
+      .post(`http://localhost:9090/v2/users/auth/user`, loginReq)
       .pipe(
         map((response: any) => {
           if (response) {
             localStorage.setItem('username', response.username);
+            localStorage.setItem('mfaTicket', response.ticket);
             this.currentUserSubject.next(response);
 
           }
@@ -46,9 +48,9 @@ export class AuthService {
       );
   }
 
-  login(loginRegularRequest: IUsername): Observable<LoggedUser> {
+  login(loginRegularRequest: IMfaTicket): Observable<LoggedUser> {
     return this._http
-      .post(`http://localhost:9090/users/auth/user/regular`, loginRegularRequest)
+      .post(`http://localhost:9090/v2/users/auth/user/regular`, loginRegularRequest)
       .pipe(
         map((response: any) => {
           if (response) {
@@ -63,7 +65,7 @@ export class AuthService {
 
   authenticate2FA(request: IAuthenticate): Observable<any> {
     return this._http.post<any>(
-      'http://localhost:9090/2fa/authenticate',
+      'http://localhost:9090/v2/2fa/authenticate',
       request
     ).pipe(
       map((response: any) => {
@@ -76,17 +78,23 @@ export class AuthService {
   }
   passwordlessLoginRequest(username: any) {
     return this._http.post<any>(
-      'http://localhost:9090/users/login/passwordless',
+      'http://localhost:9090/v2/users/login/passwordless',
       { username }
     );
   }
 
   passwordlessLogin(code: any) {
     return this._http.get<any>(
-      'http://localhost:9090/users/login/passwordless/' + code
+      'http://localhost:9090/v2/users/login/passwordless/' + code
     )
       .pipe(
         map((response: any) => {
+          if (response && response.ticket) {
+            // The account has a second factor, which the ticket is for.
+            localStorage.setItem('username', response.username);
+            localStorage.setItem('mfaTicket', response.ticket);
+            return response;
+          }
           if (response) {
             this.storeUserData(response)
           }
@@ -13,60 +13,60 @@ export class PostService {
   }
   GetAllPosts(username : string) {
     return this._http.get<any>(
-      'http://localhost:9090/post/user/' + username,
+      'http://localhost:9090/v2/post/user/' + username,
     );
   }
   GetUserReactionToPost(username: string, Id: string) {
     return this._http.get<any>(
-      'http://localhost:9090/post/' + Id + "/" + username + '/reaction'
+      'http://localhost:9090/v2/post/' + Id + "/" + username + '/reaction'
     );
   }
   GetAllReactionsForPost(Id: string) {
     return this._http.get<any>(
-      'http://localhost:9090/post/' + Id + '/reactions'
+      'http://localhost:9090/v2/post/' + Id + '/reactions'
     );
   }
   GetAllCommentsForPost(Id: any) {
     return this._http.get<any>(
-      'http://localhost:9090/post/' + Id + '/comments'
+      'http://localhost:9090/v2/post/' + Id + '/comments'
     );
   }
 
   CreatePost(newPost: IPostRequest) : Observable<any> {
     return this._http.post<any>(
-      'http://localhost:9090/post',
+      'http://localhost:9090/v2/post',
       newPost
     );
   }
   LikePost(Username: string, link: any)  {
     return this._http.post<any>(
-      'http://localhost:9090' + link,
+      'http://localhost:9090/v2' + link,
       { Username }
     );
   }
   DislikePost(Username: string, link: any) {
     return this._http.post<any>(
-      'http://localhost:9090' + link,
+      'http://localhost:9090/v2' + link,
       { Username }
     );
   }
   CommentPost(Comment: any, link: any) {
     return this._http.post<any>(
-      'http://localhost:9090' + link,
+      'http://localhost:9090/v2' + link,
       Comment
     );
   }
 
   GetPost(Id: any) {
     return this._http.get<any>(
-      'http://localhost:9090/post/' + Id 
+      'http://localhost:9090/v2/post/' + Id 
     );
   }
 
-  getUsersFeed(username : string ){
-    return this._http.get<any>(
-      'http://localhost:9090/users/' + username + '/feed'
-    );
+  getUsersFeed(username : string, cursor? : string, mode : string = 'latest' ){
+    let url = 'http://localhost:9090/v2/users/' + username + '/feed?mode=' + mode
+    if (cursor) url += '&cursor=' + encodeURIComponent(cursor)
+    return this._http.get<any>(url);
   }
 
 
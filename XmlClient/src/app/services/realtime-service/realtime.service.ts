@@ -0,0 +1,74 @@
+import { Injectable, NgZone } from '@angular/core';
+import { Observable, Subject } from 'rxjs';
+import { filter, map } from 'rxjs/operators';
+
+interface RealtimeEvent {
+  type: string,
+  data: any
+}
+
+@Injectable({
+  providedIn: 'root'
+})
+export class RealtimeService {
+
+  private source?: EventSource;
+  private lastEventId = '';
+  private events = new Subject<RealtimeEvent>();
+  private listened = new Set<string>();
+
+  constructor(private _zone: NgZone) { }
+
+  // Emits the payload of every event of the given type sent to the logged in user.
+  on<T>(type: string): Observable<T> {
+    this.connect();
+    this.listen(type);
+    return this.events.pipe(
+      filter(event => event.type === type),
+      map(event => event.data as T)
+    );
+  }
+
+  private connect() {
+    if (this.source || !localStorage.getItem('token')) {
+      return;
+    }
+    // EventSource can't send headers, so the token goes in the query.
+    let url = 'http://localhost:9090/v2/events?access_token=' + encodeURIComponent(localStorage.getItem('token')!);
+    if (this.lastEventId) {
+      url += '&lastEventId=' + encodeURIComponent(this.lastEventId);
+    }
+    this.source = new EventSource(url);
+    this.source.onerror = () => {
+      // The browser retries dropped streams by itself, but gives up once the
+      // gateway refuses an expired token, so reconnect with the current one.
+      if (this.source?.readyState === EventSource.CLOSED) {
+        this.source = undefined;
+        setTimeout(() => this.reconnect(), 3000);
+      }
+    };
+    this.listened.forEach(type => this.addListener(type));
+  }
+
+  private reconnect() {
+    this.source?.close();
+    this.source = undefined;
+    this.connect();
+  }
+
+  private listen(type: string) {
+    if (this.listened.has(type)) {
+      return;
+    }
+    this.listened.add(type);
+    this.addListener(type);
+  }
+
+  private addListener(type: string) {
+    this.source?.addEventListener(type, (message: Event) => {
+      let event = message as MessageEvent;
+      this.lastEventId = event.lastEventId;
+      this._zone.run(() => this.events.next({ type: type, data: JSON.parse(event.data) }));
+    });
+  }
+}